@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gogetmedia/internal/backup"
+	"gogetmedia/internal/config"
+)
+
+// runBackupCommand runs the backup and restore commands, which work on the
+// files of a server rather than talk to it. It returns the exit code.
+func runBackupCommand(args []string) int {
+	var err error
+	switch args[0] {
+	case "backup":
+		err = runBackup(args[1:])
+	case "restore":
+		err = runRestore(args[1:])
+	}
+	switch {
+	case err == nil:
+		return 0
+	case err == flag.ErrHelp:
+		return 0
+	case err == errBackupUsage:
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+}
+
+// errBackupUsage reports wrong arguments, which were already explained
+var errBackupUsage = fmt.Errorf("usage")
+
+// isBackupCommand reports whether name is the backup or restore command
+func isBackupCommand(name string) bool {
+	return name == "backup" || name == "restore"
+}
+
+// serverDownloadPath returns the download directory of the server with the
+// config file at configPath, taking the flag and environment variable into
+// account as the server does
+func serverDownloadPath(configPath, flagValue string) (string, error) {
+	if envValue := os.Getenv("GOGETMEDIA_DOWNLOAD_PATH"); envValue != "" {
+		return envValue, nil
+	}
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return "", err
+	}
+	return cfg.DownloadPath, nil
+}
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	downloadPath := fs.String("download-path", "", "Download directory (overrides config file)")
+	media := fs.Bool("media", false, "Include the downloaded files")
+	output := fs.String("o", "", "Archive to write, - for standard output (default gogetmedia-backup-<time>.tar.gz)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gogetmedia backup [flags]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Writes the config, users, downloads and download logs to an archive. The")
+		fmt.Fprintln(fs.Output(), "server can keep running. The archive holds password hashes, keep it safe.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errBackupUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errBackupUsage
+	}
+
+	// A missing config would be created, there is nothing to back up then
+	if _, err := os.Stat(*configPath); err != nil {
+		return fmt.Errorf("no config file at %s: %w", *configPath, err)
+	}
+	dir, err := serverDownloadPath(*configPath, *downloadPath)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	name := *output
+	if name != "-" {
+		if name == "" {
+			name = fmt.Sprintf("gogetmedia-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+		}
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	manifest, err := backup.Write(w, backup.PathsFor(*configPath, dir), backup.Options{Media: *media})
+	if err != nil {
+		if name != "-" {
+			os.Remove(name)
+		}
+		return err
+	}
+	if name != "-" {
+		if err := w.(*os.File).Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Wrote %s: %d downloads, %d users, %d logs", name, manifest.Downloads, manifest.Users, manifest.Logs)
+		if manifest.Media {
+			fmt.Fprintf(os.Stderr, ", %d downloaded files", manifest.MediaFiles)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	downloadPath := fs.String("download-path", "", "Download directory (overrides the restored config)")
+	check := fs.Bool("check", false, "Only check the archive")
+	force := fs.Bool("force", false, "Replace an existing config, users and downloads")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gogetmedia restore [flags] <archive>")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Restores an archive written by backup, - reads it from standard input. Stop")
+		fmt.Fprintln(fs.Output(), "the server first, it saves its downloads when it stops. Downloaded files")
+		fmt.Fprintln(fs.Output(), "that already exist are kept.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errBackupUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errBackupUsage
+	}
+
+	if !*check && !*force {
+		if _, err := os.Stat(*configPath); err == nil {
+			return fmt.Errorf("%s exists, use -force to replace the config, users and downloads", *configPath)
+		}
+	}
+	dir := *downloadPath
+	if envValue := os.Getenv("GOGETMEDIA_DOWNLOAD_PATH"); envValue != "" {
+		dir = envValue
+	}
+
+	var r io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*configPath), 0755); err != nil {
+		return err
+	}
+	result, err := backup.Restore(r, *configPath, backup.RestoreOptions{DownloadPath: dir, Check: *check})
+	if err != nil {
+		return err
+	}
+
+	manifest := result.Manifest
+	if *check {
+		fmt.Printf("✓ Backup of %s is valid: %d downloads, %d users, %d logs, %d downloaded files\n",
+			manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.Downloads, manifest.Users, manifest.Logs, manifest.MediaFiles)
+		return nil
+	}
+	fmt.Printf("✓ Restored backup of %s: %d downloads, %d users, %d logs, %d downloaded files\n",
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.Downloads, manifest.Users, manifest.Logs, result.MediaFiles)
+	fmt.Printf("  Download path: %s\n", result.DownloadPath)
+	for _, name := range result.Kept {
+		fmt.Printf("  Kept existing %s\n", name)
+	}
+	return nil
+}
@@ -11,15 +11,21 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"gogetmedia/internal/api"
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/backup"
+	"gogetmedia/internal/cli"
 	"gogetmedia/internal/config"
 	"gogetmedia/internal/core"
-	"gogetmedia/internal/manager"
+	"gogetmedia/internal/enginebridge"
+	"gogetmedia/internal/tlscert"
 	"gogetmedia/internal/ui"
 	"gogetmedia/internal/utils"
+	"gogetmedia/pkg/engine"
 )
 
 func ensureDirectories(cfg *config.Config) error {
@@ -43,7 +49,43 @@ func ensureDirectories(cfg *config.Config) error {
 	return nil
 }
 
+// overrideSetting sets a string setting from its command line flag or environment
+// variable, the environment variable taking precedence
+func overrideSetting(cfg *config.Config, name string, setting *string, flagValue, envName string) {
+	if flagValue != "" {
+		*setting = flagValue
+		cfg.SetOverridden(name)
+	}
+	if envValue := os.Getenv(envName); envValue != "" {
+		*setting = envValue
+		cfg.SetOverridden(name)
+	}
+}
+
+// httpsRedirect redirects every request to the same URL over HTTPS on port
+func httpsRedirect(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(port)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
 func main() {
+	// Backup and restore work on the files of a server
+	if len(os.Args) > 1 && isBackupCommand(os.Args[1]) {
+		os.Exit(runBackupCommand(os.Args[1:]))
+	}
+
+	// Client commands talk to a running server instead of starting one
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// Panic recovery for production stability
 	defer func() {
 		if r := recover(); r != nil {
@@ -58,10 +100,28 @@ func main() {
 	// Command line flags
 	var port int
 	var configPath string
+	var downloadPath, ytDlpPath, ffmpegPath string
+	var bindAddress string
 	flag.IntVar(&port, "port", 0, "Port to run the server on (overrides config file)")
+	flag.StringVar(&bindAddress, "bind", "", "Address to listen on, e.g. 0.0.0.0 for all interfaces (overrides config file)")
 	flag.StringVar(&configPath, "config", "config.json", "Path to configuration file")
+	flag.StringVar(&downloadPath, "download-path", "", "Download directory (overrides config file)")
+	flag.StringVar(&ytDlpPath, "yt-dlp-path", "", "Path to the yt-dlp executable (overrides config file)")
+	flag.StringVar(&ffmpegPath, "ffmpeg-path", "", "Path to the ffmpeg executable (overrides config file)")
 	flag.Parse()
 
+	// Restore a backup that was uploaded while the server was running
+	restoreDownloadPath := downloadPath
+	if envValue := os.Getenv("GOGETMEDIA_DOWNLOAD_PATH"); envValue != "" {
+		restoreDownloadPath = envValue
+	}
+	if result, err := backup.ApplyPending(configPath, restoreDownloadPath); err != nil {
+		fmt.Printf("❌ Failed to restore backup, it was kept as %s.failed: %v\n", backup.PendingFile(configPath), err)
+	} else if result != nil {
+		fmt.Printf("✓ Restored backup of %s: %d downloads, %d users, %d downloaded files\n",
+			result.Manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), result.Manifest.Downloads, result.Manifest.Users, result.MediaFiles)
+	}
+
 	// Load configuration
 	cfg, err := config.Load(configPath)
 	if err != nil {
@@ -71,15 +131,26 @@ func main() {
 	// Override port from command line argument
 	if port > 0 {
 		cfg.Port = port
+		cfg.SetOverridden("port")
 	}
 
 	// Override port from environment variable
 	if envPort := os.Getenv("GOGETMEDIA_PORT"); envPort != "" {
 		if parsedPort, err := strconv.Atoi(envPort); err == nil && parsedPort > 0 {
 			cfg.Port = parsedPort
+			cfg.SetOverridden("port")
 		}
 	}
 
+	// Override bind address from command line argument, then environment variable
+	overrideSetting(cfg, "bind_address", &cfg.BindAddress, bindAddress, "GOGETMEDIA_BIND_ADDRESS")
+
+	// Override paths from command line arguments, then environment variables.
+	// Overridden settings cannot be changed through the web UI.
+	overrideSetting(cfg, "download_path", &cfg.DownloadPath, downloadPath, "GOGETMEDIA_DOWNLOAD_PATH")
+	overrideSetting(cfg, "yt_dlp_path", &cfg.YtDlpPath, ytDlpPath, "GOGETMEDIA_YT_DLP_PATH")
+	overrideSetting(cfg, "ffmpeg_path", &cfg.FfmpegPath, ffmpegPath, "GOGETMEDIA_FFMPEG_PATH")
+
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
@@ -92,9 +163,12 @@ func main() {
 		log.Fatalf("Failed to create necessary directories: %v", err)
 	}
 
-	// Create downloader and manager
-	downloader := core.NewDownloader(cfg.YtDlpPath, cfg.FfmpegPath, cfg.EnableHardwareAccel, cfg.OptimizeForLowPower)
-	downloadManager := manager.NewDownloadManager(downloader, cfg.MaxConcurrentDownloads, cfg.DownloadPath, cfg)
+	// Start the download engine; the web server is one of its users
+	downloadEngine, err := engine.New(engine.WithConfig(cfg))
+	if err != nil {
+		log.Fatalf("Failed to start download engine: %v", err)
+	}
+	downloadManager := enginebridge.Manager(downloadEngine)
 
 	// Create updater
 	updater := core.NewYtDlpUpdater(cfg.YtDlpPath, filepath.Join("assets", "yt-dlp"))
@@ -156,8 +230,26 @@ func main() {
 		}
 	}
 
+	// Load user accounts, creating the admin account on first run
+	authStore, err := auth.NewStore(auth.UsersFilePath(configPath))
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	if cfg.DisableAuth {
+		fmt.Printf("⚠ Authentication is disabled - anyone who can reach the server has full access\n")
+	} else {
+		password, err := authStore.Bootstrap(os.Getenv("GOGETMEDIA_ADMIN_PASSWORD"))
+		if err != nil {
+			log.Fatalf("Failed to create admin account: %v", err)
+		}
+		if password != "" {
+			fmt.Printf("\n✓ Created user %q with password: %s\n", auth.BootstrapUsername, password)
+			fmt.Printf("  Sign in and change it, this password is not shown again.\n\n")
+		}
+	}
+
 	// Create handlers
-	apiHandler := api.NewHandler(cfg, configPath, downloadManager, updater)
+	apiHandler := api.NewHandler(cfg, configPath, downloadManager, updater, authStore)
 	uiHandler := ui.NewTemplateHandler(cfg)
 
 	// Setup routes
@@ -165,6 +257,7 @@ func main() {
 
 	// Add UI route
 	router.HandleFunc("/", uiHandler.ServeIndex).Methods("GET")
+	router.HandleFunc("/login", uiHandler.ServeLogin).Methods("GET")
 
 	// Ensure web/public directory exists
 	if err := os.MkdirAll(filepath.Join("web", "public"), 0755); err != nil {
@@ -172,19 +265,58 @@ func main() {
 	}
 
 	// Start server
-	addr := fmt.Sprintf(":%d", cfg.Port)
+	addr := net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.Port))
 	fmt.Printf("Starting GoGetMedia server...\n")
 	fmt.Printf("Port: %d\n", cfg.Port)
+	if cfg.BindAddress != "" {
+		fmt.Printf("Bind address: %s\n", cfg.BindAddress)
+	}
+	if cfg.BasePathPrefix() != "" {
+		fmt.Printf("Base path: %s\n", cfg.BasePathPrefix())
+	}
 	fmt.Printf("Download path: %s\n", cfg.DownloadPath)
 	fmt.Printf("yt-dlp path: %s\n", cfg.YtDlpPath)
 	fmt.Printf("ffmpeg path: %s\n", cfg.FfmpegPath)
 	fmt.Printf("Max concurrent downloads: %d\n", cfg.MaxConcurrentDownloads)
 	fmt.Printf("\nInitializing components and starting web server...\n")
 
+	// Set up HTTPS with the configured certificate, or a self-signed one
+	var certStore *tlscert.Store
+	scheme := "http"
+	if cfg.TLS.Enabled {
+		certFile, keyFile := cfg.TLS.CertFile, cfg.TLS.KeyFile
+		if certFile == "" {
+			certFile, keyFile = tlscert.SelfSignedPaths(configPath)
+			hosts := tlscert.LocalHosts()
+			created, err := tlscert.EnsureSelfSigned(certFile, keyFile, hosts)
+			if err != nil {
+				log.Fatalf("Failed to create self-signed certificate: %v", err)
+			}
+			if created {
+				fmt.Printf("✓ Created self-signed certificate %s\n", certFile)
+			}
+			certStore, err = tlscert.NewSelfSignedStore(certFile, keyFile, hosts)
+		} else {
+			certStore, err = tlscert.NewStore(certFile, keyFile)
+		}
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		scheme = "https"
+		fmt.Printf("TLS certificate: %s\n", certFile)
+	}
+
 	// Create a custom server to show when it's ready
 	server := &http.Server{
 		Addr:    addr,
-		Handler: router,
+		Handler: api.WithBasePath(cfg.BasePathPrefix(), router),
+	}
+	serve := func(listener net.Listener) error {
+		if certStore != nil {
+			server.TLSConfig = certStore.TLSConfig()
+			return server.ServeTLS(listener, "", "")
+		}
+		return server.Serve(listener)
 	}
 
 	// Create listener
@@ -199,8 +331,27 @@ func main() {
 		os.Exit(1)
 	}
 
-	fmt.Printf("✓ Server is ready and listening on http://localhost%s\n", addr)
+	displayHost := cfg.BindAddress
+	if displayHost == "" || displayHost == "0.0.0.0" || displayHost == "::" {
+		displayHost = "localhost"
+	}
+	fmt.Printf("✓ Server is ready and listening on %s://%s%s/\n", scheme, net.JoinHostPort(displayHost, strconv.Itoa(cfg.Port)), cfg.BasePathPrefix())
 	fmt.Printf("✓ Web UI is now available - you can access it in your browser\n")
+
+	// Optionally redirect plain HTTP to HTTPS
+	var redirectServer *http.Server
+	if certStore != nil && cfg.TLS.RedirectHTTPPort > 0 {
+		redirectServer = &http.Server{
+			Addr:    net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.TLS.RedirectHTTPPort)),
+			Handler: httpsRedirect(cfg.Port),
+		}
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("❌ HTTP redirect server error: %v\n", err)
+			}
+		}()
+		fmt.Printf("✓ Redirecting HTTP on port %d to HTTPS\n", cfg.TLS.RedirectHTTPPort)
+	}
 	fmt.Printf("\nTo change port: Edit config.json, use -port flag, or GOGETMEDIA_PORT env var\n")
 	fmt.Printf("Press Ctrl+C to stop the server\n")
 	fmt.Printf("=====================================\n")
@@ -209,10 +360,18 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload the TLS certificate on SIGHUP, e.g. after renewal
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
+	// Self-signed certificates are renewed by the server itself
+	renewTicker := time.NewTicker(tlscert.RenewInterval)
+	defer renewTicker.Stop()
+
 	// Start server in goroutine
 	serverErrChan := make(chan error, 1)
 	go func() {
-		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		if err := serve(listener); err != nil && err != http.ErrServerClosed {
 			serverErrChan <- err
 		}
 	}()
@@ -220,6 +379,27 @@ func main() {
 	// Wait for shutdown signal or server error
 	for {
 		select {
+		case <-reloadChan:
+			if certStore == nil {
+				fmt.Printf("Received SIGHUP, but TLS is not enabled\n")
+				continue
+			}
+			if err := certStore.Reload(); err != nil {
+				fmt.Printf("❌ Failed to reload TLS certificate, keeping the current one: %v\n", err)
+			} else {
+				fmt.Printf("✓ TLS certificate reloaded\n")
+			}
+
+		case <-renewTicker.C:
+			if certStore == nil {
+				continue
+			}
+			if renewed, err := certStore.Renew(); err != nil {
+				fmt.Printf("❌ Failed to renew self-signed certificate, keeping the current one: %v\n", err)
+			} else if renewed {
+				fmt.Printf("✓ Self-signed certificate renewed\n")
+			}
+
 		case sig := <-sigChan:
 			fmt.Printf("\n\nReceived %s signal, shutting down gracefully...\n", sig)
 
@@ -229,13 +409,16 @@ func main() {
 
 			// Shutdown download manager
 			fmt.Printf("Stopping download manager...\n")
-			downloadManager.Shutdown()
+			downloadEngine.Close()
 
 			// Shutdown HTTP server
 			fmt.Printf("Stopping HTTP server...\n")
 			if err := server.Shutdown(shutdownCtx); err != nil {
 				fmt.Printf("Error during server shutdown: %v\n", err)
 			}
+			if redirectServer != nil {
+				redirectServer.Shutdown(shutdownCtx)
+			}
 
 			fmt.Printf("✓ Server shutdown complete\n")
 			return
@@ -244,7 +427,7 @@ func main() {
 			fmt.Printf("\n❌ Server error: %v\n", err)
 
 			// Attempt graceful cleanup
-			downloadManager.Shutdown()
+			downloadEngine.Close()
 
 			// Give some time for cleanup
 			time.Sleep(2 * time.Second)
@@ -257,7 +440,7 @@ func main() {
 			if newListener, err := net.Listen("tcp", addr); err == nil {
 				listener = newListener
 				go func() {
-					if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+					if err := serve(listener); err != nil && err != http.ErrServerClosed {
 						serverErrChan <- err
 					}
 				}()
@@ -0,0 +1,453 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/core"
+	"gogetmedia/pkg/apitypes"
+)
+
+// newUserResponse returns the public view of a user
+func newUserResponse(user *auth.User) apitypes.User {
+	return apitypes.User{Username: user.Username, Role: user.Role, CreatedAt: user.CreatedAt}
+}
+
+// newTokenResponse returns an API token without its hash
+func newTokenResponse(token *auth.APIToken) apitypes.Token {
+	return apitypes.Token{
+		ID:         token.ID,
+		Name:       token.Name,
+		Username:   token.Username,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// authEnabled reports whether requests have to be authenticated
+func (h *Handler) authEnabled() bool {
+	return h.auth != nil && !h.config.DisableAuth
+}
+
+// isPublicPath reports whether a path can be requested without logging in
+func isPublicPath(path string) bool {
+	switch {
+	case path == "/login", path == APIVersionPrefix+"/openapi.json":
+		return true
+	case strings.HasPrefix(path, "/api/") && (apiRelativePath(path) == "/auth/login" || apiRelativePath(path) == "/auth/status"):
+		return true
+	case strings.HasPrefix(path, "/assets/"), strings.HasPrefix(path, "/static/"):
+		return true
+	default:
+		return false
+	}
+}
+
+// isSafeMethod reports whether a request method does not change state
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// validCSRF reports whether a request may change state: cookie-authenticated
+// requests must send the session's CSRF token in the X-CSRF-Token header.
+// Bearer tokens are never sent by browsers on their own and need no check.
+func (h *Handler) validCSRF(r *http.Request) bool {
+	if isSafeMethod(r.Method) || isPublicPath(r.URL.Path) {
+		return true
+	}
+	sessionID, ok := auth.SessionID(r)
+	if !ok {
+		return true
+	}
+	return h.auth.ValidCSRFToken(sessionID, r.Header.Get(auth.CSRFHeader))
+}
+
+// csrfToken returns the CSRF token of the session a request is authenticated by
+func (h *Handler) csrfToken(r *http.Request) string {
+	if sessionID, ok := auth.SessionID(r); ok {
+		token, _ := h.auth.CSRFToken(sessionID)
+		return token
+	}
+	return ""
+}
+
+// authMiddleware requires a valid session cookie or bearer token for every
+// request except the login page and static assets. Browsers are redirected
+// to the login page, API clients get 401. Cookie-authenticated requests that
+// change state also need a valid CSRF token.
+func (h *Handler) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.authEnabled() || r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if user, ok := h.auth.UserFromRequest(r); ok {
+			if !h.validCSRF(r) {
+				log.Printf("[API] Rejected %s %s from %s: missing or invalid CSRF token", r.Method, r.URL.Path, r.RemoteAddr)
+				writeError(w, r, http.StatusForbidden, apitypes.CodeInvalidCSRFToken, "Missing or invalid CSRF token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+			return
+		}
+
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gogetmedia"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, h.config.BasePathPrefix()+"/login", http.StatusSeeOther)
+	})
+}
+
+// currentUser returns the authenticated user or writes an error response
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (*auth.User, bool) {
+	if !h.authEnabled() {
+		http.Error(w, "Authentication is disabled", http.StatusNotFound)
+		return nil, false
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
+
+// requireRole only lets users with at least the given role through. It has
+// no effect when authentication is disabled.
+func (h *Handler) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.authEnabled() {
+			user, ok := auth.UserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !user.HasRole(role) {
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// requestUsername returns the name of the authenticated user, or "" when
+// authentication is disabled
+func (h *Handler) requestUsername(r *http.Request) string {
+	if !h.authEnabled() {
+		return ""
+	}
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return user.Username
+	}
+	return ""
+}
+
+// ownerFilter returns the owner that bulk operations are limited to: nobody
+// for admins and with authentication disabled, otherwise the user themselves
+func (h *Handler) ownerFilter(r *http.Request) string {
+	if !h.authEnabled() {
+		return ""
+	}
+	if user, ok := auth.UserFromContext(r.Context()); ok && user.IsAdmin() {
+		return ""
+	}
+	return h.requestUsername(r)
+}
+
+// canView reports whether the requesting user may see a download. Admins and
+// viewers see everything, users only their own downloads.
+func (h *Handler) canView(r *http.Request, download *core.Download) bool {
+	if !h.authEnabled() {
+		return true
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return false
+	}
+	return user.IsAdmin() || user.Role == auth.RoleViewer || download.Owner == user.Username
+}
+
+// canModify reports whether the requesting user may change a download
+func (h *Handler) canModify(r *http.Request, download *core.Download) bool {
+	if !h.authEnabled() {
+		return true
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return false
+	}
+	return user.IsAdmin() || (user.HasRole(auth.RoleUser) && download.Owner == user.Username)
+}
+
+// authorizeDownload checks that the requesting user may access a download and
+// writes an error response if not. Downloads the user cannot see are reported
+// as not found.
+func (h *Handler) authorizeDownload(w http.ResponseWriter, r *http.Request, id string, modify bool) bool {
+	downloads := h.downloadManager.Snapshot(id)
+	if len(downloads) == 0 || !h.canView(r, downloads[0]) {
+		http.Error(w, "Download not found", http.StatusNotFound)
+		return false
+	}
+	if modify && !h.canModify(r, downloads[0]) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// AuthStatus tells the UI whether login is required and who is logged in
+func (h *Handler) AuthStatus(w http.ResponseWriter, r *http.Request) {
+	status := apitypes.AuthStatus{Enabled: h.authEnabled()}
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		response := newUserResponse(user)
+		status.User = &response
+		status.CSRFToken = h.csrfToken(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	if !h.authEnabled() {
+		http.Error(w, "Authentication is disabled", http.StatusNotFound)
+		return
+	}
+
+	var req apitypes.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	user, err := h.auth.Authenticate(req.Username, req.Password)
+	if err != nil {
+		log.Printf("[API] Failed login for %q from %s", req.Username, r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.auth.CreateSession(user.Username)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	auth.SetSessionCookie(w, r, session)
+	log.Printf("[API] User %s logged in from %s", user.Username, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apitypes.LoginResponse{User: newUserResponse(user), CSRFToken: session.CSRFToken})
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil {
+		if cookie, err := r.Cookie(auth.SessionCookieName); err == nil {
+			h.auth.DeleteSession(cookie.Value)
+		}
+	}
+	auth.ClearSessionCookie(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "logged out"})
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req apitypes.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if _, err := h.auth.Authenticate(user.Username, req.CurrentPassword); err != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if err := h.auth.SetPassword(user.Username, req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := apitypes.ChangePasswordResponse{Status: "password changed"}
+
+	// Changing the password ends all sessions, keep the current browser logged in
+	if session, err := h.auth.CreateSession(user.Username); err == nil {
+		auth.SetSessionCookie(w, r, session)
+		response.CSRFToken = session.CSRFToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens := []apitypes.Token{}
+	for _, token := range h.auth.ListTokens(user.Username) {
+		tokens = append(tokens, newTokenResponse(token))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req apitypes.CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Token name is required", http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := h.auth.CreateToken(user.Username, req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[API] User %s created API token %s (%s)", user.Username, token.ID, token.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(apitypes.CreateTokenResponse{
+		Token:  newTokenResponse(token),
+		Secret: secret, // only shown once
+	})
+}
+
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.auth.RevokeToken(user.Username, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "revoked"})
+}
+
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentUser(w, r); !ok {
+		return
+	}
+
+	users := []apitypes.User{}
+	for _, user := range h.auth.ListUsers() {
+		users = append(users, newUserResponse(user))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req apitypes.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleUser
+	}
+
+	user, err := h.auth.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == auth.ErrUserExists {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("[API] User %s created user %s (%s)", current.Username, user.Username, user.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	username := mux.Vars(r)["username"]
+	if err := h.auth.DeleteUser(username); err != nil {
+		status := http.StatusBadRequest
+		if err == auth.ErrUserNotFound {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("[API] User %s deleted user %s", current.Username, username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "deleted"})
+}
+
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req apitypes.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	username := mux.Vars(r)["username"]
+	if err := h.auth.SetRole(username, req.Role); err != nil {
+		status := http.StatusBadRequest
+		if err == auth.ErrUserNotFound {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("[API] User %s changed role of %s to %s", current.Username, username, req.Role)
+
+	user, _ := h.auth.GetUser(username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gogetmedia/internal/backup"
+	"gogetmedia/pkg/apitypes"
+)
+
+// Backup streams an archive of the config, the users, the downloads and their
+// logs, with media=true also of the downloaded files
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	var opts backup.Options
+	if value := r.URL.Query().Get("media"); value != "" {
+		media, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "media must be true or false", http.StatusBadRequest)
+			return
+		}
+		opts.Media = media
+	}
+
+	// The archive holds the downloads as they are now
+	if err := h.downloadManager.SaveState(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save downloads: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("gogetmedia-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Once the archive is being sent, failing can only cut it short; restore
+	// rejects archives that are incomplete
+	counter := &countingWriter{w: w}
+	manifest, err := backup.Write(counter, backup.PathsFor(h.configPath, h.config.DownloadPath), opts)
+	if err != nil {
+		log.Printf("[API] Backup failed: %v", err)
+		if counter.n == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, fmt.Sprintf("Backup failed: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("[API] Backup: %d downloads, %d users, %d downloaded files", manifest.Downloads, manifest.Users, manifest.MediaFiles)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Restore checks an uploaded backup and stages it to be restored when the
+// server is next started. A running server would save its own state over the
+// restored one.
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	temp, err := os.CreateTemp(filepath.Dir(h.configPath), ".gogetmedia_upload-")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(temp.Name())
+	_, err = io.Copy(temp, r.Body)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store backup: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	file, err := os.Open(temp.Name())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	result, err := backup.Restore(file, h.configPath, backup.RestoreOptions{Check: true})
+	file.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := os.Rename(temp.Name(), backup.PendingFile(h.configPath)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[API] Backup of %s staged for restore", result.Manifest.CreatedAt.Format("2006-01-02 15:04:05"))
+
+	response := apitypes.RestoreResponse{
+		Status:   "staged",
+		Message:  "restart the server to restore the backup",
+		Manifest: newBackupManifest(result.Manifest),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CancelRestore removes a backup staged for restore
+func (h *Handler) CancelRestore(w http.ResponseWriter, r *http.Request) {
+	err := os.Remove(backup.PendingFile(h.configPath))
+	if os.IsNotExist(err) {
+		http.Error(w, "No restore is staged", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to cancel restore: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[API] Staged restore cancelled")
+
+	response := apitypes.StatusResponse{
+		Status:  "success",
+		Message: "restore cancelled",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
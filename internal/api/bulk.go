@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+)
+
+// bulkFilterParams are the list query parameters a bulk filter may use
+var bulkFilterParams = map[string]bool{"status": true, "type": true, "q": true, "since": true, "external_id": true}
+
+// BulkAction applies an action to the downloads given by ID or selected by
+// a filter and reports the outcome for each of them. Users can only act on
+// their own downloads, admins on all.
+func (h *Handler) BulkAction(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	var req apitypes.BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	action, err := h.bulkAction(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids, err := h.bulkSelection(r, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := apitypes.BulkResponse{Action: req.Action, Results: []apitypes.BulkResult{}}
+	for _, id := range ids {
+		result := apitypes.BulkResult{ID: id}
+		downloads := h.downloadManager.Snapshot(id)
+		switch {
+		case len(downloads) == 0 || !h.canView(r, downloads[0]):
+			result.Error = "download not found"
+		case !h.canModify(r, downloads[0]):
+			result.Error = "insufficient permissions"
+		default:
+			if err := action(id); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.OK = true
+			}
+		}
+
+		if result.OK {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+	log.Printf("[API] Bulk %s: %d succeeded, %d failed", req.Action, response.Succeeded, response.Failed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// bulkAction returns the function that applies the action of a bulk request
+// to one download
+func (h *Handler) bulkAction(req apitypes.BulkRequest) (func(id string) error, error) {
+	dm := h.downloadManager
+	switch req.Action {
+	case apitypes.BulkCancel:
+		return dm.CancelDownload, nil
+	case apitypes.BulkPause:
+		return dm.PauseDownload, nil
+	case apitypes.BulkResume:
+		return dm.ResumeDownload, nil
+	case apitypes.BulkRetry:
+		return dm.RetryDownload, nil
+	case apitypes.BulkRemove:
+		return dm.RemoveDownloadKeepFiles, nil
+	case apitypes.BulkRemoveWithFiles:
+		return dm.RemoveDownload, nil
+	case apitypes.BulkChangePriority:
+		return func(id string) error { return dm.SetPriority(id, req.Priority) }, nil
+	case apitypes.BulkMoveDestination:
+		destination, err := manager.CleanDestination(req.Destination)
+		if err != nil {
+			return nil, err
+		}
+		return func(id string) error { return dm.MoveDownload(id, destination) }, nil
+	case "":
+		return nil, fmt.Errorf("action is required")
+	default:
+		return nil, fmt.Errorf("unknown action %q", req.Action)
+	}
+}
+
+// bulkSelection returns the IDs of the downloads a bulk request applies to.
+// A filter selects the downloads the user may change, oldest first.
+func (h *Handler) bulkSelection(r *http.Request, req apitypes.BulkRequest) ([]string, error) {
+	if len(req.IDs) > 0 && req.Filter != "" {
+		return nil, fmt.Errorf("give either ids or filter, not both")
+	}
+	if len(req.IDs) > 0 {
+		ids := make([]string, 0, len(req.IDs))
+		seen := make(map[string]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+	if req.Filter == "" {
+		return nil, fmt.Errorf("ids or filter is required")
+	}
+
+	query, err := url.ParseQuery(req.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	for name := range query {
+		if !bulkFilterParams[name] {
+			return nil, fmt.Errorf("unknown filter parameter %q, expected status, type, q, since or external_id", name)
+		}
+	}
+	if _, isRevision := parseRevision(query.Get("since")); isRevision {
+		return nil, fmt.Errorf("since must be an RFC 3339 time in a filter")
+	}
+	filter, err := parseFilter(query)
+	if err != nil {
+		return nil, err
+	}
+
+	order, _ := manager.ParseSort("created_at")
+	downloads, _ := h.downloadManager.Query(filter, order)
+	ids := []string{}
+	for _, download := range downloads {
+		if h.canModify(r, download) {
+			ids = append(ids, download.ID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"gogetmedia/internal/backup"
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+)
+
+// The API returns the types of pkg/apitypes, which clients use without
+// linking the server. The functions below convert the server's own types to
+// them; TestAPITypesMatch checks that both encode the same.
+
+// newDownload returns the API view of a download
+func newDownload(d *core.Download) *apitypes.Download {
+	download := &apitypes.Download{
+		ID:                   d.ID,
+		URL:                  d.URL,
+		Type:                 apitypes.DownloadType(d.Type),
+		Quality:              d.Quality,
+		Format:               d.Format,
+		Status:               apitypes.DownloadStatus(d.Status),
+		Progress:             newDownloadProgress(d.Progress),
+		Title:                d.Title,
+		Filename:             d.Filename,
+		OutputPath:           d.OutputPath,
+		CreatedAt:            d.CreatedAt,
+		Owner:                d.Owner,
+		ExternalID:           d.ExternalID,
+		StartAt:              d.StartAt,
+		CompletedAt:          d.CompletedAt,
+		Error:                d.Error,
+		StatusMessage:        d.StatusMessage,
+		EstimatedBytes:       d.EstimatedBytes,
+		FileSize:             d.FileSize,
+		SHA256:               d.SHA256,
+		RateLimitKBps:        d.RateLimitKBps,
+		AppliedRateLimitKBps: d.AppliedRateLimitKBps,
+		ErrorCode:            apitypes.ErrorCode(d.ErrorCode),
+		AutoRetries:          d.AutoRetries,
+		NextAttemptAt:        d.NextAttemptAt,
+		Command:              append([]string(nil), d.Command...),
+		Priority:             d.Priority,
+		Destination:          d.Destination,
+		Revision:             d.Revision,
+	}
+	for _, attempt := range d.Attempts {
+		download.Attempts = append(download.Attempts, apitypes.Attempt{
+			Number:    attempt.Number,
+			StartedAt: attempt.StartedAt,
+			EndedAt:   attempt.EndedAt,
+			Outcome:   apitypes.DownloadStatus(attempt.Outcome),
+			ErrorCode: apitypes.ErrorCode(attempt.ErrorCode),
+			Error:     attempt.Error,
+		})
+	}
+	return download
+}
+
+// newDownloads returns the API view of a list of downloads, never nil
+func newDownloads(downloads []*core.Download) []*apitypes.Download {
+	list := make([]*apitypes.Download, 0, len(downloads))
+	for _, download := range downloads {
+		list = append(list, newDownload(download))
+	}
+	return list
+}
+
+func newDownloadProgress(p core.DownloadProgress) apitypes.DownloadProgress {
+	progress := apitypes.DownloadProgress{
+		Percentage:      p.Percentage,
+		Speed:           p.Speed,
+		ETA:             p.ETA,
+		Size:            p.Size,
+		DownloadedBytes: p.DownloadedBytes,
+		TotalBytes:      p.TotalBytes,
+		TotalEstimated:  p.TotalEstimated,
+		SpeedBps:        p.SpeedBps,
+		ETASeconds:      p.ETASeconds,
+		FragmentIndex:   p.FragmentIndex,
+		FragmentCount:   p.FragmentCount,
+		Phase:           p.Phase,
+		PhasePercentage: p.PhasePercentage,
+	}
+	for _, phase := range p.Phases {
+		progress.Phases = append(progress.Phases, apitypes.PhaseProgress{
+			Name:            phase.Name,
+			State:           phase.State,
+			Percentage:      phase.Percentage,
+			Weight:          phase.Weight,
+			DownloadedBytes: phase.DownloadedBytes,
+			TotalBytes:      phase.TotalBytes,
+		})
+	}
+	return progress
+}
+
+// newDownloadLog returns the API view of the output of a download
+func newDownloadLog(l *manager.DownloadLog) apitypes.DownloadLog {
+	downloadLog := apitypes.DownloadLog{ID: l.ID, Command: copyStrings(l.Command), Live: l.Live}
+	if l.Lines != nil {
+		downloadLog.Lines = make([]apitypes.LogLine, 0, len(l.Lines))
+	}
+	for _, line := range l.Lines {
+		downloadLog.Lines = append(downloadLog.Lines, newLogLine(line))
+	}
+	return downloadLog
+}
+
+func newLogLine(line core.LogLine) apitypes.LogLine {
+	return apitypes.LogLine{Time: line.Time, Stream: line.Stream, Text: line.Text}
+}
+
+// newConfig returns the API view of the configuration
+func newConfig(c *config.Config) *apitypes.Config {
+	cfg := &apitypes.Config{
+		DownloadPath:             c.DownloadPath,
+		MaxConcurrentDownloads:   c.MaxConcurrentDownloads,
+		YtDlpPath:                c.YtDlpPath,
+		FfmpegPath:               c.FfmpegPath,
+		Port:                     c.Port,
+		BindAddress:              c.BindAddress,
+		DefaultVideoFormat:       c.DefaultVideoFormat,
+		DefaultAudioFormat:       c.DefaultAudioFormat,
+		VerboseLogging:           c.VerboseLogging,
+		CompletedFileExpiryHours: c.CompletedFileExpiryHours,
+		EnableHardwareAccel:      c.EnableHardwareAccel,
+		OptimizeForLowPower:      c.OptimizeForLowPower,
+		DownloadWindows:          newScheduleWindows(c.DownloadWindows),
+		BandwidthLimitKBps:       c.BandwidthLimitKBps,
+		DefaultSiteLimit:         newSiteLimit(c.DefaultSiteLimit),
+		Retry: apitypes.RetryPolicy{
+			MaxAttempts:      c.Retry.MaxAttempts,
+			BaseDelaySeconds: c.Retry.BaseDelaySeconds,
+			MaxDelaySeconds:  c.Retry.MaxDelaySeconds,
+			Jitter:           c.Retry.Jitter,
+			RetryOn:          copyStrings(c.Retry.RetryOn),
+		},
+		DefaultQuota:   newQuota(c.DefaultQuota),
+		DisableAuth:    c.DisableAuth,
+		BasePath:       c.BasePath,
+		TrustedProxies: copyStrings(c.TrustedProxies),
+		CORS: apitypes.CORSConfig{
+			AllowedOrigins: copyStrings(c.CORS.AllowedOrigins),
+			AllowedMethods: copyStrings(c.CORS.AllowedMethods),
+		},
+		TLS: apitypes.TLSConfig{
+			Enabled:          c.TLS.Enabled,
+			CertFile:         c.TLS.CertFile,
+			KeyFile:          c.TLS.KeyFile,
+			RedirectHTTPPort: c.TLS.RedirectHTTPPort,
+		},
+		RateLimit: apitypes.RateLimitConfig{
+			RequestsPerMinute:      c.RateLimit.RequestsPerMinute,
+			Burst:                  c.RateLimit.Burst,
+			LoginAttemptsPerMinute: c.RateLimit.LoginAttemptsPerMinute,
+		},
+		LockedSettings: copyStrings(c.LockedSettings),
+	}
+	if c.BandwidthSchedule != nil {
+		cfg.BandwidthSchedule = make([]apitypes.BandwidthRule, 0, len(c.BandwidthSchedule))
+	}
+	for _, rule := range c.BandwidthSchedule {
+		cfg.BandwidthSchedule = append(cfg.BandwidthSchedule, apitypes.BandwidthRule{
+			ScheduleWindow: newScheduleWindow(rule.ScheduleWindow),
+			LimitKBps:      rule.LimitKBps,
+		})
+	}
+	if c.SiteLimits != nil {
+		cfg.SiteLimits = make([]apitypes.SiteLimit, 0, len(c.SiteLimits))
+	}
+	for _, limit := range c.SiteLimits {
+		cfg.SiteLimits = append(cfg.SiteLimits, newSiteLimit(limit))
+	}
+	if c.UserQuotas != nil {
+		cfg.UserQuotas = make([]apitypes.Quota, 0, len(c.UserQuotas))
+	}
+	for _, quota := range c.UserQuotas {
+		cfg.UserQuotas = append(cfg.UserQuotas, newQuota(quota))
+	}
+	return cfg
+}
+
+// newScheduleWindows converts windows, keeping nil and empty lists apart
+// since they encode differently
+func newScheduleWindows(windows []config.ScheduleWindow) []apitypes.ScheduleWindow {
+	if windows == nil {
+		return nil
+	}
+	list := make([]apitypes.ScheduleWindow, 0, len(windows))
+	for _, window := range windows {
+		list = append(list, newScheduleWindow(window))
+	}
+	return list
+}
+
+func newScheduleWindow(w config.ScheduleWindow) apitypes.ScheduleWindow {
+	return apitypes.ScheduleWindow{Start: w.Start, End: w.End, Days: copyStrings(w.Days)}
+}
+
+func newSiteLimit(l config.SiteLimit) apitypes.SiteLimit {
+	return apitypes.SiteLimit{
+		Host:                    l.Host,
+		MaxConcurrent:           l.MaxConcurrent,
+		MinIntervalSeconds:      l.MinIntervalSeconds,
+		SleepRequestsSeconds:    l.SleepRequestsSeconds,
+		SleepIntervalSeconds:    l.SleepIntervalSeconds,
+		MaxSleepIntervalSeconds: l.MaxSleepIntervalSeconds,
+	}
+}
+
+func newQuota(q config.Quota) apitypes.Quota {
+	return apitypes.Quota{
+		Username:      q.Username,
+		MaxConcurrent: q.MaxConcurrent,
+		MaxQueued:     q.MaxQueued,
+		MaxStorageMB:  q.MaxStorageMB,
+		MaxFileSizeMB: q.MaxFileSizeMB,
+	}
+}
+
+// copyStrings copies a list, keeping nil and empty lists apart
+func copyStrings(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	return append([]string{}, list...)
+}
+
+// newUsage returns the API view of a user's usage
+func newUsage(u manager.Usage) apitypes.Usage {
+	return apitypes.Usage{
+		Username:      u.Username,
+		Active:        u.Active,
+		Queued:        u.Queued,
+		StoredBytes:   u.StoredBytes,
+		ReservedBytes: u.ReservedBytes,
+		Quota:         newQuota(u.Quota),
+	}
+}
+
+// newScheduleStatus returns the API view of the scheduler state
+func newScheduleStatus(s manager.ScheduleStatus) apitypes.ScheduleStatus {
+	status := apitypes.ScheduleStatus{
+		Windows:    newScheduleWindows(s.Windows),
+		WindowOpen: s.WindowOpen,
+		NextChange: s.NextChange,
+		Held:       s.Held,
+	}
+	if s.ActiveByHost != nil {
+		status.ActiveByHost = make(map[string]int, len(s.ActiveByHost))
+		for host, active := range s.ActiveByHost {
+			status.ActiveByHost[host] = active
+		}
+	}
+	return status
+}
+
+func newUpdateInfo(u *core.UpdateInfo) apitypes.UpdateInfo {
+	return apitypes.UpdateInfo{
+		CurrentVersion:  u.CurrentVersion,
+		LatestVersion:   u.LatestVersion,
+		UpdateAvailable: u.UpdateAvailable,
+		LastChecked:     u.LastChecked,
+	}
+}
+
+func newVersionInfo(v *core.VersionInfo) apitypes.VersionInfo {
+	return apitypes.VersionInfo{YtDlpVersion: v.YtDlpVersion, FfmpegVersion: v.FfmpegVersion}
+}
+
+func newBackupManifest(m backup.Manifest) apitypes.BackupManifest {
+	return apitypes.BackupManifest{
+		Format:       m.Format,
+		Version:      m.Version,
+		CreatedAt:    m.CreatedAt,
+		DownloadPath: m.DownloadPath,
+		Users:        m.Users,
+		Downloads:    m.Downloads,
+		Logs:         m.Logs,
+		Media:        m.Media,
+		MediaFiles:   m.MediaFiles,
+		MediaBytes:   m.MediaBytes,
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gogetmedia/pkg/apitypes"
+)
+
+// APIVersionPrefix is the path of the current API version. The unversioned
+// /api paths are kept as deprecated aliases.
+const APIVersionPrefix = "/api/v1"
+
+// isVersionedPath reports whether a path belongs to the versioned API
+func isVersionedPath(path string) bool {
+	return path == APIVersionPrefix || strings.HasPrefix(path, APIVersionPrefix+"/")
+}
+
+// isLegacyPath reports whether a path belongs to the deprecated /api aliases
+func isLegacyPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") && !isVersionedPath(path)
+}
+
+// apiRelativePath returns the path of an API request below /api/v1 or /api,
+// so both versions can be checked alike. Other paths are returned unchanged.
+func apiRelativePath(path string) string {
+	switch {
+	case isVersionedPath(path):
+		return strings.TrimPrefix(path, APIVersionPrefix)
+	case isLegacyPath(path):
+		return strings.TrimPrefix(path, "/api")
+	default:
+		return path
+	}
+}
+
+// errorCode returns the error code for an HTTP status
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return apitypes.CodeBadRequest
+	case http.StatusUnauthorized:
+		return apitypes.CodeUnauthorized
+	case http.StatusForbidden:
+		return apitypes.CodeForbidden
+	case http.StatusNotFound:
+		return apitypes.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return apitypes.CodeMethodNotAllowed
+	case http.StatusConflict:
+		return apitypes.CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return apitypes.CodeRequestTooLarge
+	case http.StatusUnsupportedMediaType:
+		return apitypes.CodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return apitypes.CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return apitypes.CodeUnavailable
+	}
+	if status >= 500 {
+		return apitypes.CodeInternal
+	}
+	return apitypes.CodeBadRequest
+}
+
+// writeError writes an error response. Requests to /api/v1 get the JSON
+// error envelope with code, everything else the plain text message like
+// http.Error.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if !isVersionedPath(r.URL.Path) {
+		http.Error(w, message, status)
+		return
+	}
+	if code == "" {
+		code = errorCode(status)
+	}
+	apiError := apitypes.Error{Code: code, Message: message}
+	if status == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err == nil {
+			apiError.Details = map[string]interface{}{"retry_after_seconds": seconds}
+		}
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError)
+}
+
+// envelopeWriter turns plain text error responses written with http.Error
+// into the JSON error envelope of /api/v1. Successful responses and errors
+// that are already JSON pass through unchanged.
+type envelopeWriter struct {
+	http.ResponseWriter
+	request   *http.Request
+	status    int
+	buffering bool
+	message   bytes.Buffer
+}
+
+func (ew *envelopeWriter) WriteHeader(status int) {
+	if ew.status != 0 {
+		return
+	}
+	ew.status = status
+	if status >= 400 && strings.HasPrefix(ew.Header().Get("Content-Type"), "text/plain") {
+		ew.buffering = true
+		return
+	}
+	ew.ResponseWriter.WriteHeader(status)
+}
+
+func (ew *envelopeWriter) Write(data []byte) (int, error) {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.buffering {
+		if ew.message.Len() < maxErrorMessageBytes {
+			ew.message.Write(data)
+		}
+		return len(data), nil
+	}
+	return ew.ResponseWriter.Write(data)
+}
+
+// Flush lets the download log stream through
+func (ew *envelopeWriter) Flush() {
+	if ew.buffering {
+		return
+	}
+	if flusher, ok := ew.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// finish writes the buffered error as the envelope
+func (ew *envelopeWriter) finish() {
+	if !ew.buffering {
+		return
+	}
+	message := strings.TrimSpace(ew.message.String())
+	if message == "" {
+		message = http.StatusText(ew.status)
+	}
+	writeError(ew.ResponseWriter, ew.request, ew.status, "", message)
+}
+
+// maxErrorMessageBytes limits the message of a converted error response
+const maxErrorMessageBytes = 4096
+
+// versionMiddleware gives /api/v1 errors the JSON envelope and marks the
+// unversioned /api aliases as deprecated, pointing at their successor.
+func (h *Handler) versionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case isVersionedPath(r.URL.Path):
+			ew := &envelopeWriter{ResponseWriter: w, request: r}
+			next.ServeHTTP(ew, r)
+			ew.finish()
+		case isLegacyPath(r.URL.Path):
+			successor := h.config.BasePathPrefix() + APIVersionPrefix + apiRelativePath(r.URL.Path)
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// notFound answers requests that match no route
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "", "404 page not found")
+}
+
+// methodNotAllowed answers requests to a route with another method
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, "", "Method not allowed")
+}
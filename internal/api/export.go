@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+)
+
+// exportColumn is a column of a CSV export
+type exportColumn struct {
+	name  string
+	value func(*core.Download) string
+}
+
+// exportColumns are the columns of a CSV export. JSON exports have every
+// field of the downloads.
+var exportColumns = []exportColumn{
+	{"id", func(d *core.Download) string { return d.ID }},
+	{"url", func(d *core.Download) string { return d.URL }},
+	{"type", func(d *core.Download) string { return string(d.Type) }},
+	{"quality", func(d *core.Download) string { return d.Quality }},
+	{"format", func(d *core.Download) string { return d.Format }},
+	{"status", func(d *core.Download) string { return string(d.Status) }},
+	{"title", func(d *core.Download) string { return d.Title }},
+	{"filename", func(d *core.Download) string { return d.Filename }},
+	{"output_path", func(d *core.Download) string { return d.OutputPath }},
+	{"destination", func(d *core.Download) string { return d.Destination }},
+	{"file_size", func(d *core.Download) string { return formatExportInt(d.FileSize) }},
+	{"estimated_bytes", func(d *core.Download) string { return formatExportInt(d.EstimatedBytes) }},
+	{"sha256", func(d *core.Download) string { return d.SHA256 }},
+	{"owner", func(d *core.Download) string { return d.Owner }},
+	{"external_id", func(d *core.Download) string { return d.ExternalID }},
+	{"priority", func(d *core.Download) string { return strconv.Itoa(d.Priority) }},
+	{"created_at", func(d *core.Download) string { return formatExportTime(&d.CreatedAt) }},
+	{"start_at", func(d *core.Download) string { return formatExportTime(d.StartAt) }},
+	{"completed_at", func(d *core.Download) string { return formatExportTime(d.CompletedAt) }},
+	{"attempts", func(d *core.Download) string { return strconv.Itoa(len(d.Attempts)) }},
+	{"error_code", func(d *core.Download) string { return string(d.ErrorCode) }},
+	{"error", func(d *core.Download) string { return d.Error }},
+}
+
+func formatExportInt(value int64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvCell keeps spreadsheets from running text such as titles as a formula
+func csvCell(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
+
+// ExportDownloads writes the downloads visible to the caller that match the
+// filter as CSV, a JSON array or JSON lines, oldest first unless sorted
+// otherwise. Checksums the manager has not computed yet are left empty.
+func (h *Handler) ExportDownloads(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = apitypes.ExportJSON
+	}
+	var contentType string
+	switch format {
+	case apitypes.ExportJSON:
+		contentType = "application/json"
+	case apitypes.ExportJSONL:
+		contentType = "application/x-ndjson"
+	case apitypes.ExportCSV:
+		contentType = "text/csv; charset=utf-8"
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q, expected csv, json or jsonl", format), http.StatusBadRequest)
+		return
+	}
+
+	if _, isRevision := parseRevision(query.Get("since")); isRevision {
+		http.Error(w, "since must be an RFC 3339 time in an export", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	order, err := manager.ParseSort(sortBy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	matching, _ := h.downloadManager.Query(filter, order)
+	downloads := []*core.Download{}
+	for _, download := range matching {
+		if !h.canView(r, download) {
+			continue
+		}
+		downloads = append(downloads, download)
+	}
+	log.Printf("[API] Exporting %d downloads as %s", len(downloads), format)
+
+	filename := fmt.Sprintf("gogetmedia-downloads-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Stop writing once the client is gone
+	ctx := r.Context()
+	switch format {
+	case apitypes.ExportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(newDownloads(downloads))
+	case apitypes.ExportJSONL:
+		encoder := json.NewEncoder(w)
+		for _, download := range downloads {
+			if ctx.Err() != nil {
+				return
+			}
+			encoder.Encode(newDownload(download))
+		}
+	case apitypes.ExportCSV:
+		writer := csv.NewWriter(w)
+		record := make([]string, len(exportColumns))
+		for i, column := range exportColumns {
+			record[i] = column.name
+		}
+		writer.Write(record)
+		for _, download := range downloads {
+			if ctx.Err() != nil {
+				return
+			}
+			for i, column := range exportColumns {
+				record[i] = csvCell(column.value(download))
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+	}
+}
@@ -2,17 +2,24 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"gogetmedia/internal/auth"
 	"gogetmedia/internal/config"
 	"gogetmedia/internal/core"
 	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+	"hash/fnv"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Handler struct {
@@ -20,72 +27,184 @@ type Handler struct {
 	configPath      string
 	downloadManager *manager.DownloadManager
 	updater         *core.YtDlpUpdater
+	auth            *auth.Store
+	limiter         *rateLimiter // API requests per client
+	loginLimiter    *rateLimiter // login attempts per client
 }
 
-func NewHandler(cfg *config.Config, configPath string, dm *manager.DownloadManager, updater *core.YtDlpUpdater) *Handler {
+func NewHandler(cfg *config.Config, configPath string, dm *manager.DownloadManager, updater *core.YtDlpUpdater, authStore *auth.Store) *Handler {
 	return &Handler{
 		config:          cfg,
 		configPath:      configPath,
 		downloadManager: dm,
 		updater:         updater,
+		auth:            authStore,
+		limiter:         newRateLimiter(),
+		loginLimiter:    newRateLimiter(),
 	}
 }
 
 func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(h.config)
+	json.NewEncoder(w).Encode(apitypes.ConfigResponse{Config: newConfig(h.config), Locked: h.config.LockedFields()})
 }
 
+// UpdateConfig changes the runtime settings. Settings missing from the
+// request keep their current value, and changing a locked setting is refused.
 func (h *Handler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
-	var newConfig config.Config
-	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	current := h.config
+	updated := current.Clone()
+	if err := json.NewDecoder(r.Body).Decode(updated); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
-	if err := newConfig.Validate(); err != nil {
+	if locked := updated.LockedChanges(current); len(locked) > 0 {
+		log.Printf("[API] Refused change of locked settings: %s", strings.Join(locked, ", "))
+		writeError(w, r, http.StatusForbidden, apitypes.CodeSettingLocked, fmt.Sprintf("These settings can only be changed in the config file: %s", strings.Join(locked, ", ")))
+		return
+	}
+
+	if err := updated.Validate(); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := newConfig.Save(h.configPath); err != nil {
+	if err := updated.Save(h.configPath); err != nil {
 		http.Error(w, "Failed to save config", http.StatusInternalServerError)
 		return
 	}
 
-	h.config = &newConfig
+	h.config = updated
 
 	// Update the download manager configuration
 	if h.downloadManager != nil {
-		h.downloadManager.UpdateConfig(&newConfig)
+		h.downloadManager.UpdateConfig(updated)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(h.config)
+	json.NewEncoder(w).Encode(apitypes.ConfigResponse{Config: newConfig(h.config), Locked: h.config.LockedFields()})
 }
 
+// GetDownloads lists the downloads the user may see. The list can be
+// filtered, sorted and paged, see parseFilter and parsePage. /api/v1 returns
+// the page with the total count, the legacy path a plain array.
+//
+// With ?since=<revision> /api/v1 only returns the downloads changed after
+// that revision and the IDs of removed ones. Responses carry an ETag, so
+// polls without changes get 304.
 func (h *Handler) GetDownloads(w http.ResponseWriter, r *http.Request) {
 	if h.downloadManager == nil {
 		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	downloads := h.downloadManager.GetAllDownloads()
+	query := r.URL.Query()
+	filter, err := parseFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := parsePage(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && match == h.listETag(r, h.downloadManager.Revision()) {
+		w.Header().Set("ETag", match)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	versioned := isVersionedPath(r.URL.Path)
+	if since, ok := parseRevision(query.Get("since")); ok && versioned {
+		if list, ok := h.downloadChanges(r, since, filter, p.order); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", h.listETag(r, list.Revision))
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		// The changes are not known, send the full list
+	}
+
+	matching, revision := h.downloadManager.Query(filter, p.order)
+	downloads := []*core.Download{}
+	for _, download := range matching {
+		if h.canView(r, download) {
+			downloads = append(downloads, download)
+		}
+	}
+	total := len(downloads)
+	downloads, nextCursor, err := p.apply(downloads)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(downloads)
+	w.Header().Set("ETag", h.listETag(r, revision))
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if !versioned {
+		if nextCursor != "" {
+			w.Header().Set("X-Next-Cursor", nextCursor)
+		}
+		json.NewEncoder(w).Encode(newDownloads(downloads))
+		return
+	}
+	json.NewEncoder(w).Encode(apitypes.DownloadList{Downloads: newDownloads(downloads), Total: total, NextCursor: nextCursor, Revision: revision})
 }
 
-func (h *Handler) StartDownload(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		URL     string `json:"url"`
-		Type    string `json:"type"`    // "video" or "audio"
-		Quality string `json:"quality"` // "best", "worst", "720p", etc.
-		Format  string `json:"format"`  // "mp4", "mp3", etc.
+// downloadChanges returns the changes since a revision that the user may
+// see. Downloads that changed and no longer match the filter are reported as
+// removed, so the client drops them from its filtered list.
+func (h *Handler) downloadChanges(r *http.Request, since uint64, filter manager.Filter, order manager.Sort) (apitypes.DownloadList, bool) {
+	changed, removed, revision, ok := h.downloadManager.Changes(since)
+	if !ok {
+		return apitypes.DownloadList{}, false
 	}
 
+	list := apitypes.DownloadList{Revision: revision, Delta: true}
+	downloads := []*core.Download{}
+	for _, download := range changed {
+		if !h.canView(r, download) {
+			continue
+		}
+		if filter.Matches(download) {
+			downloads = append(downloads, download)
+		} else {
+			list.Removed = append(list.Removed, download.ID)
+		}
+	}
+	for _, removal := range removed {
+		if h.canView(r, &core.Download{ID: removal.ID, Owner: removal.Owner}) {
+			list.Removed = append(list.Removed, removal.ID)
+		}
+	}
+	order.Apply(downloads)
+	list.Downloads = newDownloads(downloads)
+	list.Total = len(downloads)
+	return list, true
+}
+
+// listETag identifies a response of GetDownloads: the revision of the
+// downloads, and the query and user that selected them
+func (h *Handler) listETag(r *http.Request, revision uint64) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s", r.URL.Path, r.URL.Query().Encode(), h.requestUsername(r))
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		fmt.Fprintf(hash, "\x00%s", user.Role)
+	}
+	return fmt.Sprintf(`"%d-%x"`, revision, hash.Sum64())
+}
+
+func (h *Handler) StartDownload(w http.ResponseWriter, r *http.Request) {
+	var request apitypes.DownloadRequest
+
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("[API] StartDownload: Invalid JSON: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
@@ -97,6 +216,27 @@ func (h *Handler) StartDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := core.ValidateMediaURL(request.URL); err != nil {
+		log.Printf("[API] StartDownload: %v", err)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidURL, err.Error())
+		return
+	}
+
+	if request.RateLimitKBps < 0 {
+		http.Error(w, "rate_limit_kbps cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	externalID, err := requestExternalID(r, request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.downloadManager != nil && h.replayDownload(w, r, externalID, request.URL) {
+		log.Printf("[API] StartDownload: Returning existing download for external ID %q", externalID)
+		return
+	}
+
 	// Check if ffmpeg is required and available
 	var downloadType core.DownloadType
 	if request.Type == "audio" {
@@ -107,7 +247,7 @@ func (h *Handler) StartDownload(w http.ResponseWriter, r *http.Request) {
 
 	if core.RequiresFfmpeg(downloadType, request.Format) && !core.CheckFfmpegAvailable(h.config.FfmpegPath) {
 		log.Printf("[API] StartDownload: ffmpeg required but not available for %s/%s", request.Type, request.Format)
-		http.Error(w, "ffmpeg is required for this download format but is not available. Please configure a valid ffmpeg path in settings.", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeFfmpegUnavailable, "ffmpeg is required for this download format but is not available. Please configure a valid ffmpeg path in settings.")
 		return
 	}
 
@@ -119,6 +259,11 @@ func (h *Handler) StartDownload(w http.ResponseWriter, r *http.Request) {
 		Quality:   request.Quality,
 		Format:    request.Format,
 		OutputDir: h.config.DownloadPath,
+		StartAt:   request.StartAt,
+		Owner:     h.requestUsername(r),
+
+		RateLimitKBps: request.RateLimitKBps,
+		ExternalID:    externalID,
 	}
 
 	// Add to download manager
@@ -132,26 +277,21 @@ func (h *Handler) StartDownload(w http.ResponseWriter, r *http.Request) {
 	download, err := h.downloadManager.AddDownload(req)
 	if err != nil {
 		log.Printf("[API] StartDownload: Failed to add download: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeAddDownloadError(w, r, err)
 		return
 	}
 
 	log.Printf("[API] StartDownload: Download added successfully with ID: %s", download.ID)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(download)
+	json.NewEncoder(w).Encode(newDownload(h.snapshot(download)))
 }
 
 func (h *Handler) StartPlaylistDownload(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		URL     string `json:"url"`
-		Type    string `json:"type"`    // "video" or "audio"
-		Quality string `json:"quality"` // "best", "worst", "720p", etc.
-		Format  string `json:"format"`  // "mp4", "mp3", etc.
-	}
+	var request apitypes.DownloadRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("[API] StartPlaylistDownload: Invalid JSON: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
@@ -163,6 +303,23 @@ func (h *Handler) StartPlaylistDownload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := core.ValidateMediaURL(request.URL); err != nil {
+		log.Printf("[API] StartPlaylistDownload: %v", err)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidURL, err.Error())
+		return
+	}
+
+	if request.RateLimitKBps < 0 {
+		http.Error(w, "rate_limit_kbps cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	// Playlists add many downloads, an external ID can only name one
+	if request.ExternalID != "" || r.Header.Get(IdempotencyKeyHeader) != "" {
+		http.Error(w, "external_id is not supported for playlists, add the videos one by one", http.StatusBadRequest)
+		return
+	}
+
 	// Convert to download type
 	var downloadType core.DownloadType
 	if request.Type == "audio" {
@@ -174,7 +331,7 @@ func (h *Handler) StartPlaylistDownload(w http.ResponseWriter, r *http.Request)
 	// Check if ffmpeg is required and available
 	if core.RequiresFfmpeg(downloadType, request.Format) && !core.CheckFfmpegAvailable(h.config.FfmpegPath) {
 		log.Printf("[API] StartPlaylistDownload: ffmpeg required but not available for %s/%s", request.Type, request.Format)
-		http.Error(w, "ffmpeg is required for this download format but is not available. Please configure a valid ffmpeg path in settings.", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeFfmpegUnavailable, "ffmpeg is required for this download format but is not available. Please configure a valid ffmpeg path in settings.")
 		return
 	}
 
@@ -185,6 +342,10 @@ func (h *Handler) StartPlaylistDownload(w http.ResponseWriter, r *http.Request)
 		Quality:   request.Quality,
 		Format:    request.Format,
 		OutputDir: h.config.DownloadPath,
+		StartAt:   request.StartAt,
+		Owner:     h.requestUsername(r),
+
+		RateLimitKBps: request.RateLimitKBps,
 	}
 
 	// Add playlist to download manager
@@ -198,29 +359,24 @@ func (h *Handler) StartPlaylistDownload(w http.ResponseWriter, r *http.Request)
 	download, err := h.downloadManager.AddPlaylistDownload(req)
 	if err != nil {
 		log.Printf("[API] StartPlaylistDownload: Failed to add playlist: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeAddDownloadError(w, r, err)
 		return
 	}
 
 	log.Printf("[API] StartPlaylistDownload: Playlist added successfully with first download ID: %s", download.ID)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":        "Playlist download started",
-		"first_download": download,
+	json.NewEncoder(w).Encode(apitypes.PlaylistResponse{
+		Message:       "Playlist download started",
+		FirstDownload: newDownload(h.snapshot(download)),
 	})
 }
 
 func (h *Handler) StartFirstVideoDownload(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		URL     string `json:"url"`
-		Type    string `json:"type"`    // "video" or "audio"
-		Quality string `json:"quality"` // "best", "worst", "720p", etc.
-		Format  string `json:"format"`  // "mp4", "mp3", etc.
-	}
+	var request apitypes.DownloadRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("[API] StartFirstVideoDownload: Invalid JSON: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
@@ -232,6 +388,28 @@ func (h *Handler) StartFirstVideoDownload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if err := core.ValidateMediaURL(request.URL); err != nil {
+		log.Printf("[API] StartFirstVideoDownload: %v", err)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidURL, err.Error())
+		return
+	}
+
+	if request.RateLimitKBps < 0 {
+		http.Error(w, "rate_limit_kbps cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	externalID, err := requestExternalID(r, request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The playlist is not looked up again; its first video may have changed
+	if h.downloadManager != nil && h.replayDownload(w, r, externalID, "") {
+		log.Printf("[API] StartFirstVideoDownload: Returning existing download for external ID %q", externalID)
+		return
+	}
+
 	// Create downloader to get playlist items
 	downloader := core.NewDownloader(h.config.YtDlpPath, h.config.FfmpegPath, h.config.EnableHardwareAccel, h.config.OptimizeForLowPower)
 	playlistItems, err := downloader.GetPlaylistItems(request.URL)
@@ -265,6 +443,11 @@ func (h *Handler) StartFirstVideoDownload(w http.ResponseWriter, r *http.Request
 		Quality:   request.Quality,
 		Format:    request.Format,
 		OutputDir: h.config.DownloadPath,
+		StartAt:   request.StartAt,
+		Owner:     h.requestUsername(r),
+
+		RateLimitKBps: request.RateLimitKBps,
+		ExternalID:    externalID,
 	}
 
 	// Add to download manager
@@ -278,25 +461,20 @@ func (h *Handler) StartFirstVideoDownload(w http.ResponseWriter, r *http.Request
 	download, err := h.downloadManager.AddDownload(req)
 	if err != nil {
 		log.Printf("[API] StartFirstVideoDownload: Failed to add download: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeAddDownloadError(w, r, err)
 		return
 	}
 
 	log.Printf("[API] StartFirstVideoDownload: First video download added successfully with ID: %s", download.ID)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(download)
+	json.NewEncoder(w).Encode(newDownload(h.snapshot(download)))
 }
 
 func (h *Handler) ValidateURL(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		URL     string `json:"url"`
-		Type    string `json:"type"`    // "video" or "audio"
-		Quality string `json:"quality"` // "best", "worst", "720p", etc.
-		Format  string `json:"format"`  // "mp4", "mp3", etc.
-	}
+	var request apitypes.ValidateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
@@ -305,27 +483,26 @@ func (h *Handler) ValidateURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := core.ValidateMediaURL(request.URL); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apitypes.ValidateResponse{Error: err.Error()})
+		return
+	}
+
 	// Create a temporary downloader to validate the URL
 	downloader := core.NewDownloader(h.config.YtDlpPath, h.config.FfmpegPath, h.config.EnableHardwareAccel, h.config.OptimizeForLowPower)
 
 	// Check if this is a playlist URL
 	isPlaylist := downloader.IsPlaylistURL(request.URL)
 
-	response := map[string]interface{}{
-		"valid":       false,
-		"is_playlist": isPlaylist,
-	}
+	response := apitypes.ValidateResponse{IsPlaylist: isPlaylist}
 
 	if isPlaylist {
 		// Get playlist information
 		playlistItems, err := downloader.GetPlaylistItems(request.URL)
 		if err != nil {
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"valid":       false,
-				"error":       err.Error(),
-				"is_playlist": true,
-			})
+			json.NewEncoder(w).Encode(apitypes.ValidateResponse{Error: err.Error(), IsPlaylist: true})
 			return
 		}
 
@@ -336,13 +513,13 @@ func (h *Handler) ValidateURL(w http.ResponseWriter, r *http.Request) {
 			firstVideoInfo, _ = downloader.GetVideoInfo(firstVideoURL)
 		}
 
-		response["valid"] = true
-		response["playlist_count"] = len(playlistItems)
-		response["playlist_title"] = "Playlist"
+		response.Valid = true
+		response.PlaylistCount = len(playlistItems)
+		response.PlaylistTitle = "Playlist"
 		if len(playlistItems) > 0 {
-			response["first_video_title"] = playlistItems[0].Title
+			response.FirstVideoTitle = playlistItems[0].Title
 			if firstVideoInfo != nil {
-				response["first_video_title"] = firstVideoInfo.Title
+				response.FirstVideoTitle = firstVideoInfo.Title
 			}
 		}
 
@@ -365,10 +542,10 @@ func (h *Handler) ValidateURL(w http.ResponseWriter, r *http.Request) {
 			}
 
 			existingFile := h.downloadManager.CheckFileExistence(downloadReq)
-			response["first_video_exists"] = existingFile != ""
+			response.FirstVideoExists = existingFile != ""
 			if existingFile != "" {
-				response["existing_file"] = existingFile
-				response["existing_filename"] = filepath.Base(existingFile)
+				response.ExistingFile = existingFile
+				response.ExistingFilename = filepath.Base(existingFile)
 			}
 		}
 	} else {
@@ -376,11 +553,7 @@ func (h *Handler) ValidateURL(w http.ResponseWriter, r *http.Request) {
 		info, err := downloader.GetVideoInfo(request.URL)
 		if err != nil {
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"valid":       false,
-				"error":       err.Error(),
-				"is_playlist": false,
-			})
+			json.NewEncoder(w).Encode(apitypes.ValidateResponse{Error: err.Error()})
 			return
 		}
 
@@ -403,14 +576,14 @@ func (h *Handler) ValidateURL(w http.ResponseWriter, r *http.Request) {
 		// Check for existing file using the download manager's logic
 		existingFile := h.downloadManager.CheckFileExistence(downloadReq)
 
-		response["valid"] = true
-		response["title"] = info.Title
-		response["filename"] = info.Filename
-		response["file_exists"] = existingFile != ""
+		response.Valid = true
+		response.Title = info.Title
+		response.Filename = info.Filename
+		response.FileExists = existingFile != ""
 
 		if existingFile != "" {
-			response["existing_file"] = existingFile
-			response["existing_filename"] = filepath.Base(existingFile)
+			response.ExistingFile = existingFile
+			response.ExistingFilename = filepath.Base(existingFile)
 		}
 	}
 
@@ -432,6 +605,10 @@ func (h *Handler) DeleteDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.authorizeDownload(w, r, id, true) {
+		return
+	}
+
 	if err := h.downloadManager.RemoveDownload(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -454,13 +631,17 @@ func (h *Handler) CancelDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.authorizeDownload(w, r, id, true) {
+		return
+	}
+
 	if err := h.downloadManager.CancelDownload(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "cancelled"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "cancelled"})
 }
 
 func (h *Handler) PauseDownload(w http.ResponseWriter, r *http.Request) {
@@ -477,13 +658,17 @@ func (h *Handler) PauseDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.authorizeDownload(w, r, id, true) {
+		return
+	}
+
 	if err := h.downloadManager.PauseDownload(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "paused"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "paused"})
 }
 
 func (h *Handler) ResumeDownload(w http.ResponseWriter, r *http.Request) {
@@ -500,13 +685,17 @@ func (h *Handler) ResumeDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.authorizeDownload(w, r, id, true) {
+		return
+	}
+
 	if err := h.downloadManager.ResumeDownload(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "resumed"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "resumed"})
 }
 
 func (h *Handler) RetryDownload(w http.ResponseWriter, r *http.Request) {
@@ -523,13 +712,17 @@ func (h *Handler) RetryDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.authorizeDownload(w, r, id, true) {
+		return
+	}
+
 	if err := h.downloadManager.RetryDownload(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "retried"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "retried"})
 }
 
 func (h *Handler) ClearAllQueued(w http.ResponseWriter, r *http.Request) {
@@ -538,13 +731,13 @@ func (h *Handler) ClearAllQueued(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.downloadManager.ClearAllQueued(); err != nil {
+	if err := h.downloadManager.ClearAllQueued(h.ownerFilter(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "cleared", "message": "All queued downloads cleared"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "cleared", Message: "All queued downloads cleared"})
 }
 
 func (h *Handler) DeleteAllCompleted(w http.ResponseWriter, r *http.Request) {
@@ -553,13 +746,13 @@ func (h *Handler) DeleteAllCompleted(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.downloadManager.DeleteAllCompleted(); err != nil {
+	if err := h.downloadManager.DeleteAllCompleted(h.ownerFilter(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "message": "All completed downloads and files deleted"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "deleted", Message: "All completed downloads and files deleted"})
 }
 
 func (h *Handler) ClearAllFailed(w http.ResponseWriter, r *http.Request) {
@@ -568,13 +761,157 @@ func (h *Handler) ClearAllFailed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.downloadManager.ClearAllFailed(); err != nil {
+	if err := h.downloadManager.ClearAllFailed(h.ownerFilter(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "cleared", "message": "All failed downloads cleared"})
+	json.NewEncoder(w).Encode(apitypes.StatusResponse{Status: "cleared", Message: "All failed downloads cleared"})
+}
+
+// snapshot returns a copy of a download the manager may still be changing,
+// so it can be encoded safely. Downloads that are gone are returned as is.
+func (h *Handler) snapshot(download *core.Download) *core.Download {
+	if downloads := h.downloadManager.Snapshot(download.ID); len(downloads) > 0 {
+		return downloads[0]
+	}
+	return download
+}
+
+// writeAddDownloadError writes the response for an error from adding a
+// download
+func writeAddDownloadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, manager.ErrQuotaExceeded) {
+		writeError(w, r, http.StatusForbidden, apitypes.CodeQuotaExceeded, err.Error())
+		return
+	}
+	if errors.Is(err, manager.ErrExternalIDInUse) {
+		writeError(w, r, http.StatusConflict, apitypes.CodeExternalIDInUse, err.Error())
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, "", err.Error())
+}
+
+// GetUsage reports the signed-in user's downloads and storage against their quota
+func (h *Handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUsage(h.downloadManager.GetUsage(h.requestUsername(r))))
+}
+
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newScheduleStatus(h.downloadManager.GetScheduleStatus()))
+}
+
+// GetDownloadLog returns the captured yt-dlp/ffmpeg output of a download.
+// With ?follow=1 the log is streamed as server-sent events until the download
+// stops running; ?format=text returns plain text instead of JSON.
+func (h *Handler) GetDownloadLog(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		http.Error(w, "Download ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.authorizeDownload(w, r, id, false) {
+		return
+	}
+
+	if r.URL.Query().Get("follow") == "1" || r.URL.Query().Get("follow") == "true" {
+		h.streamDownloadLog(w, r, id)
+		return
+	}
+
+	downloadLog, err := h.downloadManager.GetDownloadLog(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range downloadLog.Lines {
+			fmt.Fprintf(w, "%s [%s] %s\n", line.Time.Format(time.RFC3339), line.Stream, line.Text)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newDownloadLog(downloadLog))
+}
+
+// streamDownloadLog sends the existing log lines followed by new ones as
+// server-sent events. An "end" event is sent when the download stops running.
+func (h *Handler) streamDownloadLog(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	downloadLog, lines, cancel, err := h.downloadManager.SubscribeDownloadLog(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeEvent := func(event string, payload interface{}) {
+		data, _ := json.Marshal(payload)
+		if event != "" {
+			fmt.Fprintf(w, "event: %s\n", event)
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+
+	if len(downloadLog.Command) > 0 {
+		writeEvent("command", downloadLog.Command)
+	}
+	for _, line := range downloadLog.Lines {
+		writeEvent("", newLogLine(line))
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case line, ok := <-lines:
+			if !ok {
+				writeEvent("end", map[string]string{"id": id})
+				flusher.Flush()
+				return
+			}
+			writeEvent("", newLogLine(line))
+			flusher.Flush()
+		}
+	}
 }
 
 func (h *Handler) GetUpdateInfo(w http.ResponseWriter, r *http.Request) {
@@ -590,7 +927,7 @@ func (h *Handler) GetUpdateInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updateInfo)
+	json.NewEncoder(w).Encode(newUpdateInfo(updateInfo))
 }
 
 func (h *Handler) UpdateYtDlp(w http.ResponseWriter, r *http.Request) {
@@ -605,9 +942,9 @@ func (h *Handler) UpdateYtDlp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return success response
-	response := map[string]string{
-		"status":  "success",
-		"message": "yt-dlp updated successfully",
+	response := apitypes.StatusResponse{
+		Status:  "success",
+		Message: "yt-dlp updated successfully",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -617,7 +954,7 @@ func (h *Handler) UpdateYtDlp(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetVersions(w http.ResponseWriter, r *http.Request) {
 	versions := core.GetVersionInfo(h.config.YtDlpPath, h.config.FfmpegPath)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(versions)
+	json.NewEncoder(w).Encode(newVersionInfo(versions))
 }
 
 func (h *Handler) CheckFfmpeg(w http.ResponseWriter, r *http.Request) {
@@ -644,12 +981,12 @@ func (h *Handler) CheckFfmpeg(w http.ResponseWriter, r *http.Request) {
 		version = versions.FfmpegVersion
 	}
 	
-	response := map[string]interface{}{
-		"available":       available,
-		"version":         version,
-		"configured_path": configuredPath,
-		"actual_path":     actualPath,
-		"path":            actualPath, // For backward compatibility
+	response := apitypes.FfmpegStatus{
+		Available:      available,
+		Version:        version,
+		ConfiguredPath: configuredPath,
+		ActualPath:     actualPath,
+		Path:           actualPath, // For backward compatibility
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -670,12 +1007,17 @@ func (h *Handler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	download, exists := h.downloadManager.GetDownload(id)
-	if !exists {
+	if !h.authorizeDownload(w, r, id, false) {
+		return
+	}
+
+	downloads := h.downloadManager.Snapshot(id)
+	if len(downloads) == 0 {
 		http.Error(w, "Download not found", http.StatusNotFound)
 		return
 	}
 
+	download := downloads[0]
 	if download.Status != core.StatusCompleted {
 		http.Error(w, fmt.Sprintf("Download not completed (status: %s)", download.Status), http.StatusBadRequest)
 		return
@@ -2,16 +2,33 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/backup"
 	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
 func TestGetConfig(t *testing.T) {
 	cfg := config.DefaultConfig()
-	handler := NewHandler(cfg, "test_config.json", nil, nil)
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
 
 	req := httptest.NewRequest("GET", "/api/config", nil)
 	w := httptest.NewRecorder()
@@ -32,9 +49,88 @@ func TestGetConfig(t *testing.T) {
 	}
 }
 
+func TestUpdateConfigLockedSettings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_api_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	handler := NewHandler(cfg, filepath.Join(tempDir, "config.json"), nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	handler.UpdateConfig(w, httptest.NewRequest("POST", "/api/config", strings.NewReader(`{"yt_dlp_path": "/bin/sh"}`)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected changing yt_dlp_path to be refused, got %d", w.Code)
+	}
+	if handler.config.YtDlpPath == "/bin/sh" {
+		t.Error("Locked setting was changed")
+	}
+
+	// Settings left out of the request keep their values
+	w = httptest.NewRecorder()
+	handler.UpdateConfig(w, httptest.NewRequest("POST", "/api/config", strings.NewReader(`{"max_concurrent_downloads": 5}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected runtime setting change to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if handler.config.MaxConcurrentDownloads != 5 || handler.config.DownloadPath != tempDir {
+		t.Errorf("Unexpected config after update: %+v", handler.config)
+	}
+
+	var response struct {
+		Locked []string `json:"locked"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Locked) == 0 {
+		t.Error("Expected locked settings in the response")
+	}
+}
+
+func TestUpdateConfigLeavesCurrentConfigAlone(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_api_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	cfg.LockedSettings = []string{"download_path", "yt_dlp_path", "ffmpeg_path"}
+	cfg.DownloadWindows = []config.ScheduleWindow{{Start: "01:00", End: "05:00"}}
+	ytDlpPath := cfg.YtDlpPath
+	handler := NewHandler(cfg, filepath.Join(tempDir, "config.json"), nil, nil, nil)
+
+	// Unlocking a setting and changing it in the same request
+	w := httptest.NewRecorder()
+	handler.UpdateConfig(w, httptest.NewRequest("POST", "/api/config", strings.NewReader(`{"locked_settings": ["port", "port", "port"], "yt_dlp_path": "/tmp/evil"}`)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected changing locked_settings and yt_dlp_path to be refused, got %d", w.Code)
+	}
+	if handler.config.YtDlpPath != ytDlpPath {
+		t.Error("Locked setting was changed")
+	}
+	if got := handler.config.LockedSettings; len(got) != 3 || got[0] != "download_path" || got[1] != "yt_dlp_path" {
+		t.Errorf("Refused request changed locked_settings to %v", got)
+	}
+
+	// An invalid request changes nothing
+	w = httptest.NewRecorder()
+	handler.UpdateConfig(w, httptest.NewRequest("POST", "/api/config", strings.NewReader(`{"download_windows": [{"start": "02:00", "end": "03:00"}], "max_concurrent_downloads": -5}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid config to be refused, got %d", w.Code)
+	}
+	if got := handler.config.DownloadWindows; len(got) != 1 || got[0].Start != "01:00" {
+		t.Errorf("Refused request changed download_windows to %v", got)
+	}
+}
+
 func TestStartDownload(t *testing.T) {
 	cfg := config.DefaultConfig()
-	handler := NewHandler(cfg, "test_config.json", nil, nil)
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
 
 	requestBody := map[string]string{
 		"url":     "https://example.com/video",
@@ -58,7 +154,7 @@ func TestStartDownload(t *testing.T) {
 
 func TestStartDownloadInvalidJSON(t *testing.T) {
 	cfg := config.DefaultConfig()
-	handler := NewHandler(cfg, "test_config.json", nil, nil)
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
 
 	req := httptest.NewRequest("POST", "/api/downloads", bytes.NewBuffer([]byte("invalid json")))
 	req.Header.Set("Content-Type", "application/json")
@@ -73,7 +169,7 @@ func TestStartDownloadInvalidJSON(t *testing.T) {
 
 func TestStartDownloadMissingURL(t *testing.T) {
 	cfg := config.DefaultConfig()
-	handler := NewHandler(cfg, "test_config.json", nil, nil)
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
 
 	requestBody := map[string]string{
 		"type":    "video",
@@ -93,9 +189,24 @@ func TestStartDownloadMissingURL(t *testing.T) {
 	}
 }
 
+func TestStartDownloadUnsupportedScheme(t *testing.T) {
+	cfg := config.DefaultConfig()
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
+
+	for _, url := range []string{"file:///etc/passwd", "ftp://example.com/video.mp4", "-o/tmp/x"} {
+		body, _ := json.Marshal(map[string]string{"url": url, "type": "video", "quality": "720p", "format": "mp4"})
+		req := httptest.NewRequest("POST", "/api/downloads", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.StartDownload(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", url, w.Code)
+		}
+	}
+}
+
 func TestGetDownloads(t *testing.T) {
 	cfg := config.DefaultConfig()
-	handler := NewHandler(cfg, "test_config.json", nil, nil)
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
 
 	req := httptest.NewRequest("GET", "/api/downloads", nil)
 	w := httptest.NewRecorder()
@@ -107,9 +218,541 @@ func TestGetDownloads(t *testing.T) {
 	}
 }
 
+func TestGetDownloadsQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+	for i, downloadType := range []core.DownloadType{core.VideoDownload, core.AudioDownload, core.VideoDownload, core.VideoDownload, core.AudioDownload} {
+		_, err := dm.AddDownload(core.DownloadRequest{URL: fmt.Sprintf("https://example.com/watch?v=%d", i), Type: downloadType, Quality: "best", Format: "mov", OutputDir: tempDir})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+	}
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", dm, nil, nil), fstest.MapFS{})
+
+	get := func(path string) (*httptest.ResponseRecorder, apitypes.DownloadList) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var list apitypes.DownloadList
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+				t.Fatalf("GET %s: failed to decode response: %v", path, err)
+			}
+		}
+		return w, list
+	}
+
+	// Pages of two videos, until the cursor runs out
+	seen := map[string]bool{}
+	path := "/api/v1/downloads?type=video&sort=created_at&limit=2"
+	for pages := 0; ; pages++ {
+		w, list := get(path)
+		if w.Code != http.StatusOK || list.Total != 3 || len(list.Downloads) > 2 {
+			t.Fatalf("GET %s: unexpected page %d, %+v", path, w.Code, list)
+		}
+		for _, download := range list.Downloads {
+			if download.Type != apitypes.VideoDownload || seen[download.ID] {
+				t.Errorf("Unexpected or repeated download %s (%s)", download.ID, download.Type)
+			}
+			seen[download.ID] = true
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("Pagination does not end")
+		}
+		path = "/api/v1/downloads?type=video&sort=created_at&limit=2&cursor=" + list.NextCursor
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected all 3 videos across pages, got %d", len(seen))
+	}
+
+	if _, list := get("/api/v1/downloads?q=v%3D4&status=queued,scheduled"); list.Total != 1 || list.Downloads[0].URL != "https://example.com/watch?v=4" {
+		t.Errorf("Expected a single match for the search, got %+v", list)
+	}
+	for _, bad := range []string{"?sort=owner", "?status=unknown", "?limit=0", "?since=yesterday", "?cursor=bogus"} {
+		if w, _ := get("/api/v1/downloads" + bad); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status 400, got %d", bad, w.Code)
+		}
+	}
+
+	// The legacy path returns a plain array with the total in a header
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/downloads?limit=1", nil))
+	var downloads []*core.Download
+	if err := json.NewDecoder(w.Body).Decode(&downloads); err != nil || len(downloads) != 1 {
+		t.Errorf("Expected an array of one download, got %v", err)
+	}
+	if w.Header().Get("X-Total-Count") != "5" || w.Header().Get("X-Next-Cursor") == "" {
+		t.Errorf("Expected total and cursor headers, got %v", w.Header())
+	}
+}
+
+func TestGetDownloadsChanges(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		download, err := dm.AddDownload(core.DownloadRequest{URL: fmt.Sprintf("https://example.com/watch?v=%d", i), Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		ids = append(ids, download.ID)
+	}
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", dm, nil, nil), fstest.MapFS{})
+
+	get := func(path, etag string) (*httptest.ResponseRecorder, apitypes.DownloadList) {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var list apitypes.DownloadList
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&list)
+		}
+		return w, list
+	}
+
+	w, full := get("/api/v1/downloads", "")
+	etag := w.Header().Get("ETag")
+	if full.Delta || len(full.Downloads) != 3 || full.Revision == 0 || etag == "" {
+		t.Fatalf("Expected a full list with revision and ETag, got %+v, %q", full, etag)
+	}
+
+	// Nothing changed: 304
+	if w, _ := get("/api/v1/downloads", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged list, got %d", w.Code)
+	}
+	since := fmt.Sprintf("/api/v1/downloads?since=%d", full.Revision)
+	if _, delta := get(since, ""); !delta.Delta || len(delta.Downloads) != 0 || len(delta.Removed) != 0 {
+		t.Errorf("Expected an empty delta, got %+v", delta)
+	}
+
+	dm.PauseDownload(ids[0])
+	dm.RemoveDownload(ids[1])
+	if w, _ := get("/api/v1/downloads", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected the changed list after a change, got %d", w.Code)
+	}
+	_, delta := get(since, "")
+	if !delta.Delta || len(delta.Downloads) != 1 || delta.Downloads[0].ID != ids[0] || delta.Revision <= full.Revision {
+		t.Errorf("Expected the paused download in the delta, got %+v", delta)
+	}
+	if len(delta.Removed) != 1 || delta.Removed[0] != ids[1] {
+		t.Errorf("Expected the removed download in the delta, got %v", delta.Removed)
+	}
+
+	// A changed download that no longer matches the filter is removed from
+	// the client's view
+	if _, delta := get(since+"&status=queued", ""); len(delta.Downloads) != 0 || len(delta.Removed) != 2 {
+		t.Errorf("Expected the paused download to leave the queued list, got %+v", delta)
+	}
+
+	// Unknown revisions get the full list
+	if _, list := get("/api/v1/downloads?since=1", ""); list.Delta || len(list.Downloads) != 2 {
+		t.Errorf("Expected a full list for an old revision, got %+v", list)
+	}
+}
+
+func TestBulkAction(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+	var ids []string
+	for _, url := range []string{"https://example.com/watch?v=1", "https://example.com/watch?v=2", "https://other.org/video"} {
+		download, err := dm.AddDownload(core.DownloadRequest{URL: url, Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		ids = append(ids, download.ID)
+	}
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", dm, nil, nil), fstest.MapFS{})
+
+	bulk := func(body string) (*httptest.ResponseRecorder, apitypes.BulkResponse) {
+		req := httptest.NewRequest("POST", "/api/v1/downloads/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response apitypes.BulkResponse
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&response)
+		}
+		return w, response
+	}
+
+	// By filter: only the queued downloads from example.com
+	w, response := bulk(`{"action": "pause", "filter": "status=queued&q=example.com"}`)
+	if w.Code != http.StatusOK || response.Succeeded != 2 || response.Failed != 0 || len(response.Results) != 2 {
+		t.Fatalf("Expected two paused downloads, got %d %+v", w.Code, response)
+	}
+	if response.Results[0].ID != ids[0] || response.Results[1].ID != ids[1] {
+		t.Errorf("Expected the oldest download first, got %+v", response.Results)
+	}
+
+	// By ID, with a result per download
+	_, response = bulk(fmt.Sprintf(`{"action": "resume", "ids": [%q, %q, "missing"]}`, ids[0], ids[2]))
+	if response.Succeeded != 1 || response.Failed != 2 || !response.Results[0].OK ||
+		response.Results[1].Error == "" || response.Results[2].Error != "download not found" {
+		t.Errorf("Expected one resumed and two failed downloads, got %+v", response)
+	}
+
+	_, response = bulk(`{"action": "change-priority", "priority": 3, "filter": "q=other.org"}`)
+	if downloads := dm.Snapshot(ids[2]); response.Succeeded != 1 || downloads[0].Priority != 3 {
+		t.Errorf("Expected the priority to change, got %+v", response)
+	}
+
+	for _, body := range []string{
+		`{"action": "pause"}`,
+		`{"action": "explode", "ids": ["x"]}`,
+		`{"action": "pause", "ids": ["x"], "filter": "status=queued"}`,
+		`{"action": "pause", "filter": "sort=title"}`,
+		`{"action": "pause", "filter": "since=5"}`,
+		`{"action": "move-destination", "destination": "../elsewhere", "ids": ["x"]}`,
+	} {
+		w, _ := bulk(body)
+		var apiError apitypes.Error
+		json.NewDecoder(w.Body).Decode(&apiError)
+		if w.Code != http.StatusBadRequest || apiError.Message == "" {
+			t.Errorf("Expected 400 with a message for %s, got %d %+v", body, w.Code, apiError)
+		}
+	}
+}
+
+func TestIdempotentSubmission(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", dm, nil, nil), fstest.MapFS{})
+
+	submit := func(body, key string) (*httptest.ResponseRecorder, apitypes.Download) {
+		req := httptest.NewRequest("POST", "/api/v1/downloads", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var download apitypes.Download
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&download)
+		}
+		return w, download
+	}
+
+	body := `{"url": "https://example.com/watch?v=1", "type": "video", "quality": "best", "format": "mov", "external_id": "job-1"}`
+	w, first := submit(body, "")
+	if w.Code != http.StatusOK || first.ExternalID != "job-1" || w.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("Expected a new download with the external ID, got %d %+v", w.Code, first)
+	}
+
+	// A retry with other settings returns the same download
+	w, again := submit(`{"url": "https://example.com/watch?v=1", "type": "video", "quality": "720p", "format": "mov", "external_id": "job-1"}`, "")
+	if w.Code != http.StatusOK || again.ID != first.ID || w.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("Expected the existing download, got %d %+v", w.Code, again)
+	}
+	if downloads, _ := dm.Query(manager.Filter{}, manager.Sort{Field: "created_at"}); len(downloads) != 1 {
+		t.Errorf("Expected one download, got %d", len(downloads))
+	}
+
+	// The header works like external_id
+	_, keyed := submit(`{"url": "https://example.com/watch?v=2", "type": "video", "quality": "best", "format": "mov"}`, "job-2")
+	if _, replayed := submit(`{"url": "https://example.com/watch?v=2", "type": "video", "quality": "best", "format": "mov"}`, "job-2"); keyed.ExternalID != "job-2" || replayed.ID != keyed.ID {
+		t.Errorf("Expected the Idempotency-Key to return the same download, got %+v and %+v", keyed, replayed)
+	}
+
+	// Reusing an ID for another URL is a conflict
+	w, _ = submit(`{"url": "https://example.com/watch?v=3", "type": "video", "quality": "best", "format": "mov", "external_id": "job-1"}`, "")
+	var apiError apitypes.Error
+	json.NewDecoder(w.Body).Decode(&apiError)
+	if w.Code != http.StatusConflict || apiError.Code != apitypes.CodeExternalIDInUse {
+		t.Errorf("Expected 409 for a reused external ID, got %d %+v", w.Code, apiError)
+	}
+	if w, _ := submit(body, "other"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when the header and external_id differ, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/downloads?external_id=job-1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var list apitypes.DownloadList
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.Total != 1 || list.Downloads[0].ID != first.ID {
+		t.Errorf("Expected the download of job-1, got %+v", list)
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		kind     string
+		urls     []string
+		lines    []int
+	}{
+		{"lines", "", "# watch later\nhttps://a.example/1\n\n  https://a.example/2  \n", apitypes.ImportText, []string{"https://a.example/1", "https://a.example/2"}, []int{2, 4}},
+		{"csv", "", "url,type,preset\nhttps://a.example/1,audio,\n\"https://a.example/2\",,720p\n", apitypes.ImportCSV, []string{"https://a.example/1", "https://a.example/2"}, []int{2, 3}},
+		{"csv without header", "list.csv", "https://a.example/1,video,720p,mp4\n", apitypes.ImportCSV, []string{"https://a.example/1"}, []int{1}},
+		{"bookmarks", "", "<!DOCTYPE NETSCAPE-Bookmark-file-1>\n<DL><p>\n<DT><A HREF=\"https://a.example/1?a=1&amp;b=2\" ADD_DATE=\"1\">One</A>\n<DT><a href='https://a.example/2'>Two</a>\n</DL>", apitypes.ImportBookmarks, []string{"https://a.example/1?a=1&b=2", "https://a.example/2"}, []int{3, 4}},
+		{"opml", "", "<?xml version=\"1.0\"?>\n<opml version=\"2.0\"><body>\n<outline text=\"Channels\">\n<outline type=\"rss\" xmlUrl=\"https://a.example/feed\" htmlUrl=\"https://a.example/channel\"/>\n<outline type=\"rss\" xmlUrl=\"https://a.example/podcast.xml\"/>\n</outline></body></opml>", apitypes.ImportOPML, []string{"https://a.example/channel", "https://a.example/podcast.xml"}, []int{4, 5}},
+	}
+	for _, tt := range tests {
+		kind := detectImportKind(tt.filename, tt.content)
+		if kind != tt.kind {
+			t.Errorf("%s: expected kind %s, got %s", tt.name, tt.kind, kind)
+			continue
+		}
+		entries, err := parseImport(kind, tt.content)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(entries) != len(tt.urls) {
+			t.Errorf("%s: expected %d entries, got %+v", tt.name, len(tt.urls), entries)
+			continue
+		}
+		for i, entry := range entries {
+			if entry.url != tt.urls[i] || entry.line != tt.lines[i] {
+				t.Errorf("%s: expected %s on line %d, got %s on line %d", tt.name, tt.urls[i], tt.lines[i], entry.url, entry.line)
+			}
+		}
+	}
+
+	entries, _ := parseImport(apitypes.ImportCSV, "url,type,preset\nhttps://a.example/1,audio,\n")
+	if entries[0].Type != "audio" || entries[0].Preset != "" {
+		t.Errorf("Expected the columns of the header, got %+v", entries[0])
+	}
+	if _, err := parseImport(apitypes.ImportCSV, "url,colour\nhttps://a.example/1,red\n"); err == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+}
+
+func TestImportDownloads(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+	if _, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/watch?v=1", Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir}); err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", dm, nil, nil), fstest.MapFS{})
+
+	send := func(path, contentType, body string) (*httptest.ResponseRecorder, apitypes.ImportResponse) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response apitypes.ImportResponse
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&response)
+		}
+		return w, response
+	}
+
+	csv := "url,quality,format,destination\n" +
+		"https://example.com/watch?v=1,best,mov,\n" + // already in the list
+		"https://example.com/watch?v=2,720p,mov,shows\n" +
+		"https://example.com/watch?v=2,720p,mov,shows\n" + // listed twice
+		"file:///etc/passwd,,,\n" +
+		"https://example.com/watch?v=3,,mov,../outside\n"
+	w, response := send("/api/v1/import?filename=urls.csv", "text/csv", csv)
+	if w.Code != http.StatusOK || response.Kind != apitypes.ImportCSV || response.Accepted != 1 || response.Duplicates != 2 || response.Rejected != 2 {
+		t.Fatalf("Expected 1 accepted, 2 duplicate and 2 rejected entries, got %d %+v", w.Code, response)
+	}
+	accepted := response.Entries[1]
+	if accepted.Status != apitypes.ImportAccepted || accepted.Line != 3 || response.Entries[2].DownloadID != accepted.DownloadID {
+		t.Errorf("Expected the second row to be added once, got %+v", response.Entries)
+	}
+	if downloads := dm.Snapshot(accepted.DownloadID); len(downloads) == 0 || downloads[0].Quality != "720p" || downloads[0].Destination != "shows" {
+		t.Errorf("Expected the settings of the row, got %+v", downloads)
+	}
+
+	// JSON with defaults for the entries
+	w, response = send("/api/v1/import", "application/json", `{"content": "https://example.com/watch?v=4\n", "preset": "720p", "format": "mov"}`)
+	if w.Code != http.StatusOK || response.Accepted != 1 {
+		t.Fatalf("Expected the entry to be added, got %d %+v", w.Code, response)
+	}
+	if downloads := dm.Snapshot(response.Entries[0].DownloadID); downloads[0].Quality != "720p" || downloads[0].Format != "mov" {
+		t.Errorf("Expected the preset and format of the import, got %+v", downloads[0])
+	}
+
+	for _, tt := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"content": "# nothing here\n"}`},
+		{"application/json", `{"content": "https://example.com/x", "preset": "8k"}`},
+		{"application/json", `{"content": "https://example.com/x", "kind": "pdf"}`},
+		{"application/json", fmt.Sprintf(`{"content": %q}`, strings.Repeat("https://example.com/x\n", maxImportEntries+1))},
+	} {
+		if w, _ := send("/api/v1/import", tt.contentType, tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %.60s, got %d", tt.body, w.Code)
+		}
+	}
+	if w, _ := send("/api/v1/import", "text/plain", "https://example.com/x"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for text/plain, got %d", w.Code)
+	}
+}
+
+func TestExportDownloads(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+	for _, request := range []core.DownloadRequest{
+		{URL: "https://example.com/watch?v=1", Type: core.VideoDownload, ExternalID: "=HYPERLINK(1)"},
+		{URL: "https://example.com/watch?v=2", Type: core.AudioDownload, Destination: "music"},
+	} {
+		request.Quality, request.Format, request.OutputDir = "best", "mov", tempDir
+		if _, err := dm.AddDownload(request); err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+	}
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", dm, nil, nil), fstest.MapFS{})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/export?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := export("format=csv")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if w.Code != http.StatusOK || err != nil || len(records) != 3 {
+		t.Fatalf("Expected a header and two rows, got %d %v %v", w.Code, records, err)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") || !strings.Contains(w.Header().Get("Content-Disposition"), ".csv") {
+		t.Errorf("Expected a CSV attachment, got %v", w.Header())
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"url", "output_path", "file_size", "sha256", "destination"} {
+		if _, exists := columns[name]; !exists {
+			t.Errorf("Expected a %s column, got %v", name, records[0])
+		}
+	}
+	if records[1][columns["url"]] != "https://example.com/watch?v=1" || records[2][columns["destination"]] != "music" {
+		t.Errorf("Expected the downloads oldest first, got %v", records[1:])
+	}
+	if got := records[1][columns["external_id"]]; got != "'=HYPERLINK(1)" {
+		t.Errorf("Expected formulas to be escaped, got %q", got)
+	}
+
+	// JSON lines with a filter
+	w = export("format=jsonl&type=audio")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var download apitypes.Download
+	if w.Code != http.StatusOK || len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &download) != nil || download.Type != apitypes.AudioDownload {
+		t.Errorf("Expected one audio download, got %d %s", w.Code, w.Body.String())
+	}
+
+	var downloads []apitypes.Download
+	if w = export(""); w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&downloads) != nil || len(downloads) != 2 {
+		t.Errorf("Expected a JSON array of both downloads, got %d", w.Code)
+	}
+
+	// Nothing more is written for a client that is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/api/v1/export?format=jsonl", nil).WithContext(ctx)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no downloads for a cancelled request, got %s", w.Body.String())
+	}
+
+	for _, query := range []string{"format=xml", "since=3", "status=done", "sort=colour"} {
+		if w := export(query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = filepath.Join(tempDir, "downloads")
+	if err := os.MkdirAll(cfg.DownloadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	dm := manager.NewDownloadManager(core.NewDownloader("/nonexistent/yt-dlp", "ffmpeg", false, false), 0, cfg.DownloadPath, cfg)
+	defer dm.Shutdown()
+	if _, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/watch?v=1", Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: cfg.DownloadPath}); err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	router := SetupRoutes(NewHandler(cfg, configPath, dm, nil, nil), fstest.MapFS{})
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/backup", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" || !strings.Contains(w.Header().Get("Content-Disposition"), ".tar.gz") {
+		t.Fatalf("Expected a gzip attachment, got %d %v", w.Code, w.Header())
+	}
+	archive := w.Body.Bytes()
+
+	restore := func(body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/admin/restore", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The backup is checked and staged, not restored while the server runs
+	w = restore(archive)
+	var response apitypes.RestoreResponse
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&response) != nil || response.Manifest.Downloads != 1 {
+		t.Fatalf("Expected the backup to be staged, got %d %s", w.Code, w.Body.String())
+	}
+	pending := filepath.Join(tempDir, ".gogetmedia_restore.tar.gz")
+	if data, err := os.ReadFile(pending); err != nil || !bytes.Equal(data, archive) {
+		t.Errorf("Expected the backup to be staged at %s: %v", pending, err)
+	}
+
+	if w := restore([]byte("not a backup")); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid backup, got %d", w.Code)
+	}
+
+	cancel := func() int {
+		req := httptest.NewRequest("DELETE", "/api/v1/admin/restore", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := cancel(); code != http.StatusOK {
+		t.Errorf("Expected the restore to be cancelled, got %d", code)
+	}
+	if _, err := os.Stat(pending); !os.IsNotExist(err) {
+		t.Error("Cancelled restore is still staged")
+	}
+	if code := cancel(); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a staged restore, got %d", code)
+	}
+}
+
 func TestDeleteDownload(t *testing.T) {
 	cfg := config.DefaultConfig()
-	handler := NewHandler(cfg, "test_config.json", nil, nil)
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
 
 	req := httptest.NewRequest("DELETE", "/api/downloads/123", nil)
 	w := httptest.NewRecorder()
@@ -120,3 +763,571 @@ func TestDeleteDownload(t *testing.T) {
 		t.Errorf("Expected status 500, got %d", w.Code)
 	}
 }
+
+func TestAuthMiddleware(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_api_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store, err := auth.NewStore(filepath.Join(tempDir, auth.UsersFileName))
+	if err != nil {
+		t.Fatalf("Failed to create auth store: %v", err)
+	}
+	password, err := store.Bootstrap("")
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	handler := NewHandler(cfg, filepath.Join(tempDir, "config.json"), nil, nil, store)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	protected := handler.authMiddleware(next)
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/api/downloads", http.StatusUnauthorized},
+		{"/api/v1/downloads", http.StatusUnauthorized},
+		{"/api/v1/auth/status", http.StatusOK},
+		{"/api/v1/openapi.json", http.StatusOK},
+		{"/", http.StatusSeeOther},
+		{"/login", http.StatusOK},
+		{"/assets/js/vue.min.js", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.expected {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.expected, w.Code)
+		}
+	}
+
+	// Logging in sets a session cookie that grants access
+	body := strings.NewReader(`{"username":"admin","password":"` + password + `"}`)
+	w := httptest.NewRecorder()
+	handler.Login(w, httptest.NewRequest("POST", "/api/auth/login", body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/api/downloads", nil)
+	req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	w = httptest.NewRecorder()
+	protected.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected authenticated request to pass, got %d", w.Code)
+	}
+
+	// With authentication disabled everything passes through
+	cfg.DisableAuth = true
+	w = httptest.NewRecorder()
+	protected.ServeHTTP(w, httptest.NewRequest("GET", "/api/downloads", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected request to pass with auth disabled, got %d", w.Code)
+	}
+}
+
+func TestCSRFProtection(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_csrf_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store, err := auth.NewStore(filepath.Join(tempDir, auth.UsersFileName))
+	if err != nil {
+		t.Fatalf("Failed to create auth store: %v", err)
+	}
+	password, err := store.Bootstrap("")
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	handler := NewHandler(cfg, filepath.Join(tempDir, "config.json"), nil, nil, store)
+	protected := handler.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	body := strings.NewReader(`{"username":"admin","password":"` + password + `"}`)
+	w := httptest.NewRecorder()
+	handler.Login(w, httptest.NewRequest("POST", "/api/auth/login", body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	cookie := w.Header().Get("Set-Cookie")
+	var login struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&login); err != nil || login.CSRFToken == "" {
+		t.Fatalf("Expected a CSRF token in the login response, got %v", err)
+	}
+
+	tests := []struct {
+		method   string
+		token    string
+		expected int
+	}{
+		{"GET", "", http.StatusOK},
+		{"POST", "", http.StatusForbidden},
+		{"POST", "wrong", http.StatusForbidden},
+		{"DELETE", "", http.StatusForbidden},
+		{"POST", login.CSRFToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/downloads/delete-completed", nil)
+		req.Header.Set("Cookie", cookie)
+		if tt.token != "" {
+			req.Header.Set(auth.CSRFHeader, tt.token)
+		}
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s with token %q: expected status %d, got %d", tt.method, tt.token, tt.expected, w.Code)
+		}
+	}
+
+	// Bearer tokens are not sent by browsers on their own and need no CSRF token
+	_, secret, err := store.CreateToken("admin", "script")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/api/downloads/delete-completed", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	req.Header.Set("Cookie", cookie)
+	w = httptest.NewRecorder()
+	protected.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected bearer request to pass without a CSRF token, got %d", w.Code)
+	}
+}
+
+func TestRequestGuardMiddleware(t *testing.T) {
+	handler := NewHandler(config.DefaultConfig(), "test_config.json", nil, nil, nil)
+	guarded := handler.requestGuardMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		expected    int
+	}{
+		{"json", "POST", "application/json", `{"url":"x"}`, http.StatusOK},
+		{"json with charset", "POST", "application/json; charset=utf-8", `{}`, http.StatusOK},
+		{"no body", "POST", "", "", http.StatusOK},
+		{"form", "POST", "application/x-www-form-urlencoded", "url=x", http.StatusUnsupportedMediaType},
+		{"text", "POST", "text/plain", `{"url":"x"}`, http.StatusUnsupportedMediaType},
+		{"body without type", "POST", "", `{"url":"x"}`, http.StatusUnsupportedMediaType},
+		{"too large", "POST", "application/json", strings.Repeat("x", maxRequestBodyBytes+1), http.StatusRequestEntityTooLarge},
+		{"get", "GET", "text/plain", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/downloads", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		guarded.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+
+	// Browsers send requests from other sites without a body, or a JSON body
+	// after a preflight. Only origins allowed by CORS get through.
+	handler.config.CORS.AllowedOrigins = []string{"https://allowed.example"}
+	crossSite := []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{"other client", nil, http.StatusOK},
+		{"same origin", map[string]string{"Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"same origin without fetch metadata", map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"typed address", map[string]string{"Sec-Fetch-Site": "none"}, http.StatusOK},
+		{"cross site", map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"cross site without origin", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same site", map[string]string{"Origin": "http://example.com:3000", "Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"cross site without fetch metadata", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"other scheme", map[string]string{"Origin": "https://example.com"}, http.StatusForbidden},
+		{"sandboxed", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"allowed origin", map[string]string{"Origin": "https://allowed.example", "Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+	}
+	for _, tt := range crossSite {
+		req := httptest.NewRequest("POST", "/api/downloads/delete-completed", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		guarded.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+	handler.config.CORS.AllowedOrigins = nil
+
+	// Imports also take files, but not as types forms can send
+	large := strings.Repeat("x", maxRequestBodyBytes+1)
+	imports := []struct {
+		contentType string
+		body        string
+		expected    int
+	}{
+		{"text/csv", "url\nhttps://example.com/x", http.StatusOK},
+		{"text/x-opml; charset=utf-8", "<opml/>", http.StatusOK},
+		{"text/csv", large, http.StatusOK},
+		{"text/plain", "https://example.com/x", http.StatusUnsupportedMediaType},
+		{"multipart/form-data; boundary=x", "--x--", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range imports {
+		req := httptest.NewRequest("POST", "/api/v1/import", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		guarded.ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("import as %s: expected status %d, got %d", tt.contentType, tt.expected, w.Code)
+		}
+	}
+	// Backups are restored from the archive itself, of any size
+	for contentType, expected := range map[string]int{"application/gzip": http.StatusOK, "application/octet-stream": http.StatusOK, "text/csv": http.StatusUnsupportedMediaType} {
+		req := httptest.NewRequest("POST", "/api/v1/admin/restore", strings.NewReader(large+large))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		guarded.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("restore as %s: expected status %d, got %d", contentType, expected, w.Code)
+		}
+	}
+	req := httptest.NewRequest("POST", "/api/v1/downloads", strings.NewReader("url\nhttps://example.com/x"))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	guarded.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for CSV outside of imports, got %d", w.Code)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RateLimit = config.RateLimitConfig{RequestsPerMinute: 60, Burst: 2, LoginAttemptsPerMinute: 1}
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
+	limited := handler.rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(method, path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		limited.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send("GET", "/api/downloads", "192.0.2.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200 within the burst, got %d", i+1, w.Code)
+		}
+	}
+	w := send("GET", "/api/downloads", "192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After after the burst, got %d", w.Code)
+	}
+	if w := send("GET", "/api/downloads", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected other clients to be unaffected, got %d", w.Code)
+	}
+	if w := send("GET", "/", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected the UI not to be rate limited, got %d", w.Code)
+	}
+
+	// Login attempts have their own limit
+	if w := send("POST", "/api/auth/login", "192.0.2.3:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected the first login attempt to pass, got %d", w.Code)
+	}
+	if w := send("POST", "/api/auth/login", "192.0.2.3:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second login attempt to be limited, got %d", w.Code)
+	}
+
+	// Tokens refill over time
+	limiter := newRateLimiter()
+	now := time.Now()
+	if ok, _ := limiter.allow("client", 60, 1, now); !ok {
+		t.Fatal("Expected the first request to pass")
+	}
+	if ok, wait := limiter.allow("client", 60, 1, now); ok || wait <= 0 {
+		t.Errorf("Expected the second request to wait, got %v, %v", ok, wait)
+	}
+	if ok, _ := limiter.allow("client", 60, 1, now.Add(time.Second)); !ok {
+		t.Error("Expected a token to be available after a second")
+	}
+}
+
+func TestProxyAndCORSMiddleware(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	cfg.CORS.AllowedOrigins = []string{"https://allowed.example"}
+	handler := NewHandler(cfg, "test_config.json", nil, nil, nil)
+
+	var seen *http.Request
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	})
+	chain := handler.proxyMiddleware(handler.corsMiddleware(next))
+
+	// Forwarded headers from a trusted proxy are applied
+	req := httptest.NewRequest("GET", "/api/downloads", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.9.9.9")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("Origin", "https://allowed.example")
+	w := httptest.NewRecorder()
+	chain.ServeHTTP(w, req)
+	if seen.RemoteAddr != "203.0.113.7:0" || seen.URL.Scheme != "https" {
+		t.Errorf("Expected forwarded client and scheme, got %s %q", seen.RemoteAddr, seen.URL.Scheme)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://allowed.example" {
+		t.Errorf("Expected allowed origin to be echoed, got %q", got)
+	}
+
+	// ...but ignored from anyone else
+	req = httptest.NewRequest("GET", "/api/downloads", nil)
+	req.RemoteAddr = "198.51.100.1:4567"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	chain.ServeHTTP(w, req)
+	if seen.RemoteAddr != "198.51.100.1:4567" {
+		t.Errorf("Expected untrusted forwarded header to be ignored, got %s", seen.RemoteAddr)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS header for other origins, got %q", got)
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+	handler := WithBasePath("/gogetmedia/", next)
+
+	tests := []struct {
+		path     string
+		expected int
+		body     string
+	}{
+		{"/gogetmedia", http.StatusMovedPermanently, ""},
+		{"/gogetmedia/api/downloads", http.StatusOK, "/api/downloads"},
+		{"/api/downloads", http.StatusOK, "/api/downloads"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.expected {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.expected, w.Code)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s: expected path %s, got %s", tt.path, tt.body, w.Body.String())
+		}
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", nil, nil, nil), fstest.MapFS{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Errors of /api/v1 are JSON with a code
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", "/api/v1/downloads", "", http.StatusInternalServerError, apitypes.CodeInternal},
+		{"POST", "/api/v1/downloads", "{invalid", http.StatusBadRequest, apitypes.CodeInvalidJSON},
+		{"POST", "/api/v1/downloads", `{"url":"file:///etc/passwd"}`, http.StatusBadRequest, apitypes.CodeInvalidURL},
+		{"GET", "/api/v1/unknown", "", http.StatusNotFound, apitypes.CodeNotFound},
+	}
+	for _, tt := range tests {
+		w := send(tt.method, tt.path, tt.body)
+		var apiError apitypes.Error
+		if err := json.NewDecoder(w.Body).Decode(&apiError); err != nil {
+			t.Errorf("%s %s: expected a JSON error, got %v", tt.method, tt.path, err)
+			continue
+		}
+		if w.Code != tt.status || apiError.Code != tt.code || apiError.Message == "" {
+			t.Errorf("%s %s: expected %d %s, got %d %+v", tt.method, tt.path, tt.status, tt.code, w.Code, apiError)
+		}
+	}
+
+	// The unversioned paths still work, are marked deprecated and keep
+	// their plain text errors
+	w := send("GET", "/api/downloads", "")
+	if w.Code != http.StatusInternalServerError || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected a plain text error from the legacy path, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Deprecation") != "true" || !strings.Contains(w.Header().Get("Link"), "</api/v1/downloads>") {
+		t.Errorf("Expected deprecation headers, got %v", w.Header())
+	}
+	if w := send("GET", "/api/v1/versions", ""); w.Header().Get("Deprecation") != "" {
+		t.Error("Expected /api/v1 not to be deprecated")
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	cfg := config.DefaultConfig()
+	router := SetupRoutes(NewHandler(cfg, "test_config.json", nil, nil, nil), fstest.MapFS{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var document struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&document); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	if !strings.HasPrefix(document.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got %q", document.OpenAPI)
+	}
+
+	// Every route of /api/v1 is described, and nothing else
+	documented := 0
+	for _, operations := range document.Paths {
+		documented += len(operations)
+	}
+	registered := 0
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, APIVersionPrefix+"/") {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			registered++
+			if _, ok := document.Paths[strings.TrimPrefix(path, APIVersionPrefix)][strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is not in the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if registered == 0 || registered != documented {
+		t.Errorf("Expected %d documented operations, got %d", registered, documented)
+	}
+
+	for _, name := range []string{"Download", "Error", "ConfigResponse"} {
+		if _, ok := document.Components.Schemas[name]; !ok {
+			t.Errorf("Expected a %s schema", name)
+		}
+	}
+}
+
+// TestAPITypesMatch checks that the types of pkg/apitypes encode like the
+// server types they are converted from, empty and with every field set
+func TestAPITypesMatch(t *testing.T) {
+	convert := func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case *core.Download:
+			return newDownload(value)
+		case *config.Config:
+			return newConfig(value)
+		case *manager.DownloadLog:
+			return newDownloadLog(value)
+		case *manager.Usage:
+			return newUsage(*value)
+		case *manager.ScheduleStatus:
+			return newScheduleStatus(*value)
+		case *core.UpdateInfo:
+			return newUpdateInfo(value)
+		case *core.VersionInfo:
+			return newVersionInfo(value)
+		case *backup.Manifest:
+			return newBackupManifest(*value)
+		}
+		t.Fatalf("No conversion for %T", value)
+		return nil
+	}
+
+	values := []interface{}{
+		&core.Download{}, &config.Config{}, &manager.DownloadLog{}, &manager.Usage{},
+		&manager.ScheduleStatus{}, &core.UpdateInfo{}, &core.VersionInfo{}, &backup.Manifest{},
+	}
+	for _, value := range values {
+		for _, filled := range []bool{false, true} {
+			if filled {
+				fillValue(reflect.ValueOf(value).Elem())
+			}
+			want, _ := json.Marshal(value)
+			got, _ := json.Marshal(convert(value))
+			if string(got) != string(want) {
+				t.Errorf("%T (filled: %v) encodes as\n%s\nexpected\n%s", value, filled, got, want)
+			}
+		}
+	}
+}
+
+// fillValue sets every exported field below v to a value that is not empty,
+// so that encoding v shows all of them
+func fillValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillValue(v.Elem())
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fillValue(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillValue(v.Index(0))
+	case reflect.Map:
+		key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fillValue(key)
+		fillValue(elem)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, elem)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float64:
+		v.SetFloat(1.5)
+	default:
+		panic("fillValue: unexpected kind " + v.Kind().String())
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gogetmedia/pkg/apitypes"
+)
+
+// IdempotencyKeyHeader makes adding a download safe to retry, like the
+// external_id of the request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ReplayedHeader is set on responses that return a download added by an
+// earlier request with the same external ID
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxExternalIDLength limits external IDs and idempotency keys
+const maxExternalIDLength = 255
+
+// requestExternalID returns the external ID of a request to add a download,
+// from the request body or the Idempotency-Key header
+func requestExternalID(r *http.Request, request apitypes.DownloadRequest) (string, error) {
+	id := request.ExternalID
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		if id != "" && id != key {
+			return "", fmt.Errorf("%s and external_id differ", IdempotencyKeyHeader)
+		}
+		id = key
+	}
+	if len(id) > maxExternalIDLength {
+		return "", fmt.Errorf("external_id is longer than %d characters", maxExternalIDLength)
+	}
+	return id, nil
+}
+
+// replayDownload answers a repeated request with the download the first one
+// added, if there is one. url is compared with the download's unless empty.
+func (h *Handler) replayDownload(w http.ResponseWriter, r *http.Request, id, url string) bool {
+	if id == "" {
+		return false
+	}
+	download, exists := h.downloadManager.FindByExternalID(h.requestUsername(r), id)
+	if !exists {
+		return false
+	}
+	if url != "" && download.URL != url {
+		writeError(w, r, http.StatusConflict, apitypes.CodeExternalIDInUse, "external ID is already used by a download of another URL")
+		return true
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newDownload(download))
+	return true
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+)
+
+// maxImportEntries limits the URLs of one import
+const maxImportEntries = 1000
+
+// maxImportBodyBytes limits the size of imports, which may be whole files
+const maxImportBodyBytes = 8 << 20
+
+// importPresets are the presets an import or an entry can name instead of
+// giving the type, quality and format
+var importPresets = map[string]importSettings{
+	"video": {Type: "video", Quality: "best"},
+	"audio": {Type: "audio", Quality: "best"},
+	"4k":    {Type: "video", Quality: "4K"},
+	"2k":    {Type: "video", Quality: "2K"},
+	"1080p": {Type: "video", Quality: "1080p"},
+	"720p":  {Type: "video", Quality: "720p"},
+	"480p":  {Type: "video", Quality: "480p"},
+	"360p":  {Type: "video", Quality: "360p"},
+	"mp3":   {Type: "audio", Format: "mp3"},
+	"m4a":   {Type: "audio", Format: "m4a"},
+	"flac":  {Type: "audio", Format: "flac"},
+	"wav":   {Type: "audio", Format: "wav"},
+}
+
+// ImportDownloads adds the URLs of a list, a CSV file, a bookmark export or an
+// OPML file and reports which entries were accepted, which were already in
+// the list and which were rejected. The content is sent either as an
+// ImportRequest or as the raw file, with the settings in the query.
+func (h *Handler) ImportDownloads(w http.ResponseWriter, r *http.Request) {
+	if h.downloadManager == nil {
+		http.Error(w, "Download manager not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	var req apitypes.ImportRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if kind, isFile := importMediaTypes[mediaType]; isFile {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		query := r.URL.Query()
+		req = apitypes.ImportRequest{
+			Content:     string(body),
+			Kind:        kind,
+			Filename:    query.Get("filename"),
+			Type:        query.Get("type"),
+			Quality:     query.Get("quality"),
+			Format:      query.Get("format"),
+			Preset:      query.Get("preset"),
+			Destination: query.Get("destination"),
+		}
+		if query.Get("kind") != "" {
+			req.Kind = query.Get("kind")
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, apitypes.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	kind := strings.ToLower(req.Kind)
+	if kind == "" {
+		kind = detectImportKind(req.Filename, req.Content)
+	}
+	entries, err := parseImport(kind, req.Content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "no URLs found", http.StatusBadRequest)
+		return
+	}
+	if len(entries) > maxImportEntries {
+		http.Error(w, fmt.Sprintf("import has %d entries, at most %d are allowed", len(entries), maxImportEntries), http.StatusBadRequest)
+		return
+	}
+
+	defaults, err := h.importDefaults(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	im := &importer{h: h, owner: h.requestUsername(r), defaults: defaults, added: make(map[string]string)}
+	response := apitypes.ImportResponse{Kind: kind, Entries: make([]apitypes.ImportEntry, 0, len(entries))}
+	for _, entry := range entries {
+		result := im.add(entry)
+		switch result.Status {
+		case apitypes.ImportAccepted:
+			response.Accepted++
+		case apitypes.ImportDuplicate:
+			response.Duplicates++
+		default:
+			response.Rejected++
+		}
+		response.Entries = append(response.Entries, result)
+	}
+	log.Printf("[API] Import (%s): %d accepted, %d duplicates, %d rejected", kind, response.Accepted, response.Duplicates, response.Rejected)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// importDefaults returns the settings of an import that apply to entries
+// without their own
+func (h *Handler) importDefaults(req apitypes.ImportRequest) (importSettings, error) {
+	defaults, err := applyImportPreset(importSettings{
+		Type:        strings.ToLower(strings.TrimSpace(req.Type)),
+		Quality:     strings.TrimSpace(req.Quality),
+		Format:      strings.ToLower(strings.TrimSpace(req.Format)),
+		Preset:      strings.TrimSpace(req.Preset),
+		Destination: req.Destination,
+	})
+	if err != nil {
+		return defaults, err
+	}
+	if defaults.Type != "" && !isDownloadType(defaults.Type) {
+		return defaults, fmt.Errorf("unknown type %q, expected video or audio", defaults.Type)
+	}
+	defaults.Destination, err = manager.CleanDestination(defaults.Destination)
+	return defaults, err
+}
+
+// applyImportPreset fills the settings that are not given from the preset
+func applyImportPreset(settings importSettings) (importSettings, error) {
+	if settings.Preset == "" {
+		return settings, nil
+	}
+	preset, exists := importPresets[strings.ToLower(settings.Preset)]
+	if !exists {
+		return settings, fmt.Errorf("unknown preset %q", settings.Preset)
+	}
+	if settings.Type == "" {
+		settings.Type = preset.Type
+	}
+	if settings.Quality == "" {
+		settings.Quality = preset.Quality
+	}
+	if settings.Format == "" && settings.Type == preset.Type {
+		settings.Format = preset.Format
+	}
+	return settings, nil
+}
+
+func isDownloadType(downloadType string) bool {
+	return downloadType == string(core.VideoDownload) || downloadType == string(core.AudioDownload)
+}
+
+// importer adds the entries of one import
+type importer struct {
+	h        *Handler
+	owner    string
+	defaults importSettings
+
+	// added maps the URL and settings of the entries added so far to their
+	// download, to report entries listed twice as duplicates
+	added map[string]string
+
+	ffmpegChecked   bool
+	ffmpegAvailable bool
+}
+
+// settings returns the settings of an entry, filled in from the defaults of
+// the import and the config
+func (im *importer) settings(entry importSettings) (importSettings, error) {
+	settings, err := applyImportPreset(entry)
+	if err != nil {
+		return settings, err
+	}
+
+	// A format given for the other type does not carry over
+	sameType := settings.Type == "" || settings.Type == im.defaults.Type
+	if settings.Type == "" {
+		settings.Type = im.defaults.Type
+	}
+	if settings.Quality == "" {
+		settings.Quality = im.defaults.Quality
+	}
+	if settings.Format == "" && sameType {
+		settings.Format = im.defaults.Format
+	}
+	if settings.Destination == "" {
+		settings.Destination = im.defaults.Destination
+	}
+
+	if settings.Type == "" {
+		settings.Type = string(core.VideoDownload)
+	}
+	if !isDownloadType(settings.Type) {
+		return settings, fmt.Errorf("unknown type %q, expected video or audio", settings.Type)
+	}
+	if settings.Quality == "" {
+		settings.Quality = "best"
+	}
+	if settings.Format == "" {
+		if settings.Type == string(core.AudioDownload) {
+			settings.Format = im.h.config.DefaultAudioFormat
+		} else {
+			settings.Format = im.h.config.DefaultVideoFormat
+		}
+	}
+	if len(settings.ExternalID) > maxExternalIDLength {
+		return settings, fmt.Errorf("external_id is longer than %d characters", maxExternalIDLength)
+	}
+	settings.Destination, err = manager.CleanDestination(settings.Destination)
+	return settings, err
+}
+
+// hasFfmpeg reports whether ffmpeg is available, checking once per import
+func (im *importer) hasFfmpeg() bool {
+	if !im.ffmpegChecked {
+		im.ffmpegAvailable = core.CheckFfmpegAvailable(im.h.config.FfmpegPath)
+		im.ffmpegChecked = true
+	}
+	return im.ffmpegAvailable
+}
+
+// add validates an entry and adds it like POST /downloads, or like POST
+// /downloads/playlist for playlist URLs
+func (im *importer) add(entry importEntry) apitypes.ImportEntry {
+	result := apitypes.ImportEntry{Line: entry.line, URL: entry.url, Status: apitypes.ImportRejected}
+	if entry.problem != "" {
+		result.Error = entry.problem
+		return result
+	}
+	if entry.url == "" {
+		result.Error = "URL is required"
+		return result
+	}
+	if err := core.ValidateMediaURL(entry.url); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	settings, err := im.settings(entry.importSettings)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	dm := im.h.downloadManager
+	if settings.ExternalID != "" {
+		if download, exists := dm.FindByExternalID(im.owner, settings.ExternalID); exists {
+			if download.URL != entry.url {
+				result.Error = "external ID is already used by a download of another URL"
+				return result
+			}
+			result.Status = apitypes.ImportDuplicate
+			result.DownloadID = download.ID
+			return result
+		}
+	}
+
+	key := strings.Join([]string{entry.url, settings.Type, settings.Quality, settings.Format}, "\x00")
+	if id, exists := im.added[key]; exists {
+		result.Status = apitypes.ImportDuplicate
+		result.Error = "listed more than once with the same quality and format"
+		result.DownloadID = id
+		return result
+	}
+
+	downloadType := core.DownloadType(settings.Type)
+	if core.RequiresFfmpeg(downloadType, settings.Format) && !im.hasFfmpeg() {
+		result.Error = "ffmpeg is required for this download format but is not available"
+		return result
+	}
+
+	req := core.DownloadRequest{
+		URL:         entry.url,
+		Type:        downloadType,
+		Quality:     settings.Quality,
+		Format:      settings.Format,
+		OutputDir:   im.h.config.DownloadPath,
+		Owner:       im.owner,
+		ExternalID:  settings.ExternalID,
+		Destination: settings.Destination,
+	}
+	var download *core.Download
+	if dm.IsPlaylistURL(entry.url) {
+		if settings.ExternalID != "" {
+			result.Error = "external_id is not supported for playlists"
+			return result
+		}
+		result.Playlist = true
+		download, err = dm.AddPlaylistDownload(req)
+	} else {
+		download, err = dm.AddDownload(req)
+	}
+
+	switch {
+	case errors.Is(err, manager.ErrDuplicate):
+		result.Status = apitypes.ImportDuplicate
+		result.Error = err.Error()
+		im.added[key] = ""
+	case err != nil:
+		result.Error = err.Error()
+	default:
+		result.Status = apitypes.ImportAccepted
+		result.DownloadID = download.ID
+		im.added[key] = download.ID
+	}
+	return result
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gogetmedia/pkg/apitypes"
+)
+
+// importMediaTypes are the media types an import can be sent as besides JSON,
+// with the kind they stand for; "" means the kind is detected from the content
+var importMediaTypes = map[string]string{
+	"text/uri-list":            apitypes.ImportText,
+	"text/csv":                 apitypes.ImportCSV,
+	"text/html":                apitypes.ImportBookmarks,
+	"text/x-opml":              apitypes.ImportOPML,
+	"application/xml":          "",
+	"text/xml":                 "",
+	"application/octet-stream": "",
+}
+
+// importContentTypes returns the media types of importMediaTypes in order
+func importContentTypes() []string {
+	types := make([]string, 0, len(importMediaTypes))
+	for mediaType := range importMediaTypes {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// importSettings are the download settings of an import or of one entry.
+// Empty fields are taken from the import.
+type importSettings struct {
+	Type        string
+	Quality     string
+	Format      string
+	Preset      string
+	Destination string
+	ExternalID  string
+}
+
+// importEntry is a URL read from imported content. problem is set when the
+// entry could not be read.
+type importEntry struct {
+	line    int
+	url     string
+	problem string
+	importSettings
+}
+
+// importColumns are the columns of a CSV import without a header row
+var importColumns = []string{"url", "type", "quality", "format", "preset", "destination", "external_id"}
+
+// bookmarkLinkPattern matches the links of a bookmark export
+var bookmarkLinkPattern = regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// detectImportKind guesses the kind of imported content from its file name
+// or, failing that, from the content itself
+func detectImportKind(filename, content string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return apitypes.ImportCSV
+	case ".html", ".htm":
+		return apitypes.ImportBookmarks
+	case ".opml":
+		return apitypes.ImportOPML
+	case ".txt", ".list":
+		return apitypes.ImportText
+	}
+
+	head := content
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	head = strings.ToLower(head)
+	switch {
+	case strings.Contains(head, "<opml"):
+		return apitypes.ImportOPML
+	case strings.Contains(head, "netscape-bookmark"), strings.Contains(head, "<html"), strings.Contains(head, "<a "):
+		return apitypes.ImportBookmarks
+	}
+
+	// A CSV file is only recognized by its header row
+	for _, line := range strings.Split(head, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.Split(line, ",") {
+			if strings.Trim(strings.TrimSpace(field), `"`) == "url" && strings.Contains(line, ",") {
+				return apitypes.ImportCSV
+			}
+		}
+		break
+	}
+	return apitypes.ImportText
+}
+
+// parseImport reads the entries of imported content of the given kind
+func parseImport(kind, content string) ([]importEntry, error) {
+	switch kind {
+	case apitypes.ImportText:
+		return parseImportLines(content), nil
+	case apitypes.ImportCSV:
+		return parseImportCSV(content)
+	case apitypes.ImportBookmarks:
+		return parseImportBookmarks(content), nil
+	case apitypes.ImportOPML:
+		return parseImportOPML(content)
+	default:
+		return nil, fmt.Errorf("unknown kind %q, expected text, csv, bookmarks or opml", kind)
+	}
+}
+
+// parseImportLines reads one URL per line, skipping empty lines and comments
+// starting with #
+func parseImportLines(content string) []importEntry {
+	var entries []importEntry
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, importEntry{line: i + 1, url: line})
+	}
+	return entries
+}
+
+// parseImportCSV reads a CSV file. A header row naming a url column gives the
+// order of the columns, otherwise they are in the order of importColumns.
+func parseImportCSV(content string) ([]importEntry, error) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	columns := importColumns
+	var entries []importEntry
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first && isImportHeader(record) {
+			columns = make([]string, len(record))
+			for i, name := range record {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if !isImportColumn(name) {
+					return nil, fmt.Errorf("unknown CSV column %q, expected %s", name, strings.Join(importColumns, ", "))
+				}
+				columns[i] = name
+			}
+			continue
+		}
+
+		entry := importEntry{line: line}
+		if len(record) > len(columns) {
+			entry.problem = fmt.Sprintf("row has %d fields, expected at most %d", len(record), len(columns))
+		}
+		for i, value := range record {
+			if i >= len(columns) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch columns[i] {
+			case "url":
+				entry.url = value
+			case "type":
+				entry.Type = strings.ToLower(value)
+			case "quality":
+				entry.Quality = value
+			case "format":
+				entry.Format = strings.ToLower(value)
+			case "preset":
+				entry.Preset = value
+			case "destination":
+				entry.Destination = value
+			case "external_id":
+				entry.ExternalID = value
+			}
+		}
+		if entry.url == "" && entry.problem == "" && isBlankRecord(record) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isImportHeader reports whether a CSV row is a header naming a url column
+func isImportHeader(record []string) bool {
+	for _, field := range record {
+		if strings.ToLower(strings.TrimSpace(field)) == "url" {
+			return true
+		}
+	}
+	return false
+}
+
+func isImportColumn(name string) bool {
+	for _, column := range importColumns {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseImportBookmarks reads the links of a browser bookmark export
+func parseImportBookmarks(content string) []importEntry {
+	var entries []importEntry
+	for _, match := range bookmarkLinkPattern.FindAllStringSubmatchIndex(content, -1) {
+		var href string
+		for group := 1; group <= 3; group++ {
+			if start := match[2*group]; start >= 0 {
+				href = content[start:match[2*group+1]]
+				break
+			}
+		}
+		entries = append(entries, importEntry{
+			line: 1 + strings.Count(content[:match[0]], "\n"),
+			url:  strings.TrimSpace(html.UnescapeString(href)),
+		})
+	}
+	return entries
+}
+
+// parseImportOPML reads the outlines of an OPML file that have a URL. The
+// page of a feed is preferred over the feed itself, yt-dlp knows pages.
+func parseImportOPML(content string) ([]importEntry, error) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var entries []importEntry
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid OPML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || !strings.EqualFold(start.Name.Local, "outline") {
+			continue
+		}
+
+		attributes := make(map[string]string, len(start.Attr))
+		for _, attr := range start.Attr {
+			attributes[strings.ToLower(attr.Name.Local)] = strings.TrimSpace(attr.Value)
+		}
+		for _, name := range []string{"url", "htmlurl", "xmlurl"} {
+			if url := attributes[name]; url != "" {
+				line, _ := decoder.InputPos()
+				entries = append(entries, importEntry{line: line, url: url})
+				break
+			}
+		}
+	}
+	return entries, nil
+}
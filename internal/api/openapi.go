@@ -0,0 +1,258 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gogetmedia/internal/auth"
+	"gogetmedia/pkg/apitypes"
+)
+
+// pathParamPattern matches the variables of a route path like {id}
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// OpenAPI serves the OpenAPI 3 description of /api/v1, generated from the
+// route table and the request and response types
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openAPIDocument(h.config.BasePathPrefix()))
+}
+
+// openAPIDocument describes the API served under basePath
+func openAPIDocument(basePath string) map[string]interface{} {
+	schemas := newSchemaRegistry()
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(apitypes.Error{}))},
+		},
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range apiRoutes() {
+		operation := map[string]interface{}{
+			"summary": rt.summary,
+			"tags":    []string{strings.Split(strings.TrimPrefix(rt.path, "/"), "/")[0]},
+		}
+		if rt.role != "" {
+			operation["description"] = "Requires the " + rt.role + " role."
+		}
+		if isPublicPath(APIVersionPrefix + rt.path) {
+			operation["security"] = []interface{}{}
+		}
+
+		parameters := []interface{}{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(rt.path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, param := range rt.query {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        param.name,
+				"in":          "query",
+				"description": param.description,
+				"schema":      map[string]interface{}{"type": param.kind},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if rt.request != nil || len(rt.requestContent) > 0 {
+			content := map[string]interface{}{}
+			if rt.request != nil {
+				content["application/json"] = map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(rt.request))}
+			}
+			for _, mediaType := range rt.requestContent {
+				schema := map[string]interface{}{"type": "string"}
+				if isBinaryMediaType(mediaType) {
+					schema["format"] = "binary"
+				}
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			}
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  content,
+			}
+		}
+
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		content := map[string]interface{}{}
+		if rt.response != nil {
+			content["application/json"] = map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(rt.response))}
+		}
+		for _, mediaType := range rt.content {
+			schema := map[string]interface{}{"type": "string"}
+			if mediaType == "application/json" {
+				schema = map[string]interface{}{"type": "object"}
+			} else if isBinaryMediaType(mediaType) {
+				schema["format"] = "binary"
+			}
+			content[mediaType] = map[string]interface{}{"schema": schema}
+		}
+		if len(content) > 0 {
+			success["content"] = content
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]interface{}{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "GoGetMedia API",
+			"version":     "1",
+			"description": "Errors are returned as {code, message, details}. The unversioned /api paths are deprecated aliases of this API.",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": basePath + APIVersionPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API token"},
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": auth.SessionCookieName, "description": "Browser session; requests that change state also need the " + auth.CSRFHeader + " header"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"session": []string{}},
+		},
+	}
+}
+
+// schemaRegistry turns Go types into JSON schemas the way encoding/json
+// encodes them. Named structs become components referenced by name.
+type schemaRegistry struct {
+	components map[string]interface{}
+	types      map[string]reflect.Type
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{components: map[string]interface{}{}, types: map[string]reflect.Type{}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schema(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		name := s.componentName(t)
+		if _, exists := s.components[name]; !exists {
+			s.components[name] = nil // placeholder for recursive types
+			s.components[name] = s.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// componentName names the component of a struct type, with the package
+// name added when two packages use the same type name
+func (s *schemaRegistry) componentName(t reflect.Type) string {
+	name := t.Name()
+	if existing, taken := s.types[name]; taken && existing != t {
+		name = strings.ReplaceAll(t.String(), ".", "_")
+	}
+	s.types[name] = t
+	return name
+}
+
+// structSchema describes the JSON object of a struct. Fields with omitempty
+// are optional, embedded structs contribute their fields.
+func (s *schemaRegistry) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	s.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *schemaRegistry) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = s.schema(field.Type)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// isBinaryMediaType reports whether bodies of a media type are files rather
+// than text
+func isBinaryMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/octet-stream", "application/gzip", "application/x-gzip":
+		return true
+	}
+	return false
+}
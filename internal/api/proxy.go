@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"gogetmedia/internal/config"
+)
+
+// remoteAddr returns the IP address of the direct peer of a request
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func isTrusted(addr netip.Addr, proxies []netip.Prefix) bool {
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient returns the client address from an X-Forwarded-For header:
+// the last entry not added by a trusted proxy
+func forwardedClient(header string, proxies []netip.Prefix) (netip.Addr, bool) {
+	entries := strings.Split(header, ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = addr.Unmap()
+		if !isTrusted(addr, proxies) || i == 0 {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// proxyMiddleware applies the X-Forwarded-* headers of requests coming from
+// a trusted proxy: RemoteAddr becomes the client address, r.URL.Scheme the
+// original scheme and r.Host the original host. The headers of anyone else
+// are ignored, since clients can send them freely.
+func (h *Handler) proxyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxies, err := config.ParseTrustedProxies(h.config.TrustedProxies)
+		if err != nil || len(proxies) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		peer, ok := remoteAddr(r)
+		if !ok || !isTrusted(peer, proxies) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		if header := r.Header.Get("X-Forwarded-For"); header != "" {
+			if client, ok := forwardedClient(header, proxies); ok {
+				r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+			}
+		}
+		if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+			r.Host = host
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithBasePath serves next under basePath, for running behind a reverse proxy
+// at a sub path. Requests without the prefix are served as well, for proxies
+// that strip it before forwarding.
+func WithBasePath(basePath string, next http.Handler) http.Handler {
+	basePath = strings.TrimRight(basePath, "/")
+	if basePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
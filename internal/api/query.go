@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+)
+
+// maxPageSize is the largest page of downloads a client can ask for
+const maxPageSize = 1000
+
+// knownStatuses are the statuses a filter can select
+var knownStatuses = []core.DownloadStatus{
+	core.StatusQueued, core.StatusScheduled, core.StatusDownloading, core.StatusPostProcessing,
+	core.StatusPaused, core.StatusCompleted, core.StatusFailed, core.StatusCancelled, core.StatusAlreadyExists,
+}
+
+// parseFilter reads a download filter from the status, type, q, since and
+// external_id query parameters. status takes a comma-separated list.
+func parseFilter(query url.Values) (manager.Filter, error) {
+	var filter manager.Filter
+	for _, value := range strings.Split(query.Get("status"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		status, ok := parseStatus(value)
+		if !ok {
+			return filter, fmt.Errorf("unknown status %q", value)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	switch downloadType := core.DownloadType(query.Get("type")); downloadType {
+	case "", core.VideoDownload, core.AudioDownload:
+		filter.Type = downloadType
+	default:
+		return filter, fmt.Errorf("unknown type %q, expected video or audio", downloadType)
+	}
+
+	filter.Query = strings.TrimSpace(query.Get("q"))
+	filter.ExternalID = query.Get("external_id")
+
+	if since := query.Get("since"); since != "" {
+		if _, isRevision := parseRevision(since); isRevision {
+			return filter, nil
+		}
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, fmt.Errorf("since must be a revision or an RFC 3339 time: %v", err)
+		}
+		filter.Since = t
+	}
+	return filter, nil
+}
+
+// parseRevision reads a since parameter that is a revision rather than a time
+func parseRevision(value string) (uint64, bool) {
+	revision, err := strconv.ParseUint(value, 10, 64)
+	return revision, err == nil
+}
+
+func parseStatus(value string) (core.DownloadStatus, bool) {
+	for _, status := range knownStatuses {
+		if string(status) == value {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// page is a range of a sorted list of downloads
+type page struct {
+	order  manager.Sort
+	limit  int    // 0 = no limit
+	cursor string // position after the last download of the previous page
+}
+
+// parsePage reads the sort, limit and cursor query parameters
+func parsePage(query url.Values) (page, error) {
+	order, err := manager.ParseSort(query.Get("sort"))
+	if err != nil {
+		return page{}, err
+	}
+	p := page{order: order, cursor: query.Get("cursor")}
+	if limit := query.Get("limit"); limit != "" {
+		p.limit, err = strconv.Atoi(limit)
+		if err != nil || p.limit < 1 || p.limit > maxPageSize {
+			return page{}, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	return p, nil
+}
+
+// apply returns the downloads of the page and the cursor of the next page,
+// "" on the last page. downloads must be sorted by the page's order.
+func (p page) apply(downloads []*core.Download) ([]*core.Download, string, error) {
+	start := 0
+	if p.cursor != "" {
+		key, id, err := p.decodeCursor()
+		if err != nil {
+			return nil, "", err
+		}
+		// Downloads added or removed since the previous page do not shift the
+		// position, the page continues after the last download it returned
+		start = len(downloads)
+		for i, download := range downloads {
+			if p.order.Before(key, id, p.order.Key(download), download.ID) {
+				start = i
+				break
+			}
+		}
+	}
+
+	downloads = downloads[start:]
+	if p.limit == 0 || len(downloads) <= p.limit {
+		return downloads, "", nil
+	}
+	downloads = downloads[:p.limit]
+	return downloads, p.encodeCursor(downloads[len(downloads)-1]), nil
+}
+
+// Cursors are opaque to clients: the sort order, sort key and ID of the last
+// download of a page
+
+func (p page) encodeCursor(last *core.Download) string {
+	raw := p.order.String() + "\x00" + p.order.Key(last) + "\x00" + last.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (p page) decodeCursor() (string, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(p.cursor)
+	parts := strings.Split(string(raw), "\x00")
+	if err != nil || len(parts) != 3 {
+		return "", "", fmt.Errorf("invalid cursor")
+	}
+	if parts[0] != p.order.String() {
+		return "", "", fmt.Errorf("cursor belongs to sort order %s", parts[0])
+	}
+	return parts[1], parts[2], nil
+}
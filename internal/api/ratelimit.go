@@ -0,0 +1,213 @@
+package api
+
+import (
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRequestBodyBytes limits the size of request bodies. The API only takes
+// small JSON documents, except for imports and restores.
+const maxRequestBodyBytes = 1 << 20
+
+// bucketIdleTimeout is how long the rate limit of an idle client is kept
+const bucketIdleTimeout = 10 * time.Minute
+
+// bodyRule lets the requests to one endpoint have other bodies than JSON
+type bodyRule struct {
+	mediaTypes map[string]bool // besides application/json
+	limit      int64           // in bytes, 0 for no limit
+}
+
+// bodyRules are the endpoints that take files. Imports can be sent as the
+// file itself. Backups can be of any size; only admins get as far as
+// reading them.
+var bodyRules = map[string]bodyRule{
+	"/import":        {mediaTypes: importBodyTypes(), limit: maxImportBodyBytes},
+	"/admin/restore": {mediaTypes: map[string]bool{"application/gzip": true, "application/x-gzip": true, "application/octet-stream": true}},
+}
+
+func importBodyTypes() map[string]bool {
+	types := make(map[string]bool, len(importMediaTypes))
+	for mediaType := range importMediaTypes {
+		types[mediaType] = true
+	}
+	return types
+}
+
+// requestGuardMiddleware rejects state-changing requests that browsers send
+// from other sites, unless CORS allows them, and those whose body is not JSON,
+// and limits the size of request bodies. Forms and other simple requests,
+// which browsers send cross-site without asking, are refused either way.
+func (h *Handler) requestGuardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Without a body a POST is a simple request, and without login there
+		// is no CSRF token to stop it
+		if h.isCrossSite(r) {
+			http.Error(w, "Cross-site requests are not allowed", http.StatusForbidden)
+			return
+		}
+
+		rule, hasRule := bodyRules[apiRelativePath(r.URL.Path)]
+		if !hasRule {
+			rule.limit = maxRequestBodyBytes
+		}
+
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil || (mediaType != "application/json" && !rule.mediaTypes[mediaType]) {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		} else if r.ContentLength != 0 {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		if rule.limit > 0 {
+			if r.ContentLength > rule.limit {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, rule.limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isCrossSite reports whether a browser sent r from a page of another origin
+// that CORS does not allow. Browsers send Sec-Fetch-Site, older ones only
+// Origin. Other clients send neither.
+func (h *Handler) isCrossSite(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if h.allowedOrigin(origin) != "" {
+		return false
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return false
+	case "same-site", "cross-site":
+		return true
+	}
+	if origin == "" {
+		return false
+	}
+
+	// Origin is "null" for sandboxed pages and local files, which never match
+	u, err := url.Parse(origin)
+	if err != nil {
+		return true
+	}
+	scheme := "http"
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		scheme = "https"
+	}
+	return !strings.EqualFold(u.Scheme, scheme) || !strings.EqualFold(u.Host, r.Host)
+}
+
+// bucket is a token bucket for one client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client
+type rateLimiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from the bucket of key, which refills at perMinute
+// tokens per minute up to burst tokens. If the bucket is empty it returns
+// false and how long until the next token is available.
+func (l *rateLimiter) allow(key string, perMinute, burst int, now time.Time) (bool, time.Duration) {
+	if burst < 1 {
+		burst = 1
+	}
+	rate := float64(perMinute) / 60 // tokens per second
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientKey identifies the client of a request for rate limiting. It runs
+// after proxyMiddleware, so clients behind a trusted proxy are told apart.
+func clientKey(r *http.Request) string {
+	if addr, ok := remoteAddr(r); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// rateLimitMiddleware limits API requests per client address. Login attempts
+// have a separate, stricter limit against password guessing.
+func (h *Handler) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := h.config.RateLimit
+		key := clientKey(r)
+
+		if strings.HasPrefix(r.URL.Path, "/api/") && apiRelativePath(r.URL.Path) == "/auth/login" && r.Method == "POST" && limits.LoginAttemptsPerMinute > 0 {
+			if ok, wait := h.loginLimiter.allow(key, limits.LoginAttemptsPerMinute, limits.LoginAttemptsPerMinute, time.Now()); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") && limits.RequestsPerMinute > 0 {
+			if ok, wait := h.limiter.allow(key, limits.RequestsPerMinute, limits.Burst, time.Now()); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
@@ -2,39 +2,45 @@ package api
 
 import (
 	"github.com/gorilla/mux"
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/config"
+	"gogetmedia/pkg/apitypes"
 	"io/fs"
 	"net/http"
 	"path/filepath"
+	"strings"
 )
 
 func SetupRoutes(handler *Handler, assetsFS fs.FS) *mux.Router {
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+
+	// JSON error envelope of /api/v1, deprecation headers of /api
+	router.Use(handler.versionMiddleware)
+
+	// Client address and scheme from trusted reverse proxies
+	router.Use(handler.proxyMiddleware)
+
+	// Per-client rate limits, after the client address is known
+	router.Use(handler.rateLimitMiddleware)
 
 	// CORS middleware
-	router.Use(corsMiddleware)
-
-	// API routes
-	api := router.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/config", handler.GetConfig).Methods("GET")
-	api.HandleFunc("/config", handler.UpdateConfig).Methods("POST")
-	api.HandleFunc("/downloads", handler.GetDownloads).Methods("GET")
-	api.HandleFunc("/downloads", handler.StartDownload).Methods("POST")
-	api.HandleFunc("/downloads/playlist", handler.StartPlaylistDownload).Methods("POST")
-	api.HandleFunc("/downloads/first-video", handler.StartFirstVideoDownload).Methods("POST")
-	api.HandleFunc("/downloads/{id}", handler.DeleteDownload).Methods("DELETE")
-	api.HandleFunc("/downloads/{id}/cancel", handler.CancelDownload).Methods("POST")
-	api.HandleFunc("/downloads/{id}/pause", handler.PauseDownload).Methods("POST")
-	api.HandleFunc("/downloads/{id}/resume", handler.ResumeDownload).Methods("POST")
-	api.HandleFunc("/downloads/{id}/retry", handler.RetryDownload).Methods("POST")
-	api.HandleFunc("/downloads/{id}/download", handler.DownloadFile).Methods("GET")
-	api.HandleFunc("/downloads/clear-queued", handler.ClearAllQueued).Methods("POST")
-	api.HandleFunc("/downloads/delete-completed", handler.DeleteAllCompleted).Methods("POST")
-	api.HandleFunc("/downloads/clear-failed", handler.ClearAllFailed).Methods("POST")
-	api.HandleFunc("/validate", handler.ValidateURL).Methods("POST")
-	api.HandleFunc("/yt-dlp/version", handler.GetUpdateInfo).Methods("GET")
-	api.HandleFunc("/yt-dlp/update", handler.UpdateYtDlp).Methods("POST")
-	api.HandleFunc("/ffmpeg/check", handler.CheckFfmpeg).Methods("GET")
-	api.HandleFunc("/versions", handler.GetVersions).Methods("GET")
+	router.Use(handler.corsMiddleware)
+
+	// JSON-only request bodies of limited size
+	router.Use(handler.requestGuardMiddleware)
+
+	// Authentication, every route except the login page and assets
+	router.Use(handler.authMiddleware)
+
+	// API routes, current version and the deprecated unversioned aliases
+	for _, prefix := range []string{APIVersionPrefix, "/api"} {
+		api := router.PathPrefix(prefix).Subrouter()
+		for _, route := range apiRoutes() {
+			api.HandleFunc(route.path, route.handlerFunc(handler)).Methods(route.method)
+		}
+	}
 
 	// Static files (legacy)
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(filepath.Join("web", "public")))))
@@ -53,15 +59,144 @@ func SetupRoutes(handler *Handler, assetsFS fs.FS) *mux.Router {
 	return router
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// route is an API endpoint. The table below registers the endpoints and
+// describes them in the OpenAPI document, so both stay in sync.
+type route struct {
+	method  string
+	path    string // below /api/v1
+	role    string // minimum role, "" for everyone who is signed in
+	handle  func(*Handler, http.ResponseWriter, *http.Request)
+	summary string
+
+	request  interface{}  // JSON request body, nil for none
+	response interface{}  // JSON response body, nil for none
+	status   int          // success status, 200 if 0
+	content  []string     // media types of a response that is not JSON
+	query    []queryParam // optional query parameters
+
+	requestContent []string // media types the request body can be sent as besides JSON
+}
+
+// downloadFilterParams are the query parameters of parseFilter, followed by
+// more
+func downloadFilterParams(more ...queryParam) []queryParam {
+	return append([]queryParam{
+		{name: "status", kind: "string", description: "Comma-separated statuses"},
+		{name: "type", kind: "string", description: "video or audio"},
+		{name: "q", kind: "string", description: "Text in the title, filename or URL"},
+		{name: "since", kind: "string", description: "Added at or after this RFC 3339 time, or for GET /downloads a revision: only the changes after it"},
+		{name: "external_id", kind: "string", description: "The external_id the download was added with"},
+	}, more...)
+}
+
+// queryParam is an optional query parameter of a route
+type queryParam struct {
+	name        string
+	kind        string // OpenAPI type
+	description string
+}
+
+func (rt route) handlerFunc(h *Handler) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		rt.handle(h, w, r)
+	}
+	if rt.role != "" {
+		return h.requireRole(rt.role, handle)
+	}
+	return handle
+}
+
+// apiRoutes returns the endpoints of the API. Reading is open to every role,
+// managing downloads needs the user role and configuration, users, backups
+// and yt-dlp updates need admin.
+func apiRoutes() []route {
+	return []route{
+		{method: "GET", path: "/openapi.json", handle: (*Handler).OpenAPI, summary: "OpenAPI description of this API", content: []string{"application/json"}},
+		{method: "GET", path: "/auth/status", handle: (*Handler).AuthStatus, summary: "Whether login is required and who is logged in", response: apitypes.AuthStatus{}},
+		{method: "POST", path: "/auth/login", handle: (*Handler).Login, summary: "Log in with a password", request: apitypes.LoginRequest{}, response: apitypes.LoginResponse{}},
+		{method: "POST", path: "/auth/logout", handle: (*Handler).Logout, summary: "End the current session", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/auth/password", handle: (*Handler).ChangePassword, summary: "Change the password of the signed-in user", request: apitypes.ChangePasswordRequest{}, response: apitypes.ChangePasswordResponse{}},
+		{method: "GET", path: "/auth/tokens", handle: (*Handler).GetTokens, summary: "List the API tokens of the signed-in user", response: []apitypes.Token{}},
+		{method: "POST", path: "/auth/tokens", handle: (*Handler).CreateToken, summary: "Create an API token", request: apitypes.CreateTokenRequest{}, response: apitypes.CreateTokenResponse{}, status: http.StatusCreated},
+		{method: "DELETE", path: "/auth/tokens/{id}", handle: (*Handler).RevokeToken, summary: "Revoke an API token", response: apitypes.StatusResponse{}},
+		{method: "GET", path: "/auth/users", role: auth.RoleAdmin, handle: (*Handler).GetUsers, summary: "List users", response: []apitypes.User{}},
+		{method: "POST", path: "/auth/users", role: auth.RoleAdmin, handle: (*Handler).CreateUser, summary: "Create a user", request: apitypes.CreateUserRequest{}, response: apitypes.User{}, status: http.StatusCreated},
+		{method: "DELETE", path: "/auth/users/{username}", role: auth.RoleAdmin, handle: (*Handler).DeleteUser, summary: "Delete a user", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/auth/users/{username}/role", role: auth.RoleAdmin, handle: (*Handler).SetUserRole, summary: "Change the role of a user", request: apitypes.SetRoleRequest{}, response: apitypes.User{}},
+		{method: "GET", path: "/admin/backup", role: auth.RoleAdmin, handle: (*Handler).Backup, summary: "Download a backup of the config, users, downloads and logs", content: []string{"application/gzip"}, query: []queryParam{
+			{name: "media", kind: "boolean", description: "Include the downloaded files"},
+		}},
+		{method: "POST", path: "/admin/restore", role: auth.RoleAdmin, handle: (*Handler).Restore, summary: "Check a backup and restore it when the server is next started", response: apitypes.RestoreResponse{}, requestContent: []string{"application/gzip"}},
+		{method: "DELETE", path: "/admin/restore", role: auth.RoleAdmin, handle: (*Handler).CancelRestore, summary: "Cancel a restore that waits for the server to restart", response: apitypes.StatusResponse{}},
+		{method: "GET", path: "/config", handle: (*Handler).GetConfig, summary: "Get the configuration", response: apitypes.ConfigResponse{}},
+		{method: "POST", path: "/config", role: auth.RoleAdmin, handle: (*Handler).UpdateConfig, summary: "Change settings, missing settings keep their value", request: apitypes.Config{}, response: apitypes.ConfigResponse{}},
+		{method: "GET", path: "/downloads", handle: (*Handler).GetDownloads, summary: "List downloads", response: apitypes.DownloadList{}, query: downloadFilterParams(
+			queryParam{name: "sort", kind: "string", description: "Field to sort by, descending with a - prefix: created_at (default -created_at), completed_at, title, status, type, progress or size"},
+			queryParam{name: "limit", kind: "integer", description: "Downloads per page, 1 to 1000; all downloads without"},
+			queryParam{name: "cursor", kind: "string", description: "next_cursor of the previous page"},
+		)},
+		{method: "POST", path: "/downloads", role: auth.RoleUser, handle: (*Handler).StartDownload, summary: "Add a download", request: apitypes.DownloadRequest{}, response: apitypes.Download{}},
+		{method: "POST", path: "/downloads/playlist", role: auth.RoleUser, handle: (*Handler).StartPlaylistDownload, summary: "Add every video of a playlist", request: apitypes.DownloadRequest{}, response: apitypes.PlaylistResponse{}},
+		{method: "POST", path: "/downloads/first-video", role: auth.RoleUser, handle: (*Handler).StartFirstVideoDownload, summary: "Add the first video of a playlist", request: apitypes.DownloadRequest{}, response: apitypes.Download{}},
+		{method: "DELETE", path: "/downloads/{id}", role: auth.RoleUser, handle: (*Handler).DeleteDownload, summary: "Remove a download and the file of a completed one", status: http.StatusNoContent},
+		{method: "POST", path: "/downloads/{id}/cancel", role: auth.RoleUser, handle: (*Handler).CancelDownload, summary: "Cancel a download", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/downloads/{id}/pause", role: auth.RoleUser, handle: (*Handler).PauseDownload, summary: "Pause a download", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/downloads/{id}/resume", role: auth.RoleUser, handle: (*Handler).ResumeDownload, summary: "Resume a paused download", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/downloads/{id}/retry", role: auth.RoleUser, handle: (*Handler).RetryDownload, summary: "Retry a failed or cancelled download", response: apitypes.StatusResponse{}},
+		{method: "GET", path: "/downloads/{id}/download", handle: (*Handler).DownloadFile, summary: "Download the file of a completed download", content: []string{"application/octet-stream"}},
+		{method: "GET", path: "/downloads/{id}/log", handle: (*Handler).GetDownloadLog, summary: "yt-dlp and ffmpeg output of a download", response: apitypes.DownloadLog{}, content: []string{"text/event-stream", "text/plain"}, query: []queryParam{
+			{name: "follow", kind: "boolean", description: "Stream the log as server-sent events until the download stops"},
+			{name: "format", kind: "string", description: "text for plain text instead of JSON"},
+		}},
+		{method: "POST", path: "/downloads/bulk", role: auth.RoleUser, handle: (*Handler).BulkAction, summary: "Cancel, pause, resume, retry, remove, reprioritize or move downloads by ID or filter", request: apitypes.BulkRequest{}, response: apitypes.BulkResponse{}},
+		{method: "POST", path: "/downloads/clear-queued", role: auth.RoleUser, handle: (*Handler).ClearAllQueued, summary: "Remove all queued downloads", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/downloads/delete-completed", role: auth.RoleUser, handle: (*Handler).DeleteAllCompleted, summary: "Remove all completed downloads and their files", response: apitypes.StatusResponse{}},
+		{method: "POST", path: "/downloads/clear-failed", role: auth.RoleUser, handle: (*Handler).ClearAllFailed, summary: "Remove all failed downloads", response: apitypes.StatusResponse{}},
+		{method: "GET", path: "/export", handle: (*Handler).ExportDownloads, summary: "Export downloads with their files, sizes and checksums", response: []apitypes.Download{}, content: []string{"application/x-ndjson", "text/csv"}, query: downloadFilterParams(
+			queryParam{name: "format", kind: "string", description: "json (default), jsonl or csv"},
+			queryParam{name: "sort", kind: "string", description: "Field to sort by as for GET /downloads, created_at by default"},
+		)},
+		{method: "POST", path: "/import", role: auth.RoleUser, handle: (*Handler).ImportDownloads, summary: "Add the URLs of a list, CSV file, bookmark export or OPML file", request: apitypes.ImportRequest{}, requestContent: importContentTypes(), response: apitypes.ImportResponse{}, query: []queryParam{
+			{name: "kind", kind: "string", description: "When the file is the body: text, csv, bookmarks or opml, detected when missing"},
+			{name: "filename", kind: "string", description: "When the file is the body: its name, to detect the kind"},
+			{name: "type", kind: "string", description: "When the file is the body: video or audio for entries without their own"},
+			{name: "quality", kind: "string", description: "When the file is the body: quality for entries without their own"},
+			{name: "format", kind: "string", description: "When the file is the body: format for entries without their own"},
+			{name: "preset", kind: "string", description: "When the file is the body: preset for entries without their own"},
+			{name: "destination", kind: "string", description: "When the file is the body: folder for entries without their own"},
+		}},
+		{method: "GET", path: "/schedule", handle: (*Handler).GetSchedule, summary: "Download window and per-site limits", response: apitypes.ScheduleStatus{}},
+		{method: "GET", path: "/me/usage", handle: (*Handler).GetUsage, summary: "Usage of the signed-in user against their quota", response: apitypes.Usage{}},
+		{method: "POST", path: "/validate", role: auth.RoleUser, handle: (*Handler).ValidateURL, summary: "Check a URL before adding it", request: apitypes.ValidateRequest{}, response: apitypes.ValidateResponse{}},
+		{method: "GET", path: "/yt-dlp/version", handle: (*Handler).GetUpdateInfo, summary: "Installed and latest yt-dlp version", response: apitypes.UpdateInfo{}},
+		{method: "POST", path: "/yt-dlp/update", role: auth.RoleAdmin, handle: (*Handler).UpdateYtDlp, summary: "Update yt-dlp", response: apitypes.StatusResponse{}},
+		{method: "GET", path: "/ffmpeg/check", handle: (*Handler).CheckFfmpeg, summary: "Whether ffmpeg can be run", response: apitypes.FfmpegStatus{}},
+		{method: "GET", path: "/versions", handle: (*Handler).GetVersions, summary: "Versions of yt-dlp and ffmpeg", response: apitypes.VersionInfo{}},
+	}
+}
+
+// corsMiddleware sets the security headers and answers cross-origin requests
+// from the origins allowed in the config
+func (h *Handler) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			w.Header().Add("Vary", "Origin")
+		}
+		if allowed := h.allowedOrigin(origin); allowed != "" {
+			methods := h.config.CORS.AllowedMethods
+			if len(methods) == 0 {
+				methods = config.DefaultCORSMethods
+			}
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", ")+", OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+auth.CSRFHeader+", "+IdempotencyKeyHeader)
+		}
+
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -70,3 +205,20 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" if the origin is not allowed
+func (h *Handler) allowedOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range h.config.CORS.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
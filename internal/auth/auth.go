@@ -0,0 +1,443 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// UsersFileName is stored next to the config file
+	UsersFileName = "users.json"
+
+	// BootstrapUsername is the account created on first run
+	BootstrapUsername = "admin"
+
+	hashIterations = 210000
+	hashKeyLength  = 32
+	saltLength     = 16
+	minPasswordLen = 8
+)
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+var (
+	ErrInvalidCredentials = fmt.Errorf("invalid username or password")
+	ErrUserExists         = fmt.Errorf("user already exists")
+	ErrUserNotFound       = fmt.Errorf("user not found")
+)
+
+// Roles, from most to least privileged
+const (
+	RoleAdmin  = "admin"  // everything, including config, users and yt-dlp updates
+	RoleUser   = "user"   // add downloads and manage their own
+	RoleViewer = "viewer" // read-only access
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleUser:   2,
+	RoleAdmin:  3,
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// User is a local account
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// HasRole reports whether the user has at least the given role
+func (u *User) HasRole(role string) bool {
+	return roleRanks[u.Role] >= roleRanks[role]
+}
+
+// clone returns a copy of the user, for callers to read without the lock
+func (u *User) clone() *User {
+	copy := *u
+	return &copy
+}
+
+// IsAdmin reports whether the user is an administrator
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// usersFile is the on-disk format of the store
+type usersFile struct {
+	Users  []*User     `json:"users"`
+	Tokens []*APIToken `json:"tokens"`
+}
+
+// Store holds users, API tokens and login sessions. Users and tokens are
+// persisted to a JSON file; sessions only live in memory.
+type Store struct {
+	path     string
+	mutex    sync.RWMutex
+	users    map[string]*User
+	tokens   map[string]*APIToken // by token hash
+	sessions map[string]*Session  // by session ID
+}
+
+// UsersFilePath returns the users file that belongs to a config file
+func UsersFilePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), UsersFileName)
+}
+
+// NewStore loads the users file at path. A missing file yields an empty store.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:     path,
+		users:    make(map[string]*User),
+		tokens:   make(map[string]*APIToken),
+		sessions: make(map[string]*Session),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var file usersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %w", err)
+	}
+	for _, user := range file.Users {
+		if user.Role == "" {
+			// Accounts created before roles existed had full access
+			user.Role = RoleAdmin
+		}
+		s.users[user.Username] = user
+	}
+	for _, token := range file.Tokens {
+		s.tokens[token.Hash] = token
+	}
+	return s, nil
+}
+
+// Bootstrap creates the initial admin account when there are no users yet.
+// If password is empty a random one is generated. It returns the password
+// of the created account, or "" when users already exist.
+func (s *Store) Bootstrap(password string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.users) > 0 {
+		return "", nil
+	}
+	if password == "" {
+		random, err := randomString(12)
+		if err != nil {
+			return "", err
+		}
+		password = random
+	}
+
+	if err := s.addUserLocked(BootstrapUsername, password, RoleAdmin); err != nil {
+		return "", err
+	}
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, BootstrapUsername)
+		return "", err
+	}
+	return password, nil
+}
+
+// Authenticate checks a username and password
+func (s *Store) Authenticate(username, password string) (*User, error) {
+	s.mutex.RLock()
+	user, exists := s.users[username]
+	if exists {
+		user = user.clone()
+	}
+	s.mutex.RUnlock()
+
+	if !exists {
+		// Spend the same time as for a real user to not reveal which names exist
+		dummyHashOnce.Do(func() { dummyHash, _ = hashPassword("dummy password") })
+		verifyPassword(password, dummyHash)
+		return nil, ErrInvalidCredentials
+	}
+	if !verifyPassword(password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// GetUser returns a user by name
+func (s *Store) GetUser(username string) (*User, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	user, exists := s.users[username]
+	if !exists {
+		return nil, false
+	}
+	return user.clone(), true
+}
+
+// ListUsers returns all users sorted by name
+func (s *Store) ListUsers() []*User {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user.clone())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// CreateUser adds a new user with the given role
+func (s *Store) CreateUser(username, password, role string) (*User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.addUserLocked(username, password, role); err != nil {
+		return nil, err
+	}
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, username)
+		return nil, err
+	}
+	return s.users[username].clone(), nil
+}
+
+// DeleteUser removes a user together with their sessions and API tokens.
+// The last user cannot be deleted.
+func (s *Store) DeleteUser(username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if user.IsAdmin() && s.adminCountLocked() == 1 {
+		return fmt.Errorf("cannot delete the last admin")
+	}
+
+	removed := make(map[string]*APIToken)
+	for hash, token := range s.tokens {
+		if token.Username == username {
+			removed[hash] = token
+			delete(s.tokens, hash)
+		}
+	}
+	delete(s.users, username)
+	if err := s.saveLocked(); err != nil {
+		s.users[username] = user
+		for hash, token := range removed {
+			s.tokens[hash] = token
+		}
+		return err
+	}
+	s.dropSessionsLocked(username)
+	return nil
+}
+
+// SetRole changes a user's role. The last admin cannot be demoted.
+func (s *Store) SetRole(username, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("invalid role %q", role)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if user.IsAdmin() && role != RoleAdmin && s.adminCountLocked() == 1 {
+		return fmt.Errorf("cannot demote the last admin")
+	}
+
+	previous := user.Role
+	user.Role = role
+	if err := s.saveLocked(); err != nil {
+		user.Role = previous
+		return err
+	}
+	return nil
+}
+
+func (s *Store) adminCountLocked() int {
+	count := 0
+	for _, user := range s.users {
+		if user.IsAdmin() {
+			count++
+		}
+	}
+	return count
+}
+
+// SetPassword changes a user's password and ends their sessions
+func (s *Store) SetPassword(username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+	previous := user.PasswordHash
+	user.PasswordHash = hash
+	if err := s.saveLocked(); err != nil {
+		user.PasswordHash = previous
+		return err
+	}
+	s.dropSessionsLocked(username)
+	return nil
+}
+
+func (s *Store) addUserLocked(username, password, role string) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if !ValidRole(role) {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	if _, exists := s.users[username]; exists {
+		return ErrUserExists
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.users[username] = &User{Username: username, PasswordHash: hash, Role: role, CreatedAt: time.Now()}
+	return nil
+}
+
+// saveLocked writes users and tokens to disk. Caller must hold s.mutex.
+func (s *Store) saveLocked() error {
+	file := usersFile{Users: []*User{}, Tokens: []*APIToken{}}
+	for _, user := range s.users {
+		file.Users = append(file.Users, user)
+	}
+	for _, token := range s.tokens {
+		file.Tokens = append(file.Tokens, token)
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].Username < file.Users[j].Username })
+	sort.Slice(file.Tokens, func(i, j int) bool { return file.Tokens[i].CreatedAt.Before(file.Tokens[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal users: %w", err)
+	}
+
+	// The file holds password hashes, keep it private
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	if err := os.Rename(tempPath, s.path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to save users file: %w", err)
+	}
+	return nil
+}
+
+func validateUsername(username string) error {
+	if username == "" || len(username) > 64 {
+		return fmt.Errorf("username must be between 1 and 64 characters")
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-@", r)) {
+			return fmt.Errorf("username may only contain letters, digits and . _ - @")
+		}
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLen {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLen)
+	}
+	return nil
+}
+
+// hashPassword derives a salted PBKDF2-SHA256 hash, stored as
+// "pbkdf2-sha256$<iterations>$<salt>$<hash>"
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, hashKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", hashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func verifyPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// randomString returns n random bytes encoded as URL-safe base64
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_auth_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	path := filepath.Join(tempDir, UsersFileName)
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	return store, path
+}
+
+func TestBootstrapAndAuthenticate(t *testing.T) {
+	store, path := newTestStore(t)
+
+	password, err := store.Bootstrap("")
+	if err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+	if len(password) < minPasswordLen {
+		t.Fatalf("Expected a generated password, got %q", password)
+	}
+
+	// Bootstrapping again does nothing once a user exists
+	if again, err := store.Bootstrap(""); err != nil || again != "" {
+		t.Errorf("Expected second bootstrap to be a no-op, got %q, %v", again, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read users file: %v", err)
+	}
+	if strings.Contains(string(data), password) {
+		t.Error("Users file must not contain the plain password")
+	}
+
+	// A reloaded store accepts the same credentials
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+	if _, err := reloaded.Authenticate(BootstrapUsername, password); err != nil {
+		t.Errorf("Expected valid credentials to authenticate: %v", err)
+	}
+	if _, err := reloaded.Authenticate(BootstrapUsername, "wrong password"); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials error, got %v", err)
+	}
+	if _, err := reloaded.Authenticate("nobody", password); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials error for unknown user, got %v", err)
+	}
+}
+
+func TestSessionsAndTokens(t *testing.T) {
+	store, _ := newTestStore(t)
+	if _, err := store.CreateUser("alice", "correct horse", RoleUser); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	session, err := store.CreateSession("alice")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/api/downloads", nil)
+	w := httptest.NewRecorder()
+	SetSessionCookie(w, req, session)
+	req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	if user, ok := store.UserFromRequest(req); !ok || user.Username != "alice" {
+		t.Errorf("Expected session cookie to authenticate alice")
+	}
+
+	token, secret, err := store.CreateToken("alice", "cron")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if token.Hash == secret || !strings.HasPrefix(secret, tokenPrefix) {
+		t.Errorf("Expected a prefixed secret that differs from the stored hash")
+	}
+	req = httptest.NewRequest("GET", "/api/downloads", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	if user, ok := store.UserFromRequest(req); !ok || user.Username != "alice" {
+		t.Errorf("Expected bearer token to authenticate alice")
+	}
+
+	// Changing the password ends sessions; revoking a token disables it
+	if err := store.SetPassword("alice", "battery staple"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if _, ok := store.ValidateSession(session.ID); ok {
+		t.Error("Expected session to end after a password change")
+	}
+	if err := store.RevokeToken("alice", token.ID); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, ok := store.ValidateToken(secret); ok {
+		t.Error("Expected revoked token to be rejected")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	if _, err := store.Bootstrap("bootstrap-password"); err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+	admin, _ := store.GetUser(BootstrapUsername)
+	if !admin.IsAdmin() {
+		t.Errorf("Expected the bootstrap user to be an admin, got %q", admin.Role)
+	}
+
+	if _, err := store.CreateUser("bob", "bob-password", "owner"); err == nil {
+		t.Error("Expected an unknown role to be rejected")
+	}
+	viewer, err := store.CreateUser("bob", "bob-password", RoleViewer)
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if viewer.HasRole(RoleUser) || !viewer.HasRole(RoleViewer) {
+		t.Errorf("Unexpected permissions for viewer")
+	}
+	if !admin.HasRole(RoleUser) {
+		t.Errorf("Expected admin to have the user role")
+	}
+
+	// The last admin can be neither demoted nor deleted
+	if err := store.SetRole(BootstrapUsername, RoleUser); err == nil {
+		t.Error("Expected demoting the last admin to fail")
+	}
+	if err := store.DeleteUser(BootstrapUsername); err == nil {
+		t.Error("Expected deleting the last admin to fail")
+	}
+
+	if err := store.SetRole("bob", RoleAdmin); err != nil {
+		t.Fatalf("SetRole failed: %v", err)
+	}
+	if err := store.SetRole(BootstrapUsername, RoleUser); err != nil {
+		t.Errorf("Expected demoting an admin to succeed once another exists: %v", err)
+	}
+}
+
+func TestStoreReturnsCopies(t *testing.T) {
+	store, _ := newTestStore(t)
+	if _, err := store.CreateUser("alice", "alice-password", RoleAdmin); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if _, err := store.CreateUser("bob", "bob-password", RoleUser); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	_, secret, err := store.CreateToken("bob", "script")
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+
+	// Lists are read after the lock is released while requests change the store
+	users, tokens := store.ListUsers(), store.ListTokens("bob")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			store.ValidateToken(secret)
+			store.SetRole("bob", []string{RoleViewer, RoleUser}[i%2])
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = users[1].Role
+		_ = tokens[0].LastUsedAt
+	}
+	<-done
+
+	users[1].Role = RoleAdmin
+	if user, _ := store.GetUser("bob"); user.Role == RoleAdmin {
+		t.Error("Changing a listed user changed the store")
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// SessionCookieName is the cookie holding the login session ID
+const SessionCookieName = "gogetmedia_session"
+
+// CSRFHeader carries the session's CSRF token on state-changing requests
+const CSRFHeader = "X-CSRF-Token"
+
+type contextKey struct{}
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user of a request, if any
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*User)
+	return user, ok && user != nil
+}
+
+// UserFromRequest authenticates a request by bearer token or session cookie
+func (s *Store) UserFromRequest(r *http.Request) (*User, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return nil, false
+		}
+		return s.ValidateToken(strings.TrimSpace(token))
+	}
+
+	id, ok := SessionID(r)
+	if !ok {
+		return nil, false
+	}
+	return s.ValidateSession(id)
+}
+
+// SessionID returns the session a request is authenticated by. Requests with
+// an Authorization header use a bearer token instead, even if a cookie is set.
+func SessionID(r *http.Request) (string, bool) {
+	if r.Header.Get("Authorization") != "" {
+		return "", false
+	}
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// isHTTPS reports whether the client connected over HTTPS, directly or
+// through a trusted proxy that set r.URL.Scheme
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.URL.Scheme == "https"
+}
+
+// SetSessionCookie sends the session cookie for a new login
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, session *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie removes the session cookie on logout
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionTTL is how long a login session stays valid without use
+	SessionTTL = 7 * 24 * time.Hour
+
+	// tokenPrefix makes API tokens recognisable, e.g. in leaked logs
+	tokenPrefix = "ggm_"
+)
+
+// Session is a browser login. Requests that change state must echo its
+// CSRFToken, which other sites cannot read.
+type Session struct {
+	ID        string
+	Username  string
+	CSRFToken string
+	ExpiresAt time.Time
+}
+
+// APIToken is a bearer token for scripts. Only a hash of the token is stored.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	Hash       string     `json:"hash"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// clone returns a copy of the token, for callers to read without the lock
+func (t *APIToken) clone() *APIToken {
+	copy := *t
+	return &copy
+}
+
+// CreateSession starts a login session for a user
+func (s *Store) CreateSession(username string) (*Session, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[username]; !exists {
+		return nil, ErrUserNotFound
+	}
+	s.expireSessionsLocked(time.Now())
+	session := &Session{ID: id, Username: username, CSRFToken: csrfToken, ExpiresAt: time.Now().Add(SessionTTL)}
+	s.sessions[id] = session
+	return session, nil
+}
+
+// ValidateSession returns the user of a session and extends its lifetime
+func (s *Store) ValidateSession(id string) (*User, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return nil, false
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	user, exists := s.users[session.Username]
+	if !exists {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	session.ExpiresAt = now.Add(SessionTTL)
+	return user.clone(), true
+}
+
+// CSRFToken returns the CSRF token of a session
+func (s *Store) CSRFToken(id string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return "", false
+	}
+	return session.CSRFToken, true
+}
+
+// ValidCSRFToken reports whether token is the CSRF token of a session
+func (s *Store) ValidCSRFToken(id, token string) bool {
+	expected, ok := s.CSRFToken(id)
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// DeleteSession ends a login session
+func (s *Store) DeleteSession(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, id)
+}
+
+// dropSessionsLocked ends all sessions of a user. Caller must hold s.mutex.
+func (s *Store) dropSessionsLocked(username string) {
+	for id, session := range s.sessions {
+		if session.Username == username {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// expireSessionsLocked removes expired sessions. Caller must hold s.mutex.
+func (s *Store) expireSessionsLocked(now time.Time) {
+	for id, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// CreateToken issues a new API token for a user. The returned secret is only
+// available now; the store keeps just its hash.
+func (s *Store) CreateToken(username, name string) (*APIToken, string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = tokenPrefix + secret
+	id, err := randomString(6)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[username]; !exists {
+		return nil, "", ErrUserNotFound
+	}
+	token := &APIToken{
+		ID:        id,
+		Name:      name,
+		Username:  username,
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now(),
+	}
+	s.tokens[token.Hash] = token
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, token.Hash)
+		return nil, "", err
+	}
+	return token.clone(), secret, nil
+}
+
+// ValidateToken returns the user an API token belongs to
+func (s *Store) ValidateToken(secret string) (*User, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return nil, false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, exists := s.tokens[hashToken(secret)]
+	if !exists {
+		return nil, false
+	}
+	user, exists := s.users[token.Username]
+	if !exists {
+		return nil, false
+	}
+	// Only tracked in memory until the next save to avoid a write per request
+	now := time.Now()
+	token.LastUsedAt = &now
+	return user.clone(), true
+}
+
+// ListTokens returns the tokens of a user, oldest first
+func (s *Store) ListTokens(username string) []*APIToken {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tokens := []*APIToken{}
+	for _, token := range s.tokens {
+		if token.Username == username {
+			tokens = append(tokens, token.clone())
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// RevokeToken deletes one of a user's tokens
+func (s *Store) RevokeToken(username, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.ID == id && token.Username == username {
+			delete(s.tokens, hash)
+			if err := s.saveLocked(); err != nil {
+				s.tokens[hash] = token
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("token not found")
+}
+
+// hashToken hashes an API token secret. Tokens are long random values, so
+// a plain SHA-256 is sufficient.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
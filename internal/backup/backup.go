@@ -0,0 +1,294 @@
+// Package backup writes the state of a server to a single archive and
+// restores it: the config file, the users file, the downloads and their logs
+// and, optionally, the downloaded files.
+//
+// An archive is a gzip-compressed tar file. Its first file is manifest.json,
+// followed by config.json, users.json, state.json, the download logs in logs/
+// and the downloaded files in media/, by their path below the download
+// directory.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+)
+
+// Format identifies backup archives in their manifest
+const Format = "gogetmedia-backup"
+
+// Version is the version of the archive layout. Restore upgrades archives of
+// older versions and refuses newer ones.
+const Version = 1
+
+// Names in the archive
+const (
+	manifestName = "manifest.json"
+	configName   = "config.json"
+	usersName    = "users.json"
+	stateName    = "state.json"
+	logsDir      = "logs"
+	mediaDir     = "media"
+)
+
+// Manifest describes a backup archive
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// DownloadPath is the download directory of the server that was backed
+	// up. Restore moves the files of downloads below it to the new one.
+	DownloadPath string `json:"download_path"`
+
+	Users      int   `json:"users"`
+	Downloads  int   `json:"downloads"`
+	Logs       int   `json:"logs"`
+	Media      bool  `json:"media"` // whether the downloaded files are included
+	MediaFiles int   `json:"media_files,omitempty"`
+	MediaBytes int64 `json:"media_bytes,omitempty"`
+}
+
+// Paths are the files a server keeps its state in
+type Paths struct {
+	ConfigFile   string
+	UsersFile    string
+	DownloadPath string // holds the state file, the download logs and the downloaded files
+}
+
+// PathsFor returns the paths of a server with the config file at configPath
+// that saves downloads in downloadPath
+func PathsFor(configPath, downloadPath string) Paths {
+	return Paths{ConfigFile: configPath, UsersFile: auth.UsersFilePath(configPath), DownloadPath: downloadPath}
+}
+
+func (p Paths) stateFile() string {
+	return filepath.Join(p.DownloadPath, manager.StateFileName)
+}
+
+func (p Paths) logDir() string {
+	return filepath.Join(p.DownloadPath, manager.LogDirName)
+}
+
+// Options select what a backup includes
+type Options struct {
+	Media bool // the files of finished downloads in the download directory
+}
+
+// mediaFile is a downloaded file to back up
+type mediaFile struct {
+	name string // path below the download directory, with forward slashes
+	path string
+	size int64
+}
+
+// Write writes an archive of the state at paths to w. A server that is
+// running should save its downloads first, see DownloadManager.SaveState.
+func Write(w io.Writer, paths Paths, opts Options) (*Manifest, error) {
+	downloadPath, err := filepath.Abs(paths.DownloadPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{Format: Format, Version: Version, CreatedAt: time.Now().UTC(), DownloadPath: downloadPath, Media: opts.Media}
+
+	config, err := os.ReadFile(paths.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	users, err := readOptional(paths.UsersFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+	if users != nil {
+		var file struct {
+			Users []json.RawMessage `json:"users"`
+		}
+		if err := json.Unmarshal(users, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse users file: %w", err)
+		}
+		manifest.Users = len(file.Users)
+	}
+	state, err := readOptional(paths.stateFile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	var downloads map[string]*core.Download
+	if state != nil {
+		var file manager.StateFile
+		if err := json.Unmarshal(state, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse state file: %w", err)
+		}
+		downloads = file.Downloads
+		manifest.Downloads = len(downloads)
+	}
+	logs, err := logFiles(paths.logDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list download logs: %w", err)
+	}
+	manifest.Logs = len(logs)
+	var media []mediaFile
+	if opts.Media {
+		media = mediaFiles(downloadPath, downloads)
+		for _, file := range media {
+			manifest.MediaFiles++
+			manifest.MediaBytes += file.size
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := addFile(tw, manifestName, data, 0644); err != nil {
+		return nil, err
+	}
+	if err := addFile(tw, configName, config, 0644); err != nil {
+		return nil, err
+	}
+	if users != nil {
+		if err := addFile(tw, usersName, users, 0600); err != nil {
+			return nil, err
+		}
+	}
+	if state != nil {
+		if err := addFile(tw, stateName, state, 0644); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range logs {
+		data, err := os.ReadFile(filepath.Join(paths.logDir(), name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read download log: %w", err)
+		}
+		if err := addFile(tw, path.Join(logsDir, name), data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range media {
+		if err := addFromDisk(tw, path.Join(mediaDir, file.name), file.path, file.size); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readOptional reads a file, returning nil if it does not exist
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// logFiles returns the names of the download logs in dir
+func logFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// mediaFiles returns the files of the finished downloads that are in the
+// download directory. Downloads sharing a file list it once.
+func mediaFiles(downloadPath string, downloads map[string]*core.Download) []mediaFile {
+	seen := make(map[string]bool)
+	var files []mediaFile
+	for _, download := range downloads {
+		if download.Status != core.StatusCompleted && download.Status != core.StatusAlreadyExists {
+			continue
+		}
+		name, ok := relativeTo(downloadPath, download.OutputPath)
+		if !ok || seen[name] {
+			continue
+		}
+		info, err := os.Stat(download.OutputPath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		seen[name] = true
+		files = append(files, mediaFile{name: name, path: download.OutputPath, size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files
+}
+
+// relativeTo returns the path of file below dir with forward slashes, and
+// false if file is not below dir
+func relativeTo(dir, file string) (string, bool) {
+	if file == "" {
+		return "", false
+	}
+	// Relative paths are relative to the working directory of the server
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func addFile(tw *tar.Writer, name string, data []byte, mode int64) error {
+	header := &tar.Header{Name: name, Mode: mode, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func addFromDisk(tw *tar.Writer, name, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// The file must not change size while it is written
+	if _, err := io.CopyN(tw, file, size); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return nil
+}
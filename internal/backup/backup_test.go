@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+)
+
+// newServer writes the files of a server with a completed and a queued
+// download to a new directory and returns their paths
+func newServer(t *testing.T) Paths {
+	t.Helper()
+	dir := t.TempDir()
+	paths := PathsFor(filepath.Join(dir, "config.json"), filepath.Join(dir, "downloads"))
+
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = paths.DownloadPath
+	if err := cfg.Save(paths.ConfigFile); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	store, err := auth.NewStore(paths.UsersFile)
+	if err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	if _, err := store.CreateUser("alice", "correct horse battery", auth.RoleUser); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	video := filepath.Join(paths.DownloadPath, "music", "video.mp4")
+	if err := os.MkdirAll(filepath.Dir(video), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(video, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	downloads := map[string]*core.Download{
+		"done":   {ID: "done", URL: "https://example.com/done", Status: core.StatusCompleted, OutputPath: video},
+		"queued": {ID: "queued", URL: "https://example.com/queued", Status: core.StatusQueued},
+	}
+	if err := manager.NewFileStore(paths.stateFile()).Save(downloads); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	if err := os.MkdirAll(paths.logDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(paths.logDir(), "done.json"), []byte(`{"lines":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	source := newServer(t)
+	var archive bytes.Buffer
+	manifest, err := Write(&archive, source, Options{Media: true})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if manifest.Users != 1 || manifest.Downloads != 2 || manifest.Logs != 1 || manifest.MediaFiles != 1 || manifest.MediaBytes != 5 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+
+	// Restore into another directory with another download path
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	downloadPath := filepath.Join(dir, "media")
+	data := archive.Bytes()
+
+	if _, err := Restore(bytes.NewReader(data), configPath, RestoreOptions{Check: true}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		t.Fatal("Check restored the config")
+	}
+
+	result, err := Restore(bytes.NewReader(data), configPath, RestoreOptions{DownloadPath: downloadPath})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if result.MediaFiles != 1 || result.DownloadPath != downloadPath {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	if _, err := config.Load(configPath); err != nil {
+		t.Errorf("Failed to load restored config: %v", err)
+	}
+	store, err := auth.NewStore(auth.UsersFilePath(configPath))
+	if err != nil {
+		t.Fatalf("Failed to load restored users: %v", err)
+	}
+	if _, err := store.Authenticate("alice", "correct horse battery"); err != nil {
+		t.Errorf("Restored user cannot log in: %v", err)
+	}
+	if info, err := os.Stat(auth.UsersFilePath(configPath)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Restored users file is not private: %v", err)
+	}
+
+	downloads, err := manager.NewFileStore(filepath.Join(downloadPath, manager.StateFileName)).Load()
+	if err != nil {
+		t.Fatalf("Failed to load restored state: %v", err)
+	}
+	video := filepath.Join(downloadPath, "music", "video.mp4")
+	if len(downloads) != 2 || downloads["done"].OutputPath != video {
+		t.Errorf("Downloads were not moved to the new download path: %+v", downloads["done"])
+	}
+	if data, err := os.ReadFile(video); err != nil || string(data) != "video" {
+		t.Errorf("Downloaded file was not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, manager.LogDirName, "done.json")); err != nil {
+		t.Errorf("Download log was not restored: %v", err)
+	}
+
+	// Existing files are kept
+	os.WriteFile(video, []byte("newer"), 0644)
+	result, err = Restore(bytes.NewReader(data), configPath, RestoreOptions{DownloadPath: downloadPath})
+	if err != nil {
+		t.Fatalf("Second restore failed: %v", err)
+	}
+	if len(result.Kept) != 1 || result.Kept[0] != "music/video.mp4" {
+		t.Errorf("Expected the existing file to be kept, got %v", result.Kept)
+	}
+	if data, _ := os.ReadFile(video); string(data) != "newer" {
+		t.Error("Existing file was replaced")
+	}
+}
+
+func TestBackupWithoutMedia(t *testing.T) {
+	var archive bytes.Buffer
+	if _, err := Write(&archive, newServer(t), Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for _, name := range archiveNames(t, archive.Bytes()) {
+		if strings.HasPrefix(name, mediaDir+"/") {
+			t.Errorf("Backup without media holds %s", name)
+		}
+	}
+}
+
+// archiveNames lists the files of an archive
+func archiveNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	return names
+}
+
+// buildArchive writes an archive with the given files in order
+func buildArchive(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		if err := addFile(tw, file[0], []byte(file[1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestRestoreRejectsInvalidArchives(t *testing.T) {
+	manifest := func(version int) string {
+		data, _ := json.Marshal(Manifest{Format: Format, Version: version})
+		return string(data)
+	}
+	cfg := config.DefaultConfig()
+	configData, _ := json.Marshal(cfg)
+	invalidConfig := *cfg
+	invalidConfig.Port = 0
+	invalidConfigData, _ := json.Marshal(&invalidConfig)
+	outsideData, _ := json.Marshal(manager.StateFile{Version: manager.StateVersion, Downloads: map[string]*core.Download{
+		"evil": {ID: "evil", URL: "https://example.com/evil", Status: core.StatusCompleted, OutputPath: "/etc/passwd"},
+	}})
+	outsideState := string(outsideData)
+
+	tests := []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{"not gzip", []byte("plain text"), "not a backup archive"},
+		{"no manifest", buildArchive(t, [2]string{configName, string(configData)}), "manifest.json is missing"},
+		{"other format", buildArchive(t, [2]string{manifestName, `{"format":"other","version":1}`}), "format is"},
+		{"newer version", buildArchive(t, [2]string{manifestName, manifest(Version + 1)}, [2]string{configName, string(configData)}), "newer"},
+		{"path traversal", buildArchive(t, [2]string{manifestName, manifest(Version)}, [2]string{"media/../../evil", "x"}), "unexpected file"},
+		{"unknown file", buildArchive(t, [2]string{manifestName, manifest(Version)}, [2]string{"other.json", "{}"}), "unexpected file"},
+		{"no config", buildArchive(t, [2]string{manifestName, manifest(Version)}), "no config.json"},
+		{"invalid config", buildArchive(t, [2]string{manifestName, manifest(Version)}, [2]string{configName, string(invalidConfigData)}), "invalid config.json"},
+		{"invalid state", buildArchive(t, [2]string{manifestName, manifest(Version)}, [2]string{configName, string(configData)}, [2]string{stateName, `{"version":"0.1"}`}), "state.json has version"},
+		{"file outside download directory", buildArchive(t, [2]string{manifestName, manifest(Version)}, [2]string{configName, string(configData)}, [2]string{stateName, outsideState}), "outside the download directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "config.json")
+			_, err := Restore(bytes.NewReader(tt.archive), configPath, RestoreOptions{DownloadPath: filepath.Join(dir, "downloads")})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Expected error containing %q, got %v", tt.want, err)
+			}
+			if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+				t.Error("A rejected archive changed the config")
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Restore left files behind: %v", entries)
+			}
+		})
+	}
+}
+
+func TestApplyPending(t *testing.T) {
+	source := newServer(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+
+	if result, err := ApplyPending(configPath, ""); result != nil || err != nil {
+		t.Fatalf("Expected nothing to restore, got %v, %v", result, err)
+	}
+
+	var archive bytes.Buffer
+	if _, err := Write(&archive, source, Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := os.WriteFile(PendingFile(configPath), archive.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ApplyPending(configPath, filepath.Join(dir, "downloads"))
+	if err != nil || result == nil {
+		t.Fatalf("ApplyPending failed: %v", err)
+	}
+	if _, err := os.Stat(PendingFile(configPath)); !os.IsNotExist(err) {
+		t.Error("Restored archive was not removed")
+	}
+
+	// A broken archive is set aside
+	os.WriteFile(PendingFile(configPath), []byte("broken"), 0600)
+	if _, err := ApplyPending(configPath, ""); err == nil {
+		t.Fatal("Expected broken archive to fail")
+	}
+	if _, err := os.Stat(PendingFile(configPath) + ".failed"); err != nil {
+		t.Errorf("Broken archive was not kept: %v", err)
+	}
+}
+
+func TestApplyPendingKeepsLockedSettings(t *testing.T) {
+	source := newServer(t)
+	cfg, err := config.Load(source.ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.YtDlpPath = "/tmp/evil"
+	cfg.DisableAuth = true
+	cfg.LockedSettings = []string{}
+	cfg.MaxConcurrentDownloads = 7
+	if err := cfg.Save(source.ConfigFile); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := Write(&archive, source, Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	current := config.DefaultConfig()
+	current.DownloadPath = filepath.Join(dir, "downloads")
+	if err := current.Save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(PendingFile(configPath), archive.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyPending(configPath, ""); err != nil {
+		t.Fatalf("ApplyPending failed: %v", err)
+	}
+
+	restored, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load restored config: %v", err)
+	}
+	if restored.YtDlpPath != current.YtDlpPath || restored.DisableAuth || len(restored.LockedSettings) != len(current.LockedSettings) || restored.DownloadPath != current.DownloadPath {
+		t.Errorf("Expected the locked settings to be kept, got %+v", restored)
+	}
+	if restored.MaxConcurrentDownloads != 7 {
+		t.Errorf("Expected the other settings to be restored, got %d concurrent downloads", restored.MaxConcurrentDownloads)
+	}
+	downloads, err := manager.NewFileStore(filepath.Join(current.DownloadPath, manager.StateFileName)).Load()
+	if err != nil || len(downloads) != 2 {
+		t.Fatalf("Expected the downloads in the current download directory, got %v, %v", downloads, err)
+	}
+}
@@ -0,0 +1,50 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+
+	"gogetmedia/internal/config"
+)
+
+// pendingFileName is the archive a running server staged for restore
+const pendingFileName = ".gogetmedia_restore.tar.gz"
+
+// PendingFile returns the path of the archive that is restored at the next
+// start of the server with the config file at configPath. A running server
+// cannot restore itself, it would save its own state over the restored one.
+func PendingFile(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), pendingFileName)
+}
+
+// ApplyPending restores the staged archive, if there is one, and removes it.
+// It returns nil if nothing was staged. The locked settings of the current
+// config are kept. An archive that fails to restore is renamed to end in
+// .failed so the server still starts.
+func ApplyPending(configPath, downloadPath string) (*Result, error) {
+	pending := PendingFile(configPath)
+	file, err := os.Open(pending)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opts := RestoreOptions{DownloadPath: downloadPath}
+	if _, err := os.Stat(configPath); err == nil {
+		opts.Current, err = config.Load(configPath)
+		if err != nil {
+			file.Close()
+			os.Rename(pending, pending+".failed")
+			return nil, err
+		}
+	}
+	result, err := Restore(file, configPath, opts)
+	file.Close()
+	if err != nil {
+		os.Rename(pending, pending+".failed")
+		return nil, err
+	}
+	return result, os.Remove(pending)
+}
@@ -0,0 +1,345 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/manager"
+)
+
+// migrations upgrade the contents of an extracted archive by one version
+// each: migrations[0] turns a version 1 archive into version 2, and so on.
+// Version 1 is the first, there are none yet.
+var migrations []func(dir string, manifest *Manifest) error
+
+// RestoreOptions control a restore
+type RestoreOptions struct {
+	// DownloadPath overrides the download directory of the restored config,
+	// like the -download-path flag of the server
+	DownloadPath string
+
+	// Check only reads and validates the archive
+	Check bool
+
+	// Current is the config being replaced, for archives that were uploaded
+	// through the API. Its locked settings are kept, they cannot be changed
+	// through the API.
+	Current *config.Config
+}
+
+// Result describes a restore
+type Result struct {
+	Manifest     Manifest `json:"manifest"`
+	DownloadPath string   `json:"download_path,omitempty"` // where the downloads were restored
+	MediaFiles   int      `json:"media_files"`             // downloaded files written
+	Kept         []string `json:"kept,omitempty"`          // downloaded files that already existed and were kept
+}
+
+// Restore validates the archive in r and, unless opts.Check is set, replaces
+// the state of the server with the config file at configPath by it. The
+// archive is read and checked completely before anything is changed. Files
+// missing from the archive are left alone, and downloaded files that already
+// exist are kept. The server must not be running.
+func Restore(r io.Reader, configPath string, opts RestoreOptions) (*Result, error) {
+	staging, err := os.MkdirTemp(filepath.Dir(configPath), ".gogetmedia_restore-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	manifest, err := extract(r, staging)
+	if err != nil {
+		return nil, err
+	}
+	for version := manifest.Version; version < Version; version++ {
+		if err := migrations[version-1](staging, manifest); err != nil {
+			return nil, fmt.Errorf("failed to upgrade archive from version %d: %w", version, err)
+		}
+		manifest.Version = version + 1
+	}
+	cfg, state, err := validate(staging)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		// Removing a download with its files deletes them, so they must be
+		// downloaded files
+		for id, download := range state.Downloads {
+			if _, ok := relativeTo(manifest.DownloadPath, download.OutputPath); download.OutputPath != "" && !ok {
+				return nil, fmt.Errorf("invalid %s: file of download %s is outside the download directory", stateName, id)
+			}
+		}
+	}
+	if opts.Current != nil {
+		cfg.KeepLocked(opts.Current)
+	}
+
+	result := &Result{Manifest: *manifest}
+	if opts.Check {
+		return result, nil
+	}
+
+	downloadPath := opts.DownloadPath
+	if downloadPath == "" {
+		downloadPath = cfg.DownloadPath
+	}
+	downloadPath, err = filepath.Abs(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	result.DownloadPath = downloadPath
+	paths := PathsFor(configPath, downloadPath)
+	if err := os.MkdirAll(downloadPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	// Downloaded files first, the state refers to them
+	err = filepath.WalkDir(filepath.Join(staging, mediaDir), func(file string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(filepath.Join(staging, mediaDir), file)
+		target := filepath.Join(downloadPath, rel)
+		if _, err := os.Stat(target); err == nil {
+			result.Kept = append(result.Kept, filepath.ToSlash(rel))
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := moveFile(file, target); err != nil {
+			return err
+		}
+		result.MediaFiles++
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to restore downloaded files: %w", err)
+	}
+
+	logs, err := logFiles(filepath.Join(staging, logsDir))
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) > 0 {
+		if err := os.MkdirAll(paths.logDir(), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+	}
+	for _, name := range logs {
+		if err := moveFile(filepath.Join(staging, logsDir, name), filepath.Join(paths.logDir(), name)); err != nil {
+			return nil, fmt.Errorf("failed to restore download log: %w", err)
+		}
+	}
+
+	if state != nil {
+		// Downloads below the old download directory move to the new one
+		for _, download := range state.Downloads {
+			if rel, ok := relativeTo(manifest.DownloadPath, download.OutputPath); ok {
+				download.OutputPath = filepath.Join(downloadPath, filepath.FromSlash(rel))
+			}
+		}
+		if err := manager.NewFileStore(paths.stateFile()).Save(state.Downloads); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(staging, usersName)); err == nil {
+		if err := moveFile(filepath.Join(staging, usersName), paths.UsersFile); err != nil {
+			return nil, fmt.Errorf("failed to restore users file: %w", err)
+		}
+		os.Chmod(paths.UsersFile, 0600)
+	}
+	if err := cfg.Save(paths.ConfigFile); err != nil {
+		return nil, fmt.Errorf("failed to restore config file: %w", err)
+	}
+
+	return result, nil
+}
+
+// extract reads an archive into dir and returns its manifest. Only the files
+// an archive can hold are accepted.
+func extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest *Manifest
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("archive holds %s, which is not a regular file", header.Name)
+		}
+
+		// The manifest comes first, so archives of newer versions are refused
+		// before anything else is read
+		if manifest == nil {
+			if header.Name != manifestName {
+				return nil, fmt.Errorf("not a backup archive: %s is missing", manifestName)
+			}
+			if manifest, err = readManifest(tr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		name, ok := archiveName(header.Name)
+		if !ok {
+			return nil, fmt.Errorf("archive holds unexpected file %s", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+		_, err = io.Copy(file, tr)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("not a backup archive: %s is missing", manifestName)
+	}
+
+	// Reading to the end checks the gzip checksum
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, fmt.Errorf("archive is damaged: %w", err)
+	}
+	return manifest, nil
+}
+
+func readManifest(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("not a backup archive: format is %q", manifest.Format)
+	}
+	if manifest.Version < 1 {
+		return nil, fmt.Errorf("invalid archive version %d", manifest.Version)
+	}
+	if manifest.Version > Version {
+		return nil, fmt.Errorf("archive version %d is newer than this version of GoGetMedia supports (%d), update it first", manifest.Version, Version)
+	}
+	return &manifest, nil
+}
+
+// archiveName cleans the name of a file in an archive and reports whether an
+// archive can hold it
+func archiveName(name string) (string, bool) {
+	name = path.Clean(name)
+	switch {
+	case name == configName, name == usersName, name == stateName:
+		return name, true
+	case path.Dir(name) == logsDir:
+		return name, strings.HasSuffix(name, ".json")
+	case strings.HasPrefix(name, mediaDir+"/"):
+		return name, !strings.Contains("/"+name+"/", "/../")
+	default:
+		return "", false
+	}
+}
+
+// validate checks the extracted files and returns the config and the state,
+// nil if the archive has none
+func validate(dir string) (*config.Config, *manager.StateFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, configName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("archive has no %s", configName)
+	}
+	// Like config.Load, settings missing from the file keep their defaults
+	cfg := config.DefaultConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", configName, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", configName, err)
+	}
+
+	if _, err := auth.NewStore(filepath.Join(dir, usersName)); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", usersName, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, stateName))
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var state manager.StateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", stateName, err)
+	}
+	if state.Version != manager.StateVersion {
+		return nil, nil, fmt.Errorf("%s has version %q, expected %q", stateName, state.Version, manager.StateVersion)
+	}
+	for id, download := range state.Downloads {
+		if download == nil || download.ID != id || download.URL == "" {
+			return nil, nil, fmt.Errorf("invalid %s: download %s is incomplete", stateName, id)
+		}
+	}
+	return cfg, &state, nil
+}
+
+// moveFile moves a file, copying it when it is on another file system
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	temp := to + ".tmp"
+	target, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, to)
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Remove(from)
+}
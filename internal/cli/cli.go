@@ -0,0 +1,562 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gogetmedia/pkg/apitypes"
+	"gogetmedia/pkg/client"
+)
+
+// DefaultServer is used when neither -server nor GOGETMEDIA_SERVER is set
+const DefaultServer = "http://127.0.0.1:8080"
+
+// defaultTimeout limits a single API request
+const defaultTimeout = 30 * time.Second
+
+// errUsage reports invalid arguments, after the usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+// command is a client subcommand
+type command struct {
+	summary string
+	run     func(a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"add":          {"Add downloads", runAdd},
+	"list":         {"List downloads", runList},
+	"watch":        {"Show live progress of downloads", runWatch},
+	"cancel":       {"Cancel downloads", actionCommand("cancel", "cancelled", (*client.Client).CancelDownload)},
+	"pause":        {"Pause downloads", actionCommand("pause", "paused", (*client.Client).PauseDownload)},
+	"resume":       {"Resume paused downloads", actionCommand("resume", "resumed", (*client.Client).ResumeDownload)},
+	"retry":        {"Retry failed downloads", actionCommand("retry", "retried", (*client.Client).RetryDownload)},
+	"rm":           {"Remove downloads", actionCommand("rm", "removed", (*client.Client).DeleteDownload)},
+	"config":       {"Show or change settings (config get [key...], config set key=value...)", runConfig},
+	"update-ytdlp": {"Update yt-dlp on the server", runUpdateYtDlp},
+	"help":         {"Show this help", nil},
+}
+
+// IsCommand reports whether name is a client subcommand
+func IsCommand(name string) bool {
+	_, exists := commands[name]
+	return exists
+}
+
+// Run runs a client subcommand against a running server and returns the
+// process exit code. args starts with the subcommand name.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" {
+		printUsage(stdout)
+		return 0
+	}
+	cmd, exists := commands[args[0]]
+	if !exists {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+
+	a := &app{stdout: stdout, stderr: stderr}
+	err := cmd.run(a, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "Error: %v\n", explain(err))
+		return 1
+	}
+}
+
+// explain adds a hint on how to authenticate to authentication errors
+func explain(err error) error {
+	if client.StatusCode(err) == http.StatusUnauthorized {
+		return fmt.Errorf("%w (set GOGETMEDIA_TOKEN or use -token)", err)
+	}
+	return err
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gogetmedia <command> [flags] [arguments]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Without a command the server is started. Commands talk to a running server:")
+	fmt.Fprintln(w, "")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "The server and API token are read from GOGETMEDIA_SERVER and GOGETMEDIA_TOKEN,")
+	fmt.Fprintln(w, "or the -server and -token flags. Run 'gogetmedia <command> -h' for its flags.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "These commands work on the files of the server instead:")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "  backup   Write the config, users, downloads and logs to an archive")
+	fmt.Fprintln(w, "  restore  Restore an archive written by backup, with the server stopped")
+}
+
+// app holds the options shared by all commands
+type app struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	server   string
+	token    string
+	output   string
+	insecure bool
+
+	httpClient *http.Client
+	client     *client.Client
+}
+
+// flagSet creates the flags of a command, including the shared ones
+func (a *app) flagSet(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: gogetmedia %s [flags] %s\n\nFlags:\n", name, arguments)
+		fs.PrintDefaults()
+	}
+
+	server := os.Getenv("GOGETMEDIA_SERVER")
+	if server == "" {
+		server = DefaultServer
+	}
+	fs.StringVar(&a.server, "server", server, "Server URL (GOGETMEDIA_SERVER)")
+	fs.StringVar(&a.token, "token", os.Getenv("GOGETMEDIA_TOKEN"), "API token (GOGETMEDIA_TOKEN)")
+	fs.StringVar(&a.output, "output", "table", "Output format: table or json")
+	fs.BoolVar(&a.insecure, "insecure", false, "Accept any TLS certificate, e.g. a self-signed one")
+	return fs
+}
+
+// parse parses the arguments of a command and connects the client
+func (a *app) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if a.output != "table" && a.output != "json" {
+		fmt.Fprintf(a.stderr, "Invalid -output %q, use table or json\n", a.output)
+		return errUsage
+	}
+	if parsed, err := url.Parse(a.server); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		fmt.Fprintf(a.stderr, "Invalid -server %q, use a URL such as %s\n", a.server, DefaultServer)
+		return errUsage
+	}
+	a.connect()
+	return nil
+}
+
+// connect creates the API client for the parsed options
+func (a *app) connect() {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if a.insecure {
+		// For servers using the generated self-signed certificate
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	a.httpClient = &http.Client{Timeout: defaultTimeout, Transport: transport}
+	a.client = client.New(a.server, client.WithToken(a.token), client.WithHTTPClient(a.httpClient))
+}
+
+// requireArgs prints the usage and fails when a command got no arguments
+func requireArgs(fs *flag.FlagSet) error {
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// printJSON writes v as indented JSON
+func (a *app) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func runAdd(a *app, args []string) error {
+	fs := a.flagSet("add", "URL...")
+	downloadType := fs.String("type", "video", "Download type: video or audio")
+	quality := fs.String("quality", "best", "Quality, e.g. best, 1080p, 720p")
+	format := fs.String("format", "", "Format, e.g. mp4 or mp3 (default mp4 for video, mp3 for audio)")
+	playlist := fs.Bool("playlist", false, "Download every video of a playlist URL")
+	first := fs.Bool("first", false, "Only download the first video of a playlist URL")
+	startAt := fs.String("start-at", "", "Earliest start time (RFC 3339)")
+	rateLimit := fs.Int("rate-limit", 0, "Download speed limit in KiB/s, 0 uses the server's")
+	if err := a.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs); err != nil {
+		return err
+	}
+	if *downloadType != "video" && *downloadType != "audio" {
+		fmt.Fprintf(a.stderr, "Invalid -type %q, use video or audio\n", *downloadType)
+		return errUsage
+	}
+	if *playlist && *first {
+		fmt.Fprintln(a.stderr, "Use either -playlist or -first")
+		return errUsage
+	}
+	if *format == "" {
+		*format = "mp4"
+		if *downloadType == "audio" {
+			*format = "mp3"
+		}
+	}
+
+	request := apitypes.DownloadRequest{
+		Type:          *downloadType,
+		Quality:       *quality,
+		Format:        *format,
+		RateLimitKBps: *rateLimit,
+	}
+	if *startAt != "" {
+		t, err := time.Parse(time.RFC3339, *startAt)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Invalid -start-at %q, use RFC 3339 such as 2024-01-02T03:00:00Z\n", *startAt)
+			return errUsage
+		}
+		request.StartAt = &t
+	}
+
+	ctx := context.Background()
+	var added []*apitypes.Download
+	var failed int
+	for _, rawURL := range fs.Args() {
+		request.URL = rawURL
+		var download *apitypes.Download
+		var err error
+		switch {
+		case *playlist:
+			var response *apitypes.PlaylistResponse
+			if response, err = a.client.AddPlaylist(ctx, request); err == nil {
+				download = response.FirstDownload
+			}
+		case *first:
+			download, err = a.client.AddFirstVideo(ctx, request)
+		default:
+			download, err = a.client.AddDownload(ctx, request)
+		}
+		if err != nil {
+			fmt.Fprintf(a.stderr, "%s: %v\n", rawURL, explain(err))
+			failed++
+			continue
+		}
+		if download != nil {
+			added = append(added, download)
+			if a.output == "table" {
+				fmt.Fprintf(a.stdout, "Added %s  %s\n", download.ID, displayTitle(download))
+			}
+		}
+	}
+
+	if a.output == "json" {
+		if err := a.printJSON(added); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d URLs could not be added", failed, fs.NArg())
+	}
+	return nil
+}
+
+// fetchDownloads returns the downloads on the server, oldest first
+func (a *app) fetchDownloads(ctx context.Context) ([]*apitypes.Download, error) {
+	downloads, err := a.client.ListDownloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(downloads, func(i, j int) bool {
+		if !downloads[i].CreatedAt.Equal(downloads[j].CreatedAt) {
+			return downloads[i].CreatedAt.Before(downloads[j].CreatedAt)
+		}
+		return downloads[i].ID < downloads[j].ID
+	})
+	return downloads, nil
+}
+
+// filterStatus keeps the downloads with one of the comma-separated statuses
+func filterStatus(downloads []*apitypes.Download, statuses string) []*apitypes.Download {
+	if statuses == "" {
+		return downloads
+	}
+	wanted := make(map[apitypes.DownloadStatus]bool)
+	for _, status := range strings.Split(statuses, ",") {
+		wanted[apitypes.DownloadStatus(strings.TrimSpace(status))] = true
+	}
+	var filtered []*apitypes.Download
+	for _, download := range downloads {
+		if wanted[download.Status] {
+			filtered = append(filtered, download)
+		}
+	}
+	return filtered
+}
+
+func runList(a *app, args []string) error {
+	fs := a.flagSet("list", "")
+	status := fs.String("status", "", "Only show downloads with these comma-separated statuses, e.g. failed,queued")
+	if err := a.parse(fs, args); err != nil {
+		return err
+	}
+
+	downloads, err := a.fetchDownloads(context.Background())
+	if err != nil {
+		return err
+	}
+	downloads = filterStatus(downloads, *status)
+
+	if a.output == "json" {
+		if downloads == nil {
+			downloads = []*apitypes.Download{}
+		}
+		return a.printJSON(downloads)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tPROGRESS\tTYPE\tADDED\tTITLE")
+	for _, download := range downloads {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s/%s\t%s\t%s\n",
+			download.ID, download.Status, download.Progress.Percentage, download.Type, download.Format,
+			download.CreatedAt.Local().Format("2006-01-02 15:04"), displayTitle(download))
+	}
+	return tw.Flush()
+}
+
+// actionCommand returns a command that applies an action to each download ID
+// and reports done for each one that succeeded
+func actionCommand(name, done string, action func(c *client.Client, ctx context.Context, id string) error) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		fs := a.flagSet(name, "ID...")
+		if err := a.parse(fs, args); err != nil {
+			return err
+		}
+		if err := requireArgs(fs); err != nil {
+			return err
+		}
+
+		type result struct {
+			ID     string `json:"id"`
+			Status string `json:"status,omitempty"`
+			Error  string `json:"error,omitempty"`
+		}
+		var results []result
+		var failed int
+		for _, id := range fs.Args() {
+			if err := action(a.client, context.Background(), id); err != nil {
+				err = explain(err)
+				results = append(results, result{ID: id, Error: err.Error()})
+				if a.output == "table" {
+					fmt.Fprintf(a.stderr, "%s: %v\n", id, err)
+				}
+				failed++
+				continue
+			}
+			results = append(results, result{ID: id, Status: done})
+			if a.output == "table" {
+				fmt.Fprintf(a.stdout, "%s: %s\n", id, done)
+			}
+		}
+
+		if a.output == "json" {
+			if err := a.printJSON(results); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%s failed for %d of %d downloads", name, failed, fs.NArg())
+		}
+		return nil
+	}
+}
+
+func runConfig(a *app, args []string) error {
+	if len(args) == 0 || (args[0] != "get" && args[0] != "set") {
+		fmt.Fprintln(a.stderr, "Usage: gogetmedia config get [flags] [key...]")
+		fmt.Fprintln(a.stderr, "       gogetmedia config set [flags] key=value...")
+		return errUsage
+	}
+	if args[0] == "get" {
+		return runConfigGet(a, args[1:])
+	}
+	return runConfigSet(a, args[1:])
+}
+
+func runConfigGet(a *app, args []string) error {
+	fs := a.flagSet("config get", "[key...]")
+	if err := a.parse(fs, args); err != nil {
+		return err
+	}
+
+	response, err := a.client.GetConfig(context.Background())
+	if err != nil {
+		return err
+	}
+	settings, err := settingsMap(response)
+	if err != nil {
+		return err
+	}
+
+	keys := fs.Args()
+	if len(keys) == 0 {
+		if a.output == "json" {
+			return a.printJSON(settings)
+		}
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+
+	selected := make(map[string]json.RawMessage)
+	for _, key := range keys {
+		value, exists := settings[key]
+		if !exists {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		selected[key] = value
+	}
+	if a.output == "json" {
+		return a.printJSON(selected)
+	}
+
+	for _, key := range keys {
+		value := selected[key]
+		var text string
+		if err := json.Unmarshal(value, &text); err != nil {
+			text = string(value)
+		}
+		if len(fs.Args()) == 1 {
+			fmt.Fprintln(a.stdout, text)
+		} else {
+			fmt.Fprintf(a.stdout, "%s = %s\n", key, text)
+		}
+	}
+	return nil
+}
+
+func runConfigSet(a *app, args []string) error {
+	fs := a.flagSet("config set", "key=value...")
+	if err := a.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs); err != nil {
+		return err
+	}
+
+	// Values are JSON where they parse as JSON, e.g. numbers, booleans and
+	// lists, and plain strings otherwise
+	changes := make(map[string]interface{})
+	for _, arg := range fs.Args() {
+		key, value, found := strings.Cut(arg, "=")
+		if !found || key == "" {
+			fmt.Fprintf(a.stderr, "Invalid setting %q, use key=value\n", arg)
+			return errUsage
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		changes[key] = parsed
+	}
+
+	response, err := a.client.UpdateConfig(context.Background(), changes)
+	if err != nil {
+		return err
+	}
+	settings, err := settingsMap(response)
+	if err != nil {
+		return err
+	}
+	for key := range changes {
+		if _, exists := settings[key]; !exists {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+
+	if a.output == "json" {
+		return a.printJSON(settings)
+	}
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(a.stdout, "%s = %s\n", key, settings[key])
+	}
+	return nil
+}
+
+// settingsMap returns the settings of a configuration by their JSON names
+func settingsMap(response *apitypes.ConfigResponse) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func runUpdateYtDlp(a *app, args []string) error {
+	fs := a.flagSet("update-ytdlp", "")
+	if err := a.parse(fs, args); err != nil {
+		return err
+	}
+	// Downloading the new release can take a while
+	a.httpClient.Timeout = 10 * time.Minute
+
+	ctx := context.Background()
+	status, err := a.client.UpdateYtDlp(ctx)
+	if err != nil {
+		return err
+	}
+	response := map[string]string{"status": status.Status, "message": status.Message}
+	if versions, err := a.client.GetVersions(ctx); err == nil && versions.YtDlpVersion != "" {
+		response["version"] = versions.YtDlpVersion
+	}
+
+	if a.output == "json" {
+		return a.printJSON(response)
+	}
+	fmt.Fprintln(a.stdout, response["message"])
+	if version := response["version"]; version != "" {
+		fmt.Fprintf(a.stdout, "yt-dlp version: %s\n", version)
+	}
+	return nil
+}
+
+// displayTitle returns the title of a download, or its URL until the title is known
+func displayTitle(download *apitypes.Download) string {
+	if download.Title != "" {
+		return download.Title
+	}
+	return download.URL
+}
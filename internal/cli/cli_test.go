@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gogetmedia/pkg/apitypes"
+)
+
+// fakeServer answers the API routes the commands use and records request bodies
+type fakeServer struct {
+	mutex     sync.Mutex
+	downloads []*apitypes.Download
+	bodies    []map[string]interface{}
+	config    map[string]interface{}
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	s.bodies = append(s.bodies, body)
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v1/downloads":
+		json.NewEncoder(w).Encode(apitypes.DownloadList{Downloads: s.downloads, Total: len(s.downloads)})
+	case r.Method == "POST" && r.URL.Path == "/api/v1/downloads":
+		download := &apitypes.Download{ID: "3", URL: body["url"].(string), Status: apitypes.StatusQueued}
+		s.downloads = append(s.downloads, download)
+		json.NewEncoder(w).Encode(download)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/downloads/1/pause":
+		json.NewEncoder(w).Encode(map[string]string{"status": "paused"})
+	case r.Method == "DELETE" && r.URL.Path == "/api/v1/downloads/1":
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && r.URL.Path == "/api/v1/config":
+		json.NewEncoder(w).Encode(s.config)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/config":
+		for key, value := range body {
+			s.config[key] = value
+		}
+		json.NewEncoder(w).Encode(s.config)
+	default:
+		http.Error(w, "Download not found", http.StatusNotFound)
+	}
+}
+
+func newFakeServer() *fakeServer {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &fakeServer{
+		downloads: []*apitypes.Download{
+			{ID: "2", Title: "Second", Status: apitypes.StatusDownloading, CreatedAt: created.Add(time.Minute), Progress: apitypes.DownloadProgress{Percentage: 42}},
+			{ID: "1", Title: "First", Status: apitypes.StatusCompleted, CreatedAt: created, Progress: apitypes.DownloadProgress{Percentage: 100}},
+		},
+		config: map[string]interface{}{"max_concurrent_downloads": 3, "download_path": "/downloads"},
+	}
+}
+
+// run runs a command against server and returns its exit code and output
+func run(server *httptest.Server, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	words := 1
+	if args[0] == "config" {
+		words = 2
+	}
+	flags := []string{"-server", server.URL, "-token", "secret"}
+	args = append(append(append([]string{}, args[:words]...), flags...), args[words:]...)
+	code := Run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	fake := newFakeServer()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// Listing sorts oldest first and filters by status
+	code, stdout, stderr := run(server, "list", "-output", "json")
+	var listed []*apitypes.Download
+	if code != 0 || json.Unmarshal([]byte(stdout), &listed) != nil {
+		t.Fatalf("list failed with %d: %s", code, stderr)
+	}
+	if len(listed) != 2 || listed[0].ID != "1" {
+		t.Errorf("Expected downloads oldest first, got %v", listed)
+	}
+	if _, stdout, _ := run(server, "list", "-status", "downloading"); !strings.Contains(stdout, "Second") || strings.Contains(stdout, "First") {
+		t.Errorf("Expected only the downloading entry, got:\n%s", stdout)
+	}
+
+	// Adding posts the request with the default audio format
+	code, stdout, stderr = run(server, "add", "-type", "audio", "https://example.com/a")
+	if code != 0 || !strings.Contains(stdout, "Added 3") {
+		t.Fatalf("add failed with %d: %s%s", code, stdout, stderr)
+	}
+	if body := fake.bodies[len(fake.bodies)-1]; body["format"] != "mp3" || body["url"] != "https://example.com/a" {
+		t.Errorf("Unexpected add request: %v", body)
+	}
+
+	// Actions report each ID and fail if one of them fails
+	code, stdout, _ = run(server, "pause", "1", "missing")
+	if code != 1 || !strings.Contains(stdout, "1: paused") {
+		t.Errorf("Expected pause to report the failure, got %d: %s", code, stdout)
+	}
+
+	// Removing succeeds without a response body
+	if code, stdout, stderr := run(server, "rm", "1"); code != 0 || !strings.Contains(stdout, "1: removed") {
+		t.Errorf("Expected rm to succeed, got %d: %s%s", code, stdout, stderr)
+	}
+
+	// Settings are read and changed by key, with JSON values
+	if _, stdout, _ := run(server, "config", "get", "download_path"); strings.TrimSpace(stdout) != "/downloads" {
+		t.Errorf("Expected the download path, got %q", stdout)
+	}
+	if code, _, stderr := run(server, "config", "set", "max_concurrent_downloads=5"); code != 0 {
+		t.Fatalf("config set failed: %s", stderr)
+	}
+	if fake.config["max_concurrent_downloads"] != float64(5) {
+		t.Errorf("Expected a numeric setting, got %v", fake.config["max_concurrent_downloads"])
+	}
+
+	// Missing or invalid arguments are usage errors
+	if code, _, _ := run(server, "rm"); code != 2 {
+		t.Errorf("Expected exit code 2 without IDs, got %d", code)
+	}
+	if code, _, _ := run(server, "list", "-output", "xml"); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown output format, got %d", code)
+	}
+
+	// Without a token the server refuses the request
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if code := Run([]string{"list", "-server", server.URL, "-token", ""}, &stdoutBuf, &stderrBuf); code != 1 || !strings.Contains(stderrBuf.String(), "GOGETMEDIA_TOKEN") {
+		t.Errorf("Expected an authentication error, got %d: %s", code, stderrBuf.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	fake := newFakeServer()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	a := &app{stdout: &stdout, stderr: &stderr, output: "table", server: server.URL, token: "secret"}
+	a.connect()
+
+	// Finishes once the watched download completes
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fake.mutex.Lock()
+		fake.downloads[0].Status = apitypes.StatusCompleted
+		fake.downloads[0].Progress.Percentage = 100
+		fake.mutex.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.watch(ctx, []string{"2"}, 20*time.Millisecond); err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "42.0%") || !strings.Contains(out, "100.0%") {
+		t.Errorf("Expected progress lines, got:\n%s", out)
+	}
+
+	if err := a.watch(ctx, []string{"missing"}, 20*time.Millisecond); err == nil {
+		t.Error("Expected an error for an unknown download")
+	}
+
+	if bar := progressBar(50); bar != "["+strings.Repeat("#", 15)+strings.Repeat("-", 15)+"]" {
+		t.Errorf("Unexpected progress bar %s", bar)
+	}
+}
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"gogetmedia/pkg/apitypes"
+)
+
+// progressBarWidth is the number of characters of a progress bar
+const progressBarWidth = 30
+
+// isFinished reports whether a download will not change without user action
+func isFinished(download *apitypes.Download) bool {
+	switch download.Status {
+	case apitypes.StatusCompleted, apitypes.StatusFailed, apitypes.StatusCancelled, apitypes.StatusAlreadyExists:
+		return true
+	}
+	return false
+}
+
+// isTerminal reports whether w is an interactive terminal, where progress
+// bars can be redrawn in place
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar renders a bar for a percentage between 0 and 100
+func progressBar(percentage float64) string {
+	if percentage < 0 {
+		percentage = 0
+	}
+	if percentage > 100 {
+		percentage = 100
+	}
+	filled := int(percentage / 100 * progressBarWidth)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "]"
+}
+
+// progressLine describes the state of a download on one line
+func progressLine(download *apitypes.Download) string {
+	line := fmt.Sprintf("%-20s %s %5.1f%% %-15s", download.ID, progressBar(download.Progress.Percentage), download.Progress.Percentage, download.Status)
+	switch {
+	case download.Status == apitypes.StatusDownloading && download.Progress.Speed != "":
+		line += fmt.Sprintf(" %10s ETA %-8s", download.Progress.Speed, download.Progress.ETA)
+	case download.Error != "":
+		line += " " + download.Error
+	case download.StatusMessage != "":
+		line += " " + download.StatusMessage
+	}
+	return line + "  " + displayTitle(download)
+}
+
+func runWatch(a *app, args []string) error {
+	fs := a.flagSet("watch", "[ID...]")
+	interval := fs.Duration("interval", time.Second, "How often to refresh")
+	if err := a.parse(fs, args); err != nil {
+		return err
+	}
+	if *interval < 100*time.Millisecond {
+		fmt.Fprintln(a.stderr, "The -interval must be at least 100ms")
+		return errUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return a.watch(ctx, fs.Args(), *interval)
+}
+
+// watch shows the progress of the downloads with the given IDs until they have
+// all finished, or of all unfinished downloads until ctx ends. It fails if a
+// watched download does not complete.
+func (a *app) watch(ctx context.Context, ids []string, interval time.Duration) error {
+	terminal := a.output == "table" && isTerminal(a.stdout)
+	last := make(map[string]string) // last reported state per download, when not redrawing
+	drawn := 0                      // lines drawn in the terminal
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		downloads, err := a.fetchDownloads(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		watched, missing := selectWatched(downloads, ids)
+		if len(missing) > 0 {
+			return fmt.Errorf("download not found: %s", strings.Join(missing, ", "))
+		}
+
+		switch {
+		case terminal:
+			if drawn > 0 {
+				fmt.Fprintf(a.stdout, "\033[%dA\033[J", drawn)
+			}
+			for _, download := range watched {
+				fmt.Fprintln(a.stdout, progressLine(download))
+			}
+			drawn = len(watched)
+		default:
+			a.printChanges(watched, last)
+		}
+
+		if len(ids) > 0 && allFinished(watched) {
+			var failed []string
+			for _, download := range watched {
+				if download.Status != apitypes.StatusCompleted && download.Status != apitypes.StatusAlreadyExists {
+					failed = append(failed, download.ID)
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("downloads did not complete: %s", strings.Join(failed, ", "))
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printChanges prints a line, or a JSON object per line, for each download
+// whose status changed or whose progress passed another 10%. last keeps the
+// reported state between calls.
+func (a *app) printChanges(downloads []*apitypes.Download, last map[string]string) {
+	for _, download := range downloads {
+		state := fmt.Sprintf("%s/%d", download.Status, int(download.Progress.Percentage)/10)
+		if a.output == "json" {
+			state = fmt.Sprintf("%s/%.1f", download.Status, download.Progress.Percentage)
+		}
+		if last[download.ID] == state {
+			continue
+		}
+		last[download.ID] = state
+
+		if a.output == "json" {
+			data, _ := json.Marshal(download)
+			fmt.Fprintln(a.stdout, string(data))
+		} else {
+			fmt.Fprintln(a.stdout, progressLine(download))
+		}
+	}
+}
+
+// selectWatched returns the downloads with the given IDs, or all unfinished
+// downloads without IDs, along with the IDs that do not exist
+func selectWatched(downloads []*apitypes.Download, ids []string) ([]*apitypes.Download, []string) {
+	if len(ids) == 0 {
+		var watched []*apitypes.Download
+		for _, download := range downloads {
+			if !isFinished(download) {
+				watched = append(watched, download)
+			}
+		}
+		return watched, nil
+	}
+
+	byID := make(map[string]*apitypes.Download, len(downloads))
+	for _, download := range downloads {
+		byID[download.ID] = download
+	}
+	var watched []*apitypes.Download
+	var missing []string
+	for _, id := range ids {
+		if download, exists := byID[id]; exists {
+			watched = append(watched, download)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return watched, missing
+}
+
+func allFinished(downloads []*apitypes.Download) bool {
+	for _, download := range downloads {
+		if !isFinished(download) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,9 +3,16 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -14,12 +21,158 @@ type Config struct {
 	YtDlpPath                string `json:"yt_dlp_path"`
 	FfmpegPath               string `json:"ffmpeg_path"`
 	Port                     int    `json:"port"`
+	BindAddress              string `json:"bind_address"` // address to listen on, "" for all interfaces
 	DefaultVideoFormat       string `json:"default_video_format"`
 	DefaultAudioFormat       string `json:"default_audio_format"`
 	VerboseLogging           bool   `json:"verbose_logging"`
 	CompletedFileExpiryHours int    `json:"completed_file_expiry_hours"`
 	EnableHardwareAccel      bool   `json:"enable_hardware_acceleration"`
 	OptimizeForLowPower      bool   `json:"optimize_for_low_power"`
+
+	// DownloadWindows restricts when downloads may run. When empty, downloads
+	// are allowed at any time.
+	DownloadWindows []ScheduleWindow `json:"download_windows"`
+
+	// BandwidthLimitKBps caps the combined throughput of all active downloads
+	// in KiB/s; 0 means unlimited. BandwidthSchedule entries override it while
+	// their window is active, the first matching entry wins.
+	BandwidthLimitKBps int             `json:"bandwidth_limit_kbps"`
+	BandwidthSchedule  []BandwidthRule `json:"bandwidth_schedule"`
+
+	// DefaultSiteLimit applies to every host without its own entry in SiteLimits
+	DefaultSiteLimit SiteLimit   `json:"default_site_limit"`
+	SiteLimits       []SiteLimit `json:"site_limits"`
+
+	// Retry controls automatic retries of failed downloads
+	Retry RetryPolicy `json:"retry"`
+
+	// DefaultQuota applies to every user without their own entry in UserQuotas
+	DefaultQuota Quota   `json:"default_quota"`
+	UserQuotas   []Quota `json:"user_quotas"`
+
+	// DisableAuth turns off login for the web UI and API. Only use it when
+	// the server is not reachable by anyone else. It cannot be changed
+	// through the API.
+	DisableAuth bool `json:"disable_auth"`
+
+	// BasePath serves the app under a path prefix such as "/gogetmedia",
+	// for running behind a reverse proxy
+	BasePath string `json:"base_path"`
+
+	// TrustedProxies lists the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers are used
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// CORS controls which other sites may call the API from a browser
+	CORS CORSConfig `json:"cors"`
+
+	// TLS serves the UI and API over HTTPS
+	TLS TLSConfig `json:"tls"`
+
+	// RateLimit limits how many API requests a single client address can make
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	// LockedSettings lists settings, by their JSON name, that cannot be
+	// changed through the API. When missing, DefaultLockedSettings applies.
+	LockedSettings []string `json:"locked_settings"`
+
+	// overridden holds the settings set by command line flags or environment
+	// variables, which are locked as well
+	overridden map[string]bool
+}
+
+// DefaultLockedSettings can only be changed in the config file, with command
+// line flags or environment variables. The executables are run as configured,
+// so changing their paths over HTTP would allow running any program.
+var DefaultLockedSettings = []string{"download_path", "yt_dlp_path", "ffmpeg_path"}
+
+// alwaysLocked settings can never be changed through the API. Besides the
+// lock settings themselves these are the server settings, which only apply
+// on restart and could lock out or expose the server.
+var alwaysLocked = []string{"disable_auth", "locked_settings", "bind_address", "base_path", "trusted_proxies", "cors", "tls"}
+
+// CORSConfig lists the origins allowed to make cross-origin requests and the
+// methods they may use. Without origins, cross-origin requests are not allowed.
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowed_origins"` // e.g. "https://example.com", or "*" for any
+	AllowedMethods []string `json:"allowed_methods"` // empty means GET, POST, PUT, DELETE
+}
+
+// TLSConfig enables HTTPS. Without CertFile and KeyFile a self-signed
+// certificate is generated and stored next to the config file.
+type TLSConfig struct {
+	Enabled          bool   `json:"enabled"`
+	CertFile         string `json:"cert_file"`          // PEM certificate chain
+	KeyFile          string `json:"key_file"`           // PEM private key
+	RedirectHTTPPort int    `json:"redirect_http_port"` // port redirecting plain HTTP to HTTPS, 0 disables it
+}
+
+// RateLimitConfig limits API requests per client address. Zero values disable
+// the corresponding limit.
+type RateLimitConfig struct {
+	RequestsPerMinute      int `json:"requests_per_minute"`       // sustained rate of API requests
+	Burst                  int `json:"burst"`                     // requests allowed at once above the sustained rate
+	LoginAttemptsPerMinute int `json:"login_attempts_per_minute"` // login requests, limited separately
+}
+
+// DefaultCORSMethods are allowed when CORSConfig.AllowedMethods is empty
+var DefaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE"}
+
+// RetryPolicy describes when and how often failed downloads are retried.
+// The delay before retry n is BaseDelaySeconds * 2^(n-1), capped at
+// MaxDelaySeconds and randomised by +/- Jitter.
+type RetryPolicy struct {
+	MaxAttempts      int      `json:"max_attempts"`       // total attempts including the first, 0 or 1 disables retries
+	BaseDelaySeconds int      `json:"base_delay_seconds"` // delay before the first retry
+	MaxDelaySeconds  int      `json:"max_delay_seconds"`  // upper bound for the delay
+	Jitter           float64  `json:"jitter"`             // 0..1, fraction of the delay to randomise
+	RetryOn          []string `json:"retry_on,omitempty"` // error codes to retry, empty means all transient errors
+}
+
+// Quota limits how much a single user may download. Zero values disable the
+// corresponding limit.
+type Quota struct {
+	Username      string `json:"username,omitempty"`
+	MaxConcurrent int    `json:"max_concurrent"`   // downloads running at the same time
+	MaxQueued     int    `json:"max_queued"`       // downloads waiting to run
+	MaxStorageMB  int64  `json:"max_storage_mb"`   // total size of completed downloads
+	MaxFileSizeMB int64  `json:"max_file_size_mb"` // size of a single download
+}
+
+// SiteLimit throttles downloads from a single host. Zero values disable the
+// corresponding limit.
+type SiteLimit struct {
+	Host                    string  `json:"host,omitempty"`             // e.g. "youtube.com", also matches subdomains
+	MaxConcurrent           int     `json:"max_concurrent"`             // active downloads from the host
+	MinIntervalSeconds      int     `json:"min_interval_seconds"`       // minimum gap between download starts
+	SleepRequestsSeconds    float64 `json:"sleep_requests_seconds"`     // yt-dlp --sleep-requests
+	SleepIntervalSeconds    float64 `json:"sleep_interval_seconds"`     // yt-dlp --sleep-interval
+	MaxSleepIntervalSeconds float64 `json:"max_sleep_interval_seconds"` // yt-dlp --max-sleep-interval
+}
+
+// BandwidthRule applies a bandwidth limit during a recurring window
+type BandwidthRule struct {
+	ScheduleWindow
+	LimitKBps int `json:"limit_kbps"` // 0 means unlimited during the window
+}
+
+// ScheduleWindow is a recurring time-of-day window in server local time.
+// A window whose end is before its start wraps past midnight and belongs to
+// the day on which it starts.
+type ScheduleWindow struct {
+	Start string   `json:"start"`          // "HH:MM"
+	End   string   `json:"end"`            // "HH:MM"
+	Days  []string `json:"days,omitempty"` // "mon".."sun", empty means every day
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
 }
 
 func DefaultConfig() *Config {
@@ -32,12 +185,32 @@ func DefaultConfig() *Config {
 		YtDlpPath:                getDefaultYtDlpPath(),
 		FfmpegPath:               getDefaultFfmpegPath(),
 		Port:                     8080,
+		BindAddress:              "127.0.0.1",
 		DefaultVideoFormat:       "mp4",
 		DefaultAudioFormat:       "mp3",
 		VerboseLogging:           false,
 		CompletedFileExpiryHours: 72, // 72 hours default
 		EnableHardwareAccel:      true,
 		OptimizeForLowPower:      false,
+		DownloadWindows:          []ScheduleWindow{},
+		BandwidthLimitKBps:       0,
+		BandwidthSchedule:        []BandwidthRule{},
+		SiteLimits:               []SiteLimit{},
+		UserQuotas:               []Quota{},
+		TrustedProxies:           []string{},
+		CORS:                     CORSConfig{AllowedOrigins: []string{}, AllowedMethods: []string{}},
+		LockedSettings:           append([]string(nil), DefaultLockedSettings...),
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute:      600,
+			Burst:                  120,
+			LoginAttemptsPerMinute: 10,
+		},
+		Retry: RetryPolicy{
+			MaxAttempts:      4,
+			BaseDelaySeconds: 30,
+			MaxDelaySeconds:  900,
+			Jitter:           0.2,
+		},
 	}
 }
 
@@ -102,12 +275,14 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	// Settings missing from the file, such as those added since it was
+	// written, keep their defaults
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 func (c *Config) Save(configPath string) error {
@@ -153,9 +328,443 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("completed_file_expiry_hours cannot be negative")
 	}
 
+	for i, window := range c.DownloadWindows {
+		if err := window.Validate(); err != nil {
+			return fmt.Errorf("download_windows[%d]: %w", i, err)
+		}
+	}
+
+	if c.BandwidthLimitKBps < 0 {
+		return fmt.Errorf("bandwidth_limit_kbps cannot be negative")
+	}
+
+	for i, rule := range c.BandwidthSchedule {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("bandwidth_schedule[%d]: %w", i, err)
+		}
+		if rule.LimitKBps < 0 {
+			return fmt.Errorf("bandwidth_schedule[%d]: limit_kbps cannot be negative", i)
+		}
+	}
+
+	if err := c.DefaultSiteLimit.Validate(); err != nil {
+		return fmt.Errorf("default_site_limit: %w", err)
+	}
+
+	for i, limit := range c.SiteLimits {
+		if limit.Host == "" {
+			return fmt.Errorf("site_limits[%d]: host cannot be empty", i)
+		}
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("site_limits[%d]: %w", i, err)
+		}
+	}
+
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+
+	if c.BindAddress != "" && net.ParseIP(c.BindAddress) == nil && c.BindAddress != "localhost" {
+		return fmt.Errorf("bind_address must be an IP address or localhost")
+	}
+
+	if c.BasePath != "" && !validBasePath.MatchString(c.BasePath) {
+		return fmt.Errorf("base_path must look like /gogetmedia and only contain letters, digits, '-', '_', '.' and '/'")
+	}
+
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted_proxies: %w", err)
+	}
+
+	for _, method := range c.CORS.AllowedMethods {
+		if method == "" || strings.ToUpper(method) != method {
+			return fmt.Errorf("cors: invalid method %q, use uppercase names such as GET", method)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+
+	if c.TLS.RedirectHTTPPort < 0 || c.TLS.RedirectHTTPPort > 65535 {
+		return fmt.Errorf("tls: redirect_http_port must be between 1 and 65535, or 0 to disable it")
+	}
+
+	if c.TLS.RedirectHTTPPort != 0 && c.TLS.RedirectHTTPPort == c.Port {
+		return fmt.Errorf("tls: redirect_http_port must differ from port")
+	}
+
+	if c.RateLimit.RequestsPerMinute < 0 || c.RateLimit.Burst < 0 || c.RateLimit.LoginAttemptsPerMinute < 0 {
+		return fmt.Errorf("rate_limit: values cannot be negative")
+	}
+
+	for _, name := range c.LockedSettings {
+		if !c.field(name).IsValid() {
+			return fmt.Errorf("locked_settings: unknown setting %q", name)
+		}
+	}
+
+	if err := c.DefaultQuota.Validate(); err != nil {
+		return fmt.Errorf("default_quota: %w", err)
+	}
+
+	for i, quota := range c.UserQuotas {
+		if quota.Username == "" {
+			return fmt.Errorf("user_quotas[%d]: username cannot be empty", i)
+		}
+		if err := quota.Validate(); err != nil {
+			return fmt.Errorf("user_quotas[%d]: %w", i, err)
+		}
+	}
+
 	if err := os.MkdirAll(c.DownloadPath, 0755); err != nil {
 		return fmt.Errorf("failed to create download directory: %w", err)
 	}
 
 	return nil
 }
+
+// Validate checks that no limit is negative
+func (l SiteLimit) Validate() error {
+	if l.MaxConcurrent < 0 || l.MinIntervalSeconds < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	if l.SleepRequestsSeconds < 0 || l.SleepIntervalSeconds < 0 || l.MaxSleepIntervalSeconds < 0 {
+		return fmt.Errorf("sleep intervals cannot be negative")
+	}
+	if l.MaxSleepIntervalSeconds > 0 && l.MaxSleepIntervalSeconds < l.SleepIntervalSeconds {
+		return fmt.Errorf("max_sleep_interval_seconds must not be less than sleep_interval_seconds")
+	}
+	return nil
+}
+
+// Validate checks that no limit is negative
+func (q Quota) Validate() error {
+	if q.MaxConcurrent < 0 || q.MaxQueued < 0 || q.MaxStorageMB < 0 || q.MaxFileSizeMB < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	return nil
+}
+
+// MaxStorageBytes returns the storage limit in bytes, or 0 when unlimited
+func (q Quota) MaxStorageBytes() int64 {
+	return q.MaxStorageMB * 1024 * 1024
+}
+
+// MaxFileSizeBytes returns the file size limit in bytes, or 0 when unlimited
+func (q Quota) MaxFileSizeBytes() int64 {
+	return q.MaxFileSizeMB * 1024 * 1024
+}
+
+// Validate checks that the retry settings are within range
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.MaxAttempts > 20 {
+		return fmt.Errorf("max_attempts must be between 0 and 20")
+	}
+	if p.BaseDelaySeconds < 0 || p.MaxDelaySeconds < 0 {
+		return fmt.Errorf("delays cannot be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// Enabled reports whether failed downloads are retried at all
+func (p RetryPolicy) Enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// Delay returns how long to wait before the given retry (1 for the first
+// retry). rnd is a random number in [0, 1) used for jitter.
+func (p RetryPolicy) Delay(retry int, rnd float64) time.Duration {
+	delay := time.Duration(p.BaseDelaySeconds) * time.Second
+	maxDelay := time.Duration(p.MaxDelaySeconds) * time.Second
+	for i := 1; i < retry && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	if p.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rnd-1)))
+	}
+	return delay
+}
+
+// SiteLimitFor returns the limits for host. The most specific matching entry
+// in SiteLimits wins; hosts without an entry get DefaultSiteLimit.
+func (c *Config) SiteLimitFor(host string) SiteLimit {
+	host = strings.ToLower(host)
+	best, bestLen := -1, 0
+	for i, limit := range c.SiteLimits {
+		entry := strings.ToLower(strings.TrimPrefix(limit.Host, "www."))
+		if host != entry && !strings.HasSuffix(host, "."+entry) {
+			continue
+		}
+		if best == -1 || len(entry) > bestLen {
+			best, bestLen = i, len(entry)
+		}
+	}
+	if best == -1 {
+		limit := c.DefaultSiteLimit
+		limit.Host = host
+		return limit
+	}
+	return c.SiteLimits[best]
+}
+
+var validBasePath = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+
+// BasePathPrefix returns BasePath without a trailing slash, so that it can
+// be put in front of absolute paths; "" when the app is served at the root
+func (c *Config) BasePathPrefix() string {
+	return strings.TrimRight(c.BasePath, "/")
+}
+
+// ParseTrustedProxies parses IP addresses and CIDR ranges
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q", entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Clone returns a deep copy of the config. Decoding JSON into a shallow copy
+// would write into the slices of the original.
+func (c *Config) Clone() *Config {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(fmt.Sprintf("config: failed to copy: %v", err))
+	}
+	var clone Config
+	if err := json.Unmarshal(data, &clone); err != nil {
+		panic(fmt.Sprintf("config: failed to copy: %v", err))
+	}
+	for name := range c.overridden {
+		clone.SetOverridden(name)
+	}
+	return &clone
+}
+
+// SetOverridden marks a setting as set by a command line flag or environment
+// variable. Such settings are locked, since the override would replace any
+// change made through the API on the next start.
+func (c *Config) SetOverridden(name string) {
+	if c.overridden == nil {
+		c.overridden = make(map[string]bool)
+	}
+	c.overridden[name] = true
+}
+
+// LockedFields returns the JSON names of all settings that cannot be changed
+// through the API, sorted
+func (c *Config) LockedFields() []string {
+	locked := c.LockedSettings
+	if locked == nil {
+		locked = DefaultLockedSettings
+	}
+
+	seen := make(map[string]bool)
+	var fields []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	for _, name := range alwaysLocked {
+		add(name)
+	}
+	for _, name := range locked {
+		add(name)
+	}
+	for name := range c.overridden {
+		add(name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// IsLocked reports whether a setting cannot be changed through the API
+func (c *Config) IsLocked(name string) bool {
+	for _, field := range c.LockedFields() {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LockedChanges returns the locked settings whose values differ between c
+// and the current config
+func (c *Config) LockedChanges(current *Config) []string {
+	var changed []string
+	for _, name := range current.LockedFields() {
+		if !current.field(name).IsValid() {
+			continue
+		}
+		if !reflect.DeepEqual(c.field(name).Interface(), current.field(name).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// KeepLocked sets the locked settings of c to their values in the current
+// config
+func (c *Config) KeepLocked(current *Config) {
+	current = current.Clone()
+	for _, name := range current.LockedFields() {
+		if value := current.field(name); value.IsValid() {
+			c.field(name).Set(value)
+		}
+	}
+}
+
+// field returns the struct field with the given JSON name, or an invalid
+// value if there is none
+func (c *Config) field(name string) reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == name && t.Field(i).IsExported() {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// QuotaFor returns the quota of a user: their entry in UserQuotas, or
+// DefaultQuota when they have none
+func (c *Config) QuotaFor(username string) Quota {
+	for _, quota := range c.UserQuotas {
+		if quota.Username == username {
+			return quota
+		}
+	}
+	quota := c.DefaultQuota
+	quota.Username = username
+	return quota
+}
+
+// BandwidthLimitAt returns the total bandwidth limit in KiB/s in effect at t,
+// or 0 when unlimited
+func (c *Config) BandwidthLimitAt(t time.Time) int {
+	for _, rule := range c.BandwidthSchedule {
+		if rule.Contains(t) {
+			return rule.LimitKBps
+		}
+	}
+	return c.BandwidthLimitKBps
+}
+
+// Validate checks the window's times and day names
+func (w ScheduleWindow) Validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return fmt.Errorf("invalid end: %w", err)
+	}
+	for _, day := range w.Days {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q (use mon, tue, wed, thu, fri, sat or sun)", day)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether t falls inside the window. Invalid windows never match.
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		// Same start and end means the whole day
+		return w.onDay(t.Weekday())
+	case start < end:
+		return w.onDay(t.Weekday()) && minute >= start && minute < end
+	default:
+		// Wraps past midnight: the early-morning part belongs to the previous day
+		if minute >= start && w.onDay(t.Weekday()) {
+			return true
+		}
+		yesterday := (t.Weekday() + 6) % 7
+		return minute < end && w.onDay(yesterday)
+	}
+}
+
+func (w ScheduleWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if d, ok := weekdayNames[strings.ToLower(name)]; ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// InWindows reports whether t is inside any of the windows. An empty list
+// places no restriction and always returns true.
+func InWindows(windows []ScheduleWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindowChange returns the next minute after t at which InWindows changes
+// value, or the zero time if it does not change within the next week.
+func NextWindowChange(windows []ScheduleWindow, t time.Time) time.Time {
+	if len(windows) == 0 {
+		return time.Time{}
+	}
+	current := InWindows(windows, t)
+	next := t.Truncate(time.Minute)
+	for i := 0; i < 8*24*60; i++ {
+		next = next.Add(time.Minute)
+		if InWindows(windows, next) != current {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// parseClock converts "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not in HH:MM format", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -24,6 +25,10 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.DefaultAudioFormat != "mp3" {
 		t.Errorf("Expected DefaultAudioFormat to be 'mp3', got '%s'", cfg.DefaultAudioFormat)
 	}
+
+	if cfg.DefaultSiteLimit != (SiteLimit{}) {
+		t.Errorf("Expected no default site limit, got %+v", cfg.DefaultSiteLimit)
+	}
 }
 
 func TestConfigValidation(t *testing.T) {
@@ -104,6 +109,28 @@ func TestConfigSaveLoad(t *testing.T) {
 	}
 }
 
+func TestLoadKeepsDefaultsForMissingSettings(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"port": 9090, "rate_limit": {"burst": 5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	defaults := DefaultConfig()
+	if config.Port != 9090 || config.RateLimit.Burst != 5 {
+		t.Errorf("Settings in the file were not loaded: %+v", config)
+	}
+	if config.RateLimit.RequestsPerMinute != defaults.RateLimit.RequestsPerMinute || config.RateLimit.LoginAttemptsPerMinute != defaults.RateLimit.LoginAttemptsPerMinute {
+		t.Errorf("Expected missing rate limits to keep their defaults, got %+v", config.RateLimit)
+	}
+	if config.MaxConcurrentDownloads != defaults.MaxConcurrentDownloads {
+		t.Errorf("Expected missing max_concurrent_downloads to keep its default, got %d", config.MaxConcurrentDownloads)
+	}
+}
+
 func TestLoadNonExistentConfig(t *testing.T) {
 	tempDir := t.TempDir()
 	configPath := filepath.Join(tempDir, "nonexistent.json")
@@ -122,3 +149,215 @@ func TestLoadNonExistentConfig(t *testing.T) {
 		t.Error("Expected config file to be created")
 	}
 }
+
+func TestScheduleWindowContains(t *testing.T) {
+	// 2024-01-05 is a Friday
+	at := func(day int, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name   string
+		window ScheduleWindow
+		time   time.Time
+		want   bool
+	}{
+		{"inside daily window", ScheduleWindow{Start: "01:00", End: "07:00"}, at(5, 3, 0), true},
+		{"at window end", ScheduleWindow{Start: "01:00", End: "07:00"}, at(5, 7, 0), false},
+		{"before window", ScheduleWindow{Start: "01:00", End: "07:00"}, at(5, 0, 59), false},
+		{"wraps past midnight late", ScheduleWindow{Start: "22:00", End: "02:00"}, at(5, 23, 30), true},
+		{"wraps past midnight early", ScheduleWindow{Start: "22:00", End: "02:00"}, at(6, 1, 30), true},
+		{"restricted to weekday", ScheduleWindow{Start: "01:00", End: "07:00", Days: []string{"mon"}}, at(5, 3, 0), false},
+		{"wrap belongs to start day", ScheduleWindow{Start: "22:00", End: "02:00", Days: []string{"fri"}}, at(6, 1, 0), true},
+		{"full day", ScheduleWindow{Start: "00:00", End: "00:00", Days: []string{"fri"}}, at(5, 12, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.time); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.time.Format(time.RFC1123), got, tt.want)
+			}
+		})
+	}
+
+	if !InWindows(nil, at(5, 12, 0)) {
+		t.Error("Expected no windows to allow downloads at any time")
+	}
+}
+
+func TestScheduleWindowValidation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DownloadPath = t.TempDir()
+	cfg.DownloadWindows = []ScheduleWindow{{Start: "25:00", End: "07:00"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected invalid start time to fail validation")
+	}
+
+	cfg.DownloadWindows = []ScheduleWindow{{Start: "01:00", End: "07:00", Days: []string{"someday"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected invalid day name to fail validation")
+	}
+}
+
+func TestBandwidthLimitAt(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BandwidthLimitKBps = 500
+	cfg.BandwidthSchedule = []BandwidthRule{
+		{ScheduleWindow: ScheduleWindow{Start: "09:00", End: "17:00"}, LimitKBps: 100},
+		{ScheduleWindow: ScheduleWindow{Start: "01:00", End: "07:00"}, LimitKBps: 0},
+	}
+
+	day := func(hour int) time.Time {
+		return time.Date(2024, 1, 5, hour, 0, 0, 0, time.Local)
+	}
+
+	if got := cfg.BandwidthLimitAt(day(12)); got != 100 {
+		t.Errorf("Expected office-hours limit 100, got %d", got)
+	}
+	if got := cfg.BandwidthLimitAt(day(3)); got != 0 {
+		t.Errorf("Expected unlimited overnight, got %d", got)
+	}
+	if got := cfg.BandwidthLimitAt(day(20)); got != 500 {
+		t.Errorf("Expected global limit 500, got %d", got)
+	}
+}
+
+func TestSiteLimitFor(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SiteLimits = []SiteLimit{
+		{Host: "youtube.com", MaxConcurrent: 1},
+		{Host: "music.example.com", MaxConcurrent: 4},
+		{Host: "example.com", MaxConcurrent: 3},
+		{Host: "www.news.example.org", MaxConcurrent: 5},
+		{Host: "live.news.example.org", MaxConcurrent: 6},
+	}
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"youtube.com", 1},
+		{"music.youtube.com", 1},
+		{"music.example.com", 4},
+		{"video.example.com", 3},
+		{"notyoutube.com", cfg.DefaultSiteLimit.MaxConcurrent},
+		{"news.example.org", 5},
+		{"live.news.example.org", 6}, // longer than www.news.example.org once www. is dropped
+	}
+
+	for _, tt := range tests {
+		if got := cfg.SiteLimitFor(tt.host).MaxConcurrent; got != tt.want {
+			t.Errorf("SiteLimitFor(%s).MaxConcurrent = %d, want %d", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelaySeconds: 30, MaxDelaySeconds: 100}
+
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, 60 * time.Second},
+		{3, 100 * time.Second}, // capped
+		{10, 100 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.retry, 0.5); got != tt.expected {
+			t.Errorf("Delay(%d) = %v, expected %v", tt.retry, got, tt.expected)
+		}
+	}
+
+	policy.Jitter = 0.5
+	if got := policy.Delay(1, 0); got != 15*time.Second {
+		t.Errorf("Expected lowest jitter to halve the delay, got %v", got)
+	}
+	if got := policy.Delay(1, 0.999); got <= 30*time.Second || got >= 45*time.Second {
+		t.Errorf("Expected highest jitter to add up to half the delay, got %v", got)
+	}
+
+	policy.Jitter = 2
+	if err := policy.Validate(); err == nil {
+		t.Error("Expected jitter above 1 to be rejected")
+	}
+}
+
+func TestQuotaFor(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DefaultQuota = Quota{MaxQueued: 10}
+	cfg.UserQuotas = []Quota{{Username: "alice", MaxQueued: 2, MaxStorageMB: 100}}
+
+	if got := cfg.QuotaFor("alice"); got.MaxQueued != 2 || got.MaxStorageBytes() != 100*1024*1024 {
+		t.Errorf("QuotaFor(alice) = %+v", got)
+	}
+	if got := cfg.QuotaFor("bob"); got.MaxQueued != 10 || got.Username != "bob" {
+		t.Errorf("QuotaFor(bob) = %+v, want the default quota", got)
+	}
+
+	cfg.UserQuotas = []Quota{{MaxQueued: 1}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a quota without username to be rejected")
+	}
+}
+
+func TestLockedSettings(t *testing.T) {
+	current := DefaultConfig()
+	current.SetOverridden("port")
+
+	changed := *current
+	changed.YtDlpPath = "/tmp/evil"
+	changed.Port = 9090
+	changed.MaxConcurrentDownloads = 5
+
+	got := changed.LockedChanges(current)
+	if len(got) != 2 || got[0] != "port" || got[1] != "yt_dlp_path" {
+		t.Errorf("LockedChanges = %v, want [port yt_dlp_path]", got)
+	}
+
+	// Configs from before locking existed get the default locks
+	current.LockedSettings = nil
+	if !current.IsLocked("ffmpeg_path") || !current.IsLocked("disable_auth") {
+		t.Error("Expected executable paths and disable_auth to be locked by default")
+	}
+	current.LockedSettings = []string{}
+	if current.IsLocked("ffmpeg_path") || !current.IsLocked("locked_settings") {
+		t.Error("Expected an empty list to unlock everything but the always locked settings")
+	}
+
+	current.LockedSettings = []string{"no_such_setting"}
+	if err := current.Validate(); err == nil {
+		t.Error("Expected unknown locked setting to be rejected")
+	}
+}
+
+func TestServerSettingsValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"bind address", func(c *Config) { c.BindAddress = "not an address" }},
+		{"base path", func(c *Config) { c.BasePath = "gogetmedia" }},
+		{"trusted proxy", func(c *Config) { c.TrustedProxies = []string{"10.0.0.0/33"} }},
+		{"cors method", func(c *Config) { c.CORS.AllowedMethods = []string{"get"} }},
+		{"tls key", func(c *Config) { c.TLS.CertFile = "cert.pem" }},
+		{"tls redirect port", func(c *Config) { c.TLS.RedirectHTTPPort = c.Port }},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		tt.modify(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected invalid %s to be rejected", tt.name)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.BasePath = "/gogetmedia/"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid base path, got %v", err)
+	}
+	if got := cfg.BasePathPrefix(); got != "/gogetmedia" {
+		t.Errorf("BasePathPrefix() = %q, want /gogetmedia", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -35,6 +36,7 @@ const (
 	StatusFailed         DownloadStatus = "failed"
 	StatusCancelled      DownloadStatus = "cancelled"
 	StatusAlreadyExists  DownloadStatus = "already_exists"
+	StatusScheduled      DownloadStatus = "scheduled"
 )
 
 type DownloadRequest struct {
@@ -43,6 +45,29 @@ type DownloadRequest struct {
 	Quality   string       `json:"quality"`
 	Format    string       `json:"format"`
 	OutputDir string       `json:"output_dir"`
+	StartAt   *time.Time   `json:"start_at,omitempty"`
+
+	// RateLimitKBps is passed to yt-dlp as --limit-rate; 0 means unlimited
+	RateLimitKBps int `json:"rate_limit_kbps,omitempty"`
+
+	// Politeness delays passed to yt-dlp, in seconds; 0 disables each
+	SleepRequests    float64 `json:"sleep_requests,omitempty"`
+	SleepInterval    float64 `json:"sleep_interval,omitempty"`
+	MaxSleepInterval float64 `json:"max_sleep_interval,omitempty"`
+
+	// Log receives the command line and output of the run, if set
+	Log *LogBuffer `json:"-"`
+
+	// Owner is the user adding the download, set by the server
+	Owner string `json:"-"`
+
+	// ExternalID identifies the download to the client that added it. A
+	// repeated request with the same ID returns the existing download.
+	ExternalID string `json:"external_id,omitempty"`
+
+	// Destination is the folder below the download directory, see
+	// Download.Destination
+	Destination string `json:"destination,omitempty"`
 }
 
 type DownloadProgress struct {
@@ -50,6 +75,22 @@ type DownloadProgress struct {
 	Speed      string  `json:"speed"`
 	ETA        string  `json:"eta"`
 	Size       string  `json:"size"`
+
+	// Machine-readable values, filled when yt-dlp reports them. TotalBytes
+	// is an estimate when TotalEstimated is set.
+	DownloadedBytes int64   `json:"downloaded_bytes,omitempty"`
+	TotalBytes      int64   `json:"total_bytes,omitempty"`
+	TotalEstimated  bool    `json:"total_estimated,omitempty"`
+	SpeedBps        float64 `json:"speed_bps,omitempty"`
+	ETASeconds      int     `json:"eta_seconds,omitempty"`
+	FragmentIndex   int     `json:"fragment_index,omitempty"`
+	FragmentCount   int     `json:"fragment_count,omitempty"`
+
+	// Percentage is the overall progress across all phases; PhasePercentage
+	// is the progress of the current Phase, detailed per phase in Phases
+	Phase           string          `json:"phase,omitempty"` // see the Phase constants
+	PhasePercentage float64         `json:"phase_percentage,omitempty"`
+	Phases          []PhaseProgress `json:"phases,omitempty"`
 }
 
 type TitleUpdateCallback func(id, title string)
@@ -67,9 +108,56 @@ type Download struct {
 	Filename      string           `json:"filename"`
 	OutputPath    string           `json:"output_path"`
 	CreatedAt     time.Time        `json:"created_at"`
+	Owner         string           `json:"owner,omitempty"`       // username of the user who added it
+	ExternalID    string           `json:"external_id,omitempty"` // the client's ID, see DownloadRequest
+	StartAt       *time.Time       `json:"start_at,omitempty"`
 	CompletedAt   *time.Time       `json:"completed_at,omitempty"`
 	Error         string           `json:"error,omitempty"`
 	StatusMessage string           `json:"status_message,omitempty"`
+
+	// EstimatedBytes is the expected size from the metadata when the download
+	// was added, FileSize the size of the finished file (0 = unknown)
+	EstimatedBytes int64 `json:"estimated_bytes,omitempty"`
+	FileSize       int64 `json:"file_size,omitempty"`
+
+	// SHA256 is the hex checksum of the finished file, computed after the
+	// download completes ("" = not computed yet)
+	SHA256 string `json:"sha256,omitempty"`
+
+	// RateLimitKBps is the requested per-download limit, AppliedRateLimitKBps
+	// the limit the current run was started with (0 = unlimited)
+	RateLimitKBps        int `json:"rate_limit_kbps,omitempty"`
+	AppliedRateLimitKBps int `json:"applied_rate_limit_kbps,omitempty"`
+
+	// ErrorCode classifies Error. Attempts holds the history of runs, and
+	// AutoRetries counts automatic retries since the last manual retry.
+	ErrorCode     ErrorCode  `json:"error_code,omitempty"`
+	Attempts      []Attempt  `json:"attempts,omitempty"`
+	AutoRetries   int        `json:"auto_retries,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	// Command is the yt-dlp command line of the most recent run
+	Command []string `json:"command,omitempty"`
+
+	// Priority orders queued downloads, higher starts first. Destination is
+	// the folder below the download directory the file is saved in ("" for
+	// the download directory itself).
+	Priority    int    `json:"priority,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	// Revision increases with every change of the download, see
+	// DownloadManager.Changes
+	Revision uint64 `json:"revision"`
+}
+
+// Clone returns a copy of the download that shares no slices with it, so it
+// can be read while the original keeps changing
+func (d *Download) Clone() *Download {
+	clone := *d
+	clone.Progress.Phases = append([]PhaseProgress(nil), d.Progress.Phases...)
+	clone.Attempts = append([]Attempt(nil), d.Attempts...)
+	clone.Command = append([]string(nil), d.Command...)
+	return &clone
 }
 
 type Downloader struct {
@@ -161,13 +249,22 @@ func (d *Downloader) Download(ctx context.Context, req DownloadRequest, progress
 	args := d.buildYtDlpArgs(req, download)
 	log.Printf("[DOWNLOAD] %s: yt-dlp command: %s %s", download.ID, d.ytDlpPath, strings.Join(args, " "))
 
+	// Capture the full output of this run, keeping the last lines to explain failures
+	output := req.Log
+	if output == nil {
+		output = NewLogBuffer(DefaultLogLines)
+	}
+	download.Command = append([]string{d.ytDlpPath}, args...)
+	output.SetCommand(download.Command)
+
 	download.Status = StatusDownloading
 	log.Printf("[DOWNLOAD] %s: Starting download", download.ID)
 	log.Printf("[DOWNLOAD] %s: yt-dlp path: %s", download.ID, d.ytDlpPath)
 	
 	// Check if yt-dlp binary exists and is executable
 	if _, err := os.Stat(d.ytDlpPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("yt-dlp binary not found at %s", d.ytDlpPath)
+		output.Add(LogInfo, fmt.Sprintf("yt-dlp binary not found at %s", d.ytDlpPath))
+		return nil, &DownloadError{Code: ErrorMissingExecutable, Message: fmt.Sprintf("yt-dlp binary not found at %s", d.ytDlpPath)}
 	}
 
 	cmd := exec.CommandContext(ctx, d.ytDlpPath, args...)
@@ -197,20 +294,31 @@ func (d *Downloader) Download(ctx context.Context, req DownloadRequest, progress
 		log.Printf("[DOWNLOAD] %s: Failed to start yt-dlp: %v", download.ID, err)
 		download.Status = StatusFailed
 		download.Error = fmt.Sprintf("Failed to start yt-dlp: %v", err)
+		output.Add(LogInfo, download.Error)
 		return download, err
 	}
 
 	log.Printf("[DOWNLOAD] %s: yt-dlp process started, PID: %d", download.ID, cmd.Process.Pid)
 
 	// Monitor progress
-	go d.monitorProgress(stdout, stderr, progressChan, statusCallback, download.ID)
+	tracker := newProgressTracker(req.Type)
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		d.monitorProgress(stdout, stderr, progressChan, statusCallback, output, tracker, download.ID)
+	}()
 
-	// Wait for completion
+	// Wait for completion. Output has to be read fully before Wait closes the pipes.
 	log.Printf("[DOWNLOAD] %s: Waiting for yt-dlp to complete...", download.ID)
+	select {
+	case <-monitorDone:
+	case <-ctx.Done():
+	}
 	err = cmd.Wait()
 
 	if ctx.Err() == context.Canceled {
 		log.Printf("[DOWNLOAD] %s: Download cancelled", download.ID)
+		output.Add(LogInfo, "Download stopped")
 		download.Status = StatusCancelled
 		return download, nil
 	}
@@ -220,11 +328,13 @@ func (d *Downloader) Download(ctx context.Context, req DownloadRequest, progress
 		download.Status = StatusFailed
 
 		// Enhanced error reporting
-		errorMsg := d.categorizeError(err, download.URL)
+		code, errorMsg := d.categorizeError(err, output.Tail(50))
+		output.Add(LogInfo, fmt.Sprintf("yt-dlp exited: %v", err))
 		download.Error = errorMsg
+		download.ErrorCode = code
 
-		log.Printf("[DOWNLOAD] %s: Categorized error: %s", download.ID, errorMsg)
-		return download, fmt.Errorf("download failed: %s", errorMsg)
+		log.Printf("[DOWNLOAD] %s: Categorized error (%s): %s", download.ID, code, errorMsg)
+		return download, &DownloadError{Code: code, Message: errorMsg}
 	}
 
 	log.Printf("[DOWNLOAD] %s: yt-dlp process completed", download.ID)
@@ -250,6 +360,20 @@ func (d *Downloader) Download(ctx context.Context, req DownloadRequest, progress
 		log.Printf("[DOWNLOAD] %s: Warning - could not locate downloaded file in %s", download.ID, req.OutputDir)
 	}
 
+	// Report completion, skipping the phases that did not run
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				// Channel was closed, ignore
+			}
+		}()
+		select {
+		case progressChan <- tracker.Finish():
+		default:
+			// Channel is full, skip
+		}
+	}()
+
 	download.Status = StatusCompleted
 	now := time.Now()
 	download.CompletedAt = &now
@@ -360,6 +484,26 @@ func (d *Downloader) buildYtDlpArgs(req DownloadRequest, download *Download) []s
 		"--continue",      // Resume partial downloads if they exist
 	}
 
+	// Machine-readable progress, parsed by monitorProgress
+	for _, template := range progressTemplates {
+		args = append(args, "--progress-template", template)
+	}
+
+	if req.RateLimitKBps > 0 {
+		args = append(args, "--limit-rate", fmt.Sprintf("%dK", req.RateLimitKBps))
+	}
+
+	// Politeness delays between requests and before each download
+	if req.SleepRequests > 0 {
+		args = append(args, "--sleep-requests", strconv.FormatFloat(req.SleepRequests, 'f', -1, 64))
+	}
+	if req.SleepInterval > 0 {
+		args = append(args, "--sleep-interval", strconv.FormatFloat(req.SleepInterval, 'f', -1, 64))
+		if req.MaxSleepInterval > req.SleepInterval {
+			args = append(args, "--max-sleep-interval", strconv.FormatFloat(req.MaxSleepInterval, 'f', -1, 64))
+		}
+	}
+
 	// Add Reddit-specific options if it's a Reddit URL
 	if strings.Contains(req.URL, "reddit.com") || strings.Contains(req.URL, "redd.it") {
 		args = append(args, "--extractor-args", "reddit:sort=best")
@@ -406,7 +550,8 @@ func (d *Downloader) buildYtDlpArgs(req DownloadRequest, download *Download) []s
 	}
 
 	// Add URL
-	args = append(args, req.URL)
+	// "--" keeps a URL starting with "-" from being read as an option
+	args = append(args, "--", req.URL)
 
 	return args
 }
@@ -650,72 +795,92 @@ func (d *Downloader) getVideoDuration(videoPath string) float64 {
 	return duration
 }
 
-// categorizeError provides user-friendly error messages based on the error type
-func (d *Downloader) categorizeError(err error, url string) string {
-	errStr := strings.ToLower(err.Error())
+// transientProgressRegex matches yt-dlp progress updates that are superseded
+// by the next one, e.g. "[download]  42.1% of 11.21MiB at 2.47MiB/s ETA 00:04"
+var transientProgressRegex = regexp.MustCompile(`^\[download\]\s+\d+\.?\d*%\s+of\s.*\sETA\s`)
+
+// isTransientProgressLine reports whether a line is an intermediate progress
+// update that is not worth keeping in the download log
+func isTransientProgressLine(line string) bool {
+	return transientProgressRegex.MatchString(line) || isProgressTemplateLine(line)
+}
+
+// categorizeError classifies a failed download and provides a user-friendly
+// message. The process error alone is usually just an exit status, so the
+// last lines of yt-dlp's output are checked as well.
+func (d *Downloader) categorizeError(err error, output []string) (ErrorCode, string) {
+	errStr := strings.ToLower(err.Error() + "\n" + strings.Join(output, "\n"))
 
 	// Check for common error patterns
 	switch {
-	case strings.Contains(errStr, "video unavailable"):
-		return "Video is unavailable or has been removed"
+	case strings.Contains(errStr, "context canceled"):
+		return ErrorCancelled, "Download was cancelled by user"
+	case strings.Contains(errStr, "context deadline exceeded"):
+		return ErrorTimeout, "Download timed out"
 	case strings.Contains(errStr, "private video"):
-		return "Video is private and cannot be downloaded"
-	case strings.Contains(errStr, "age-restricted"):
-		return "Video is age-restricted and requires authentication"
-	case strings.Contains(errStr, "region blocked") || strings.Contains(errStr, "not available in your country"):
-		return "Video is not available in your region"
+		return ErrorPrivate, "Video is private and cannot be downloaded"
+	case strings.Contains(errStr, "age-restricted") || strings.Contains(errStr, "confirm your age"):
+		return ErrorAuthRequired, "Video is age-restricted and requires authentication"
+	case strings.Contains(errStr, "region blocked") || strings.Contains(errStr, "available in your country") ||
+		strings.Contains(errStr, "geo restrict") || strings.Contains(errStr, "geo-restrict"):
+		return ErrorGeoBlocked, "Video is not available in your region"
 	case strings.Contains(errStr, "copyright"):
-		return "Video is blocked due to copyright restrictions"
-	case strings.Contains(errStr, "network") || strings.Contains(errStr, "connection"):
-		return "Network connection issue - please check your internet connection"
-	case strings.Contains(errStr, "timeout"):
-		return "Download timed out - the server may be slow or overloaded"
-	case strings.Contains(errStr, "unsupported url"):
-		return "This website or URL format is not supported"
-	case strings.Contains(errStr, "format not available"):
-		return "Requested quality or format is not available for this video"
-	case strings.Contains(errStr, "login") || strings.Contains(errStr, "authentication"):
-		return "Video requires login or authentication"
+		return ErrorCopyright, "Video is blocked due to copyright restrictions"
+	// Before the unavailable case, which matches "is not available" too
+	case strings.Contains(errStr, "format not available") || strings.Contains(errStr, "requested format is not available"):
+		return ErrorFormatUnavailable, "Requested quality or format is not available for this video"
+	case strings.Contains(errStr, "video unavailable") || strings.Contains(errStr, "has been removed") ||
+		strings.Contains(errStr, "is not available"):
+		return ErrorUnavailable, "Video is unavailable or has been removed"
+	case strings.Contains(errStr, "too many requests") || strings.Contains(errStr, "http error 429") ||
+		strings.Contains(errStr, "rate-limit") || strings.Contains(errStr, "rate limit"):
+		return ErrorRateLimited, "Too many requests - please wait and try again"
 	case strings.Contains(errStr, "quota exceeded"):
-		return "API quota exceeded - please try again later"
-	case strings.Contains(errStr, "too many requests"):
-		return "Too many requests - please wait and try again"
-	case strings.Contains(errStr, "disk") || strings.Contains(errStr, "space"):
-		return "Insufficient disk space to complete download"
+		return ErrorRateLimited, "API quota exceeded - please try again later"
+	case strings.Contains(errStr, "no space left") || strings.Contains(errStr, "disk full") ||
+		strings.Contains(errStr, "disk quota"):
+		return ErrorDiskFull, "Insufficient disk space to complete download"
+	case strings.Contains(errStr, "timed out") || strings.Contains(errStr, "timeout"):
+		return ErrorTimeout, "Download timed out - the server may be slow or overloaded"
+	case strings.Contains(errStr, "unsupported url"):
+		return ErrorUnsupported, "This website or URL format is not supported"
+	case strings.Contains(errStr, "sign in") || strings.Contains(errStr, "login") ||
+		strings.Contains(errStr, "authentication") || strings.Contains(errStr, "members-only"):
+		return ErrorAuthRequired, "Video requires login or authentication"
 	case strings.Contains(errStr, "permission denied"):
-		return "Permission denied - check file/directory permissions"
-	case strings.Contains(errStr, "file exists"):
-		return "File already exists at destination"
-	case strings.Contains(errStr, "no such file"):
-		return "Required file or directory not found"
+		return ErrorPermission, "Permission denied - check file/directory permissions"
 	case strings.Contains(errStr, "executable file not found"):
-		return "yt-dlp or ffmpeg executable not found - please check installation"
+		return ErrorMissingExecutable, "yt-dlp or ffmpeg executable not found - please check installation"
+	case strings.Contains(errStr, "http error 404") || strings.Contains(errStr, "404: not found"):
+		return ErrorUnavailable, "Video not found (404 error)"
+	case strings.Contains(errStr, "http error 403") || strings.Contains(errStr, "403: forbidden"):
+		return ErrorAuthRequired, "Access forbidden (403 error) - video may require authentication"
+	case strings.Contains(errStr, "http error 5") || strings.Contains(errStr, "internal server error") ||
+		strings.Contains(errStr, "service unavailable") || strings.Contains(errStr, "bad gateway"):
+		return ErrorServer, "Server error - please try again later"
+	case strings.Contains(errStr, "connection") || strings.Contains(errStr, "network") ||
+		strings.Contains(errStr, "name resolution") || strings.Contains(errStr, "temporary failure"):
+		return ErrorNetwork, "Network connection issue - please check your internet connection"
+	case strings.Contains(errStr, "ffmpeg") || strings.Contains(errStr, "postprocessing") ||
+		strings.Contains(errStr, "conversion failed"):
+		return ErrorFfmpegFailed, "FFmpeg processing failed - video conversion error"
 	case strings.Contains(errStr, "extract") && strings.Contains(errStr, "info"):
-		return "Failed to extract video information - video may be corrupted or unavailable"
-	case strings.Contains(errStr, "ffmpeg"):
-		return "FFmpeg processing failed - video conversion error"
-	case strings.Contains(errStr, "postprocessing"):
-		return "Post-processing failed - video downloaded but conversion failed"
-	case strings.Contains(errStr, "http") && (strings.Contains(errStr, "404") || strings.Contains(errStr, "not found")):
-		return "Video not found (404 error)"
-	case strings.Contains(errStr, "http") && (strings.Contains(errStr, "403") || strings.Contains(errStr, "forbidden")):
-		return "Access forbidden (403 error) - video may require authentication"
-	case strings.Contains(errStr, "http") && (strings.Contains(errStr, "500") || strings.Contains(errStr, "internal server")):
-		return "Server error (500) - please try again later"
-	case strings.Contains(errStr, "http") && strings.Contains(errStr, "503"):
-		return "Service temporarily unavailable (503) - please try again later"
+		return ErrorUnavailable, "Failed to extract video information - video may be corrupted or unavailable"
 	case strings.Contains(errStr, "killed") || strings.Contains(errStr, "terminated"):
-		return "Download was cancelled or interrupted"
-	case strings.Contains(errStr, "context canceled"):
-		return "Download was cancelled by user"
-	case strings.Contains(errStr, "context deadline exceeded"):
-		return "Download timed out"
+		return ErrorCancelled, "Download was cancelled or interrupted"
 	default:
-		// If no specific pattern matches, provide the original error with some cleanup
-		if len(errStr) > 200 {
-			return fmt.Sprintf("Download failed: %s...", errStr[:200])
+		// If no specific pattern matches, provide the last error line with some cleanup
+		message := err.Error()
+		for i := len(output) - 1; i >= 0; i-- {
+			if strings.Contains(output[i], "ERROR") {
+				message = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(output[i]), "ERROR:"))
+				break
+			}
+		}
+		if len(message) > 200 {
+			return ErrorUnknown, fmt.Sprintf("Download failed: %s...", message[:200])
 		}
-		return fmt.Sprintf("Download failed: %s", err.Error())
+		return ErrorUnknown, fmt.Sprintf("Download failed: %s", message)
 	}
 }
 
@@ -733,7 +898,7 @@ func timeStringToSeconds(timeStr string) float64 {
 	return hours*3600 + minutes*60 + seconds
 }
 
-func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan chan<- DownloadProgress, statusCallback StatusUpdateCallback, downloadID string) {
+func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan chan<- DownloadProgress, statusCallback StatusUpdateCallback, output *LogBuffer, tracker *progressTracker, downloadID string) {
 	// Multiple regex patterns to match different yt-dlp output formats
 	progressRegexes := []*regexp.Regexp{
 		// [download]   0.0% of   11.21MiB at    2.47MiB/s ETA 00:04
@@ -761,10 +926,13 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 	ffmpegProgressBitrateRegex := regexp.MustCompile(`^bitrate=(\d+\.?\d*)kbits/s$`)
 	ffmpegProgressSpeedRegex := regexp.MustCompile(`^speed=(\d+\.?\d*)x$`)
 
+	ffmpegProgressKeyRegex := regexp.MustCompile(`^(frame|fps|stream_\d+_\d+_q|bitrate|total_size|out_time_us|out_time_ms|out_time|dup_frames|drop_frames|speed|progress)=`)
+
 	// Regex to extract duration from FFmpeg output
 	durationRegex := regexp.MustCompile(`Duration:\s*([\d:\.]+)`)
 
 	lastPercentage := -1.0
+	lastPhase := ""
 	isPostProcessing := false
 
 	// FFmpeg progress tracking variables (protected by mutex for thread safety)
@@ -806,9 +974,24 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 	stderrScanner := bufio.NewScanner(stderr)
 
 	// Start stderr monitoring in a separate goroutine
+	var stderrDone sync.WaitGroup
+	stderrDone.Add(1)
 	go func() {
+		defer stderrDone.Done()
 		for stderrScanner.Scan() {
 			line := stderrScanner.Text()
+			if !ffmpegProgressKeyRegex.MatchString(line) {
+				// ffmpeg -progress key=value pairs would crowd out everything else
+				output.Add(LogStderr, line)
+			}
+
+			// Only log actual errors, not all stderr output
+			lowerLine := strings.ToLower(line)
+			if strings.Contains(lowerLine, "error") ||
+				strings.Contains(lowerLine, "warning") ||
+				strings.Contains(lowerLine, "failed") {
+				log.Printf("[DOWNLOAD] %s: %s", downloadID, line)
+			}
 
 			// Log stderr line for debugging
 			if strings.Contains(line, "frame=") || strings.Contains(line, "time=") || strings.Contains(line, "bitrate=") {
@@ -857,7 +1040,7 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 
 				// Calculate and send progress if updated
 				if progressUpdated {
-					frames, duration, currentTime, bitrate, speed := readFFmpegProgress()
+					_, duration, currentTime, bitrate, speed := readFFmpegProgress()
 					if duration > 0 && currentTime > 0 {
 						progressPercent := (currentTime / duration) * 100
 						if progressPercent > 100 {
@@ -889,12 +1072,12 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 								}
 							}()
 							select {
-							case progressChan <- DownloadProgress{
+							case progressChan <- tracker.Update(DownloadProgress{
 								Percentage: progressPercent,
 								Speed:      speedInfo,
 								ETA:        eta,
-								Size:       fmt.Sprintf("Frame %d", frames),
-							}:
+								Phase:      tracker.CurrentPostProcessPhase(),
+							}):
 							default:
 								// Channel is full, skip
 							}
@@ -908,6 +1091,9 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 	scanner := bufio.NewScanner(stdout)
 	for scanner.Scan() {
 		line := scanner.Text()
+		if !isTransientProgressLine(line) {
+			output.Add(LogStdout, line)
+		}
 
 		// Extract duration from FFmpeg output if we're in post-processing
 		if isPostProcessing {
@@ -926,12 +1112,12 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 							}
 						}()
 						select {
-						case progressChan <- DownloadProgress{
+						case progressChan <- tracker.Update(DownloadProgress{
 							Percentage: 0,
 							Speed:      "FFmpeg starting...",
 							ETA:        fmt.Sprintf("Duration: %.0fs", detectedDuration),
-							Size:       "Processing",
-						}:
+							Phase:      tracker.CurrentPostProcessPhase(),
+						}):
 						default:
 							// Channel is full, skip
 						}
@@ -959,12 +1145,12 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 						}
 					}()
 					select {
-					case progressChan <- DownloadProgress{
+					case progressChan <- tracker.Update(DownloadProgress{
 						Percentage: 0, // No percentage during post-processing
 						Speed:      "Converting with FFmpeg",
 						ETA:        "Processing",
-						Size:       "Converting",
-					}:
+						Phase:      postProcessLinePhase(line),
+					}):
 					default:
 						// Channel is full, skip
 					}
@@ -984,7 +1170,39 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 			}
 		}
 
-		// Try each regex pattern for progress
+		// Structured progress from --progress-template
+		if progress, ok := parseProgressTemplateLine(line); ok {
+			progress = tracker.Update(progress)
+			if isPostProcessPhase(progress.Phase) {
+				if !isPostProcessing {
+					isPostProcessing = true
+					log.Printf("[DOWNLOAD] %s: Starting post-processing (%s)", downloadID, progress.Size)
+					if statusCallback != nil {
+						statusCallback(downloadID, StatusPostProcessing)
+					}
+				}
+			} else if progress.Phase != lastPhase || progress.PhasePercentage >= lastPercentage+25 || progress.PhasePercentage == 100 {
+				lastPhase = progress.Phase
+				log.Printf("[DOWNLOAD] %s: Progress %.0f%% (%s, %.0f%% overall)", downloadID, progress.PhasePercentage, progress.Phase, progress.Percentage)
+				lastPercentage = progress.PhasePercentage
+			}
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						// Channel was closed, ignore the panic
+					}
+				}()
+				select {
+				case progressChan <- progress:
+				default:
+					// Channel is full, skip this update
+				}
+			}()
+			continue
+		}
+
+		// Fall back to the human-readable progress lines
 		for _, progressRegex := range progressRegexes {
 			if matches := progressRegex.FindStringSubmatch(line); matches != nil {
 				percentage, _ := strconv.ParseFloat(matches[1], 64)
@@ -1016,7 +1234,7 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 						}
 					}()
 					select {
-					case progressChan <- progress:
+					case progressChan <- tracker.Update(progress):
 					default:
 						// Channel is full, skip this update
 					}
@@ -1026,19 +1244,8 @@ func (d *Downloader) monitorProgress(stdout, stderr io.ReadCloser, progressChan
 		}
 	}
 
-	// Also read from stderr for error messages
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			// Only log actual errors, not all stderr output
-			if strings.Contains(strings.ToLower(line), "error") ||
-				strings.Contains(strings.ToLower(line), "warning") ||
-				strings.Contains(strings.ToLower(line), "failed") {
-				log.Printf("[DOWNLOAD] %s: %s", downloadID, line)
-			}
-		}
-	}()
+	// Wait for stderr so error messages are captured before the process is reaped
+	stderrDone.Wait()
 }
 
 type VideoInfo struct {
@@ -1061,7 +1268,7 @@ func (d *Downloader) GetVideoInfo(url string) (*VideoInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, d.ytDlpPath, "--get-title", "--get-filename", "--no-warnings", "--no-playlist", url)
+	cmd := exec.CommandContext(ctx, d.ytDlpPath, "--get-title", "--get-filename", "--no-warnings", "--no-playlist", "--", url)
 	output, err := cmd.Output()
 	if err != nil {
 		log.Printf("[INFO] Failed to get video info for %s: %v", url, err)
@@ -1090,6 +1297,74 @@ func (d *Downloader) GetVideoInfo(url string) (*VideoInfo, error) {
 	return info, nil
 }
 
+// EstimateSize asks yt-dlp for the expected size in bytes of the formats the
+// request would download. It returns 0 when the site reports no size.
+func (d *Downloader) EstimateSize(req DownloadRequest) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	format := "bestaudio/best"
+	if req.Type != AudioDownload {
+		format = d.getVideoFormat(req.Quality, req.Format)
+	}
+
+	cmd := exec.CommandContext(ctx, d.ytDlpPath, "--no-warnings", "--no-playlist", "--skip-download",
+		"--format", format, "--print", "%(filesize,filesize_approx)s", "--", req.URL)
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return 0, fmt.Errorf("timeout estimating size for URL: %s", req.URL)
+		}
+		return 0, fmt.Errorf("failed to estimate size: %w", err)
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		// "NA" when neither the exact nor the approximate size is known
+		return 0, nil
+	}
+	return int64(size), nil
+}
+
+// ValidateMediaURL checks that a URL can be handed to yt-dlp: only http and
+// https URLs with a host are allowed, so local files and other schemes such as
+// file:// cannot be read through the server.
+func ValidateMediaURL(rawURL string) error {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q, only http and https are allowed", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	return nil
+}
+
+// HostKey returns the host a URL is rate limited under: the lowercase host
+// name without "www." or "m.", with short-link domains mapped to their site.
+// It returns "" for URLs without a host.
+func HostKey(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	switch host {
+	case "youtu.be", "music.youtube.com", "youtube-nocookie.com":
+		return "youtube.com"
+	case "redd.it", "old.reddit.com", "v.redd.it":
+		return "reddit.com"
+	}
+	return host
+}
+
 func GenerateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
@@ -1109,7 +1384,7 @@ func (d *Downloader) GetPlaylistItems(url string) ([]PlaylistItem, error) {
 	defer cancel()
 
 	// Use yt-dlp to extract playlist info in JSON format
-	cmd := exec.CommandContext(ctx, d.ytDlpPath, "--flat-playlist", "--dump-json", "--no-warnings", url)
+	cmd := exec.CommandContext(ctx, d.ytDlpPath, "--flat-playlist", "--dump-json", "--no-warnings", "--", url)
 	output, err := cmd.Output()
 	if err != nil {
 		log.Printf("[PLAYLIST] Failed to get playlist items for %s: %v", url, err)
@@ -2,8 +2,10 @@ package core
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -235,3 +237,277 @@ func TestDownloadContext_Cancellation(t *testing.T) {
 		t.Errorf("Expected context to be cancelled")
 	}
 }
+
+func TestBuildYtDlpArgsRateLimit(t *testing.T) {
+	downloader := NewDownloader("", "", false, false)
+	download := &Download{Title: "Test", Filename: "Test.mp4"}
+
+	req := DownloadRequest{URL: "https://example.com/video", Type: VideoDownload, Quality: "best", Format: "mp4"}
+	args := strings.Join(downloader.buildYtDlpArgs(req, download), " ")
+	if strings.Contains(args, "--limit-rate") {
+		t.Errorf("Expected no --limit-rate without a limit, got: %s", args)
+	}
+
+	req.RateLimitKBps = 250
+	args = strings.Join(downloader.buildYtDlpArgs(req, download), " ")
+	if !strings.Contains(args, "--limit-rate 250K") {
+		t.Errorf("Expected --limit-rate 250K, got: %s", args)
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube.com"},
+		{"https://youtu.be/dQw4w9WgXcQ", "youtube.com"},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", "youtube.com"},
+		{"https://redd.it/abc123", "reddit.com"},
+		{"https://Vimeo.com/12345", "vimeo.com"},
+		{"not a url", ""},
+	}
+
+	for _, tc := range testCases {
+		if result := HostKey(tc.url); result != tc.expected {
+			t.Errorf("HostKey(%s) = %q, expected %q", tc.url, result, tc.expected)
+		}
+	}
+}
+
+func TestValidateMediaURL(t *testing.T) {
+	valid := []string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "http://example.com/video.mp4"}
+	invalid := []string{"file:///etc/passwd", "ftp://example.com/video", "https://", "/etc/passwd", "--exec=rm", "javascript:alert(1)"}
+
+	for _, u := range valid {
+		if err := ValidateMediaURL(u); err != nil {
+			t.Errorf("ValidateMediaURL(%s) = %v, expected no error", u, err)
+		}
+	}
+	for _, u := range invalid {
+		if err := ValidateMediaURL(u); err == nil {
+			t.Errorf("ValidateMediaURL(%s) succeeded, expected an error", u)
+		}
+	}
+
+	downloader := NewDownloader("", "", false, false)
+	args := downloader.buildYtDlpArgs(DownloadRequest{URL: "https://example.com/video", Type: VideoDownload, Quality: "best", Format: "mp4"}, &Download{Title: "Test", Filename: "Test.mp4"})
+	if len(args) < 2 || args[len(args)-2] != "--" {
+		t.Errorf("Expected the URL to follow \"--\", got: %v", args)
+	}
+}
+
+func TestBuildYtDlpArgsSleepIntervals(t *testing.T) {
+	downloader := NewDownloader("", "", false, false)
+	download := &Download{Title: "Test", Filename: "Test.mp4"}
+
+	req := DownloadRequest{
+		URL:              "https://example.com/video",
+		Type:             VideoDownload,
+		Quality:          "best",
+		Format:           "mp4",
+		SleepRequests:    0.5,
+		SleepInterval:    2,
+		MaxSleepInterval: 5,
+	}
+	args := strings.Join(downloader.buildYtDlpArgs(req, download), " ")
+	for _, want := range []string{"--sleep-requests 0.5", "--sleep-interval 2", "--max-sleep-interval 5"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected %q in args: %s", want, args)
+		}
+	}
+}
+
+func TestCategorizeError(t *testing.T) {
+	downloader := NewDownloader("yt-dlp", "ffmpeg", false, false)
+	exitErr := errors.New("exit status 1")
+
+	tests := []struct {
+		output   string
+		expected ErrorCode
+	}{
+		{"ERROR: [youtube] abc: Private video. Sign in if you've been granted access", ErrorPrivate},
+		{"ERROR: unable to download video data: HTTP Error 429: Too Many Requests", ErrorRateLimited},
+		{"ERROR: [youtube] abc: The uploader has not made this video available in your country", ErrorGeoBlocked},
+		{"ERROR: [youtube] abc: Video unavailable", ErrorUnavailable},
+		{"ERROR: Unable to download webpage: <urlopen error [Errno -3] Temporary failure in name resolution>", ErrorNetwork},
+		{"ERROR: unable to download video data: HTTP Error 503: Service Unavailable", ErrorServer},
+		{"ERROR: Postprocessing: Conversion failed!", ErrorFfmpegFailed},
+		{"ERROR: unable to write data: [Errno 28] No space left on device", ErrorDiskFull},
+		{"ERROR: Unsupported URL: https://example.com/", ErrorUnsupported},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Requested format is not available. Use --list-formats for a list of available formats", ErrorFormatUnavailable},
+		{"ERROR: [vimeo] 12345: This video is not available", ErrorUnavailable},
+		{"ERROR: something nobody has seen before", ErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		code, message := downloader.categorizeError(exitErr, []string{tt.output})
+		if code != tt.expected {
+			t.Errorf("categorizeError(%q) = %s, expected %s", tt.output, code, tt.expected)
+		}
+		if message == "" {
+			t.Errorf("categorizeError(%q) returned an empty message", tt.output)
+		}
+	}
+}
+
+func TestLogBuffer(t *testing.T) {
+	buffer := NewLogBuffer(3)
+	buffer.SetCommand([]string{"yt-dlp", "-o", "%(title)s [%(id)s].%(ext)s"})
+
+	existing, lines, cancel := buffer.Subscribe()
+	defer cancel()
+	if len(existing) != 1 || existing[0].Stream != LogCommand {
+		t.Fatalf("Expected the command line to be logged, got %+v", existing)
+	}
+	if existing[0].Text != "yt-dlp -o '%(title)s [%(id)s].%(ext)s'" {
+		t.Errorf("Unexpected command line: %s", existing[0].Text)
+	}
+
+	for _, text := range []string{"one", "two", "three"} {
+		buffer.Add(LogStdout, text)
+	}
+	if got := buffer.Tail(10); strings.Join(got, ",") != "one,two,three" {
+		t.Errorf("Expected the oldest line to be dropped, got %v", got)
+	}
+
+	if line := <-lines; line.Text != "one" {
+		t.Errorf("Expected subscriber to receive new lines, got %q", line.Text)
+	}
+
+	buffer.Close()
+	for range lines {
+		// Drain the buffered lines until the channel is closed
+	}
+}
+
+func TestIsTransientProgressLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected bool
+	}{
+		{"[download]  42.1% of   11.21MiB at    2.47MiB/s ETA 00:04", true},
+		{"[download]   0.0% of ~  11.21MiB at    2.47MiB/s ETA Unknown", true},
+		{"[download] 100% of   11.21MiB in 00:04", false},
+		{"[download] Destination: video.f137.mp4", false},
+		{"[Merger] Merging formats into \"video.mp4\"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransientProgressLine(tt.line); got != tt.expected {
+			t.Errorf("isTransientProgressLine(%q) = %v, expected %v", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestParseProgressTemplateLine(t *testing.T) {
+	line := `[gogetmedia-progress]{"status":"downloading","downloaded_bytes":5242880,"total_bytes":"NA",` +
+		`"total_bytes_estimate":10485760.0,"speed":1048576.0,"eta":5,"fragment_index":3,"fragment_count":6,` +
+		`"vcodec":"avc1.640028","acodec":"none"}`
+
+	progress, ok := parseProgressTemplateLine(line)
+	if !ok {
+		t.Fatal("Expected progress template line to be parsed")
+	}
+	if progress.Phase != PhaseVideo {
+		t.Errorf("Expected video phase, got %q", progress.Phase)
+	}
+	if progress.DownloadedBytes != 5242880 || progress.TotalBytes != 10485760 || !progress.TotalEstimated {
+		t.Errorf("Unexpected byte counts: %+v", progress)
+	}
+	if progress.Percentage != 50 {
+		t.Errorf("Expected 50%%, got %.1f", progress.Percentage)
+	}
+	if progress.SpeedBps != 1048576 || progress.ETASeconds != 5 || progress.FragmentIndex != 3 || progress.FragmentCount != 6 {
+		t.Errorf("Unexpected numeric values: %+v", progress)
+	}
+	if progress.Size != "~10.00MiB" || progress.Speed != "1.00MiB/s" || progress.ETA != "00:05" {
+		t.Errorf("Unexpected display values: size=%q speed=%q eta=%q", progress.Size, progress.Speed, progress.ETA)
+	}
+
+	progress, ok = parseProgressTemplateLine(`[gogetmedia-progress]{"status":"started","postprocessor":"Merger"}`)
+	if !ok || progress.Phase != PhaseMerge {
+		t.Errorf("Expected merge phase, got %+v", progress)
+	}
+
+	if _, ok := parseProgressTemplateLine("[download]  42.1% of 11.21MiB at 2.47MiB/s ETA 00:04"); ok {
+		t.Error("Expected human-readable progress line to be ignored")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		expected string
+	}{
+		{512, "512B"},
+		{1536, "1.50KiB"},
+		{11754536, "11.21MiB"},
+		{3 * 1024 * 1024 * 1024, "3.00GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes); got != tt.expected {
+			t.Errorf("FormatBytes(%d) = %s, expected %s", tt.bytes, got, tt.expected)
+		}
+	}
+}
+
+func TestProgressTrackerPhases(t *testing.T) {
+	tracker := newProgressTracker(VideoDownload)
+
+	// Video stream half done: 30 of 92 planned weight
+	progress := tracker.Update(DownloadProgress{Phase: PhaseVideo, Percentage: 50})
+	if progress.PhasePercentage != 50 {
+		t.Errorf("Expected phase percentage 50, got %.1f", progress.PhasePercentage)
+	}
+	if got := progress.Percentage; got < 32 || got > 33 {
+		t.Errorf("Expected overall percentage around 32.6, got %.1f", got)
+	}
+
+	// Without a phase, a percentage restarting after the video stream belongs to the audio stream
+	tracker.Update(DownloadProgress{Percentage: 100})
+	progress = tracker.Update(DownloadProgress{Percentage: 10})
+	if progress.Phase != PhaseAudio {
+		t.Errorf("Expected audio phase after the video stream, got %q", progress.Phase)
+	}
+	before := progress.Percentage
+
+	// Unplanned phases are inserted without moving the overall percentage backwards
+	progress = tracker.Update(DownloadProgress{Phase: PhaseEmbed, Percentage: 0})
+	if progress.Percentage < before {
+		t.Errorf("Expected overall percentage not to go backwards, got %.1f after %.1f", progress.Percentage, before)
+	}
+	states := map[string]string{}
+	for _, phase := range progress.Phases {
+		states[phase.Name] = phase.State
+	}
+	if states[PhaseAudio] != PhaseDone || states[PhaseMerge] != PhaseSkipped || states[PhaseEmbed] != PhaseActive {
+		t.Errorf("Unexpected phase states: %v", states)
+	}
+
+	progress = tracker.Finish()
+	if progress.Percentage != 100 {
+		t.Errorf("Expected 100%% when finished, got %.1f", progress.Percentage)
+	}
+	for _, phase := range progress.Phases {
+		if phase.State != PhaseDone && phase.State != PhaseSkipped {
+			t.Errorf("Expected phase %s to be done or skipped, got %s", phase.Name, phase.State)
+		}
+	}
+}
+
+func TestProgressTrackerSingleStream(t *testing.T) {
+	tracker := newProgressTracker(VideoDownload)
+
+	progress := tracker.Update(DownloadProgress{Phase: PhaseDownload, Percentage: 100})
+	for _, phase := range progress.Phases {
+		if (phase.Name == PhaseVideo || phase.Name == PhaseAudio || phase.Name == PhaseMerge) && phase.State != PhaseSkipped {
+			t.Errorf("Expected %s to be skipped for a combined stream, got %s", phase.Name, phase.State)
+		}
+	}
+	// 80 of 82 remaining weight
+	if got := progress.Percentage; got < 97 || got > 98 {
+		t.Errorf("Expected overall percentage around 97.6, got %.1f", got)
+	}
+}
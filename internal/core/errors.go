@@ -0,0 +1,71 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrorCode classifies why a download failed
+type ErrorCode string
+
+const (
+	ErrorNetwork           ErrorCode = "network"
+	ErrorTimeout           ErrorCode = "timeout"
+	ErrorRateLimited       ErrorCode = "rate_limited"
+	ErrorServer            ErrorCode = "server_error"
+	ErrorUnavailable       ErrorCode = "unavailable"
+	ErrorPrivate           ErrorCode = "private"
+	ErrorGeoBlocked        ErrorCode = "geo_blocked"
+	ErrorAuthRequired      ErrorCode = "auth_required"
+	ErrorCopyright         ErrorCode = "copyright"
+	ErrorUnsupported       ErrorCode = "unsupported"
+	ErrorFormatUnavailable ErrorCode = "format_unavailable"
+	ErrorFfmpegFailed      ErrorCode = "ffmpeg_failed"
+	ErrorDiskFull          ErrorCode = "disk_full"
+	ErrorPermission        ErrorCode = "permission_denied"
+	ErrorMissingExecutable ErrorCode = "missing_executable"
+	ErrorQuotaExceeded     ErrorCode = "quota_exceeded"
+	ErrorCancelled         ErrorCode = "cancelled"
+	ErrorUnknown           ErrorCode = "unknown"
+)
+
+// Transient reports whether a failure with this code is likely to succeed
+// when retried later
+func (c ErrorCode) Transient() bool {
+	switch c {
+	case ErrorNetwork, ErrorTimeout, ErrorRateLimited, ErrorServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// DownloadError is returned by Downloader.Download when a download fails
+type DownloadError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *DownloadError) Error() string {
+	return "download failed: " + e.Message
+}
+
+// ErrorCodeOf returns the code of a DownloadError in err's chain, or
+// ErrorUnknown for any other error
+func ErrorCodeOf(err error) ErrorCode {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Code
+	}
+	return ErrorUnknown
+}
+
+// Attempt records a single run of a download
+type Attempt struct {
+	Number    int            `json:"number"`
+	StartedAt time.Time      `json:"started_at"`
+	EndedAt   *time.Time     `json:"ended_at,omitempty"`
+	Outcome   DownloadStatus `json:"outcome,omitempty"`
+	ErrorCode ErrorCode      `json:"error_code,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogLines is the number of output lines kept per download
+	DefaultLogLines = 1000
+	// maxLogLineLength truncates very long output lines
+	maxLogLineLength = 4096
+)
+
+// Log streams written by the downloader
+const (
+	LogStdout  = "stdout"
+	LogStderr  = "stderr"
+	LogCommand = "command"
+	LogInfo    = "info"
+)
+
+// LogLine is a single line of yt-dlp/ffmpeg output
+type LogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Text   string    `json:"text"`
+}
+
+// LogBuffer keeps the most recent output lines of a download and fans new
+// lines out to subscribers. It is safe for concurrent use.
+type LogBuffer struct {
+	mutex       sync.Mutex
+	lines       []LogLine
+	max         int
+	command     []string
+	subscribers map[chan LogLine]struct{}
+	closed      bool
+}
+
+// NewLogBuffer creates a buffer holding at most max lines
+func NewLogBuffer(max int) *LogBuffer {
+	if max <= 0 {
+		max = DefaultLogLines
+	}
+	return &LogBuffer{
+		max:         max,
+		subscribers: make(map[chan LogLine]struct{}),
+	}
+}
+
+// Add appends a line, dropping the oldest line when the buffer is full.
+// Subscribers that cannot keep up miss lines rather than block the download.
+func (b *LogBuffer) Add(stream, text string) {
+	if len(text) > maxLogLineLength {
+		text = text[:maxLogLineLength] + "..."
+	}
+	line := LogLine{Time: time.Now(), Stream: stream, Text: text}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.appendLocked(line)
+	for ch := range b.subscribers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+func (b *LogBuffer) appendLocked(line LogLine) {
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.max {
+		b.lines = append(b.lines[:0:0], b.lines[len(b.lines)-b.max:]...)
+	}
+}
+
+// Restore prepends previously saved lines, e.g. from an earlier run
+func (b *LogBuffer) Restore(lines []LogLine, command []string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	current := b.lines
+	b.lines = nil
+	for _, line := range append(append([]LogLine(nil), lines...), current...) {
+		b.appendLocked(line)
+	}
+	if b.command == nil {
+		b.command = command
+	}
+}
+
+// SetCommand records the command line of the current run and logs it
+func (b *LogBuffer) SetCommand(command []string) {
+	b.mutex.Lock()
+	b.command = append([]string(nil), command...)
+	b.mutex.Unlock()
+	b.Add(LogCommand, FormatCommand(command))
+}
+
+// Command returns the command line of the most recent run
+func (b *LogBuffer) Command() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string(nil), b.command...)
+}
+
+// Lines returns a copy of the buffered lines
+func (b *LogBuffer) Lines() []LogLine {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]LogLine(nil), b.lines...)
+}
+
+// Tail returns the text of the last n lines
+func (b *LogBuffer) Tail(n int) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	start := len(b.lines) - n
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]string, 0, len(b.lines)-start)
+	for _, line := range b.lines[start:] {
+		tail = append(tail, line.Text)
+	}
+	return tail
+}
+
+// Subscribe returns the buffered lines and a channel receiving every line
+// added afterwards. The channel is closed when the buffer is closed or
+// cancel is called.
+func (b *LogBuffer) Subscribe() ([]LogLine, <-chan LogLine, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan LogLine, 100)
+	existing := append([]LogLine(nil), b.lines...)
+	if b.closed {
+		close(ch)
+		return existing, ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return existing, ch, cancel
+}
+
+// Close ends all subscriptions. Lines can still be read afterwards.
+func (b *LogBuffer) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// FormatCommand renders a command line for display, quoting arguments that
+// contain whitespace
+func FormatCommand(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		if arg == "" || strings.ContainsAny(arg, " \t") {
+			arg = "'" + arg + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,449 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// progressPrefix marks the machine-readable progress lines that yt-dlp
+// prints for --progress-template
+const progressPrefix = "[gogetmedia-progress]"
+
+// Progress phases reported in DownloadProgress.Phase, in the order they run
+const (
+	PhaseDownload    = "download" // a single stream containing video and audio
+	PhaseVideo       = "video"
+	PhaseAudio       = "audio"
+	PhaseMerge       = "merge"
+	PhaseTranscode   = "transcode"
+	PhaseEmbed       = "embed"
+	PhasePostProcess = "postprocess" // any other post-processor
+	PhaseMove        = "move"
+)
+
+// Phase states reported in PhaseProgress.State
+const (
+	PhasePending = "pending"
+	PhaseActive  = "active"
+	PhaseDone    = "done"
+	PhaseSkipped = "skipped"
+)
+
+// phaseOrder is the order in which yt-dlp runs the phases
+var phaseOrder = []string{PhaseDownload, PhaseVideo, PhaseAudio, PhaseMerge, PhaseTranscode, PhaseEmbed, PhasePostProcess, PhaseMove}
+
+// phaseWeights is the relative share of each phase in the overall percentage
+var phaseWeights = map[string]float64{
+	PhaseDownload:    80,
+	PhaseVideo:       60,
+	PhaseAudio:       20,
+	PhaseMerge:       10,
+	PhaseTranscode:   10,
+	PhaseEmbed:       3,
+	PhasePostProcess: 5,
+	PhaseMove:        2,
+}
+
+// PhaseProgress is the progress of a single phase of a download
+type PhaseProgress struct {
+	Name            string  `json:"name"`
+	State           string  `json:"state"`
+	Percentage      float64 `json:"percentage"`
+	Weight          float64 `json:"weight"`
+	DownloadedBytes int64   `json:"downloaded_bytes,omitempty"`
+	TotalBytes      int64   `json:"total_bytes,omitempty"`
+}
+
+// progressTemplates are passed to yt-dlp as --progress-template. Fields that
+// are not available are printed as "NA" and parsed as zero.
+var progressTemplates = []string{
+	"download:" + progressPrefix + `{"status":%(progress.status)j,` +
+		`"downloaded_bytes":%(progress.downloaded_bytes)j,` +
+		`"total_bytes":%(progress.total_bytes)j,` +
+		`"total_bytes_estimate":%(progress.total_bytes_estimate)j,` +
+		`"speed":%(progress.speed)j,` +
+		`"eta":%(progress.eta)j,` +
+		`"fragment_index":%(progress.fragment_index)j,` +
+		`"fragment_count":%(progress.fragment_count)j,` +
+		`"vcodec":%(info.vcodec)j,` +
+		`"acodec":%(info.acodec)j}`,
+	"postprocess:" + progressPrefix + `{"status":%(progress.status)j,` +
+		`"postprocessor":%(progress.postprocessor)j}`,
+}
+
+// templateNumber decodes a numeric template field, treating "NA" and null
+// as zero
+type templateNumber float64
+
+func (n *templateNumber) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*n = templateNumber(v)
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			parsed = 0
+		}
+		*n = templateNumber(parsed)
+	default:
+		*n = 0
+	}
+	return nil
+}
+
+// templateProgress is a line printed by one of the progressTemplates
+type templateProgress struct {
+	Status             string         `json:"status"`
+	DownloadedBytes    templateNumber `json:"downloaded_bytes"`
+	TotalBytes         templateNumber `json:"total_bytes"`
+	TotalBytesEstimate templateNumber `json:"total_bytes_estimate"`
+	Speed              templateNumber `json:"speed"`
+	ETA                templateNumber `json:"eta"`
+	FragmentIndex      templateNumber `json:"fragment_index"`
+	FragmentCount      templateNumber `json:"fragment_count"`
+	VCodec             string         `json:"vcodec"`
+	ACodec             string         `json:"acodec"`
+	PostProcessor      string         `json:"postprocessor"`
+}
+
+// isProgressTemplateLine reports whether a line was printed for --progress-template
+func isProgressTemplateLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), progressPrefix)
+}
+
+// parseProgressTemplateLine converts a --progress-template line into a
+// DownloadProgress with both numeric values and display strings
+func parseProgressTemplateLine(line string) (DownloadProgress, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, progressPrefix) {
+		return DownloadProgress{}, false
+	}
+
+	var raw templateProgress
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, progressPrefix)), &raw); err != nil {
+		return DownloadProgress{}, false
+	}
+
+	if raw.PostProcessor != "" {
+		progress := DownloadProgress{Phase: postProcessorPhase(raw.PostProcessor), Speed: "Processing", Size: raw.PostProcessor}
+		if raw.Status == "finished" {
+			progress.Percentage = 100
+		}
+		return progress, true
+	}
+
+	progress := DownloadProgress{
+		Phase:           streamPhase(raw.VCodec, raw.ACodec),
+		DownloadedBytes: int64(raw.DownloadedBytes),
+		TotalBytes:      int64(raw.TotalBytes),
+		SpeedBps:        float64(raw.Speed),
+		ETASeconds:      int(raw.ETA),
+		FragmentIndex:   int(raw.FragmentIndex),
+		FragmentCount:   int(raw.FragmentCount),
+	}
+	if progress.TotalBytes == 0 && raw.TotalBytesEstimate > 0 {
+		progress.TotalBytes = int64(raw.TotalBytesEstimate)
+		progress.TotalEstimated = true
+	}
+
+	switch {
+	case raw.Status == "finished":
+		progress.Percentage = 100
+	case progress.TotalBytes > 0:
+		progress.Percentage = float64(progress.DownloadedBytes) / float64(progress.TotalBytes) * 100
+	case progress.FragmentCount > 0:
+		progress.Percentage = float64(progress.FragmentIndex) / float64(progress.FragmentCount) * 100
+	}
+	if progress.Percentage > 100 {
+		progress.Percentage = 100
+	}
+
+	// Keep the display strings the UI has always shown
+	if progress.TotalBytes > 0 {
+		progress.Size = FormatBytes(progress.TotalBytes)
+		if progress.TotalEstimated {
+			progress.Size = "~" + progress.Size
+		}
+	}
+	if progress.SpeedBps > 0 {
+		progress.Speed = FormatBytes(int64(progress.SpeedBps)) + "/s"
+	}
+	if raw.Status == "downloading" && raw.ETA > 0 {
+		progress.ETA = formatETA(progress.ETASeconds)
+	}
+	return progress, true
+}
+
+// streamPhase tells from the codecs of the format being downloaded whether
+// it is the video or audio part of a split download
+func streamPhase(vcodec, acodec string) string {
+	hasVideo := vcodec != "" && vcodec != "none" && vcodec != "NA"
+	hasAudio := acodec != "" && acodec != "none" && acodec != "NA"
+	switch {
+	case hasVideo && !hasAudio && acodec == "none":
+		return PhaseVideo
+	case hasAudio && !hasVideo && vcodec == "none":
+		return PhaseAudio
+	default:
+		return PhaseDownload
+	}
+}
+
+// postProcessorPhase maps a yt-dlp post-processor name to a phase
+func postProcessorPhase(name string) string {
+	switch {
+	case name == "Merger":
+		return PhaseMerge
+	case name == "MoveFiles":
+		return PhaseMove
+	case strings.HasPrefix(name, "Embed") || name == "FFmpegMetadata" || name == "FFmpegEmbedSubtitle":
+		return PhaseEmbed
+	case name == "ExtractAudio" || strings.HasSuffix(name, "Convertor") || strings.HasSuffix(name, "Remuxer"):
+		return PhaseTranscode
+	default:
+		return PhasePostProcess
+	}
+}
+
+// postProcessLinePhase maps a human-readable post-processing line to a phase
+func postProcessLinePhase(line string) string {
+	switch {
+	case strings.Contains(line, "[Merger]") || strings.Contains(line, "Merging formats into"):
+		return PhaseMerge
+	case strings.Contains(line, "[ExtractAudio]") || strings.Contains(line, "[VideoConvertor]") || strings.Contains(line, "[VideoRemuxer]"):
+		return PhaseTranscode
+	case strings.Contains(line, "[EmbedThumbnail]") || strings.Contains(line, "[Metadata]") || strings.Contains(line, "[EmbedSubtitle]"):
+		return PhaseEmbed
+	default:
+		return PhasePostProcess
+	}
+}
+
+// isPostProcessPhase reports whether a phase runs after the streams are downloaded
+func isPostProcessPhase(name string) bool {
+	return name != PhaseDownload && name != PhaseVideo && name != PhaseAudio
+}
+
+// progressTracker combines the progress of the individual phases of a
+// download into one overall percentage. Phases that turn out not to run are
+// skipped and phases that were not expected are added when they start.
+type progressTracker struct {
+	mutex   sync.Mutex
+	phases  []PhaseProgress
+	current int
+	overall float64
+	last    DownloadProgress
+}
+
+// newProgressTracker plans the phases expected for a download type
+func newProgressTracker(downloadType DownloadType) *progressTracker {
+	planned := []string{PhaseVideo, PhaseAudio, PhaseMerge, PhaseMove}
+	if downloadType == AudioDownload {
+		planned = []string{PhaseAudio, PhaseTranscode, PhaseMove}
+	}
+
+	t := &progressTracker{current: -1}
+	for _, name := range planned {
+		t.phases = append(t.phases, PhaseProgress{Name: name, State: PhasePending, Weight: phaseWeights[name]})
+	}
+	return t
+}
+
+// Update records the progress of a phase and returns it with the overall
+// percentage and the per-phase detail. A progress without a phase belongs to
+// the current stream, or to the next one once the current stream is done.
+func (t *progressTracker) Update(progress DownloadProgress) DownloadProgress {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	name := progress.Phase
+	if name == "" {
+		name = t.streamPhaseLocked(progress.Percentage)
+	}
+	index := t.phaseIndexLocked(name)
+
+	// Everything before this phase has either finished or did not run
+	for i := range t.phases[:index] {
+		switch t.phases[i].State {
+		case PhaseActive:
+			t.phases[i].State = PhaseDone
+			t.phases[i].Percentage = 100
+		case PhasePending:
+			t.phases[i].State = PhaseSkipped
+		}
+	}
+	if name == PhaseDownload {
+		// A single combined stream, there are no separate streams to merge
+		for i := range t.phases {
+			switch t.phases[i].Name {
+			case PhaseVideo, PhaseAudio, PhaseMerge:
+			default:
+				continue
+			}
+			if t.phases[i].State == PhasePending {
+				t.phases[i].State = PhaseSkipped
+			}
+		}
+	}
+
+	phase := &t.phases[index]
+	phase.State = PhaseActive
+	phase.Percentage = progress.Percentage
+	if progress.TotalBytes > 0 {
+		phase.DownloadedBytes = progress.DownloadedBytes
+		phase.TotalBytes = progress.TotalBytes
+	}
+	t.current = index
+
+	progress.Phase = name
+	progress.PhasePercentage = progress.Percentage
+	progress.Percentage = t.overallLocked()
+	progress.Phases = append([]PhaseProgress(nil), t.phases...)
+	t.last = progress
+	return progress
+}
+
+// Finish marks the download as complete, skipping phases that did not run
+func (t *progressTracker) Finish() DownloadProgress {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i := range t.phases {
+		switch t.phases[i].State {
+		case PhaseActive:
+			t.phases[i].State = PhaseDone
+			t.phases[i].Percentage = 100
+		case PhasePending:
+			t.phases[i].State = PhaseSkipped
+		}
+	}
+	t.overall = 100
+
+	progress := t.last
+	progress.Percentage = 100
+	progress.PhasePercentage = 100
+	progress.ETA = ""
+	progress.ETASeconds = 0
+	progress.Phases = append([]PhaseProgress(nil), t.phases...)
+	return progress
+}
+
+// CurrentPostProcessPhase returns the running post-processing phase, for
+// ffmpeg output that does not say which phase it belongs to
+func (t *progressTracker) CurrentPostProcessPhase() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.current >= 0 && isPostProcessPhase(t.phases[t.current].Name) {
+		return t.phases[t.current].Name
+	}
+	return PhasePostProcess
+}
+
+// streamPhaseLocked guesses the stream a phase-less download percentage
+// belongs to. With split formats yt-dlp downloads video first, then audio,
+// and the percentage starts over for the second stream.
+func (t *progressTracker) streamPhaseLocked(percentage float64) string {
+	if t.current >= 0 {
+		phase := t.phases[t.current]
+		if phase.Name == PhaseVideo && phase.Percentage >= 99.9 && percentage < phase.Percentage {
+			return PhaseAudio
+		}
+		if !isPostProcessPhase(phase.Name) {
+			return phase.Name
+		}
+	}
+	for _, phase := range t.phases {
+		if !isPostProcessPhase(phase.Name) && phase.State == PhasePending {
+			return phase.Name
+		}
+	}
+	return PhaseDownload
+}
+
+// phaseIndexLocked returns the index of a phase, inserting it in run order
+// if it was not planned
+func (t *progressTracker) phaseIndexLocked(name string) int {
+	for i, phase := range t.phases {
+		if phase.Name == name {
+			return i
+		}
+	}
+
+	rank := func(name string) int {
+		for i, ordered := range phaseOrder {
+			if ordered == name {
+				return i
+			}
+		}
+		return len(phaseOrder)
+	}
+	index := len(t.phases)
+	for i, phase := range t.phases {
+		if rank(phase.Name) > rank(name) {
+			index = i
+			break
+		}
+	}
+
+	t.phases = append(t.phases, PhaseProgress{})
+	copy(t.phases[index+1:], t.phases[index:])
+	t.phases[index] = PhaseProgress{Name: name, State: PhasePending, Weight: phaseWeights[name]}
+	if t.current >= index {
+		t.current++
+	}
+	return index
+}
+
+// overallLocked weights the phases that have not been skipped. It never goes
+// backwards, even when an unexpected phase is added.
+func (t *progressTracker) overallLocked() float64 {
+	var total, done float64
+	for _, phase := range t.phases {
+		if phase.State == PhaseSkipped {
+			continue
+		}
+		total += phase.Weight
+		switch phase.State {
+		case PhaseDone:
+			done += phase.Weight
+		case PhaseActive:
+			done += phase.Weight * phase.Percentage / 100
+		}
+	}
+	if total > 0 && done/total*100 > t.overall {
+		t.overall = done / total * 100
+	}
+	if t.overall > 100 {
+		t.overall = 100
+	}
+	return t.overall
+}
+
+// FormatBytes renders a byte count the way yt-dlp does, e.g. "11.21MiB"
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f%ciB", float64(bytes)/float64(div), "KMGTP"[exp])
+}
+
+// formatETA renders seconds as MM:SS or HH:MM:SS
+func formatETA(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,9 @@
+// Package enginebridge gives the server in this module the download manager
+// of an engine.Engine, which pkg/engine keeps out of its public API.
+package enginebridge
+
+import "gogetmedia/internal/manager"
+
+// Manager returns the download manager of an *engine.Engine. pkg/engine sets
+// it when it is loaded, since this package cannot import it.
+var Manager func(engine interface{}) *manager.DownloadManager
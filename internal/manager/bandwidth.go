@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"log"
+	"time"
+
+	"gogetmedia/internal/core"
+)
+
+// rateLimitLocked returns the --limit-rate value in KiB/s for a download at
+// now, or 0 for unlimited. The global limit is shared evenly between active
+// downloads when the download starts; a per-download limit takes precedence
+// but never exceeds the global cap. Caller must hold dm.mutex.
+func (dm *DownloadManager) rateLimitLocked(download *core.Download, now time.Time) int {
+	global := dm.config.BandwidthLimitAt(now)
+	if global <= 0 {
+		return download.RateLimitKBps
+	}
+
+	if download.RateLimitKBps > 0 {
+		if download.RateLimitKBps < global {
+			return download.RateLimitKBps
+		}
+		return global
+	}
+
+	active := 0
+	for _, d := range dm.downloads {
+		if d.Status == core.StatusDownloading {
+			active++
+		}
+	}
+	if active == 0 {
+		active = 1
+	}
+
+	share := global / active
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
+
+// rebalanceBandwidthLocked restarts active downloads whose applied rate limit
+// is far from what they should get after the global limit changed, by the
+// config or the bandwidth schedule. yt-dlp cannot change its rate while
+// running, so the download is restarted and continues from its partial file.
+// Downloads starting or finishing do not restart the others: every restart
+// changes the shares again. Caller must hold dm.mutex.
+func (dm *DownloadManager) rebalanceBandwidthLocked(now time.Time) {
+	global := dm.config.BandwidthLimitAt(now)
+	if global == dm.bandwidthLimit {
+		return
+	}
+	dm.bandwidthLimit = global
+
+	// The shares are taken before any download is restarted, restarting
+	// changes them
+	wants := make(map[*core.Download]int)
+	for id, download := range dm.downloads {
+		if download.Status != core.StatusDownloading {
+			continue
+		}
+		if _, running := dm.cancelFuncs[id]; !running {
+			continue
+		}
+		wants[download] = dm.rateLimitLocked(download, now)
+	}
+
+	for download, want := range wants {
+		have := download.AppliedRateLimitKBps
+		if !rateLimitNeedsRestart(have, want) {
+			continue
+		}
+
+		log.Printf("[MANAGER] Download %s: Restarting to apply rate limit %d KiB/s (was %d)", download.ID, want, have)
+		dm.restartDownloadLocked(download, "Restarting to apply new bandwidth limit")
+	}
+}
+
+// rateLimitNeedsRestart reports whether the difference between the applied
+// and wanted limit justifies restarting yt-dlp. Small adjustments are
+// ignored to avoid restarting downloads every time the share shifts a little.
+func rateLimitNeedsRestart(have, want int) bool {
+	switch {
+	case have == want:
+		return false
+	case have == 0 || want == 0:
+		// Switching between limited and unlimited
+		return true
+	case have > want:
+		return have*4 > want*5 // more than 25% over budget
+	default:
+		return have*2 < want // using less than half the allowed rate
+	}
+}
+
+// restartDownloadLocked stops a running download and puts it back in the
+// queue once its process has exited. Caller must hold dm.mutex.
+func (dm *DownloadManager) restartDownloadLocked(download *core.Download, message string) {
+	cancelFunc, exists := dm.cancelFuncs[download.ID]
+	if !exists {
+		return
+	}
+	download.Status = core.StatusQueued
+	download.StatusMessage = message
+	cancelFunc()
+	delete(dm.cancelFuncs, download.ID)
+	dm.changedLocked(download)
+}
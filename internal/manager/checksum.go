@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"gogetmedia/internal/core"
+)
+
+// Checksum returns the SHA-256 checksum of the file of a finished download,
+// "" for downloads without a file. It is computed the first time and kept
+// with the download; the file is read without holding the lock.
+func (dm *DownloadManager) Checksum(id string) (string, error) {
+	dm.mutex.RLock()
+	download, exists := dm.downloads[id]
+	if !exists {
+		dm.mutex.RUnlock()
+		return "", fmt.Errorf("download not found")
+	}
+	path, checksum := download.OutputPath, download.SHA256
+	finished := download.Status == core.StatusCompleted || download.Status == core.StatusAlreadyExists
+	dm.mutex.RUnlock()
+
+	if checksum != "" || !finished || path == "" {
+		return checksum, nil
+	}
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return "", err
+	}
+
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	// The file may have been moved or replaced in the meantime
+	if current, exists := dm.downloads[id]; exists && current.OutputPath == path && current.SHA256 == "" {
+		current.SHA256 = checksum
+		dm.touchLocked(current)
+	}
+	return checksum, nil
+}
+
+// wakeChecksums makes the checksum worker compute the missing checksums
+func (dm *DownloadManager) wakeChecksums() {
+	select {
+	case dm.checksumWake <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// checksumWorker computes the missing checksums of finished downloads, once
+// at start and whenever a download completes or a file is found already
+// downloaded
+func (dm *DownloadManager) checksumWorker() {
+	for {
+		dm.computeMissingChecksums()
+		select {
+		case <-dm.ctx.Done():
+			return
+		case <-dm.checksumWake:
+		}
+	}
+}
+
+func (dm *DownloadManager) computeMissingChecksums() {
+	dm.mutex.RLock()
+	var missing []string
+	for id, download := range dm.downloads {
+		finished := download.Status == core.StatusCompleted || download.Status == core.StatusAlreadyExists
+		if finished && download.SHA256 == "" && download.OutputPath != "" {
+			missing = append(missing, id)
+		}
+	}
+	dm.mutex.RUnlock()
+
+	for _, id := range missing {
+		if dm.ctx.Err() != nil {
+			return
+		}
+		if _, err := dm.Checksum(id); err != nil {
+			log.Printf("[MANAGER] Download %s: Failed to compute checksum: %v", id, err)
+		}
+	}
+}
+
+// fileChecksum returns the hex SHA-256 checksum of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gogetmedia/internal/core"
+)
+
+// CleanDestination checks a destination folder and returns it in the form
+// stored with a download: a clean relative path below the download
+// directory, "" for the download directory itself
+func CleanDestination(destination string) (string, error) {
+	destination = strings.TrimSpace(destination)
+	if destination == "" {
+		return "", nil
+	}
+	if filepath.IsAbs(destination) || filepath.VolumeName(destination) != "" {
+		return "", fmt.Errorf("destination must be a folder below the download directory")
+	}
+	destination = filepath.Clean(destination)
+	if destination == ".." || strings.HasPrefix(destination, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("destination must be a folder below the download directory")
+	}
+	if destination == "." {
+		return "", nil
+	}
+	// The server keeps its state and logs in the download directory
+	for _, name := range strings.Split(destination, string(filepath.Separator)) {
+		if strings.HasPrefix(name, ".gogetmedia") {
+			return "", fmt.Errorf("destination %s is reserved for the server", name)
+		}
+	}
+	return destination, nil
+}
+
+// insideOutputDir reports whether dir, with links resolved, is below the
+// download directory. Folders that do not exist yet are checked by their
+// deepest existing parent, they cannot be links.
+func (dm *DownloadManager) insideOutputDir(dir string) bool {
+	root, err := filepath.EvalSymlinks(dm.outputDir)
+	if err != nil {
+		return false
+	}
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return false
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// outputDirLocked returns the folder a download is saved in. Caller must
+// hold dm.mutex.
+func (dm *DownloadManager) outputDirLocked(download *core.Download) string {
+	return filepath.Join(dm.outputDir, download.Destination)
+}
+
+// MoveDownload changes the folder of a download. The file of a finished
+// download is moved there right away, other downloads are saved there when
+// they run.
+func (dm *DownloadManager) MoveDownload(id, destination string) error {
+	destination, err := CleanDestination(destination)
+	if err != nil {
+		return err
+	}
+
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	download, exists := dm.downloads[id]
+	if !exists {
+		return fmt.Errorf("download not found")
+	}
+	if isRunning(download) {
+		return fmt.Errorf("download cannot be moved while it is running")
+	}
+
+	finished := download.Status == core.StatusCompleted || download.Status == core.StatusAlreadyExists
+	if finished && download.OutputPath != "" {
+		dir := filepath.Join(dm.outputDir, destination)
+		target := filepath.Join(dir, filepath.Base(download.OutputPath))
+		if target != download.OutputPath {
+			if _, err := os.Stat(target); err == nil {
+				return fmt.Errorf("a file named %s already exists in the destination", filepath.Base(target))
+			}
+			if !dm.insideOutputDir(dir) {
+				return fmt.Errorf("destination must be a folder below the download directory")
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create destination: %w", err)
+			}
+			if err := os.Rename(download.OutputPath, target); err != nil {
+				return fmt.Errorf("failed to move file: %w", err)
+			}
+			log.Printf("[MANAGER] Moved %s to %s", download.OutputPath, target)
+			download.OutputPath = target
+		}
+	}
+
+	download.Destination = destination
+	dm.touchLocked(download)
+	return nil
+}
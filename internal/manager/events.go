@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gogetmedia/internal/core"
+)
+
+// EventType tells what happened to a download
+type EventType string
+
+const (
+	EventAdded         EventType = "added"
+	EventStatusChanged EventType = "status_changed"
+	EventProgress      EventType = "progress"
+	EventRemoved       EventType = "removed"
+)
+
+// Event reports a change of a download. Download is a copy taken when the
+// event happened; PreviousStatus is set for EventStatusChanged.
+type Event struct {
+	Type           EventType
+	Download       *core.Download
+	PreviousStatus core.DownloadStatus
+	Time           time.Time
+}
+
+// EventHandler receives the events of a manager, one at a time and in order.
+// It runs on a goroutine of its own and may call back into the manager.
+type EventHandler func(Event)
+
+// eventQueue delivers events to the handler without holding the manager's
+// lock, so a slow handler cannot stall downloads
+type eventQueue struct {
+	handler EventHandler
+	mutex   sync.Mutex
+	pending []Event
+	wake    chan struct{}
+
+	// Last status reported per download, to report changes only once
+	statuses map[string]core.DownloadStatus
+}
+
+func newEventQueue(handler EventHandler) *eventQueue {
+	return &eventQueue{
+		handler:  handler,
+		wake:     make(chan struct{}, 1),
+		statuses: make(map[string]core.DownloadStatus),
+	}
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, event)
+	q.mutex.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers events until done is closed, then delivers the events that
+// are still pending
+func (q *eventQueue) run(done <-chan struct{}) {
+	for {
+		select {
+		case <-q.wake:
+			q.deliver()
+		case <-done:
+			q.deliver()
+			return
+		}
+	}
+}
+
+func (q *eventQueue) deliver() {
+	for {
+		q.mutex.Lock()
+		events := q.pending
+		q.pending = nil
+		q.mutex.Unlock()
+		if len(events) == 0 {
+			return
+		}
+
+		for _, event := range events {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[MANAGER] Event handler panicked on %s event for %s: %v", event.Type, event.Download.ID, r)
+					}
+				}()
+				q.handler(event)
+			}()
+		}
+	}
+}
+
+// addedLocked reports a new download. Caller must hold dm.mutex.
+func (dm *DownloadManager) addedLocked(download *core.Download) {
+	dm.touchLocked(download)
+	if dm.events == nil {
+		return
+	}
+	dm.events.statuses[download.ID] = download.Status
+	dm.events.push(Event{Type: EventAdded, Download: download.Clone(), Time: time.Now()})
+}
+
+// changedLocked reports the status of a download if it changed since it was
+// last reported. Caller must hold dm.mutex.
+func (dm *DownloadManager) changedLocked(download *core.Download) {
+	if _, exists := dm.downloads[download.ID]; exists {
+		dm.touchLocked(download)
+	}
+	if dm.events == nil {
+		return
+	}
+	previous, known := dm.events.statuses[download.ID]
+	if known && previous == download.Status {
+		return
+	}
+	if _, exists := dm.downloads[download.ID]; !exists {
+		return
+	}
+	dm.events.statuses[download.ID] = download.Status
+	dm.events.push(Event{Type: EventStatusChanged, Download: download.Clone(), PreviousStatus: previous, Time: time.Now()})
+}
+
+// progressLocked reports new progress of a running download. Caller must
+// hold dm.mutex.
+func (dm *DownloadManager) progressLocked(download *core.Download) {
+	dm.touchLocked(download)
+	if dm.events == nil {
+		return
+	}
+	dm.events.push(Event{Type: EventProgress, Download: download.Clone(), Time: time.Now()})
+}
+
+// removedLocked reports a download that is no longer tracked. Caller must
+// hold dm.mutex.
+func (dm *DownloadManager) removedLocked(download *core.Download) {
+	dm.forgetLocked(download)
+	if dm.events == nil {
+		return
+	}
+	delete(dm.events.statuses, download.ID)
+	dm.events.push(Event{Type: EventRemoved, Download: download.Clone(), Time: time.Now()})
+}
@@ -0,0 +1,165 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gogetmedia/internal/core"
+)
+
+// DownloadLog is the captured yt-dlp/ffmpeg output of a download
+type DownloadLog struct {
+	ID      string         `json:"id"`
+	Command []string       `json:"command,omitempty"`
+	Lines   []core.LogLine `json:"lines"`
+	Live    bool           `json:"live"` // true while the download may still produce output
+}
+
+// savedLog is the on-disk format of a download log
+type savedLog struct {
+	Command []string       `json:"command,omitempty"`
+	Lines   []core.LogLine `json:"lines"`
+}
+
+// LogDirName is the directory in the download directory that holds the logs
+// of finished downloads, one JSON file per download
+const LogDirName = ".gogetmedia_logs"
+
+// GetLogDir returns the directory where download logs are kept
+func (dm *DownloadManager) GetLogDir() string {
+	return filepath.Join(dm.outputDir, LogDirName)
+}
+
+func (dm *DownloadManager) logFilePath(id string) string {
+	return filepath.Join(dm.GetLogDir(), id+".json")
+}
+
+// GetDownloadLog returns the log of a download, from memory while it is
+// active and from disk once it has finished
+func (dm *DownloadManager) GetDownloadLog(id string) (*DownloadLog, error) {
+	downloadLog, _, _, err := dm.subscribeLog(id, false)
+	return downloadLog, err
+}
+
+// SubscribeDownloadLog returns the log of a download together with a channel
+// receiving new lines as they are written. The channel is closed when the
+// download stops running; it is closed immediately for inactive downloads.
+// cancel must be called once the caller is no longer interested.
+func (dm *DownloadManager) SubscribeDownloadLog(id string) (*DownloadLog, <-chan core.LogLine, func(), error) {
+	return dm.subscribeLog(id, true)
+}
+
+func (dm *DownloadManager) subscribeLog(id string, follow bool) (*DownloadLog, <-chan core.LogLine, func(), error) {
+	dm.mutex.RLock()
+	_, exists := dm.downloads[id]
+	buffer, live := dm.logs[id]
+	dm.mutex.RUnlock()
+
+	if !exists {
+		return nil, nil, nil, fmt.Errorf("download not found")
+	}
+
+	downloadLog := &DownloadLog{ID: id, Lines: []core.LogLine{}}
+	if !live {
+		saved, err := dm.readLog(id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		downloadLog.Command = saved.Command
+		downloadLog.Lines = append(downloadLog.Lines, saved.Lines...)
+
+		closed := make(chan core.LogLine)
+		close(closed)
+		return downloadLog, closed, func() {}, nil
+	}
+
+	downloadLog.Live = true
+	downloadLog.Command = buffer.Command()
+	if !follow {
+		downloadLog.Lines = append(downloadLog.Lines, buffer.Lines()...)
+		return downloadLog, nil, func() {}, nil
+	}
+
+	lines, ch, cancel := buffer.Subscribe()
+	downloadLog.Lines = append(downloadLog.Lines, lines...)
+	return downloadLog, ch, cancel, nil
+}
+
+// logBufferLocked returns the live log buffer of a download, creating it and
+// restoring earlier runs from disk if needed. Caller must hold dm.mutex.
+func (dm *DownloadManager) logBufferLocked(id string) *core.LogBuffer {
+	if buffer, exists := dm.logs[id]; exists {
+		return buffer
+	}
+
+	buffer := core.NewLogBuffer(core.DefaultLogLines)
+	if saved, err := dm.readLog(id); err != nil {
+		log.Printf("[MANAGER] Download %s: Failed to read saved log: %v", id, err)
+	} else {
+		buffer.Restore(saved.Lines, saved.Command)
+	}
+	dm.logs[id] = buffer
+	return buffer
+}
+
+// releaseLogLocked closes the live log buffer of a download that has stopped
+// running; later reads come from the saved file. Caller must hold dm.mutex.
+func (dm *DownloadManager) releaseLogLocked(id string) {
+	if buffer, exists := dm.logs[id]; exists {
+		buffer.Close()
+		delete(dm.logs, id)
+	}
+}
+
+// removeLogLocked discards the log of a download that is being removed.
+// Caller must hold dm.mutex.
+func (dm *DownloadManager) removeLogLocked(id string) {
+	dm.releaseLogLocked(id)
+	if err := os.Remove(dm.logFilePath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[MANAGER] Download %s: Failed to remove log: %v", id, err)
+	}
+}
+
+// saveLog writes a log buffer to disk so it is retained with the download
+func (dm *DownloadManager) saveLog(id string, buffer *core.LogBuffer) {
+	data, err := json.Marshal(savedLog{Command: buffer.Command(), Lines: buffer.Lines()})
+	if err != nil {
+		log.Printf("[MANAGER] Download %s: Failed to encode log: %v", id, err)
+		return
+	}
+	if err := os.MkdirAll(dm.GetLogDir(), 0755); err != nil {
+		log.Printf("[MANAGER] Download %s: Failed to create log directory: %v", id, err)
+		return
+	}
+
+	path := dm.logFilePath(id)
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		log.Printf("[MANAGER] Download %s: Failed to write log: %v", id, err)
+		return
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		log.Printf("[MANAGER] Download %s: Failed to save log: %v", id, err)
+	}
+}
+
+// readLog loads a saved log. A missing file is not an error, the download
+// simply has not produced any output yet.
+func (dm *DownloadManager) readLog(id string) (*savedLog, error) {
+	saved := &savedLog{}
+	data, err := os.ReadFile(dm.logFilePath(id))
+	if os.IsNotExist(err) {
+		return saved, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	if err := json.Unmarshal(data, saved); err != nil {
+		return nil, fmt.Errorf("failed to parse log: %w", err)
+	}
+	return saved, nil
+}
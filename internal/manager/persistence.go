@@ -20,28 +20,76 @@ type StateFile struct {
 
 const StateVersion = "1.0"
 
+// StateFileName is the state file in the download directory
+const StateFileName = ".gogetmedia_state.json"
+
+// Store keeps the downloads of a manager between runs
+type Store interface {
+	// Load returns the saved downloads, or nil if none have been saved
+	Load() (map[string]*core.Download, error)
+	// Save replaces the saved downloads
+	Save(downloads map[string]*core.Download) error
+}
+
+// FileStore saves the downloads in a JSON state file
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a store that keeps the state file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
 // GetStateFilePath returns the path where the state file should be stored
 func (dm *DownloadManager) GetStateFilePath() string {
-	return filepath.Join(dm.outputDir, ".gogetmedia_state.json")
+	return filepath.Join(dm.outputDir, StateFileName)
 }
 
-// SaveState persists the current download manager state to disk
-func (dm *DownloadManager) SaveState() error {
+// stateStore returns the configured store, or the state file in the output
+// directory
+func (dm *DownloadManager) stateStore() Store {
+	if dm.store != nil {
+		return dm.store
+	}
 	dm.mutex.RLock()
 	defer dm.mutex.RUnlock()
+	return NewFileStore(dm.GetStateFilePath())
+}
+
+// SaveState persists the current download manager state
+func (dm *DownloadManager) SaveState() error {
+	// Saves run one at a time so an older state never replaces a newer one
+	dm.saveMutex.Lock()
+	defer dm.saveMutex.Unlock()
+
+	store := dm.stateStore()
+
+	// Copy downloads so they can be saved without holding the lock
+	dm.mutex.RLock()
+	downloads := make(map[string]*core.Download, len(dm.downloads))
+	for id, download := range dm.downloads {
+		downloads[id] = download.Clone()
+	}
+	dm.mutex.RUnlock()
+
+	if err := store.Save(downloads); err != nil {
+		return err
+	}
 
+	log.Printf("[MANAGER] State saved with %d downloads", len(downloads))
+	return nil
+}
+
+// Save writes the state file, replacing it atomically
+func (s *FileStore) Save(downloads map[string]*core.Download) error {
 	stateFile := StateFile{
-		Downloads: make(map[string]*core.Download),
+		Downloads: downloads,
 		SavedAt:   time.Now(),
 		Version:   StateVersion,
 	}
 
-	// Copy downloads to avoid locking issues
-	for id, download := range dm.downloads {
-		stateFile.Downloads[id] = download
-	}
-
-	stateFilePath := dm.GetStateFilePath()
+	stateFilePath := s.path
 	data, err := json.MarshalIndent(stateFile, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
@@ -57,35 +105,48 @@ func (dm *DownloadManager) SaveState() error {
 		os.Remove(tempPath) // Clean up temp file
 		return fmt.Errorf("failed to rename state file: %w", err)
 	}
-
-	log.Printf("[MANAGER] State saved with %d downloads", len(stateFile.Downloads))
 	return nil
 }
 
-// LoadState restores the download manager state from disk
-func (dm *DownloadManager) LoadState() error {
-	stateFilePath := dm.GetStateFilePath()
+// Load reads the state file. A missing file or one of another version
+// yields no downloads.
+func (s *FileStore) Load() (map[string]*core.Download, error) {
+	stateFilePath := s.path
 
 	// Check if state file exists
 	if _, err := os.Stat(stateFilePath); os.IsNotExist(err) {
 		log.Printf("[MANAGER] No state file found, starting fresh")
-		return nil
+		return nil, nil
 	}
 
 	data, err := os.ReadFile(stateFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to read state file: %w", err)
+		return nil, fmt.Errorf("failed to read state file: %w", err)
 	}
 
 	var stateFile StateFile
 	if err := json.Unmarshal(data, &stateFile); err != nil {
-		return fmt.Errorf("failed to unmarshal state file: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal state file: %w", err)
 	}
 
 	// Version compatibility check
 	if stateFile.Version != StateVersion {
 		log.Printf("[MANAGER] State file version mismatch (found %s, expected %s), starting fresh",
 			stateFile.Version, StateVersion)
+		return nil, nil
+	}
+
+	log.Printf("[MANAGER] Loading state saved at %s", stateFile.SavedAt.Format("2006-01-02 15:04:05"))
+	return stateFile.Downloads, nil
+}
+
+// LoadState restores the download manager state from its store
+func (dm *DownloadManager) LoadState() error {
+	downloads, err := dm.stateStore().Load()
+	if err != nil {
+		return err
+	}
+	if downloads == nil {
 		return nil
 	}
 
@@ -94,15 +155,17 @@ func (dm *DownloadManager) LoadState() error {
 
 	// Restore downloads
 	restoredCount := 0
-	for id, download := range stateFile.Downloads {
+	for id, download := range downloads {
 		// Validate download state and file existence
 		if dm.validateRestoredDownload(download) {
 			dm.downloads[id] = download
 			dm.progressChannels[id] = make(chan core.DownloadProgress, 10)
 
 			// Re-queue interrupted downloads
+			// Scheduled downloads go back through the queue and are held again if still not due
 			if download.Status == core.StatusDownloading ||
 				download.Status == core.StatusQueued ||
+				download.Status == core.StatusScheduled ||
 				download.Status == core.StatusPostProcessing {
 				download.Status = core.StatusQueued
 				select {
@@ -120,8 +183,8 @@ func (dm *DownloadManager) LoadState() error {
 		}
 	}
 
-	log.Printf("[MANAGER] State restored: %d downloads loaded (saved at %s)",
-		restoredCount, stateFile.SavedAt.Format("2006-01-02 15:04:05"))
+	dm.restoredLocked()
+	log.Printf("[MANAGER] State restored: %d downloads loaded", restoredCount)
 
 	return nil
 }
@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+
+	"gogetmedia/internal/core"
+)
+
+// SetPriority changes the priority of a download. Queued downloads with a
+// higher priority start first.
+func (dm *DownloadManager) SetPriority(id string, priority int) error {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	download, exists := dm.downloads[id]
+	if !exists {
+		return fmt.Errorf("download not found")
+	}
+	if download.Priority == priority {
+		return nil
+	}
+
+	log.Printf("[MANAGER] Download %s priority %d -> %d", id, download.Priority, priority)
+	download.Priority = priority
+	dm.touchLocked(download)
+
+	// A held download may now go ahead of others, or others ahead of it
+	dm.wakeScheduler()
+	return nil
+}
+
+// higherPriorityQueuedLocked reports whether a queued download with a higher
+// priority than download is waiting for a worker. Caller must hold dm.mutex.
+func (dm *DownloadManager) higherPriorityQueuedLocked(download *core.Download) bool {
+	for _, d := range dm.downloads {
+		if d.ID != download.ID && d.Status == core.StatusQueued && d.Priority > download.Priority {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gogetmedia/internal/core"
+)
+
+// Filter selects downloads. Empty fields match every download.
+type Filter struct {
+	Statuses []core.DownloadStatus
+	Type     core.DownloadType
+	Query    string    // case-insensitive text in the title, filename or URL
+	Since    time.Time // added at or after
+
+	ExternalID string // exact match
+}
+
+// Matches reports whether a download is selected by the filter
+func (f Filter) Matches(download *core.Download) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			if download.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.ExternalID != "" && download.ExternalID != f.ExternalID {
+		return false
+	}
+	if f.Type != "" && download.Type != f.Type {
+		return false
+	}
+	if !f.Since.IsZero() && download.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(download.Title), query) &&
+			!strings.Contains(strings.ToLower(download.Filename), query) &&
+			!strings.Contains(strings.ToLower(download.URL), query) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKeys turn a download into a string that sorts like the field
+var sortKeys = map[string]func(*core.Download) string{
+	"created_at": func(d *core.Download) string { return timeKey(&d.CreatedAt) },
+	"completed_at": func(d *core.Download) string {
+		return timeKey(d.CompletedAt)
+	},
+	"title":    func(d *core.Download) string { return strings.ToLower(d.Title) },
+	"status":   func(d *core.Download) string { return string(d.Status) },
+	"type":     func(d *core.Download) string { return string(d.Type) },
+	"progress": func(d *core.Download) string { return fmt.Sprintf("%012.4f", d.Progress.Percentage) },
+	"size": func(d *core.Download) string {
+		size := d.FileSize
+		if size == 0 {
+			size = d.EstimatedBytes
+		}
+		return fmt.Sprintf("%020d", size)
+	},
+}
+
+func timeKey(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("20060102150405.000000000")
+}
+
+// DefaultSort lists the newest downloads first
+const DefaultSort = "-created_at"
+
+// Sort orders downloads by a field, descending with a "-" prefix. Downloads
+// with the same value are ordered by ID, so the order is stable.
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSort parses a sort order like "title" or "-created_at"; "" is
+// DefaultSort
+func ParseSort(value string) (Sort, error) {
+	if value == "" {
+		value = DefaultSort
+	}
+	order := Sort{Field: strings.TrimPrefix(value, "-"), Descending: strings.HasPrefix(value, "-")}
+	if _, ok := sortKeys[order.Field]; !ok {
+		fields := make([]string, 0, len(sortKeys))
+		for field := range sortKeys {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		return Sort{}, fmt.Errorf("unknown sort field %q, expected one of %s", order.Field, strings.Join(fields, ", "))
+	}
+	return order, nil
+}
+
+func (s Sort) String() string {
+	if s.Descending {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Key returns the value a download is sorted by
+func (s Sort) Key(download *core.Download) string {
+	return sortKeys[s.Field](download)
+}
+
+// Before reports whether a download with the given sort key and ID comes
+// before another one
+func (s Sort) Before(key, id, otherKey, otherID string) bool {
+	if key != otherKey {
+		return (key < otherKey) != s.Descending
+	}
+	return (id < otherID) != s.Descending
+}
+
+// Apply sorts downloads in place
+func (s Sort) Apply(downloads []*core.Download) {
+	keys := make(map[string]string, len(downloads))
+	for _, download := range downloads {
+		keys[download.ID] = s.Key(download)
+	}
+	sort.Slice(downloads, func(i, j int) bool {
+		a, b := downloads[i], downloads[j]
+		return s.Before(keys[a.ID], a.ID, keys[b.ID], b.ID)
+	})
+}
+
+// Query returns copies of the downloads selected by filter, in the given
+// order, and the revision they were taken at
+func (dm *DownloadManager) Query(filter Filter, order Sort) ([]*core.Download, uint64) {
+	dm.mutex.RLock()
+	downloads := []*core.Download{}
+	for _, download := range dm.downloads {
+		if filter.Matches(download) {
+			downloads = append(downloads, download.Clone())
+		}
+	}
+	revision := dm.revisions.current
+	dm.mutex.RUnlock()
+
+	order.Apply(downloads)
+	return downloads, revision
+}
+
+// ErrExternalIDInUse is returned when a download is added with the external ID
+// of an existing download of another URL
+var ErrExternalIDInUse = errors.New("external ID is already used by a download of another URL")
+
+// FindByExternalID returns a copy of the download owner added with an
+// external ID
+func (dm *DownloadManager) FindByExternalID(owner, externalID string) (*core.Download, bool) {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	if download := dm.externalLocked(owner, externalID); download != nil {
+		return download.Clone(), true
+	}
+	return nil, false
+}
+
+// externalLocked returns the download owner added with an external ID, or
+// nil. External IDs are only unique per owner. Caller must hold dm.mutex.
+func (dm *DownloadManager) externalLocked(owner, externalID string) *core.Download {
+	if externalID == "" {
+		return nil
+	}
+	for _, download := range dm.downloads {
+		if download.ExternalID == externalID && download.Owner == owner {
+			return download
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -25,15 +26,41 @@ type DownloadManager struct {
 	progressChannels map[string]chan core.DownloadProgress
 	cancelFuncs      map[string]context.CancelFunc
 	pausedDownloads  map[string]*core.Download
-	processingUrls   map[string]bool // Track URLs currently being processed
+	processingUrls   map[string]bool            // Track URLs currently being processed, by processingKey
+	pendingExternal  map[string]pendingAdd      // AddDownload calls with an external ID in progress, by processingKey of the ID
+	held             map[string]*core.Download  // Downloads waiting for their start time, download window or site slot
+	lastHostStart    map[string]time.Time       // Last download start per host, for request spacing
+	logs             map[string]*core.LogBuffer // Output of downloads that are running or may run again soon
+	scheduleWake     chan struct{}
+	bandwidthLimit   int // global limit the running downloads were started with, see rebalanceBandwidthLocked
+	checksumWake     chan struct{}
 	mutex            sync.RWMutex
 	ctx              context.Context
 	cancel           context.CancelFunc
 	outputDir        string
 	config           *config.Config
+	store            Store       // nil for the state file in outputDir
+	saveMutex        sync.Mutex  // serializes SaveState
+	events           *eventQueue // nil without an event handler
+	revisions        revisions
+}
+
+// Options are the optional parts of a download manager
+type Options struct {
+	// Store keeps the downloads between runs, by default in a state file in
+	// the output directory
+	Store Store
+	// OnEvent is called for every added, changed and removed download
+	OnEvent EventHandler
 }
 
 func NewDownloadManager(downloader *core.Downloader, maxConcurrent int, outputDir string, cfg *config.Config) *DownloadManager {
+	return NewDownloadManagerWithOptions(downloader, maxConcurrent, outputDir, cfg, Options{})
+}
+
+// NewDownloadManagerWithOptions creates a download manager with a custom
+// store or event handler
+func NewDownloadManagerWithOptions(downloader *core.Downloader, maxConcurrent int, outputDir string, cfg *config.Config, opts Options) *DownloadManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	workerCtx, workerCancel := context.WithCancel(ctx)
 
@@ -49,10 +76,23 @@ func NewDownloadManager(downloader *core.Downloader, maxConcurrent int, outputDi
 		cancelFuncs:      make(map[string]context.CancelFunc),
 		pausedDownloads:  make(map[string]*core.Download),
 		processingUrls:   make(map[string]bool),
+		pendingExternal:  make(map[string]pendingAdd),
+		held:             make(map[string]*core.Download),
+		lastHostStart:    make(map[string]time.Time),
+		logs:             make(map[string]*core.LogBuffer),
+		scheduleWake:     make(chan struct{}, 1),
+		bandwidthLimit:   cfg.BandwidthLimitAt(time.Now()),
+		checksumWake:     make(chan struct{}, 1),
 		ctx:              ctx,
 		cancel:           cancel,
 		outputDir:        outputDir,
 		config:           cfg,
+		store:            opts.Store,
+		revisions:        newRevisions(time.Now()),
+	}
+	if opts.OnEvent != nil {
+		dm.events = newEventQueue(opts.OnEvent)
+		go dm.events.run(ctx.Done())
 	}
 
 	// Start workers
@@ -68,59 +108,142 @@ func NewDownloadManager(downloader *core.Downloader, maxConcurrent int, outputDi
 		go dm.cleanupWorker()
 	}
 
+	// Start scheduler for held downloads and download windows
+	go dm.schedulerWorker()
+
+	// Checksums of finished files are computed in the background
+	go dm.checksumWorker()
+
 	// Start periodic state saving
 	dm.StartPeriodicStateSave()
 
 	return dm
 }
 
+// ErrNegativeRateLimit is returned for a request with a negative rate limit
+var ErrNegativeRateLimit = errors.New("rate limit cannot be negative")
+
+// ErrDuplicate is wrapped by the errors of AddDownload for a URL that is
+// already in the list with the same type, quality and format
+var ErrDuplicate = errors.New("duplicate download")
+
+type duplicateError string
+
+func (e duplicateError) Error() string { return string(e) }
+func (e duplicateError) Unwrap() error { return ErrDuplicate }
+
+// pendingAdd is an AddDownload with an external ID that has not added its
+// download yet. done is closed when it returns.
+type pendingAdd struct {
+	url  string
+	done chan struct{}
+}
+
 func (dm *DownloadManager) AddDownload(req core.DownloadRequest) (*core.Download, error) {
+	if req.RateLimitKBps < 0 {
+		return nil, ErrNegativeRateLimit
+	}
+
 	// Check if URL is a playlist - don't auto-process playlists
 	if dm.downloader.IsPlaylistURL(req.URL) {
 		return nil, fmt.Errorf("playlist URL detected - use playlist-specific endpoints instead")
 	}
 
-	// Check if this URL is already being processed
+	// Storage and file size quotas need the expected size of the download
+	var estimate int64
+	if dm.needsSizeEstimate(req.Owner) {
+		size, err := dm.downloader.EstimateSize(req)
+		if err != nil {
+			log.Printf("[MANAGER] Failed to estimate size of %s: %v", req.URL, err)
+		}
+		estimate = size
+	}
+
 	dm.mutex.Lock()
-	if dm.processingUrls[req.URL] {
+
+	// A repeated request returns the download it added before, or waits for
+	// the request that is still adding it
+	if existing := dm.externalLocked(req.Owner, req.ExternalID); existing != nil {
 		dm.mutex.Unlock()
-		return nil, fmt.Errorf("this URL is already being processed")
+		if existing.URL != req.URL {
+			return nil, ErrExternalIDInUse
+		}
+		return existing.Clone(), nil
+	}
+	externalKey := processingKey(req.Owner, req.ExternalID)
+	if pending, exists := dm.pendingExternal[externalKey]; exists {
+		dm.mutex.Unlock()
+		if pending.url != req.URL {
+			return nil, ErrExternalIDInUse
+		}
+		<-pending.done
+		return dm.AddDownload(req)
 	}
 
-	// Check if this URL with same type/quality/format is already present
+	// Check if this URL is already being processed
+	if dm.processingUrls[processingKey(req.Owner, req.URL)] {
+		dm.mutex.Unlock()
+		return nil, duplicateError("this URL is already being processed")
+	}
+
+	// Check if this URL with same type/quality/format is already present.
+	// Users only see their own downloads, so those of others do not count.
 	for _, download := range dm.downloads {
-		if download.URL == req.URL &&
+		if download.Owner == req.Owner &&
+			download.URL == req.URL &&
 			download.Type == req.Type &&
 			download.Quality == req.Quality &&
 			download.Format == req.Format {
 
 			// Provide specific error message based on status
 			switch download.Status {
-			case core.StatusQueued, core.StatusDownloading, core.StatusPostProcessing:
+			case core.StatusQueued, core.StatusScheduled, core.StatusDownloading, core.StatusPostProcessing:
 				dm.mutex.Unlock()
-				return nil, fmt.Errorf("this URL is already being downloaded with the same quality and format")
+				return nil, duplicateError("this URL is already being downloaded with the same quality and format")
 			case core.StatusCompleted, core.StatusAlreadyExists:
 				dm.mutex.Unlock()
-				return nil, fmt.Errorf("this URL has already been downloaded with the same quality and format")
+				return nil, duplicateError("this URL has already been downloaded with the same quality and format")
 			case core.StatusFailed:
 				dm.mutex.Unlock()
-				return nil, fmt.Errorf("this URL was previously attempted with the same settings. Remove the failed download first to retry")
+				return nil, duplicateError("this URL was previously attempted with the same settings. Remove the failed download first to retry")
 			}
 		}
 	}
 
+	if err := dm.checkQuotaLocked(req.Owner, 1, estimate); err != nil {
+		dm.mutex.Unlock()
+		return nil, err
+	}
+
 	// Mark URL as being processed
-	dm.processingUrls[req.URL] = true
+	dm.processingUrls[processingKey(req.Owner, req.URL)] = true
+	if req.ExternalID != "" {
+		done := make(chan struct{})
+		dm.pendingExternal[externalKey] = pendingAdd{url: req.URL, done: done}
+		defer func() {
+			dm.mutex.Lock()
+			delete(dm.pendingExternal, externalKey)
+			dm.mutex.Unlock()
+			close(done)
+		}()
+	}
 	dm.mutex.Unlock()
 
 	download := &core.Download{
-		ID:        core.GenerateID(),
-		URL:       req.URL,
-		Type:      req.Type,
-		Quality:   req.Quality,
-		Format:    req.Format,
-		Status:    core.StatusQueued,
-		CreatedAt: time.Now(),
+		ID:          core.GenerateID(),
+		URL:         req.URL,
+		Type:        req.Type,
+		Quality:     req.Quality,
+		Format:      req.Format,
+		Status:      core.StatusQueued,
+		CreatedAt:   time.Now(),
+		StartAt:     req.StartAt,
+		Owner:       req.Owner,
+		ExternalID:  req.ExternalID,
+		Destination: req.Destination,
+
+		RateLimitKBps:  req.RateLimitKBps,
+		EstimatedBytes: estimate,
 	}
 
 	log.Printf("[MANAGER] Adding download %s to queue: URL=%s, Type=%s", download.ID, req.URL, req.Type)
@@ -131,6 +254,9 @@ func (dm *DownloadManager) AddDownload(req core.DownloadRequest) (*core.Download
 		download.Status = core.StatusAlreadyExists
 		download.OutputPath = existingFile
 		download.Filename = filepath.Base(existingFile)
+		if info, err := os.Stat(existingFile); err == nil {
+			download.FileSize = info.Size()
+		}
 		now := time.Now()
 		download.CompletedAt = &now
 
@@ -141,8 +267,10 @@ func (dm *DownloadManager) AddDownload(req core.DownloadRequest) (*core.Download
 		dm.downloads[download.ID] = download
 		dm.progressChannels[download.ID] = make(chan core.DownloadProgress, 10)
 		// Clean up processing URL since file already exists
-		delete(dm.processingUrls, req.URL)
+		delete(dm.processingUrls, processingKey(req.Owner, req.URL))
+		dm.addedLocked(download)
 		dm.mutex.Unlock()
+		dm.wakeChecksums()
 
 		return download, nil
 	}
@@ -150,6 +278,7 @@ func (dm *DownloadManager) AddDownload(req core.DownloadRequest) (*core.Download
 	dm.mutex.Lock()
 	dm.downloads[download.ID] = download
 	dm.progressChannels[download.ID] = make(chan core.DownloadProgress, 10)
+	dm.addedLocked(download)
 	dm.mutex.Unlock()
 
 	// Add to queue
@@ -161,14 +290,27 @@ func (dm *DownloadManager) AddDownload(req core.DownloadRequest) (*core.Download
 		log.Printf("[MANAGER] Download queue is full, rejecting download %s", download.ID)
 		dm.mutex.Lock()
 		delete(dm.downloads, download.ID)
+		dm.removedLocked(download)
 		delete(dm.progressChannels, download.ID)
-		delete(dm.processingUrls, req.URL)
+		delete(dm.processingUrls, processingKey(req.Owner, req.URL))
 		dm.mutex.Unlock()
 		return nil, fmt.Errorf("download queue is full")
 	}
 }
 
+// IsPlaylistURL reports whether url has to be added with AddPlaylistDownload
+func (dm *DownloadManager) IsPlaylistURL(url string) bool {
+	dm.mutex.RLock()
+	downloader := dm.downloader
+	dm.mutex.RUnlock()
+	return downloader.IsPlaylistURL(url)
+}
+
 func (dm *DownloadManager) AddPlaylistDownload(req core.DownloadRequest) (*core.Download, error) {
+	if req.RateLimitKBps < 0 {
+		return nil, ErrNegativeRateLimit
+	}
+
 	log.Printf("[MANAGER] Processing playlist URL: %s", req.URL)
 
 	// Get playlist items
@@ -183,23 +325,42 @@ func (dm *DownloadManager) AddPlaylistDownload(req core.DownloadRequest) (*core.
 
 	log.Printf("[MANAGER] Found %d items in playlist, creating individual downloads", len(items))
 
+	// Sizes are not estimated for playlists, finished items are checked instead
+	dm.mutex.Lock()
+	err = dm.checkQuotaLocked(req.Owner, 1, 0)
+	dm.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a download for each playlist item
 	var firstDownload *core.Download
 	for i, item := range items {
 		download := &core.Download{
-			ID:        core.GenerateID(),
-			URL:       fmt.Sprintf("https://www.youtube.com/watch?v=%s", item.ID),
-			Type:      req.Type,
-			Quality:   req.Quality,
-			Format:    req.Format,
-			Status:    core.StatusQueued,
-			Title:     item.Title,
-			CreatedAt: time.Now(),
+			ID:          core.GenerateID(),
+			URL:         fmt.Sprintf("https://www.youtube.com/watch?v=%s", item.ID),
+			Type:        req.Type,
+			Quality:     req.Quality,
+			Format:      req.Format,
+			Status:      core.StatusQueued,
+			Title:       item.Title,
+			CreatedAt:   time.Now(),
+			StartAt:     req.StartAt,
+			Owner:       req.Owner,
+			Destination: req.Destination,
+
+			RateLimitKBps: req.RateLimitKBps,
 		}
 
 		dm.mutex.Lock()
+		if err := dm.checkQuotaLocked(req.Owner, 1, 0); err != nil {
+			dm.mutex.Unlock()
+			log.Printf("[MANAGER] Skipping remaining playlist items: %v", err)
+			break
+		}
 		dm.downloads[download.ID] = download
 		dm.progressChannels[download.ID] = make(chan core.DownloadProgress, 10)
+		dm.addedLocked(download)
 		dm.mutex.Unlock()
 
 		// Add to queue
@@ -226,6 +387,18 @@ func (dm *DownloadManager) GetDownload(id string) (*core.Download, bool) {
 	return download, exists
 }
 
+// processingKey is the key of a URL in processingUrls. Each owner can add a
+// URL once at a time.
+func processingKey(owner, url string) string {
+	return owner + "\x00" + url
+}
+
+// ownedBy reports whether a download belongs to owner; an empty owner matches
+// every download
+func ownedBy(download *core.Download, owner string) bool {
+	return owner == "" || download.Owner == owner
+}
+
 func (dm *DownloadManager) GetAllDownloads() []*core.Download {
 	dm.mutex.RLock()
 	defer dm.mutex.RUnlock()
@@ -238,6 +411,29 @@ func (dm *DownloadManager) GetAllDownloads() []*core.Download {
 	return downloads
 }
 
+// Snapshot returns copies of the downloads with the given IDs, or of all
+// downloads without IDs. Unlike GetDownload and GetAllDownloads, the copies
+// can be read while downloads keep changing.
+func (dm *DownloadManager) Snapshot(ids ...string) []*core.Download {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	if len(ids) == 0 {
+		downloads := make([]*core.Download, 0, len(dm.downloads))
+		for _, download := range dm.downloads {
+			downloads = append(downloads, download.Clone())
+		}
+		return downloads
+	}
+	downloads := make([]*core.Download, 0, len(ids))
+	for _, id := range ids {
+		if download, exists := dm.downloads[id]; exists {
+			downloads = append(downloads, download.Clone())
+		}
+	}
+	return downloads
+}
+
 func (dm *DownloadManager) CancelDownload(id string) error {
 	dm.mutex.Lock()
 	defer dm.mutex.Unlock()
@@ -262,13 +458,15 @@ func (dm *DownloadManager) CancelDownload(id string) error {
 		}
 		
 		download.Status = core.StatusCancelled
-	} else if download.Status == core.StatusQueued {
+	} else if download.Status == core.StatusQueued || download.Status == core.StatusScheduled {
 		download.Status = core.StatusCancelled
 	}
+	delete(dm.held, id)
 
 	// Clean up processing URL on cancellation
-	delete(dm.processingUrls, download.URL)
+	delete(dm.processingUrls, processingKey(download.Owner, download.URL))
 
+	dm.changedLocked(download)
 	return nil
 }
 
@@ -290,14 +488,17 @@ func (dm *DownloadManager) PauseDownload(id string) error {
 		download.Status = core.StatusPaused
 		dm.pausedDownloads[id] = download
 		log.Printf("[MANAGER] Download %s paused", id)
-	} else if download.Status == core.StatusQueued {
+	} else if download.Status == core.StatusQueued || download.Status == core.StatusScheduled {
+		log.Printf("[MANAGER] Download %s paused (was %s)", id, download.Status)
 		download.Status = core.StatusPaused
+		download.StatusMessage = ""
 		dm.pausedDownloads[id] = download
-		log.Printf("[MANAGER] Download %s paused (was queued)", id)
+		delete(dm.held, id)
 	} else {
 		return fmt.Errorf("download cannot be paused in current state: %s", download.Status)
 	}
 
+	dm.changedLocked(download)
 	return nil
 }
 
@@ -327,6 +528,7 @@ func (dm *DownloadManager) ResumeDownload(id string) error {
 	select {
 	case dm.queue <- download:
 		log.Printf("[MANAGER] Download %s resumed (will continue from partial file if exists)", id)
+		dm.changedLocked(download)
 		return nil
 	default:
 		download.Status = core.StatusPaused
@@ -344,26 +546,48 @@ func (dm *DownloadManager) RetryDownload(id string) error {
 		return fmt.Errorf("download not found")
 	}
 
-	if download.Status == core.StatusDownloading || download.Status == core.StatusQueued {
+	if download.Status == core.StatusDownloading || download.Status == core.StatusQueued || download.Status == core.StatusScheduled {
 		return fmt.Errorf("download is already active")
 	}
 
-	// Reset download state
-	download.Status = core.StatusQueued
-	download.Error = ""
-	download.Progress = core.DownloadProgress{}
-	download.CompletedAt = nil
-
-	// Re-queue the download
+	// Re-queue the download first, so it keeps its state when the queue is
+	// full. The worker that takes it waits for the lock and sees the reset.
 	select {
 	case dm.queue <- download:
-		return nil
 	default:
 		return fmt.Errorf("download queue is full")
 	}
+
+	// An attempt left open by an internal restart ended with the download
+	if n := len(download.Attempts); n > 0 && download.Attempts[n-1].EndedAt == nil {
+		dm.finishAttemptLocked(download, time.Now(), download.Status, nil)
+	}
+
+	// Reset download state. A manual retry starts a fresh automatic retry budget.
+	download.Status = core.StatusQueued
+	download.Error = ""
+	download.ErrorCode = ""
+	download.AutoRetries = 0
+	download.NextAttemptAt = nil
+	download.Progress = core.DownloadProgress{}
+	download.CompletedAt = nil
+	dm.changedLocked(download)
+	return nil
 }
 
+// RemoveDownload removes a download and deletes its file and any partial or
+// temporary files
 func (dm *DownloadManager) RemoveDownload(id string) error {
+	return dm.removeDownload(id, true)
+}
+
+// RemoveDownloadKeepFiles removes a download from the list and leaves its
+// files on disk
+func (dm *DownloadManager) RemoveDownloadKeepFiles(id string) error {
+	return dm.removeDownload(id, false)
+}
+
+func (dm *DownloadManager) removeDownload(id string, deleteFiles bool) error {
 	dm.mutex.Lock()
 	defer dm.mutex.Unlock()
 
@@ -382,9 +606,9 @@ func (dm *DownloadManager) RemoveDownload(id string) error {
 	}
 
 	// Delete the actual file if it exists (for completed, already exists, or post-processing downloads)
-	if download.Status == core.StatusCompleted || 
-	   download.Status == core.StatusAlreadyExists || 
-	   download.Status == core.StatusPostProcessing {
+	if deleteFiles && (download.Status == core.StatusCompleted ||
+		download.Status == core.StatusAlreadyExists ||
+		download.Status == core.StatusPostProcessing) {
 		if download.OutputPath != "" {
 			// Delete the main output file
 			if err := os.Remove(download.OutputPath); err != nil {
@@ -397,10 +621,10 @@ func (dm *DownloadManager) RemoveDownload(id string) error {
 	}
 
 	// Clean up temporary files for downloads that were in progress, post-processing, or left in failed/cancelled state
-	if download.Status == core.StatusDownloading || 
-	   download.Status == core.StatusPostProcessing || 
-	   download.Status == core.StatusFailed || 
-	   download.Status == core.StatusCancelled {
+	if deleteFiles && (download.Status == core.StatusDownloading ||
+		download.Status == core.StatusPostProcessing ||
+		download.Status == core.StatusFailed ||
+		download.Status == core.StatusCancelled) {
 		dm.cleanupTemporaryFiles(download)
 		log.Printf("[MANAGER] Cleaned up temporary files for download %s (status: %s)", download.ID, download.Status)
 		
@@ -416,9 +640,12 @@ func (dm *DownloadManager) RemoveDownload(id string) error {
 	}
 
 	delete(dm.downloads, id)
+	dm.removedLocked(download)
+	dm.removeLogLocked(id)
 	delete(dm.pausedDownloads, id)
-	delete(dm.cancelFuncs, id)              // Ensure cancel function is removed
-	delete(dm.processingUrls, download.URL) // Clean up processing URL
+	delete(dm.held, id)
+	delete(dm.cancelFuncs, id)                                             // Ensure cancel function is removed
+	delete(dm.processingUrls, processingKey(download.Owner, download.URL)) // Clean up processing URL
 	if ch, exists := dm.progressChannels[id]; exists {
 		// Safe channel closing - use recover to handle already closed channels
 		func() {
@@ -469,7 +696,7 @@ func (dm *DownloadManager) cleanupTemporaryFiles(download *core.Download) {
 	}
 
 	// Look for temporary files in the output directory
-	outputDir := dm.outputDir
+	outputDir := dm.outputDirLocked(download)
 	if download.OutputPath != "" {
 		outputDir = filepath.Dir(download.OutputPath)
 	}
@@ -550,8 +777,9 @@ func (dm *DownloadManager) cleanupTemporaryFiles(download *core.Download) {
 	}
 }
 
-// ClearAllQueued marks all downloads in queued status as cancelled and removes them
-func (dm *DownloadManager) ClearAllQueued() error {
+// ClearAllQueued marks all downloads in queued status as cancelled and removes them.
+// Only downloads of owner are affected, or all downloads if owner is empty.
+func (dm *DownloadManager) ClearAllQueued(owner string) error {
 	func() {
 		dm.mutex.Lock()
 		defer dm.mutex.Unlock()
@@ -560,16 +788,17 @@ func (dm *DownloadManager) ClearAllQueued() error {
 		deletedCount := 0
 		
 		for id, download := range dm.downloads {
-			if download.Status == core.StatusQueued {
+			if (download.Status == core.StatusQueued || download.Status == core.StatusScheduled) && ownedBy(download, owner) {
 				// First mark as cancelled so workers will skip them when they pick them up from the queue
 				download.Status = core.StatusCancelled
 				cancelledCount++
 				
 				// Clean up from processing URLs map to allow re-adding same URL
-				delete(dm.processingUrls, download.URL)
+				delete(dm.processingUrls, processingKey(download.Owner, download.URL))
 				
 				// Remove progress channels and cancel functions
 				delete(dm.pausedDownloads, id)
+				delete(dm.held, id)
 				delete(dm.cancelFuncs, id)
 				if ch, exists := dm.progressChannels[id]; exists {
 					func() {
@@ -585,6 +814,8 @@ func (dm *DownloadManager) ClearAllQueued() error {
 				
 				// Remove from downloads map completely
 				delete(dm.downloads, id)
+				dm.removedLocked(download)
+				dm.removeLogLocked(id)
 				deletedCount++
 			}
 		}
@@ -751,15 +982,16 @@ func (dm *DownloadManager) isLikelyYtDlpFile(filename string) bool {
 	return false
 }
 
-// DeleteAllCompleted removes all completed downloads and their files
-func (dm *DownloadManager) DeleteAllCompleted() error {
+// DeleteAllCompleted removes all completed downloads and their files.
+// Only downloads of owner are affected, or all downloads if owner is empty.
+func (dm *DownloadManager) DeleteAllCompleted(owner string) error {
 	dm.mutex.Lock()
 	defer dm.mutex.Unlock()
 
 	deletedCount := 0
 	filesDeleted := 0
 	for id, download := range dm.downloads {
-		if download.Status == core.StatusCompleted || download.Status == core.StatusAlreadyExists {
+		if (download.Status == core.StatusCompleted || download.Status == core.StatusAlreadyExists) && ownedBy(download, owner) {
 			// Delete the actual file if it exists
 			if download.OutputPath != "" {
 				if err := os.Remove(download.OutputPath); err != nil {
@@ -772,6 +1004,8 @@ func (dm *DownloadManager) DeleteAllCompleted() error {
 
 			// Remove from tracking
 			delete(dm.downloads, id)
+			dm.removedLocked(download)
+			dm.removeLogLocked(id)
 			delete(dm.pausedDownloads, id)
 			delete(dm.cancelFuncs, id)
 			if ch, exists := dm.progressChannels[id]; exists {
@@ -793,19 +1027,22 @@ func (dm *DownloadManager) DeleteAllCompleted() error {
 	return nil
 }
 
-// ClearAllFailed removes all failed downloads from the list
-func (dm *DownloadManager) ClearAllFailed() error {
+// ClearAllFailed removes all failed downloads from the list.
+// Only downloads of owner are affected, or all downloads if owner is empty.
+func (dm *DownloadManager) ClearAllFailed(owner string) error {
 	dm.mutex.Lock()
 	defer dm.mutex.Unlock()
 
 	clearedCount := 0
 	for id, download := range dm.downloads {
-		if download.Status == core.StatusFailed {
+		if download.Status == core.StatusFailed && ownedBy(download, owner) {
 			// Clean up any temporary files that might have been left behind
 			dm.cleanupTemporaryFiles(download)
 			
 			// Remove from tracking
 			delete(dm.downloads, id)
+			dm.removedLocked(download)
+			dm.removeLogLocked(id)
 			delete(dm.pausedDownloads, id)
 			delete(dm.cancelFuncs, id)
 			if ch, exists := dm.progressChannels[id]; exists {
@@ -872,6 +1109,9 @@ func (dm *DownloadManager) worker() {
 				log.Printf("[MANAGER] Skipping paused download %s", download.ID)
 				continue
 			}
+			if !dm.admit(currentDownload) {
+				continue
+			}
 			
 			// Use the current download state, not the queued one
 			log.Printf("[MANAGER] Worker processing download %s", currentDownload.ID)
@@ -905,6 +1145,9 @@ func (dm *DownloadManager) UpdateConfig(newConfig *config.Config) {
 	log.Printf("[MANAGER] Downloader updated with new paths: yt-dlp=%s, ffmpeg=%s", 
 		newConfig.YtDlpPath, newConfig.FfmpegPath)
 
+	// Apply bandwidth limit changes to running downloads
+	dm.rebalanceBandwidthLocked(time.Now())
+
 	// Adjust workers if needed
 	if oldMaxConcurrent != dm.maxConcurrent {
 		dm.adjustWorkers(oldMaxConcurrent, dm.maxConcurrent)
@@ -942,7 +1185,22 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 	dm.mutex.Lock()
 	// Update status to downloading immediately
 	download.Status = core.StatusDownloading
-	progressChan := dm.progressChannels[download.ID]
+	progressChan, exists := dm.progressChannels[download.ID]
+	if !exists {
+		// The channel is closed when a run ends, so resumed downloads need a new one
+		progressChan = make(chan core.DownloadProgress, 10)
+		dm.progressChannels[download.ID] = progressChan
+	}
+	download.AppliedRateLimitKBps = dm.rateLimitLocked(download, time.Now())
+	started := "started"
+	if !dm.startAttemptLocked(download, time.Now()) {
+		started = "continued"
+	}
+	logBuffer := dm.logBufferLocked(download.ID)
+	logBuffer.Add(core.LogInfo, fmt.Sprintf("Attempt %d %s", download.Attempts[len(download.Attempts)-1].Number, started))
+	siteLimit := dm.config.SiteLimitFor(core.HostKey(download.URL))
+	outputDir := dm.outputDirLocked(download)
+	dm.changedLocked(download)
 	dm.mutex.Unlock()
 
 	req := core.DownloadRequest{
@@ -950,7 +1208,14 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 		Type:      download.Type,
 		Quality:   download.Quality,
 		Format:    download.Format,
-		OutputDir: dm.outputDir, // Use the configured output directory
+		OutputDir: outputDir,
+
+		RateLimitKBps:    download.AppliedRateLimitKBps,
+		SleepRequests:    siteLimit.SleepRequestsSeconds,
+		SleepInterval:    siteLimit.SleepIntervalSeconds,
+		MaxSleepInterval: siteLimit.MaxSleepIntervalSeconds,
+
+		Log: logBuffer,
 	}
 
 	log.Printf("[MANAGER] Download %s: Creating context and starting download", download.ID)
@@ -963,13 +1228,25 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 	dm.cancelFuncs[download.ID] = cancel
 	dm.mutex.Unlock()
 
+	requeue := false
 	defer func() {
 		dm.mutex.Lock()
-		delete(dm.cancelFuncs, download.ID)
-		delete(dm.processingUrls, download.URL)
+		// Whoever stopped this run removed its cancel function already, and
+		// the next run may have registered its own since
+		if ctx.Err() == nil {
+			delete(dm.cancelFuncs, download.ID)
+		}
+		if !requeue {
+			delete(dm.processingUrls, processingKey(download.Owner, download.URL))
+		}
 		dm.mutex.Unlock()
 		cancel()
 		log.Printf("[MANAGER] Download %s: Context cancelled and cleanup completed", download.ID)
+
+		// Only now, so the next run cannot overlap with this one
+		if requeue {
+			dm.requeue(download)
+		}
 	}()
 
 	// Start progress monitoring goroutine
@@ -982,6 +1259,7 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 		for progress := range progressChan {
 			dm.mutex.Lock()
 			download.Progress = progress
+			dm.progressLocked(download)
 			dm.mutex.Unlock()
 		}
 		log.Printf("[MANAGER] Download %s: Progress monitoring stopped", download.ID)
@@ -992,13 +1270,31 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 	completedDownload, err := dm.downloader.Download(ctx, req, progressChan, dm.UpdateDownloadTitle, dm.UpdateDownloadStatus, download.ID)
 
 	dm.mutex.Lock()
+	now := time.Now()
+	download.Command = logBuffer.Command()
 	if ctx.Err() == context.Canceled {
-		log.Printf("[MANAGER] Download %s: Cancelled", download.ID)
-		download.Status = core.StatusCancelled
+		if download.Status == core.StatusScheduled {
+			// Stopped by the scheduler when the download window closed; the
+			// attempt stays open and continues later
+			log.Printf("[MANAGER] Download %s: Stopped (%s)", download.ID, download.Status)
+		} else if download.Status == core.StatusQueued {
+			// Restarted with new settings; yt-dlp continues from the partial
+			// file within the same attempt
+			log.Printf("[MANAGER] Download %s: Restarting", download.ID)
+			requeue = true
+		} else {
+			if download.Status == core.StatusPaused {
+				// Keep the status so it can continue later
+				log.Printf("[MANAGER] Download %s: Stopped (%s)", download.ID, download.Status)
+			} else {
+				log.Printf("[MANAGER] Download %s: Cancelled", download.ID)
+				download.Status = core.StatusCancelled
+			}
+			dm.finishAttemptLocked(download, now, download.Status, nil)
+		}
 	} else if err != nil {
 		log.Printf("[MANAGER] Download %s: Failed with error: %v", download.ID, err)
-		download.Status = core.StatusFailed
-		download.Error = err.Error()
+		dm.handleFailureLocked(download, err, now)
 	} else {
 		log.Printf("[MANAGER] Download %s: Completed successfully", download.ID)
 		download.Status = completedDownload.Status
@@ -1006,6 +1302,16 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 		download.Filename = completedDownload.Filename
 		download.OutputPath = completedDownload.OutputPath
 		download.CompletedAt = completedDownload.CompletedAt
+		download.ErrorCode = ""
+		download.SHA256 = ""
+		if info, err := os.Stat(download.OutputPath); err == nil {
+			download.FileSize = info.Size()
+		}
+		if quotaErr := dm.checkCompletedQuotaLocked(download); quotaErr != nil {
+			dm.rejectCompletedLocked(download, quotaErr, now)
+		} else {
+			dm.finishAttemptLocked(download, now, download.Status, nil)
+		}
 	}
 
 	// Close progress channel safely after download completion
@@ -1020,7 +1326,47 @@ func (dm *DownloadManager) processDownload(download *core.Download) {
 		}()
 		delete(dm.progressChannels, download.ID)
 	}
+	dm.changedLocked(download)
 	dm.mutex.Unlock()
+
+	// Keep the log with the download; finished downloads are read from disk
+	dm.mutex.RLock()
+	_, stillExists := dm.downloads[download.ID]
+	dm.mutex.RUnlock()
+	if stillExists {
+		dm.saveLog(download.ID, logBuffer)
+	}
+	dm.mutex.Lock()
+	if download.Status == core.StatusCompleted || download.Status == core.StatusFailed || download.Status == core.StatusCancelled {
+		dm.releaseLogLocked(download.ID)
+	}
+	completed := download.Status == core.StatusCompleted
+	dm.mutex.Unlock()
+
+	// A worker and possibly a per-site slot just became free
+	dm.wakeScheduler()
+
+	// Hashing a large file would hold the worker, the checksum worker does it
+	if completed {
+		dm.wakeChecksums()
+	}
+}
+
+// requeue puts a restarted download back in the queue
+func (dm *DownloadManager) requeue(download *core.Download) {
+	if dm.ctx.Err() != nil {
+		// Shutting down, the queue is closed; the download resumes at the next start
+		return
+	}
+	select {
+	case dm.queue <- download:
+	default:
+		dm.mutex.Lock()
+		download.Status = core.StatusFailed
+		download.Error = "Download queue is full"
+		dm.changedLocked(download)
+		dm.mutex.Unlock()
+	}
 }
 
 func (dm *DownloadManager) UpdateDownloadTitle(id, title string) {
@@ -1030,6 +1376,7 @@ func (dm *DownloadManager) UpdateDownloadTitle(id, title string) {
 	if download, exists := dm.downloads[id]; exists {
 		if download.Title != title {
 			download.Title = title
+			dm.touchLocked(download)
 			log.Printf("[MANAGER] Download %s: Title updated to: %s", id, title)
 		}
 	}
@@ -1043,6 +1390,7 @@ func (dm *DownloadManager) UpdateDownloadStatus(id string, status core.DownloadS
 		if download.Status != status {
 			download.Status = status
 			log.Printf("[MANAGER] Download %s: Status updated to: %s", id, status)
+			dm.changedLocked(download)
 		}
 	}
 }
@@ -1090,6 +1438,8 @@ func (dm *DownloadManager) cleanupExpiredDownloads() {
 
 				// Remove from downloads map
 				delete(dm.downloads, id)
+				dm.removedLocked(download)
+				dm.removeLogLocked(id)
 
 				// Clean up progress channel
 				if ch, exists := dm.progressChannels[id]; exists {
@@ -1,8 +1,12 @@
 package manager
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -80,6 +84,12 @@ func TestAddDownload(t *testing.T) {
 	if download.URL != req.URL {
 		t.Errorf("Expected URL=%s, got %s", req.URL, download.URL)
 	}
+
+	req.URL = "https://example.com/other"
+	req.RateLimitKBps = -1
+	if _, err := dm.AddDownload(req); !errors.Is(err, ErrNegativeRateLimit) {
+		t.Errorf("Expected an error for a negative rate limit, got %v", err)
+	}
 }
 
 func TestGetDownload(t *testing.T) {
@@ -373,3 +383,926 @@ func TestShutdown(t *testing.T) {
 	// Give some time for cleanup
 	time.Sleep(100 * time.Millisecond)
 }
+
+func TestScheduledDownloadIsHeld(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	downloader := core.NewDownloader("yt-dlp", "ffmpeg", false, false)
+	cfg := &config.Config{
+		CompletedFileExpiryHours: 0,
+	}
+
+	dm := NewDownloadManager(downloader, 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	startAt := time.Now().Add(time.Hour)
+	download, err := dm.AddDownload(core.DownloadRequest{
+		URL:       "https://example.com/test",
+		Type:      core.VideoDownload,
+		Quality:   "720p",
+		Format:    "mp4",
+		OutputDir: tempDir,
+		StartAt:   &startAt,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+
+	if dm.admit(download) {
+		t.Fatal("Expected download with future start time to be held")
+	}
+	if download.Status != core.StatusScheduled {
+		t.Errorf("Expected status=scheduled, got %s", download.Status)
+	}
+
+	// Not yet due, so the scheduler keeps holding it
+	dm.runSchedule(time.Now())
+	if download.Status != core.StatusScheduled {
+		t.Errorf("Expected download to stay scheduled, got %s", download.Status)
+	}
+
+	// Once the start time has passed the scheduler releases it to the queue
+	dm.runSchedule(startAt.Add(time.Minute))
+	if download.Status != core.StatusQueued {
+		t.Errorf("Expected status=queued after start time, got %s", download.Status)
+	}
+	if dm.GetScheduleStatus().Held != 0 {
+		t.Errorf("Expected no held downloads after release")
+	}
+}
+
+func TestDownloadWindowHoldsDownloads(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A one-minute window that has just closed
+	closed := time.Now().Add(-2 * time.Minute)
+	cfg := &config.Config{
+		DownloadWindows: []config.ScheduleWindow{{
+			Start: closed.Format("15:04"),
+			End:   closed.Add(time.Minute).Format("15:04"),
+		}},
+	}
+
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	download, err := dm.AddDownload(core.DownloadRequest{
+		URL:       "https://example.com/test",
+		Type:      core.VideoDownload,
+		Quality:   "720p",
+		Format:    "mp4",
+		OutputDir: tempDir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+
+	if dm.admit(download) {
+		t.Fatal("Expected download outside the window to be held")
+	}
+	if dm.GetScheduleStatus().WindowOpen {
+		t.Error("Expected download window to be reported as closed")
+	}
+}
+
+func TestRateLimitSharing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{BandwidthLimitKBps: 900}
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	for _, id := range []string{"a", "b", "c"} {
+		dm.downloads[id] = &core.Download{ID: id, Status: core.StatusDownloading}
+	}
+	override := &core.Download{ID: "d", Status: core.StatusQueued, RateLimitKBps: 2000}
+
+	if got := dm.rateLimitLocked(dm.downloads["a"], time.Now()); got != 300 {
+		t.Errorf("Expected global limit split three ways (300), got %d", got)
+	}
+	if got := dm.rateLimitLocked(override, time.Now()); got != 900 {
+		t.Errorf("Expected per-download override capped at global limit (900), got %d", got)
+	}
+
+	dm.config.BandwidthLimitKBps = 0
+	if got := dm.rateLimitLocked(dm.downloads["a"], time.Now()); got != 0 {
+		t.Errorf("Expected unlimited without a global limit, got %d", got)
+	}
+	if got := dm.rateLimitLocked(override, time.Now()); got != 2000 {
+		t.Errorf("Expected per-download override without a global limit, got %d", got)
+	}
+}
+
+func TestRateLimitNeedsRestart(t *testing.T) {
+	tests := []struct {
+		have, want int
+		restart    bool
+	}{
+		{300, 300, false},
+		{300, 280, false},
+		{300, 200, true},
+		{300, 500, false},
+		{300, 900, true},
+		{0, 300, true},
+		{300, 0, true},
+	}
+	for _, tt := range tests {
+		if got := rateLimitNeedsRestart(tt.have, tt.want); got != tt.restart {
+			t.Errorf("rateLimitNeedsRestart(%d, %d) = %v, want %v", tt.have, tt.want, got, tt.restart)
+		}
+	}
+}
+
+func TestRebalanceOnlyWhenLimitChanges(t *testing.T) {
+	cfg := &config.Config{BandwidthLimitKBps: 1000}
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, t.TempDir(), cfg)
+	defer dm.Shutdown()
+
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	start := func(id string) {
+		download := &core.Download{ID: id, Status: core.StatusDownloading}
+		dm.downloads[id] = download
+		download.AppliedRateLimitKBps = dm.rateLimitLocked(download, time.Now())
+		dm.cancelFuncs[id] = func() {}
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		start(id)
+	}
+
+	// A download starting next to the running ones gets a smaller share
+	// without restarting them
+	start("d")
+	if got := dm.downloads["d"].AppliedRateLimitKBps; got != 250 {
+		t.Errorf("Expected the new download to get a quarter (250), got %d", got)
+	}
+	for i := 0; i < 3; i++ {
+		dm.rebalanceBandwidthLocked(time.Now())
+	}
+	for id, download := range dm.downloads {
+		if download.Status != core.StatusDownloading {
+			t.Errorf("Expected download %s to keep running, got %s", id, download.Status)
+		}
+	}
+
+	// A new limit restarts the downloads that are far from their share
+	dm.config.BandwidthLimitKBps = 400
+	dm.rebalanceBandwidthLocked(time.Now())
+	for id, download := range dm.downloads {
+		if download.Status != core.StatusQueued {
+			t.Errorf("Expected download %s to be restarted, got %s", id, download.Status)
+		}
+	}
+}
+
+func TestSiteLimitHoldsDownloads(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{
+		SiteLimits: []config.SiteLimit{{Host: "example.com", MaxConcurrent: 1}},
+	}
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	var downloads []*core.Download
+	for _, url := range []string{"https://example.com/one", "https://www.example.com/two", "https://other.org/three"} {
+		download, err := dm.AddDownload(core.DownloadRequest{URL: url, Type: core.VideoDownload, Quality: "720p", Format: "mp4", OutputDir: tempDir})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		downloads = append(downloads, download)
+	}
+
+	if !dm.admit(downloads[0]) {
+		t.Fatal("Expected first download from example.com to start")
+	}
+	if dm.admit(downloads[1]) {
+		t.Error("Expected second download from example.com to wait for a free slot")
+	}
+	if !dm.admit(downloads[2]) {
+		t.Error("Expected download from another host to start")
+	}
+
+	// Finishing the first download frees the slot
+	dm.mutex.Lock()
+	downloads[0].Status = core.StatusCompleted
+	dm.mutex.Unlock()
+	dm.runSchedule(time.Now())
+	if downloads[1].Status != core.StatusQueued {
+		t.Errorf("Expected held download to be released, got %s", downloads[1].Status)
+	}
+}
+
+func TestHeldDownloadsReleasedInOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	startAt := time.Now().Add(time.Hour)
+	var downloads []*core.Download
+	for i := 0; i < 8; i++ {
+		download, err := dm.AddDownload(core.DownloadRequest{URL: fmt.Sprintf("https://example.com/%d", i), Type: core.VideoDownload, Quality: "720p", Format: "mp4", OutputDir: tempDir, StartAt: &startAt})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		downloads = append(downloads, download)
+	}
+	for len(dm.queue) > 0 {
+		dm.admit(<-dm.queue)
+	}
+
+	// Released in the order they were added, whatever the map order
+	dm.runSchedule(startAt.Add(time.Minute))
+	if len(dm.queue) != len(downloads) {
+		t.Fatalf("Expected all %d downloads to be released, got %d", len(downloads), len(dm.queue))
+	}
+	for i, expected := range downloads {
+		if got := <-dm.queue; got.ID != expected.ID {
+			t.Fatalf("Released download %d is %s, expected %s", i, got.URL, expected.URL)
+		}
+	}
+}
+
+func TestTransientFailureIsRetried(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{
+		Retry: config.RetryPolicy{MaxAttempts: 2, BaseDelaySeconds: 60, MaxDelaySeconds: 60},
+	}
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	download, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/video", Type: core.VideoDownload, Quality: "720p", Format: "mp4", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+
+	now := time.Now()
+	dm.mutex.Lock()
+	dm.startAttemptLocked(download, now)
+	dm.handleFailureLocked(download, &core.DownloadError{Code: core.ErrorNetwork, Message: "connection reset"}, now)
+	dm.mutex.Unlock()
+
+	if download.Status != core.StatusScheduled || download.NextAttemptAt == nil {
+		t.Fatalf("Expected network failure to be scheduled for retry, got %s", download.Status)
+	}
+	if !download.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected retry in 1 minute, got %v", download.NextAttemptAt.Sub(now))
+	}
+	if len(download.Attempts) != 1 || download.Attempts[0].ErrorCode != core.ErrorNetwork {
+		t.Errorf("Expected one recorded network attempt, got %+v", download.Attempts)
+	}
+
+	dm.runSchedule(now.Add(30 * time.Second))
+	if download.Status != core.StatusScheduled {
+		t.Errorf("Expected download to wait for its retry time, got %s", download.Status)
+	}
+	dm.runSchedule(now.Add(2 * time.Minute))
+	if download.Status != core.StatusQueued {
+		t.Errorf("Expected download to be released for retry, got %s", download.Status)
+	}
+
+	// The second attempt uses up the policy
+	dm.mutex.Lock()
+	dm.startAttemptLocked(download, now)
+	dm.handleFailureLocked(download, &core.DownloadError{Code: core.ErrorNetwork, Message: "connection reset"}, now)
+	dm.mutex.Unlock()
+	if download.Status != core.StatusFailed {
+		t.Errorf("Expected download to fail after max attempts, got %s", download.Status)
+	}
+	if len(download.Attempts) != 2 || download.Attempts[1].Number != 2 {
+		t.Errorf("Expected two recorded attempts, got %+v", download.Attempts)
+	}
+}
+
+func TestInternalRestartIsNoAttempt(t *testing.T) {
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, t.TempDir(), &config.Config{})
+	defer dm.Shutdown()
+
+	download := &core.Download{ID: "a", URL: "https://example.com/video", Status: core.StatusDownloading}
+	now := time.Now()
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	dm.downloads[download.ID] = download
+	if !dm.startAttemptLocked(download, now) {
+		t.Fatal("Expected the first run to start an attempt")
+	}
+
+	// Restarted for a new bandwidth limit, the run continues the attempt
+	dm.cancelFuncs[download.ID] = func() {}
+	dm.restartDownloadLocked(download, "Restarting to apply new bandwidth limit")
+	if dm.startAttemptLocked(download, now) || len(download.Attempts) != 1 {
+		t.Errorf("Expected the restart to continue the attempt, got %+v", download.Attempts)
+	}
+
+	dm.handleFailureLocked(download, &core.DownloadError{Code: core.ErrorPrivate, Message: "private video"}, now)
+	if !dm.startAttemptLocked(download, now) || len(download.Attempts) != 2 || download.Attempts[1].Number != 2 {
+		t.Errorf("Expected a new attempt after a failure, got %+v", download.Attempts)
+	}
+}
+
+func TestPermanentFailureIsNotRetried(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{
+		Retry: config.RetryPolicy{MaxAttempts: 5, BaseDelaySeconds: 1},
+	}
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	download, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/private", Type: core.VideoDownload, Quality: "720p", Format: "mp4", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+
+	dm.mutex.Lock()
+	dm.handleFailureLocked(download, &core.DownloadError{Code: core.ErrorPrivate, Message: "Video is private"}, time.Now())
+	dm.mutex.Unlock()
+
+	if download.Status != core.StatusFailed || download.ErrorCode != core.ErrorPrivate {
+		t.Errorf("Expected private video to fail without retry, got %s (%s)", download.Status, download.ErrorCode)
+	}
+}
+
+func TestDownloadLogIsRetained(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	download, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/video", Type: core.VideoDownload, Quality: "720p", Format: "mp4", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+
+	dm.mutex.Lock()
+	buffer := dm.logBufferLocked(download.ID)
+	dm.mutex.Unlock()
+	buffer.SetCommand([]string{"yt-dlp", "https://example.com/video"})
+	buffer.Add(core.LogStderr, "ERROR: Video unavailable")
+
+	downloadLog, err := dm.GetDownloadLog(download.ID)
+	if err != nil {
+		t.Fatalf("Failed to get log: %v", err)
+	}
+	if !downloadLog.Live || len(downloadLog.Lines) != 2 {
+		t.Errorf("Expected live log with 2 lines, got %+v", downloadLog)
+	}
+
+	// Once the download stops, the log is read back from disk
+	dm.saveLog(download.ID, buffer)
+	dm.mutex.Lock()
+	dm.releaseLogLocked(download.ID)
+	dm.mutex.Unlock()
+
+	downloadLog, err = dm.GetDownloadLog(download.ID)
+	if err != nil {
+		t.Fatalf("Failed to get saved log: %v", err)
+	}
+	if downloadLog.Live || len(downloadLog.Lines) != 2 || len(downloadLog.Command) != 2 {
+		t.Errorf("Expected saved log with command and 2 lines, got %+v", downloadLog)
+	}
+
+	if err := dm.RemoveDownload(download.ID); err != nil {
+		t.Fatalf("Failed to remove download: %v", err)
+	}
+	if _, err := os.Stat(dm.logFilePath(download.ID)); !os.IsNotExist(err) {
+		t.Error("Expected log file to be removed with the download")
+	}
+}
+
+func TestBulkOperationsAreScopedToOwner(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	downloader := core.NewDownloader("yt-dlp", "ffmpeg", false, false)
+	cfg := &config.Config{
+		CompletedFileExpiryHours: 0,
+	}
+
+	dm := NewDownloadManager(downloader, 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	ids := make(map[string]string)
+	for _, owner := range []string{"alice", "bob"} {
+		download, err := dm.AddDownload(core.DownloadRequest{
+			URL:       "https://example.com/" + owner,
+			Type:      core.VideoDownload,
+			Quality:   "720p",
+			Format:    "mp4",
+			OutputDir: tempDir,
+			Owner:     owner,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		if download.Owner != owner {
+			t.Errorf("Expected owner %s, got %q", owner, download.Owner)
+		}
+		ids[owner] = download.ID
+	}
+
+	dm.mutex.Lock()
+	for _, id := range ids {
+		dm.downloads[id].Status = core.StatusFailed
+	}
+	dm.mutex.Unlock()
+
+	if err := dm.ClearAllFailed("alice"); err != nil {
+		t.Fatalf("ClearAllFailed failed: %v", err)
+	}
+	if _, exists := dm.GetDownload(ids["alice"]); exists {
+		t.Error("Expected alice's failed download to be cleared")
+	}
+	if _, exists := dm.GetDownload(ids["bob"]); !exists {
+		t.Error("Expected bob's failed download to be kept")
+	}
+
+	// An empty owner clears everything
+	if err := dm.ClearAllFailed(""); err != nil {
+		t.Fatalf("ClearAllFailed failed: %v", err)
+	}
+	if _, exists := dm.GetDownload(ids["bob"]); exists {
+		t.Error("Expected all failed downloads to be cleared")
+	}
+}
+
+func TestDuplicatesAreScopedToOwner(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	downloader := core.NewDownloader("yt-dlp", "ffmpeg", false, false)
+	dm := NewDownloadManager(downloader, 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	request := func(owner string) core.DownloadRequest {
+		return core.DownloadRequest{
+			URL:       "https://example.com/shared",
+			Type:      core.VideoDownload,
+			Quality:   "720p",
+			Format:    "mp4",
+			OutputDir: tempDir,
+			Owner:     owner,
+		}
+	}
+
+	for _, owner := range []string{"alice", "bob"} {
+		if _, err := dm.AddDownload(request(owner)); err != nil {
+			t.Fatalf("Failed to add download for %s: %v", owner, err)
+		}
+	}
+	if _, err := dm.AddDownload(request("alice")); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected a duplicate for the same owner, got %v", err)
+	}
+}
+
+func TestRepeatedRequestReturnsCopy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	downloader := core.NewDownloader("yt-dlp", "ffmpeg", false, false)
+	dm := NewDownloadManager(downloader, 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	req := core.DownloadRequest{
+		URL:        "https://example.com/video",
+		Type:       core.VideoDownload,
+		Quality:    "720p",
+		Format:     "mp4",
+		OutputDir:  tempDir,
+		ExternalID: "job-1",
+	}
+	first, err := dm.AddDownload(req)
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	repeated, err := dm.AddDownload(req)
+	if err != nil {
+		t.Fatalf("Failed to repeat request: %v", err)
+	}
+	if repeated.ID != first.ID {
+		t.Fatalf("Expected download %s, got %s", first.ID, repeated.ID)
+	}
+
+	repeated.Title = "changed"
+	if download, _ := dm.GetDownload(first.ID); download.Title == "changed" {
+		t.Error("Expected the repeated request to return a copy of the download")
+	}
+}
+
+func TestConcurrentRepeatedRequests(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as yt-dlp")
+	}
+	tempDir := t.TempDir()
+
+	// A slow yt-dlp keeps the first request busy looking up the video while
+	// the others arrive
+	ytDlp := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(ytDlp, []byte("#!/bin/sh\nsleep 0.2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write yt-dlp: %v", err)
+	}
+	dm := NewDownloadManager(core.NewDownloader(ytDlp, "ffmpeg", false, false), 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	req := core.DownloadRequest{
+		URL:        "https://example.com/video",
+		Type:       core.VideoDownload,
+		Quality:    "720p",
+		Format:     "mp4",
+		OutputDir:  tempDir,
+		ExternalID: "job-1",
+	}
+	ids := make(chan string, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			download, err := dm.AddDownload(req)
+			if err != nil {
+				t.Errorf("Expected every request to get the download, got %v", err)
+				return
+			}
+			ids <- download.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	first := ""
+	for id := range ids {
+		if first == "" {
+			first = id
+		}
+		if id != first {
+			t.Errorf("Expected one download, got %s and %s", first, id)
+		}
+	}
+}
+
+func TestQuotaLimits(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{
+		UserQuotas: []config.Quota{{Username: "alice", MaxQueued: 1, MaxStorageMB: 1}},
+	}
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	defer dm.Shutdown()
+
+	add := func(owner, url string) (*core.Download, error) {
+		return dm.AddDownload(core.DownloadRequest{URL: url, Type: core.VideoDownload, Quality: "720p", Format: "mp4", OutputDir: tempDir, Owner: owner})
+	}
+
+	first, err := add("alice", "https://example.com/one")
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	if _, err := add("alice", "https://example.com/two"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected queued quota to be exceeded, got %v", err)
+	}
+	if _, err := add("bob", "https://example.com/two"); err != nil {
+		t.Errorf("Expected users without a quota to be unaffected, got %v", err)
+	}
+
+	// A finished file over the storage limit is deleted and the download fails
+	path := filepath.Join(tempDir, "one.mp4")
+	if err := os.WriteFile(path, make([]byte, 2*1024*1024), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	now := time.Now()
+	dm.mutex.Lock()
+	dm.startAttemptLocked(first, now)
+	first.Status = core.StatusCompleted
+	first.OutputPath = path
+	first.FileSize = 2 * 1024 * 1024
+	if quotaErr := dm.checkCompletedQuotaLocked(first); quotaErr != nil {
+		dm.rejectCompletedLocked(first, quotaErr, now)
+	}
+	dm.mutex.Unlock()
+
+	if first.Status != core.StatusFailed || first.ErrorCode != core.ErrorQuotaExceeded {
+		t.Errorf("Expected quota_exceeded failure, got %s (%s)", first.Status, first.ErrorCode)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the file over quota to be deleted")
+	}
+
+	usage := dm.GetUsage("alice")
+	if usage.Queued != 0 || usage.StoredBytes != 0 || usage.Quota.MaxQueued != 1 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	downloader := core.NewDownloader("yt-dlp", "ffmpeg", false, false)
+	dm := NewDownloadManager(downloader, 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	now := time.Now()
+	dm.mutex.Lock()
+	for _, download := range []*core.Download{
+		{ID: "a", Title: "Zebra", URL: "https://example.com/1", Type: core.VideoDownload, Status: core.StatusCompleted, CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: "b", Title: "apple", URL: "https://example.org/2", Type: core.AudioDownload, Status: core.StatusFailed, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "c", Title: "Mango", URL: "https://example.org/3", Type: core.VideoDownload, Status: core.StatusFailed, CreatedAt: now.Add(-time.Hour)},
+		{ID: "d", Title: "mango", URL: "https://example.com/4", Type: core.VideoDownload, Status: core.StatusQueued, CreatedAt: now.Add(-time.Hour)},
+	} {
+		dm.downloads[download.ID] = download
+	}
+	dm.mutex.Unlock()
+
+	ids := func(downloads []*core.Download) string {
+		result := ""
+		for _, download := range downloads {
+			result += download.ID
+		}
+		return result
+	}
+
+	tests := []struct {
+		filter   Filter
+		sort     string
+		expected string
+	}{
+		{Filter{}, "", "dcba"},
+		{Filter{}, "created_at", "abcd"},
+		{Filter{}, "title", "bcda"},
+		{Filter{}, "-title", "adcb"},
+		{Filter{Statuses: []core.DownloadStatus{core.StatusFailed}}, "", "cb"},
+		{Filter{Type: core.VideoDownload, Query: "EXAMPLE.ORG"}, "", "c"},
+		{Filter{Query: "mango"}, "", "dc"},
+		{Filter{Since: now.Add(-90 * time.Minute)}, "created_at", "cd"},
+	}
+	for _, tt := range tests {
+		order, err := ParseSort(tt.sort)
+		if err != nil {
+			t.Fatalf("ParseSort(%q) failed: %v", tt.sort, err)
+		}
+		downloads, _ := dm.Query(tt.filter, order)
+		if got := ids(downloads); got != tt.expected {
+			t.Errorf("Query(%+v, %s) = %s, expected %s", tt.filter, order, got, tt.expected)
+		}
+	}
+
+	if _, err := ParseSort("-owner"); err == nil {
+		t.Error("Expected an unknown sort field to be rejected")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	tempDir := t.TempDir()
+	downloader := core.NewDownloader("yt-dlp", "ffmpeg", false, false)
+	dm := NewDownloadManager(downloader, 0, tempDir, &config.Config{})
+
+	add := func(url string) *core.Download {
+		download, err := dm.AddDownload(core.DownloadRequest{URL: url, Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		return download
+	}
+	first := add("https://example.com/1")
+	second := add("https://example.com/2")
+
+	since := dm.Revision()
+	if err := dm.PauseDownload(first.ID); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if err := dm.RemoveDownload(second.ID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	changed, removed, revision, ok := dm.Changes(since)
+	if !ok || revision <= since {
+		t.Fatalf("Expected changes after revision %d, got %v at %d", since, ok, revision)
+	}
+	if len(changed) != 1 || changed[0].ID != first.ID || changed[0].Status != core.StatusPaused || changed[0].Revision <= since {
+		t.Errorf("Expected the paused download to have changed, got %v", changed)
+	}
+	if len(removed) != 1 || removed[0].ID != second.ID {
+		t.Errorf("Expected the removed download, got %v", removed)
+	}
+	if changed, removed, _, ok := dm.Changes(revision); !ok || len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("Expected no changes at the current revision, got %v %v", changed, removed)
+	}
+	if _, _, _, ok := dm.Changes(revision + 1); ok {
+		t.Error("Expected a revision from the future to need a full list")
+	}
+
+	// Removals from before a restart are not known
+	dm.Shutdown()
+	restarted := NewDownloadManager(downloader, 0, tempDir, &config.Config{})
+	defer restarted.Shutdown()
+	if _, _, _, ok := restarted.Changes(revision); ok {
+		t.Error("Expected a revision from before the restart to need a full list")
+	}
+	if restarted.Revision() <= revision {
+		t.Errorf("Expected revisions to continue after %d, got %d", revision, restarted.Revision())
+	}
+}
+
+func TestPriorityOrdersQueue(t *testing.T) {
+	tempDir := t.TempDir()
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	var downloads []*core.Download
+	for _, url := range []string{"https://example.com/low", "https://example.com/high"} {
+		download, err := dm.AddDownload(core.DownloadRequest{URL: url, Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+		if err != nil {
+			t.Fatalf("Failed to add download: %v", err)
+		}
+		downloads = append(downloads, download)
+	}
+	low, high := downloads[0], downloads[1]
+	if err := dm.SetPriority(high.ID, 5); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+
+	if dm.admit(low) {
+		t.Error("Expected the lower priority download to wait")
+	}
+	if !dm.admit(high) {
+		t.Error("Expected the higher priority download to start")
+	}
+	dm.runSchedule(time.Now())
+	if low.Status != core.StatusQueued {
+		t.Errorf("Expected the lower priority download to be released, got %s", low.Status)
+	}
+}
+
+func TestMoveAndRemoveKeepingFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	queued, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/queued", Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	finished, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/finished", Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	file := filepath.Join(tempDir, "finished.mov")
+	if err := os.WriteFile(file, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	dm.mutex.Lock()
+	finished.Status = core.StatusCompleted
+	finished.OutputPath = file
+	dm.mutex.Unlock()
+
+	// A link in the download directory must not lead the file out of it
+	if err := os.Symlink(t.TempDir(), filepath.Join(tempDir, "link")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	for _, destination := range []string{"../outside", "/tmp", "a/../../b", LogDirName, "music/.gogetmedia_state", "link", "link/music"} {
+		if err := dm.MoveDownload(finished.ID, destination); err == nil {
+			t.Errorf("Expected destination %q to be rejected", destination)
+		}
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Expected the file to stay in place: %v", err)
+	}
+
+	if err := dm.MoveDownload(finished.ID, "music/2026/"); err != nil {
+		t.Fatalf("MoveDownload failed: %v", err)
+	}
+	moved := filepath.Join(tempDir, "music", "2026", "finished.mov")
+	if finished.OutputPath != moved || finished.Destination != filepath.Join("music", "2026") {
+		t.Errorf("Expected the download to point at %s, got %s in %q", moved, finished.OutputPath, finished.Destination)
+	}
+	if _, err := os.Stat(moved); err != nil {
+		t.Errorf("Expected the file to be moved: %v", err)
+	}
+
+	// Downloads that have not run yet are saved in their destination later
+	if err := dm.MoveDownload(queued.ID, "later"); err != nil {
+		t.Fatalf("MoveDownload failed: %v", err)
+	}
+	dm.mutex.RLock()
+	outputDir := dm.outputDirLocked(queued)
+	dm.mutex.RUnlock()
+	if outputDir != filepath.Join(tempDir, "later") {
+		t.Errorf("Expected the queued download to be saved in later, got %s", outputDir)
+	}
+
+	if err := dm.RemoveDownloadKeepFiles(finished.ID); err != nil {
+		t.Fatalf("RemoveDownloadKeepFiles failed: %v", err)
+	}
+	if _, exists := dm.GetDownload(finished.ID); exists {
+		t.Error("Expected the download to be removed")
+	}
+	if _, err := os.Stat(moved); err != nil {
+		t.Errorf("Expected the file to be kept: %v", err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tempDir := t.TempDir()
+	dm := NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, &config.Config{})
+	defer dm.Shutdown()
+
+	download, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/video", Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	if checksum, err := dm.Checksum(download.ID); err != nil || checksum != "" {
+		t.Errorf("Expected no checksum before the download finishes, got %q, %v", checksum, err)
+	}
+
+	file := filepath.Join(tempDir, "video.mov")
+	if err := os.WriteFile(file, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	dm.mutex.Lock()
+	download.Status = core.StatusCompleted
+	download.OutputPath = file
+	revision := download.Revision
+	dm.mutex.Unlock()
+
+	// sha256("video")
+	const expected = "0cab1c9617404faf2b24e221e189ca5945813e14d3f766345b09ca13bbe28ffc"
+	checksum, err := dm.Checksum(download.ID)
+	if err != nil || checksum != expected {
+		t.Fatalf("Expected checksum %s, got %q, %v", expected, checksum, err)
+	}
+	downloads := dm.Snapshot(download.ID)
+	if downloads[0].SHA256 != checksum || downloads[0].Revision == revision {
+		t.Errorf("Expected the checksum to be kept with a new revision, got %+v", downloads[0])
+	}
+
+	// Kept checksums are not computed again
+	os.Remove(file)
+	if again, err := dm.Checksum(download.ID); err != nil || again != checksum {
+		t.Errorf("Expected the kept checksum, got %q, %v", again, err)
+	}
+	if _, err := dm.Checksum("missing"); err == nil {
+		t.Error("Expected an error for a missing download")
+	}
+
+	// Missing checksums are computed in the background
+	other, err := dm.AddDownload(core.DownloadRequest{URL: "https://example.com/other", Type: core.VideoDownload, Quality: "best", Format: "mov", OutputDir: tempDir})
+	if err != nil {
+		t.Fatalf("Failed to add download: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("video"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	dm.mutex.Lock()
+	other.Status = core.StatusAlreadyExists
+	other.OutputPath = file
+	dm.mutex.Unlock()
+	dm.wakeChecksums()
+	deadline := time.Now().Add(2 * time.Second)
+	for dm.Snapshot(other.ID)[0].SHA256 != expected {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the checksum to be computed in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
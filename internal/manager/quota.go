@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+)
+
+// ErrQuotaExceeded is returned when adding a download would exceed its
+// owner's quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Usage reports what a user currently consumes against their quota
+type Usage struct {
+	Username      string       `json:"username,omitempty"`
+	Active        int          `json:"active"`         // running downloads
+	Queued        int          `json:"queued"`         // downloads waiting to run
+	StoredBytes   int64        `json:"stored_bytes"`   // size of completed downloads
+	ReservedBytes int64        `json:"reserved_bytes"` // estimated size of unfinished downloads
+	Quota         config.Quota `json:"quota"`
+}
+
+// GetUsage returns the usage of owner, or of all downloads if owner is empty
+func (dm *DownloadManager) GetUsage(owner string) Usage {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	usage := dm.usageLocked(owner, "")
+	if owner != "" {
+		usage.Quota = dm.config.QuotaFor(owner)
+	}
+	return usage
+}
+
+// isWaiting reports whether a download is waiting to run
+func isWaiting(download *core.Download) bool {
+	return download.Status == core.StatusQueued || download.Status == core.StatusScheduled
+}
+
+// usageLocked adds up the downloads of owner, leaving out the download with
+// id exclude. Completed downloads from before file sizes were recorded are
+// measured on disk. Caller must hold dm.mutex.
+func (dm *DownloadManager) usageLocked(owner, exclude string) Usage {
+	usage := Usage{Username: owner}
+	for id, download := range dm.downloads {
+		if id == exclude || !ownedBy(download, owner) {
+			continue
+		}
+		switch {
+		case isRunning(download):
+			usage.Active++
+			usage.ReservedBytes += download.EstimatedBytes
+		case isWaiting(download):
+			usage.Queued++
+			usage.ReservedBytes += download.EstimatedBytes
+		case download.Status == core.StatusPaused:
+			usage.ReservedBytes += download.EstimatedBytes
+		case download.Status == core.StatusCompleted:
+			if download.FileSize == 0 && download.OutputPath != "" {
+				if info, err := os.Stat(download.OutputPath); err == nil {
+					download.FileSize = info.Size()
+					dm.touchLocked(download)
+				}
+			}
+			usage.StoredBytes += download.FileSize
+		}
+	}
+	return usage
+}
+
+// needsSizeEstimate reports whether adding a download for owner has to know
+// its size in advance
+func (dm *DownloadManager) needsSizeEstimate(owner string) bool {
+	if owner == "" {
+		return false
+	}
+	quota := dm.config.QuotaFor(owner)
+	return quota.MaxStorageMB > 0 || quota.MaxFileSizeMB > 0
+}
+
+// checkQuotaLocked returns an error if owner cannot add items more downloads
+// of estimate bytes each. Downloads without an owner are not limited. Caller
+// must hold dm.mutex.
+func (dm *DownloadManager) checkQuotaLocked(owner string, items int, estimate int64) error {
+	if owner == "" {
+		return nil
+	}
+	quota := dm.config.QuotaFor(owner)
+	usage := dm.usageLocked(owner, "")
+
+	if quota.MaxQueued > 0 && usage.Queued+items > quota.MaxQueued {
+		return fmt.Errorf("%w: at most %d queued downloads allowed (%d queued)", ErrQuotaExceeded, quota.MaxQueued, usage.Queued)
+	}
+	if max := quota.MaxFileSizeBytes(); max > 0 && estimate > max {
+		return fmt.Errorf("%w: download is about %s, the limit is %s", ErrQuotaExceeded, core.FormatBytes(estimate), core.FormatBytes(max))
+	}
+	if max := quota.MaxStorageBytes(); max > 0 {
+		used := usage.StoredBytes + usage.ReservedBytes
+		if used >= max || used+estimate*int64(items) > max {
+			return fmt.Errorf("%w: storage limit of %s reached (%s used)", ErrQuotaExceeded, core.FormatBytes(max), core.FormatBytes(used))
+		}
+	}
+	return nil
+}
+
+// checkCompletedQuotaLocked re-checks the quota with the actual size of a
+// finished download, since estimates are often missing or too low. Caller
+// must hold dm.mutex.
+func (dm *DownloadManager) checkCompletedQuotaLocked(download *core.Download) error {
+	if download.Owner == "" {
+		return nil
+	}
+	quota := dm.config.QuotaFor(download.Owner)
+
+	if max := quota.MaxFileSizeBytes(); max > 0 && download.FileSize > max {
+		return &core.DownloadError{
+			Code:    core.ErrorQuotaExceeded,
+			Message: fmt.Sprintf("file is %s, the limit is %s", core.FormatBytes(download.FileSize), core.FormatBytes(max)),
+		}
+	}
+	if max := quota.MaxStorageBytes(); max > 0 {
+		stored := dm.usageLocked(download.Owner, download.ID).StoredBytes
+		if stored+download.FileSize > max {
+			return &core.DownloadError{
+				Code:    core.ErrorQuotaExceeded,
+				Message: fmt.Sprintf("storage limit of %s exceeded (%s used)", core.FormatBytes(max), core.FormatBytes(stored+download.FileSize)),
+			}
+		}
+	}
+	return nil
+}
+
+// rejectCompletedLocked deletes the file of a finished download that exceeds
+// its owner's quota and marks the download as failed. Caller must hold dm.mutex.
+func (dm *DownloadManager) rejectCompletedLocked(download *core.Download, err error, now time.Time) {
+	log.Printf("[MANAGER] Download %s: %v, deleting %s", download.ID, err, download.OutputPath)
+	if download.OutputPath != "" {
+		if removeErr := os.Remove(download.OutputPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Printf("[MANAGER] Download %s: Failed to delete file: %v", download.ID, removeErr)
+		}
+	}
+	download.OutputPath = ""
+	download.FileSize = 0
+	download.SHA256 = ""
+	download.CompletedAt = nil
+	dm.handleFailureLocked(download, err, now)
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"gogetmedia/internal/core"
+)
+
+// maxAttemptHistory bounds the number of attempts kept on a download
+const maxAttemptHistory = 20
+
+// startAttemptLocked records the start of a new run and reports whether it
+// is a new attempt. A run after an internal restart continues the attempt
+// that is still open. Caller must hold dm.mutex.
+func (dm *DownloadManager) startAttemptLocked(download *core.Download, now time.Time) bool {
+	download.NextAttemptAt = nil
+	if n := len(download.Attempts); n > 0 && download.Attempts[n-1].EndedAt == nil {
+		return false
+	}
+
+	number := 1
+	if n := len(download.Attempts); n > 0 {
+		number = download.Attempts[n-1].Number + 1
+	}
+	download.Attempts = append(download.Attempts, core.Attempt{Number: number, StartedAt: now})
+	if len(download.Attempts) > maxAttemptHistory {
+		download.Attempts = download.Attempts[len(download.Attempts)-maxAttemptHistory:]
+	}
+	return true
+}
+
+// finishAttemptLocked records how the current run ended. Caller must hold dm.mutex.
+func (dm *DownloadManager) finishAttemptLocked(download *core.Download, now time.Time, outcome core.DownloadStatus, err error) {
+	if len(download.Attempts) == 0 {
+		return
+	}
+	attempt := &download.Attempts[len(download.Attempts)-1]
+	attempt.EndedAt = &now
+	attempt.Outcome = outcome
+	if err != nil {
+		attempt.ErrorCode = core.ErrorCodeOf(err)
+		attempt.Error = err.Error()
+	}
+}
+
+// handleFailureLocked marks a download as failed, or holds it for an
+// automatic retry when the error is transient and the retry policy allows
+// another attempt. Caller must hold dm.mutex.
+func (dm *DownloadManager) handleFailureLocked(download *core.Download, err error, now time.Time) {
+	code := core.ErrorCodeOf(err)
+	download.Error = err.Error()
+	download.ErrorCode = code
+
+	if !dm.shouldRetryLocked(download, code) {
+		download.Status = core.StatusFailed
+		dm.finishAttemptLocked(download, now, core.StatusFailed, err)
+		return
+	}
+
+	download.AutoRetries++
+	next := now.Add(dm.config.Retry.Delay(download.AutoRetries, rand.Float64()))
+	download.NextAttemptAt = &next
+	download.Status = core.StatusScheduled
+	download.StatusMessage = fmt.Sprintf("Retrying at %s after %s error (retry %d of %d)",
+		next.Local().Format("15:04:05"), code, download.AutoRetries, dm.config.Retry.MaxAttempts-1)
+	dm.held[download.ID] = download
+	dm.finishAttemptLocked(download, now, core.StatusScheduled, err)
+
+	log.Printf("[MANAGER] Download %s: %s error, retry %d scheduled for %s",
+		download.ID, code, download.AutoRetries, next.Format(time.RFC3339))
+}
+
+// shouldRetryLocked reports whether a failure with code may be retried
+// automatically. Caller must hold dm.mutex.
+func (dm *DownloadManager) shouldRetryLocked(download *core.Download, code core.ErrorCode) bool {
+	policy := dm.config.Retry
+	if !policy.Enabled() || download.AutoRetries+1 >= policy.MaxAttempts {
+		return false
+	}
+	if len(policy.RetryOn) == 0 {
+		return code.Transient()
+	}
+	for _, retryable := range policy.RetryOn {
+		if core.ErrorCode(retryable) == code {
+			return true
+		}
+	}
+	return false
+}
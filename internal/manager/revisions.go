@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"time"
+
+	"gogetmedia/internal/core"
+)
+
+// maxRemovals is how many removed downloads are remembered for clients that
+// ask for changes since an older revision
+const maxRemovals = 1000
+
+// Removal records a download that was removed at a revision
+type Removal struct {
+	ID       string
+	Owner    string
+	Revision uint64
+}
+
+// revisions numbers every change of a download, so clients can ask for the
+// changes since the revision they have seen
+type revisions struct {
+	current  uint64
+	removals []Removal // oldest first
+
+	// Changes at or before floor may be unknown: removals that were
+	// forgotten, or everything before a restart
+	floor uint64
+}
+
+// newRevisions starts numbering at the current time in microseconds. Removals
+// are not saved, so revisions of an earlier run must never be handed out
+// again; starting from the clock keeps them increasing across restarts.
+func newRevisions(now time.Time) revisions {
+	start := uint64(now.UnixMicro())
+	return revisions{current: start, floor: start}
+}
+
+// touchLocked gives a changed download the next revision. Caller must hold
+// dm.mutex.
+func (dm *DownloadManager) touchLocked(download *core.Download) {
+	dm.revisions.current++
+	download.Revision = dm.revisions.current
+}
+
+// forgetLocked records the removal of a download. Caller must hold dm.mutex.
+func (dm *DownloadManager) forgetLocked(download *core.Download) {
+	r := &dm.revisions
+	r.current++
+	r.removals = append(r.removals, Removal{ID: download.ID, Owner: download.Owner, Revision: r.current})
+	if len(r.removals) > maxRemovals {
+		dropped := len(r.removals) - maxRemovals
+		r.floor = r.removals[dropped-1].Revision
+		r.removals = append([]Removal(nil), r.removals[dropped:]...)
+	}
+}
+
+// restoredLocked continues numbering after the downloads loaded from the
+// store, should the clock have gone back. Removals from before the restart
+// are unknown, so earlier revisions cannot be answered with changes. Caller
+// must hold dm.mutex.
+func (dm *DownloadManager) restoredLocked() {
+	for _, download := range dm.downloads {
+		if download.Revision > dm.revisions.current {
+			dm.revisions.current = download.Revision
+		}
+	}
+	dm.revisions.floor = dm.revisions.current
+}
+
+// Revision returns the revision of the latest change
+func (dm *DownloadManager) Revision() uint64 {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+	return dm.revisions.current
+}
+
+// Changes returns copies of the downloads changed after revision since, the
+// downloads removed after it and the current revision, all taken at the same
+// moment. ok is false when the changes since that revision are not known,
+// because it is too old, from before a restart or from the future; clients
+// then have to fetch the full list.
+func (dm *DownloadManager) Changes(since uint64) (changed []*core.Download, removed []Removal, revision uint64, ok bool) {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	r := &dm.revisions
+	if since < r.floor || since > r.current {
+		return nil, nil, r.current, false
+	}
+	changed = []*core.Download{}
+	for _, download := range dm.downloads {
+		if download.Revision > since {
+			changed = append(changed, download.Clone())
+		}
+	}
+	for _, removal := range r.removals {
+		if removal.Revision > since {
+			removed = append(removed, removal)
+		}
+	}
+	return changed, removed, r.current, true
+}
@@ -0,0 +1,240 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+)
+
+// schedulerInterval is how often held downloads and download windows are checked
+const schedulerInterval = 5 * time.Second
+
+// ScheduleStatus describes the current state of the download scheduler
+type ScheduleStatus struct {
+	Windows      []config.ScheduleWindow `json:"windows"`
+	WindowOpen   bool                    `json:"window_open"`
+	NextChange   *time.Time              `json:"next_change,omitempty"`
+	Held         int                     `json:"held"`
+	ActiveByHost map[string]int          `json:"active_by_host"`
+}
+
+// GetScheduleStatus reports whether downloads may currently run and how many are held
+func (dm *DownloadManager) GetScheduleStatus() ScheduleStatus {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	now := time.Now()
+	status := ScheduleStatus{
+		Windows:      dm.config.DownloadWindows,
+		WindowOpen:   config.InWindows(dm.config.DownloadWindows, now),
+		Held:         len(dm.held),
+		ActiveByHost: make(map[string]int),
+	}
+	for _, download := range dm.downloads {
+		if isRunning(download) {
+			status.ActiveByHost[core.HostKey(download.URL)]++
+		}
+	}
+	if next := config.NextWindowChange(dm.config.DownloadWindows, now); !next.IsZero() {
+		status.NextChange = &next
+	}
+	return status
+}
+
+// admit reports whether a download taken from the queue may start now.
+// Downloads that have to wait are moved to the held set with status
+// "scheduled" and re-queued by the scheduler once they become eligible.
+func (dm *DownloadManager) admit(download *core.Download) bool {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	if reason := dm.holdReasonLocked(download, time.Now()); reason != "" {
+		if download.Status != core.StatusScheduled {
+			log.Printf("[MANAGER] Download %s held: %s", download.ID, reason)
+		}
+		download.Status = core.StatusScheduled
+		download.StatusMessage = reason
+		dm.held[download.ID] = download
+		dm.changedLocked(download)
+		return false
+	}
+
+	delete(dm.held, download.ID)
+	download.StatusMessage = ""
+	// Mark as downloading right away so per-site limits see it before the
+	// worker gets to update the status itself
+	download.Status = core.StatusDownloading
+	dm.lastHostStart[core.HostKey(download.URL)] = time.Now()
+	dm.changedLocked(download)
+	return true
+}
+
+// heldInOrderLocked returns the held downloads in the order they go to the
+// queue: higher priority first, then the oldest first. Caller must hold
+// dm.mutex.
+func (dm *DownloadManager) heldInOrderLocked() []*core.Download {
+	held := make([]*core.Download, 0, len(dm.held))
+	for _, download := range dm.held {
+		held = append(held, download)
+	}
+	sort.Slice(held, func(i, j int) bool {
+		a, b := held[i], held[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return held
+}
+
+// isRunning reports whether a download currently occupies a worker
+func isRunning(download *core.Download) bool {
+	return download.Status == core.StatusDownloading || download.Status == core.StatusPostProcessing
+}
+
+// holdReasonLocked returns why a download cannot start at now, or "" if it can.
+// Caller must hold dm.mutex.
+func (dm *DownloadManager) holdReasonLocked(download *core.Download, now time.Time) string {
+	if download.NextAttemptAt != nil && now.Before(*download.NextAttemptAt) {
+		return fmt.Sprintf("Retrying at %s", download.NextAttemptAt.Local().Format("15:04:05"))
+	}
+
+	if download.StartAt != nil && now.Before(*download.StartAt) {
+		return fmt.Sprintf("Scheduled to start at %s", download.StartAt.Local().Format("2006-01-02 15:04"))
+	}
+
+	if !config.InWindows(dm.config.DownloadWindows, now) {
+		if next := config.NextWindowChange(dm.config.DownloadWindows, now); !next.IsZero() {
+			return fmt.Sprintf("Waiting for download window (opens %s)", next.Format("Mon 15:04"))
+		}
+		return "Waiting for download window"
+	}
+
+	// The queue is first in, first out; downloads with a lower priority step
+	// aside until the higher ones have started
+	if dm.higherPriorityQueuedLocked(download) {
+		return "Waiting for downloads with a higher priority"
+	}
+
+	host := core.HostKey(download.URL)
+	limit := dm.config.SiteLimitFor(host)
+	if limit.MaxConcurrent > 0 {
+		active := 0
+		for _, d := range dm.downloads {
+			if d.ID != download.ID && isRunning(d) && core.HostKey(d.URL) == host {
+				active++
+			}
+		}
+		if active >= limit.MaxConcurrent {
+			return fmt.Sprintf("Waiting for a free %s slot (%d active)", host, active)
+		}
+	}
+	if limit.MinIntervalSeconds > 0 {
+		if last, ok := dm.lastHostStart[host]; ok {
+			if wait := last.Add(time.Duration(limit.MinIntervalSeconds) * time.Second).Sub(now); wait > 0 {
+				return fmt.Sprintf("Spacing requests to %s", host)
+			}
+		}
+	}
+
+	if download.Owner != "" {
+		if quota := dm.config.QuotaFor(download.Owner); quota.MaxConcurrent > 0 {
+			active := dm.usageLocked(download.Owner, download.ID).Active
+			if active >= quota.MaxConcurrent {
+				return fmt.Sprintf("Waiting for one of your %d active downloads to finish", active)
+			}
+		}
+	}
+
+	return ""
+}
+
+// wakeScheduler asks the scheduler to run early, e.g. when a download
+// finishes and frees a per-site slot
+func (dm *DownloadManager) wakeScheduler() {
+	select {
+	case dm.scheduleWake <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// schedulerWorker periodically releases held downloads and enforces download windows
+func (dm *DownloadManager) schedulerWorker() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dm.ctx.Done():
+			log.Printf("[MANAGER] Scheduler shutting down")
+			return
+		case <-ticker.C:
+			dm.runSchedule(time.Now())
+		case <-dm.scheduleWake:
+			dm.runSchedule(time.Now())
+		}
+	}
+}
+
+// runSchedule re-queues held downloads that may now start and stops active
+// downloads when the download window has closed. Stopped downloads are held
+// and later restarted, continuing from their partial files. While the window
+// is open, running downloads are rebalanced against the bandwidth limit.
+func (dm *DownloadManager) runSchedule(now time.Time) {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	for _, download := range dm.heldInOrderLocked() {
+		id := download.ID
+		if _, exists := dm.downloads[id]; !exists || download.Status != core.StatusScheduled {
+			// Paused, cancelled or removed while held
+			delete(dm.held, id)
+			continue
+		}
+		if dm.holdReasonLocked(download, now) != "" {
+			continue
+		}
+
+		download.Status = core.StatusQueued
+		download.StatusMessage = ""
+		select {
+		case dm.queue <- download:
+			delete(dm.held, id)
+			log.Printf("[MANAGER] Released scheduled download %s to queue", id)
+			dm.changedLocked(download)
+		default:
+			// Queue is full, try again on the next tick
+			download.Status = core.StatusScheduled
+		}
+	}
+
+	if config.InWindows(dm.config.DownloadWindows, now) {
+		dm.rebalanceBandwidthLocked(now)
+		return
+	}
+
+	for id, download := range dm.downloads {
+		if download.Status != core.StatusDownloading {
+			continue
+		}
+		cancelFunc, exists := dm.cancelFuncs[id]
+		if !exists {
+			continue
+		}
+		log.Printf("[MANAGER] Download window closed, pausing download %s", id)
+		download.Status = core.StatusScheduled
+		download.StatusMessage = dm.holdReasonLocked(download, now)
+		dm.held[id] = download
+		cancelFunc()
+		delete(dm.cancelFuncs, id)
+		dm.changedLocked(download)
+	}
+}
@@ -0,0 +1,212 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Self-signed certificate files, kept next to the config file
+const (
+	SelfSignedCertFileName = "gogetmedia-cert.pem"
+	SelfSignedKeyFileName  = "gogetmedia-key.pem"
+)
+
+// selfSignedValidity is how long a generated certificate is valid
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// renewBefore is how long before expiry a generated certificate is replaced
+const renewBefore = 30 * 24 * time.Hour
+
+// RenewInterval is how often a server should call Store.Renew, well within
+// renewBefore
+const RenewInterval = 24 * time.Hour
+
+// SelfSignedPaths returns where the self-signed certificate and key for the
+// given config file are stored
+func SelfSignedPaths(configPath string) (certFile, keyFile string) {
+	dir := filepath.Dir(configPath)
+	return filepath.Join(dir, SelfSignedCertFileName), filepath.Join(dir, SelfSignedKeyFileName)
+}
+
+// Store holds the server certificate and can reload it from disk while the
+// server is running
+type Store struct {
+	certFile string
+	keyFile  string
+	hosts    []string // of a self-signed certificate, nil for other certificates
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+}
+
+// NewStore loads the certificate and key from PEM files
+func NewStore(certFile, keyFile string) (*Store, error) {
+	s := &Store{certFile: certFile, keyFile: keyFile}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSelfSignedStore loads a self-signed certificate created by
+// EnsureSelfSigned, which the store replaces before it expires
+func NewSelfSignedStore(certFile, keyFile string, hosts []string) (*Store, error) {
+	s := &Store{certFile: certFile, keyFile: keyFile, hosts: hosts}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the certificate files again, replacing a self-signed
+// certificate that is about to expire first. The current certificate stays in
+// use if they cannot be loaded.
+func (s *Store) Reload() error {
+	if s.hosts != nil {
+		if _, err := EnsureSelfSigned(s.certFile, s.keyFile, s.hosts); err != nil {
+			return err
+		}
+	}
+	return s.load()
+}
+
+// Renew replaces a self-signed certificate that is about to expire and
+// reports whether it did. Other certificates are renewed outside the server
+// and reloaded with Reload.
+func (s *Store) Renew() (bool, error) {
+	if s.hosts == nil {
+		return false, nil
+	}
+	created, err := EnsureSelfSigned(s.certFile, s.keyFile, s.hosts)
+	if err != nil || !created {
+		return false, err
+	}
+	return true, s.load()
+}
+
+func (s *Store) load() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.cert = &cert
+	s.mutex.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (s *Store) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.cert, nil
+}
+
+// TLSConfig returns a server TLS configuration that always uses the current
+// certificate
+func (s *Store) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.GetCertificate,
+	}
+}
+
+// EnsureSelfSigned creates a self-signed certificate for hosts unless a valid
+// one already exists at certFile, and reports whether it created one.
+// Certificates close to expiry are replaced.
+func EnsureSelfSigned(certFile, keyFile string, hosts []string) (bool, error) {
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Until(leaf.NotAfter) > renewBefore {
+			return false, nil
+		}
+		log.Printf("[TLS] Self-signed certificate %s is about to expire, creating a new one", certFile)
+	}
+
+	if err := GenerateSelfSigned(certFile, keyFile, hosts, time.Now()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GenerateSelfSigned writes a new self-signed ECDSA certificate for hosts,
+// which may be host names or IP addresses. The key is only readable by the
+// current user.
+func GenerateSelfSigned(certFile, keyFile string, hosts []string, now time.Time) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"GoGetMedia"}, CommonName: "GoGetMedia self-signed"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// LocalHosts returns the names and addresses this machine is likely to be
+// reached by, for a self-signed certificate
+func LocalHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,121 @@
+package tlscert
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_tls_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	certFile, keyFile := SelfSignedPaths(filepath.Join(tempDir, "config.json"))
+
+	created, err := EnsureSelfSigned(certFile, keyFile, []string{"localhost", "192.168.1.10"})
+	if err != nil || !created {
+		t.Fatalf("Expected a certificate to be created, got %v, %v", created, err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected key file with mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// An existing valid certificate is kept
+	if created, err := EnsureSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil || created {
+		t.Errorf("Expected existing certificate to be reused, got %v, %v", created, err)
+	}
+
+	store, err := NewStore(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	cert, _ := store.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if err := leaf.VerifyHostname("192.168.1.10"); err != nil {
+		t.Errorf("Expected certificate to be valid for its IP address: %v", err)
+	}
+
+	// Reloading picks up a rotated certificate
+	if err := GenerateSelfSigned(certFile, keyFile, []string{"example.internal"}, time.Now()); err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	cert, _ = store.GetCertificate(nil)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	if err := leaf.VerifyHostname("example.internal"); err != nil {
+		t.Errorf("Expected the reloaded certificate to be used: %v", err)
+	}
+
+	// A broken file leaves the current certificate in place
+	os.WriteFile(certFile, []byte("not a certificate"), 0644)
+	if err := store.Reload(); err == nil {
+		t.Error("Expected reload of an invalid certificate to fail")
+	}
+	if current, _ := store.GetCertificate(nil); current != cert {
+		t.Error("Expected the previous certificate to stay in use")
+	}
+}
+
+func TestSelfSignedCertificateIsRenewed(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "gogetmedia_tls_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	certFile, keyFile := SelfSignedPaths(filepath.Join(tempDir, "config.json"))
+	hosts := []string{"localhost"}
+
+	// A certificate that expires in 10 days
+	if err := GenerateSelfSigned(certFile, keyFile, hosts, time.Now().Add(-355*24*time.Hour)); err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	store, err := NewSelfSignedStore(certFile, keyFile, hosts)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	expiresIn := func() time.Duration {
+		cert, _ := store.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		return time.Until(leaf.NotAfter)
+	}
+	if expiresIn() < renewBefore {
+		t.Fatal("Expected loading the store to replace the expiring certificate")
+	}
+
+	// Renew only replaces a certificate once it is about to expire
+	if renewed, err := store.Renew(); err != nil || renewed {
+		t.Errorf("Expected a valid certificate to be kept, got %v, %v", renewed, err)
+	}
+	if err := GenerateSelfSigned(certFile, keyFile, hosts, time.Now().Add(-355*24*time.Hour)); err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	if renewed, err := store.Renew(); err != nil || !renewed {
+		t.Fatalf("Expected the expiring certificate to be renewed, got %v, %v", renewed, err)
+	}
+	if expiresIn() < renewBefore {
+		t.Error("Expected the renewed certificate to be used")
+	}
+
+	// Configured certificates are left to whoever issued them
+	other, err := NewStore(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if renewed, err := other.Renew(); err != nil || renewed {
+		t.Errorf("Expected a configured certificate not to be renewed, got %v, %v", renewed, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"embed"
 	"gogetmedia/internal/config"
 	"net/http"
+	"strings"
 )
 
 //go:embed assets
@@ -25,8 +26,8 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>GoGetMedia - A WebUI for yt-dlp</title>
-    <link rel="stylesheet" href="/assets/css/tailwind.min.css">
-    <script src="/assets/js/vue.min.js"></script>
+    <link rel="stylesheet" href="__BASE_PATH__/assets/css/tailwind.min.css">
+    <script src="__BASE_PATH__/assets/js/vue.min.js"></script>
     <style>
         .gradient-bg {
             background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
@@ -280,7 +281,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             </div>
                         </div>
                         <div class="flex flex-wrap gap-3">
-                            <button @click="showSettings = true" class="group flex items-center px-4 py-2 bg-slate-100 dark:bg-slate-700 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200 dark:hover:bg-slate-600 transition-all duration-200 shadow-md hover:shadow-lg">
+                            <button v-if="isAdmin" @click="showSettings = true" class="group flex items-center px-4 py-2 bg-slate-100 dark:bg-slate-700 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200 dark:hover:bg-slate-600 transition-all duration-200 shadow-md hover:shadow-lg">
                                 <svg class="w-5 h-5 mr-2 group-hover:rotate-45 transition-transform duration-300" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                     <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M10.325 4.317c.426-1.756 2.924-1.756 3.35 0a1.724 1.724 0 002.573 1.066c1.543-.94 3.31.826 2.37 2.37a1.724 1.724 0 001.065 2.572c1.756.426 1.756 2.924 0 3.35a1.724 1.724 0 00-1.066 2.573c.94 1.543-.826 3.31-2.37 2.37a1.724 1.724 0 00-2.572 1.065c-.426 1.756-2.924 1.756-3.35 0a1.724 1.724 0 00-2.573-1.066c-1.543.94-3.31-.826-2.37-2.37a1.724 1.724 0 00-1.065-2.572c-1.756-.426-1.756-2.924 0-3.35a1.724 1.724 0 001.066-2.573c-.94-1.543.826-3.31 2.37-2.37.996.608 2.296.07 2.572-1.065z"/>
                                     <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M15 12a3 3 0 11-6 0 3 3 0 016 0z"/>
@@ -296,6 +297,12 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                                 </svg>
                                 <span class="text-sm font-medium">{{ isDarkMode ? 'Light' : 'Dark' }}</span>
                             </button>
+                            <button v-if="currentUser" @click="logout" :title="'Signed in as ' + currentUser.username + ' (' + currentUser.role + ')'" class="group flex items-center px-4 py-2 bg-slate-100 dark:bg-slate-700 text-slate-700 dark:text-slate-300 rounded-xl hover:bg-slate-200 dark:hover:bg-slate-600 transition-all duration-200 shadow-md hover:shadow-lg">
+                                <svg class="w-5 h-5 mr-2" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M17 16l4-4m0 0l-4-4m4 4H7m6 4v1a3 3 0 01-3 3H6a3 3 0 01-3-3V7a3 3 0 013-3h4a3 3 0 013 3v1"/>
+                                </svg>
+                                <span class="text-sm font-medium">Sign out</span>
+                            </button>
                         </div>
                     </div>
                 </div>
@@ -303,7 +310,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
         </div>
 
         <!-- Add New Download Form -->
-        <div class="max-w-4xl mx-auto mb-8 bg-white dark:bg-slate-800 rounded-2xl shadow-2xl card-shadow">
+        <div v-if="canAddDownloads" class="max-w-4xl mx-auto mb-8 bg-white dark:bg-slate-800 rounded-2xl shadow-2xl card-shadow">
             <div class="px-8 py-6 border-b border-slate-200 dark:border-slate-700">
                 <div class="flex items-center space-x-4">
                     <div class="p-3 bg-gradient-to-r from-blue-500 to-purple-600 rounded-2xl shadow-lg">
@@ -441,6 +448,29 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                         </button>
                     </div>
                 </form>
+
+                <!-- Import -->
+                <details class="mt-6 border-t border-slate-200 dark:border-slate-700 pt-4">
+                    <summary class="cursor-pointer text-sm font-medium text-slate-700 dark:text-slate-300">Import URLs from a list or file</summary>
+                    <div class="mt-4 space-y-3">
+                        <textarea
+                            v-model="importText"
+                            rows="5"
+                            placeholder="One URL per line, or paste a CSV file with a url column"
+                            class="w-full px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white font-mono text-sm"
+                        ></textarea>
+                        <div class="flex flex-wrap items-center justify-between gap-3">
+                            <input type="file" accept=".txt,.csv,.html,.htm,.opml,.xml" @change="readImportFile" class="text-sm text-slate-600 dark:text-slate-400">
+                            <button
+                                type="button"
+                                @click="importUrls"
+                                :disabled="isImporting || !importText.trim()"
+                                class="btn-primary text-white px-6 py-2 rounded-xl font-medium transition-all duration-200 disabled:opacity-50 disabled:cursor-not-allowed"
+                            >{{ isImporting ? 'Importing...' : 'Import' }}</button>
+                        </div>
+                        <p class="text-xs text-slate-500 dark:text-slate-400">Bookmark exports and OPML files work too. Entries without their own settings use the type, quality and format above.</p>
+                    </div>
+                </details>
             </div>
         </div>
 
@@ -491,9 +521,10 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                                 <p class="text-xs text-slate-700 dark:text-slate-300 truncate">{{ download.url }}</p>
                                 <p class="text-xs text-slate-600 dark:text-slate-400">{{ download.type }} • {{ download.format }} {{ download.quality ? '• ' + download.quality : '' }}</p>
                                 <p class="text-xs text-slate-600 dark:text-slate-400">Added: {{ formatDate(download.created_at) }}</p>
+                                <p v-if="download.status_message" class="text-xs text-slate-600 dark:text-slate-400">Status: {{ download.status_message }}</p>
                             </div>
                             <div class="flex items-center space-x-2">
-                                <span class="status-badge status-queued">queued</span>
+                                <span class="status-badge status-queued">{{ download.status }}</span>
                                 <button @click="deleteDownload(download.id)" class="p-1 text-red-500 hover:text-red-700">
                                     <svg class="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                         <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M19 7l-.867 12.142A2 2 0 0116.138 21H7.862a2 2 0 01-1.995-1.858L5 7m5 4v6m4-6v6m1-10V4a1 1 0 00-1-1h-4a1 1 0 00-1 1v3M4 7h16"/>
@@ -549,6 +580,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                                 <p class="text-xs text-slate-700 dark:text-slate-300 truncate">{{ download.url }}</p>
                                 <p class="text-xs text-slate-600 dark:text-slate-400">{{ download.type }} • {{ download.format }} {{ download.quality ? '• ' + download.quality : '' }} • {{ download.progress ? Math.round(download.progress.percentage) : 0 }}%</p>
                                 <p v-if="download.progress && download.progress.speed" class="text-xs text-slate-600 dark:text-slate-400">Speed: {{ download.progress.speed }}{{ download.progress.eta ? ' • ETA: ' + download.progress.eta : '' }}</p>
+                                <p v-if="download.progress && download.progress.phase" class="text-xs text-slate-600 dark:text-slate-400">Phase: {{ download.progress.phase }} ({{ Math.round(download.progress.phase_percentage || 0) }}%)</p>
                                 <p v-if="download.status_message" class="text-xs text-slate-600 dark:text-slate-400">Status: {{ download.status_message }}</p>
                             </div>
                             <div class="flex items-center space-x-2 ">
@@ -684,7 +716,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             </div>
                             <div class="flex flex-wrap items-center gap-3 justify-start sm:justify-end">
                                 <span class="status-badge status-completed">completed</span>
-                                <a v-if="download.output_path" :href="'/api/downloads/' + download.id + '/download'" download class="btn-sm bg-blue-500 hover:bg-blue-600 text-white px-3 py-1 rounded text-xs transition-colors duration-200 flex items-center space-x-1" title="Download File">
+                                <a v-if="download.output_path" :href="basePath + '/api/v1/downloads/' + download.id + '/download'" download class="btn-sm bg-blue-500 hover:bg-blue-600 text-white px-3 py-1 rounded text-xs transition-colors duration-200 flex items-center space-x-1" title="Download File">
                                     <svg class="w-3 h-3" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                         <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M12 10v6m0 0l-3-3m3 3l3-3m2 8H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z"/>
                                     </svg>
@@ -745,7 +777,9 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                                 <div class="space-y-1">
                                     <p class="text-xs text-slate-700 dark:text-slate-300 truncate break-all">{{ download.url }}</p>
                                     <p class="text-xs text-slate-600 dark:text-slate-400">{{ download.type }} • {{ download.format }} {{ download.quality ? '• ' + download.quality : '' }}</p>
-                                    <p v-if="download.error_message" class="text-xs text-red-600 dark:text-red-400">Error: {{ download.error_message }}</p>
+                                    <p v-if="download.error" class="text-xs text-red-600 dark:text-red-400">Error: {{ download.error }}</p>
+                                    <p v-if="download.attempts && download.attempts.length > 1" class="text-xs text-slate-600 dark:text-slate-400">Gave up after {{ download.attempts.length }} attempts ({{ download.error_code }})</p>
+                                    <a :href="basePath + '/api/v1/downloads/' + download.id + '/log?format=text'" target="_blank" rel="noopener" class="text-xs text-blue-600 dark:text-blue-400 hover:underline">View log</a>
                                     <p class="text-xs text-slate-600 dark:text-slate-400">Failed: {{ formatDate(download.error_at || download.created_at) }}</p>
                                 </div>
                             </div>
@@ -787,7 +821,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                         <div class="grid grid-cols-1 md:grid-cols-2 gap-6">
                             <div class="md:col-span-2">
                                 <label class="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-2">Download Path</label>
-                                <input v-model="settings.download_path" type="text" class="w-full px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white transition-colors" required>
+                                <input v-model="settings.download_path" :disabled="isLocked('download_path')" :title="isLocked('download_path') ? lockedHint : ''" type="text" class="disabled:opacity-60 disabled:cursor-not-allowed w-full px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white transition-colors" required>
                             </div>
                             
                             <div>
@@ -814,13 +848,13 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             
                             <div class="md:col-span-2">
                                 <label class="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-2">yt-dlp Path</label>
-                                <input v-model="settings.yt_dlp_path" type="text" class="w-full px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white transition-colors" required>
+                                <input v-model="settings.yt_dlp_path" :disabled="isLocked('yt_dlp_path')" :title="isLocked('yt_dlp_path') ? lockedHint : ''" type="text" class="disabled:opacity-60 disabled:cursor-not-allowed w-full px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white transition-colors" required>
                             </div>
                             
                             <div class="md:col-span-2">
                                 <label class="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-2">FFmpeg Path</label>
                                 <div class="flex space-x-3">
-                                    <input v-model="settings.ffmpeg_path" type="text" class="flex-1 px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white transition-colors" required>
+                                    <input v-model="settings.ffmpeg_path" :disabled="isLocked('ffmpeg_path')" :title="isLocked('ffmpeg_path') ? lockedHint : ''" type="text" class="disabled:opacity-60 disabled:cursor-not-allowed flex-1 px-4 py-3 border border-slate-300 dark:border-slate-600 rounded-xl focus:outline-none focus:ring-2 focus:ring-blue-500 dark:bg-slate-700 dark:text-white transition-colors" required>
                                     <button type="button" @click="checkFfmpeg" :disabled="isCheckingFfmpeg" class="bg-blue-500 hover:bg-blue-600 text-white px-4 py-3 rounded-xl text-sm font-medium transition-colors duration-200 disabled:opacity-50 whitespace-nowrap">
                                         {{ isCheckingFfmpeg ? 'Checking...' : 'Check ffmpeg' }}
                                     </button>
@@ -957,11 +991,46 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
 
     <script>
         const { createApp } = Vue;
+
+        // Prefix absolute paths with the base path the app is served under, send
+        // the session's CSRF token with requests that change something, and send
+        // the browser back to the login page when the session has expired
+        const basePath = '__BASE_PATH__';
+        let csrfToken = '';
+        const originalFetch = window.fetch;
+        window.fetch = async (resource, options = {}) => {
+            if (typeof resource === 'string' && resource.startsWith('/')) {
+                resource = basePath + resource;
+            }
+            const method = (options.method || 'GET').toUpperCase();
+            if (csrfToken && method !== 'GET' && method !== 'HEAD') {
+                options = { ...options, headers: { ...(options.headers || {}), 'X-CSRF-Token': csrfToken } };
+            }
+            const response = await originalFetch(resource, options);
+            if (response.status === 401) {
+                window.location.href = basePath + '/login';
+            }
+            return response;
+        };
+
+        // Message of an error response, {code, message} or plain text
+        const errorMessage = async (response) => {
+            const text = await response.text();
+            try {
+                return JSON.parse(text).message || text;
+            } catch (e) {
+                return text.trim();
+            }
+        };
         
         createApp({
             data() {
                 return {
+                    basePath: basePath,
+                    currentUser: null,
+                    lockedHint: 'Locked - can only be changed in the config file, with a command line flag or environment variable',
                     downloads: [],
+                    revision: 0,
                     newDownload: {
                         url: '',
                         type: 'video',
@@ -969,6 +1038,9 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                         format: 'mp4'
                     },
                     isSubmitting: false,
+                    importText: '',
+                    importFilename: '',
+                    isImporting: false,
                     isDarkMode: false,
                     isConnected: false,
                     statusMessage: null,
@@ -1008,8 +1080,15 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
             },
             
             computed: {
+                // Without authentication there is no current user and everything is allowed
+                isAdmin() {
+                    return !this.currentUser || this.currentUser.role === 'admin';
+                },
+                canAddDownloads() {
+                    return !this.currentUser || this.currentUser.role !== 'viewer';
+                },
                 queuedDownloads() {
-                    return this.downloads.filter(d => d.status === 'queued').sort((a, b) => {
+                    return this.downloads.filter(d => d.status === 'queued' || d.status === 'scheduled').sort((a, b) => {
                         const aDate = new Date(a.created_at);
                         const bDate = new Date(b.created_at);
                         const timeDiff = aDate - bDate;
@@ -1066,10 +1145,32 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
             },
             
             methods: {
+                isLocked(setting) {
+                    return (this.settings.locked || []).includes(setting);
+                },
+
                 toggleSection(section) {
                     this.sections[section].expanded = !this.sections[section].expanded;
                 },
                 
+                async loadAuthStatus() {
+                    try {
+                        const response = await fetch('/api/v1/auth/status');
+                        if (response.ok) {
+                            const status = await response.json();
+                            this.currentUser = status.user || null;
+                            csrfToken = status.csrf_token || '';
+                        }
+                    } catch (error) {
+                        console.error('Error loading auth status:', error);
+                    }
+                },
+
+                async logout() {
+                    await fetch('/api/v1/auth/logout', { method: 'POST' });
+                    window.location.href = basePath + '/login';
+                },
+
                 toggleDarkMode() {
                     this.isDarkMode = !this.isDarkMode;
                     if (this.isDarkMode) {
@@ -1132,7 +1233,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                         this.isValidatingUrl = true;
                         
                         try {
-                            const response = await fetch('/api/validate', {
+                            const response = await fetch('/api/v1/validate', {
                                 method: 'POST',
                                 headers: {
                                     'Content-Type': 'application/json'
@@ -1168,7 +1269,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     this.statusMessage = null;
                     
                     try {
-                        const response = await fetch('/api/downloads/first-video', {
+                        const response = await fetch('/api/v1/downloads/first-video', {
                             method: 'POST',
                             headers: {
                                 'Content-Type': 'application/json'
@@ -1187,7 +1288,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             this.playlistInfo = null;
                             await this.loadDownloads();
                         } else {
-                            const error = await response.text();
+                            const error = await errorMessage(response);
                             this.statusMessage = { type: 'error', text: 'Error: ' + error };
                         }
                     } catch (error) {
@@ -1209,7 +1310,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     this.statusMessage = null;
                     
                     try {
-                        const response = await fetch('/api/downloads/playlist', {
+                        const response = await fetch('/api/v1/downloads/playlist', {
                             method: 'POST',
                             headers: {
                                 'Content-Type': 'application/json'
@@ -1228,7 +1329,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             this.playlistInfo = null;
                             await this.loadDownloads();
                         } else {
-                            const error = await response.text();
+                            const error = await errorMessage(response);
                             this.statusMessage = { type: 'error', text: 'Error: ' + error };
                         }
                     } catch (error) {
@@ -1257,7 +1358,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     this.isValidatingUrl = true;
                     
                     try {
-                        const response = await fetch('/api/validate', {
+                        const response = await fetch('/api/v1/validate', {
                             method: 'POST',
                             headers: {
                                 'Content-Type': 'application/json'
@@ -1326,7 +1427,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             // Check status to give appropriate message
                             if (download.status === 'completed' || download.status === 'already_exists') {
                                 return { isDuplicate: true, message: 'This URL has already been downloaded with the same quality and format.' };
-                            } else if (download.status === 'downloading' || download.status === 'queued' || download.status === 'post-processing') {
+                            } else if (download.status === 'downloading' || download.status === 'queued' || download.status === 'scheduled' || download.status === 'post-processing') {
                                 return { isDuplicate: true, message: 'This URL is already being downloaded with the same quality and format.' };
                             } else if (download.status === 'failed') {
                                 return { isDuplicate: true, message: 'This URL was previously attempted. You can retry by removing the failed download first.' };
@@ -1365,7 +1466,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     this.statusMessage = null;
                     
                     try {
-                        const response = await fetch('/api/downloads', {
+                        const response = await fetch('/api/v1/downloads', {
                             method: 'POST',
                             headers: {
                                 'Content-Type': 'application/json'
@@ -1383,7 +1484,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             this.newDownload.url = '';
                             await this.loadDownloads();
                         } else {
-                            const error = await response.text();
+                            const error = await errorMessage(response);
                             this.statusMessage = { type: 'error', text: 'Error: ' + error };
                         }
                     } catch (error) {
@@ -1396,9 +1497,66 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     }, 5000);
                 },
                 
+                readImportFile(event) {
+                    const file = event.target.files[0];
+                    if (!file) {
+                        return;
+                    }
+                    const reader = new FileReader();
+                    reader.onload = () => {
+                        this.importText = reader.result;
+                        this.importFilename = file.name;
+                    };
+                    reader.readAsText(file);
+                },
+
+                async importUrls() {
+                    this.isImporting = true;
+                    this.statusMessage = null;
+
+                    try {
+                        const response = await fetch('/api/v1/import', {
+                            method: 'POST',
+                            headers: {
+                                'Content-Type': 'application/json'
+                            },
+                            body: JSON.stringify({
+                                content: this.importText,
+                                filename: this.importFilename,
+                                type: this.newDownload.type,
+                                quality: this.newDownload.quality,
+                                format: this.newDownload.format
+                            })
+                        });
+
+                        if (response.ok) {
+                            const result = await response.json();
+                            let text = 'Imported ' + result.accepted + ' URLs, ' + result.duplicates + ' duplicates, ' + result.rejected + ' rejected';
+                            const rejected = result.entries.find(entry => entry.status === 'rejected');
+                            if (rejected) {
+                                text += ' (line ' + rejected.line + ': ' + rejected.error + ')';
+                            }
+                            this.statusMessage = { type: result.rejected > 0 ? 'error' : 'success', text: text };
+                            this.importText = '';
+                            this.importFilename = '';
+                            await this.loadDownloads();
+                        } else {
+                            const error = await errorMessage(response);
+                            this.statusMessage = { type: 'error', text: 'Error: ' + error };
+                        }
+                    } catch (error) {
+                        this.statusMessage = { type: 'error', text: 'Network error: ' + error.message };
+                    }
+
+                    this.isImporting = false;
+                    setTimeout(() => {
+                        this.statusMessage = null;
+                    }, 8000);
+                },
+
                 async deleteDownload(id) {
                     try {
-                        const response = await fetch('/api/downloads/' + id, {
+                        const response = await fetch('/api/v1/downloads/' + id, {
                             method: 'DELETE'
                         });
                         
@@ -1414,7 +1572,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 
                 async pauseDownload(id) {
                     try {
-                        const response = await fetch('/api/downloads/' + id + '/pause', {
+                        const response = await fetch('/api/v1/downloads/' + id + '/pause', {
                             method: 'POST'
                         });
                         
@@ -1430,7 +1588,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 
                 async retryDownload(id) {
                     try {
-                        const response = await fetch('/api/downloads/' + id + '/retry', {
+                        const response = await fetch('/api/v1/downloads/' + id + '/retry', {
                             method: 'POST'
                         });
                         
@@ -1451,7 +1609,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     }
                     
                     try {
-                        const response = await fetch('/api/downloads/clear-queued', {
+                        const response = await fetch('/api/v1/downloads/clear-queued', {
                             method: 'POST'
                         });
                         
@@ -1472,7 +1630,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     }
                     
                     try {
-                        const response = await fetch('/api/downloads/delete-completed', {
+                        const response = await fetch('/api/v1/downloads/delete-completed', {
                             method: 'POST'
                         });
                         
@@ -1493,7 +1651,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                     }
                     
                     try {
-                        const response = await fetch('/api/downloads/clear-failed', {
+                        const response = await fetch('/api/v1/downloads/clear-failed', {
                             method: 'POST'
                         });
                         
@@ -1510,9 +1668,18 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 
                 async loadDownloads() {
                     try {
-                        const response = await fetch('/api/downloads');
+                        // After the first load only the changes since the last
+                        // revision are fetched
+                        const url = this.revision ? '/api/v1/downloads?since=' + this.revision : '/api/v1/downloads';
+                        const response = await fetch(url);
                         if (response.ok) {
-                            const newDownloads = await response.json();
+                            const list = await response.json();
+                            let newDownloads = list.downloads;
+                            if (list.delta) {
+                                const gone = new Set((list.removed || []).concat(list.downloads.map(d => d.id)));
+                                newDownloads = this.downloads.filter(d => !gone.has(d.id)).concat(list.downloads);
+                            }
+                            this.revision = list.revision;
                             
                             // Only update if there are actual changes to prevent unnecessary re-renders
                             if (JSON.stringify(this.downloads) !== JSON.stringify(newDownloads)) {
@@ -1529,7 +1696,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 
                 async loadSettings() {
                     try {
-                        const response = await fetch('/api/config');
+                        const response = await fetch('/api/v1/config');
                         if (response.ok) {
                             this.settings = await response.json();
                         }
@@ -1541,7 +1708,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 async saveSettings() {
                     this.isSavingSettings = true;
                     try {
-                        const response = await fetch('/api/config', {
+                        const response = await fetch('/api/v1/config', {
                             method: 'POST',
                             headers: {
                                 'Content-Type': 'application/json'
@@ -1553,7 +1720,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             this.statusMessage = { type: 'success', text: 'Settings saved successfully!' };
                             this.showSettings = false;
                         } else {
-                            const error = await response.text();
+                            const error = await errorMessage(response);
                             this.statusMessage = { type: 'error', text: 'Failed to save settings: ' + error };
                         }
                     } catch (error) {
@@ -1568,7 +1735,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 
                 async loadVersions() {
                     try {
-                        const response = await fetch('/api/versions');
+                        const response = await fetch('/api/v1/versions');
                         if (response.ok) {
                             this.versions = await response.json();
                         }
@@ -1580,7 +1747,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 async checkForUpdates() {
                     this.isCheckingUpdates = true;
                     try {
-                        const response = await fetch('/api/yt-dlp/version');
+                        const response = await fetch('/api/v1/yt-dlp/version');
                         if (response.ok) {
                             this.updateInfo = await response.json();
                             
@@ -1607,7 +1774,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 async updateYtDlp() {
                     this.isUpdating = true;
                     try {
-                        const response = await fetch('/api/yt-dlp/update', {
+                        const response = await fetch('/api/v1/yt-dlp/update', {
                             method: 'POST'
                         });
                         
@@ -1619,7 +1786,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                             await this.checkForUpdates();
                             await this.loadVersions();
                         } else {
-                            const error = await response.text();
+                            const error = await errorMessage(response);
                             this.statusMessage = { type: 'error', text: 'Failed to update yt-dlp: ' + error };
                         }
                     } catch (error) {
@@ -1635,7 +1802,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
                 async checkFfmpeg() {
                     this.isCheckingFfmpeg = true;
                     try {
-                        const response = await fetch('/api/ffmpeg/check');
+                        const response = await fetch('/api/v1/ffmpeg/check');
                         if (response.ok) {
                             this.ffmpegInfo = await response.json();
                         } else {
@@ -1651,6 +1818,7 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
             
             mounted() {
                 this.checkDarkMode();
+                this.loadAuthStatus();
                 this.loadDownloads();
                 this.loadSettings();
                 this.loadVersions();
@@ -1669,6 +1837,77 @@ func (th *TemplateHandler) ServeIndex(w http.ResponseWriter, r *http.Request) {
 </body>
 </html>`
 
+	th.render(w, html)
+}
+
+func (th *TemplateHandler) ServeLogin(w http.ResponseWriter, r *http.Request) {
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Sign in - GoGetMedia</title>
+    <link rel="stylesheet" href="__BASE_PATH__/assets/css/tailwind.min.css">
+    <script>
+        if (localStorage.getItem('darkMode') === 'true') {
+            document.documentElement.classList.add('dark');
+        }
+    </script>
+</head>
+<body class="min-h-screen flex items-center justify-center bg-slate-100 dark:bg-slate-900">
+    <form id="login" class="w-full max-w-sm mx-4 p-8 bg-white dark:bg-slate-800 rounded-2xl shadow-2xl space-y-5">
+        <h1 class="text-2xl font-bold text-slate-800 dark:text-white text-center">GoGetMedia</h1>
+        <div>
+            <label for="username" class="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Username</label>
+            <input id="username" name="username" autocomplete="username" required autofocus class="w-full px-4 py-2 border border-slate-300 dark:border-slate-600 rounded-xl bg-white dark:bg-slate-700 text-slate-900 dark:text-white">
+        </div>
+        <div>
+            <label for="password" class="block text-sm font-medium text-slate-700 dark:text-slate-300 mb-1">Password</label>
+            <input id="password" name="password" type="password" autocomplete="current-password" required class="w-full px-4 py-2 border border-slate-300 dark:border-slate-600 rounded-xl bg-white dark:bg-slate-700 text-slate-900 dark:text-white">
+        </div>
+        <p id="error" class="hidden text-sm text-red-600 dark:text-red-400"></p>
+        <button type="submit" class="w-full py-3 text-white font-medium rounded-xl bg-gradient-to-r from-blue-500 to-purple-600 hover:opacity-90">Sign in</button>
+    </form>
+    <script>
+        document.getElementById('login').addEventListener('submit', async (event) => {
+            event.preventDefault();
+            const error = document.getElementById('error');
+            error.classList.add('hidden');
+            try {
+                const response = await fetch('__BASE_PATH__/api/v1/auth/login', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({
+                        username: document.getElementById('username').value,
+                        password: document.getElementById('password').value
+                    })
+                });
+                if (response.ok) {
+                    window.location.href = '__BASE_PATH__/';
+                    return;
+                }
+                const text = await response.text();
+                try {
+                    error.textContent = JSON.parse(text).message;
+                } catch (e) {
+                    error.textContent = text.trim();
+                }
+            } catch (e) {
+                error.textContent = 'Unable to reach the server';
+            }
+            error.classList.remove('hidden');
+        });
+    </script>
+</body>
+</html>`
+
+	th.render(w, html)
+}
+
+// render writes a page, pointing its links at the configured base path
+func (th *TemplateHandler) render(w http.ResponseWriter, html string) {
+	html = strings.ReplaceAll(html, "__BASE_PATH__", th.config.BasePathPrefix())
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(html))
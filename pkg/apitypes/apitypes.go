@@ -0,0 +1,347 @@
+// Package apitypes defines the requests and responses of the GoGetMedia REST
+// API. The server encodes these types and pkg/client decodes them, so both
+// sides agree on the JSON format. They are defined here rather than taken from
+// the server, so that clients do not link it and the format only changes on
+// purpose.
+package apitypes
+
+import "time"
+
+// User roles
+const (
+	RoleAdmin  = "admin"  // everything, including config, users and yt-dlp updates
+	RoleUser   = "user"   // add downloads and manage their own
+	RoleViewer = "viewer" // read-only access
+)
+
+// DownloadRequest adds a download, a playlist or the first video of a playlist
+type DownloadRequest struct {
+	URL     string     `json:"url"`
+	Type    string     `json:"type"`               // "video" or "audio"
+	Quality string     `json:"quality"`            // "best", "worst", "720p", etc.
+	Format  string     `json:"format"`             // "mp4", "mp3", etc.
+	StartAt *time.Time `json:"start_at,omitempty"` // optional earliest start time (RFC 3339)
+
+	RateLimitKBps int `json:"rate_limit_kbps,omitempty"` // optional per-download limit, 0 = use global
+
+	// ExternalID is the client's own ID of the download, at most 255
+	// characters. Adding a download with an ID that is already in use returns
+	// the existing download instead, so requests can be retried safely. The
+	// Idempotency-Key header does the same.
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// DownloadList is a page of downloads. Total counts the downloads that match
+// the filter on all pages; NextCursor fetches the next page and is empty on
+// the last one.
+//
+// Revision is the revision of the list. Asking for the changes since it
+// returns a list with Delta set, holding only the downloads that changed and
+// the IDs of the ones that were removed or no longer match the filter.
+type DownloadList struct {
+	Downloads  []*Download `json:"downloads"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Revision   uint64      `json:"revision"`
+	Delta      bool        `json:"delta,omitempty"`
+	Removed    []string    `json:"removed,omitempty"`
+}
+
+// Bulk actions
+const (
+	BulkCancel          = "cancel"
+	BulkPause           = "pause"
+	BulkResume          = "resume"
+	BulkRetry           = "retry"
+	BulkRemove          = "remove"            // keeps the files
+	BulkRemoveWithFiles = "remove-with-files" // deletes the files too
+	BulkChangePriority  = "change-priority"
+	BulkMoveDestination = "move-destination"
+)
+
+// BulkRequest applies an action to several downloads, either the ones in IDs
+// or the ones matching Filter. Filter uses the query syntax of the downloads
+// list, e.g. "status=failed&q=example.com&since=2026-01-02T00:00:00Z".
+type BulkRequest struct {
+	Action string   `json:"action"`
+	IDs    []string `json:"ids,omitempty"`
+	Filter string   `json:"filter,omitempty"`
+
+	Priority    int    `json:"priority,omitempty"`    // change-priority, higher starts first
+	Destination string `json:"destination,omitempty"` // move-destination, folder below the download directory
+}
+
+// BulkResult is the outcome of a bulk action for one download
+type BulkResult struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkResponse lists the outcome for every selected download
+type BulkResponse struct {
+	Action    string       `json:"action"`
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+// Import kinds
+const (
+	ImportText      = "text"      // one URL per line
+	ImportCSV       = "csv"       // url, type, quality, format, preset, destination and external_id columns
+	ImportBookmarks = "bookmarks" // browser bookmark export (HTML)
+	ImportOPML      = "opml"
+)
+
+// ImportRequest adds every URL of a list, a CSV file, a bookmark export or an
+// OPML file. Kind is detected from Filename and Content when empty. The
+// settings below apply to the entries that don't give their own; a preset
+// sets type and quality or format in one go, e.g. "audio" or "720p".
+type ImportRequest struct {
+	Content  string `json:"content"`
+	Kind     string `json:"kind,omitempty"`
+	Filename string `json:"filename,omitempty"`
+
+	Type        string `json:"type,omitempty"`
+	Quality     string `json:"quality,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Preset      string `json:"preset,omitempty"`
+	Destination string `json:"destination,omitempty"` // folder below the download directory
+}
+
+// Import entry statuses
+const (
+	ImportAccepted  = "accepted"
+	ImportDuplicate = "duplicate"
+	ImportRejected  = "rejected"
+)
+
+// ImportEntry is the outcome of one URL of an import. Line is where the entry
+// starts in the imported content. DownloadID is the download the entry was
+// added as, the first download of a playlist, or the download an earlier
+// entry or external ID already added.
+type ImportEntry struct {
+	Line       int    `json:"line"`
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DownloadID string `json:"download_id,omitempty"`
+	Playlist   bool   `json:"playlist,omitempty"`
+}
+
+// ImportResponse reports the outcome of every entry of an import
+type ImportResponse struct {
+	Kind       string        `json:"kind"`
+	Accepted   int           `json:"accepted"`
+	Duplicates int           `json:"duplicates"`
+	Rejected   int           `json:"rejected"`
+	Entries    []ImportEntry `json:"entries"`
+}
+
+// Export formats
+const (
+	ExportJSON  = "json"  // an array of downloads
+	ExportJSONL = "jsonl" // one download per line
+	ExportCSV   = "csv"
+)
+
+// BackupManifest describes a backup archive
+type BackupManifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// DownloadPath is the download directory of the server that was backed up
+	DownloadPath string `json:"download_path"`
+
+	Users      int   `json:"users"`
+	Downloads  int   `json:"downloads"`
+	Logs       int   `json:"logs"`
+	Media      bool  `json:"media"` // whether the downloaded files are included
+	MediaFiles int   `json:"media_files,omitempty"`
+	MediaBytes int64 `json:"media_bytes,omitempty"`
+}
+
+// RestoreResponse is returned when a backup is staged for restore. The
+// backup is restored when the server is next started.
+type RestoreResponse struct {
+	Status   string         `json:"status"`
+	Message  string         `json:"message"`
+	Manifest BackupManifest `json:"manifest"`
+}
+
+// PlaylistResponse is returned when a playlist is added
+type PlaylistResponse struct {
+	Message       string    `json:"message"`
+	FirstDownload *Download `json:"first_download"`
+}
+
+// ValidateRequest checks a URL before it is added
+type ValidateRequest struct {
+	URL     string `json:"url"`
+	Type    string `json:"type"`
+	Quality string `json:"quality"`
+	Format  string `json:"format"`
+}
+
+// ValidateResponse describes the media behind a URL and whether it has
+// already been downloaded
+type ValidateResponse struct {
+	Valid      bool   `json:"valid"`
+	Error      string `json:"error,omitempty"`
+	IsPlaylist bool   `json:"is_playlist"`
+
+	// Single videos
+	Title      string `json:"title,omitempty"`
+	Filename   string `json:"filename,omitempty"`
+	FileExists bool   `json:"file_exists,omitempty"`
+
+	// Playlists
+	PlaylistCount    int    `json:"playlist_count"`
+	PlaylistTitle    string `json:"playlist_title,omitempty"`
+	FirstVideoTitle  string `json:"first_video_title,omitempty"`
+	FirstVideoExists bool   `json:"first_video_exists,omitempty"`
+
+	// The file of an earlier download with the same settings
+	ExistingFile     string `json:"existing_file,omitempty"`
+	ExistingFilename string `json:"existing_filename,omitempty"`
+}
+
+// StatusResponse is returned by actions without a more specific result
+type StatusResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ConfigResponse is the configuration along with the settings that cannot be
+// changed through the API
+type ConfigResponse struct {
+	*Config
+	Locked []string `json:"locked"`
+}
+
+// UpdateInfo is the installed and the latest version of yt-dlp
+type UpdateInfo struct {
+	CurrentVersion  string    `json:"current_version"`
+	LatestVersion   string    `json:"latest_version"`
+	UpdateAvailable bool      `json:"update_available"`
+	LastChecked     time.Time `json:"last_checked"`
+}
+
+// VersionInfo is the version of yt-dlp and ffmpeg
+type VersionInfo struct {
+	YtDlpVersion  string `json:"yt_dlp"`
+	FfmpegVersion string `json:"ffmpeg"`
+}
+
+// FfmpegStatus reports whether ffmpeg can be run
+type FfmpegStatus struct {
+	Available      bool   `json:"available"`
+	Version        string `json:"version"`
+	ConfiguredPath string `json:"configured_path"`
+	ActualPath     string `json:"actual_path"`
+	Path           string `json:"path"` // same as ActualPath, for older clients
+}
+
+// User is the public view of an account
+type User struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthStatus tells clients whether login is required and who is logged in
+type AuthStatus struct {
+	Enabled   bool   `json:"enabled"`
+	User      *User  `json:"user,omitempty"`
+	CSRFToken string `json:"csrf_token,omitempty"` // for requests authenticated by the session cookie
+}
+
+// LoginRequest signs in with a password
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse is the signed-in user and the CSRF token of the new session
+type LoginResponse struct {
+	User
+	CSRFToken string `json:"csrf_token"`
+}
+
+// ChangePasswordRequest changes the password of the signed-in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePasswordResponse carries the CSRF token of the session that replaces
+// the current one
+type ChangePasswordResponse struct {
+	Status    string `json:"status"`
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+// Token is an API token, without its secret
+type Token struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateTokenRequest creates an API token
+type CreateTokenRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateTokenResponse is a new API token. The secret is only returned here.
+type CreateTokenResponse struct {
+	Token  Token  `json:"token"`
+	Secret string `json:"secret"`
+}
+
+// CreateUserRequest creates an account. The role defaults to RoleUser.
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role,omitempty"`
+}
+
+// SetRoleRequest changes the role of an account
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Error is the body of every error response of /api/v1
+type Error struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Error codes. Most errors get the code of their HTTP status, the others
+// name a problem clients may want to handle on its own.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeRequestTooLarge      = "request_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+	CodeUnavailable          = "service_unavailable"
+
+	CodeInvalidJSON       = "invalid_json"
+	CodeInvalidURL        = "invalid_url"
+	CodeInvalidCSRFToken  = "invalid_csrf_token"
+	CodeQuotaExceeded     = "quota_exceeded"
+	CodeFfmpegUnavailable = "ffmpeg_unavailable"
+	CodeSettingLocked     = "setting_locked"
+	CodeExternalIDInUse   = "external_id_in_use"
+)
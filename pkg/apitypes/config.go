@@ -0,0 +1,152 @@
+package apitypes
+
+import "time"
+
+// Config is the configuration of the server. Settings missing from an update
+// keep their value.
+type Config struct {
+	DownloadPath             string `json:"download_path"`
+	MaxConcurrentDownloads   int    `json:"max_concurrent_downloads"`
+	YtDlpPath                string `json:"yt_dlp_path"`
+	FfmpegPath               string `json:"ffmpeg_path"`
+	Port                     int    `json:"port"`
+	BindAddress              string `json:"bind_address"` // address to listen on, "" for all interfaces
+	DefaultVideoFormat       string `json:"default_video_format"`
+	DefaultAudioFormat       string `json:"default_audio_format"`
+	VerboseLogging           bool   `json:"verbose_logging"`
+	CompletedFileExpiryHours int    `json:"completed_file_expiry_hours"`
+	EnableHardwareAccel      bool   `json:"enable_hardware_acceleration"`
+	OptimizeForLowPower      bool   `json:"optimize_for_low_power"`
+
+	// DownloadWindows restricts when downloads may run. When empty, downloads
+	// are allowed at any time.
+	DownloadWindows []ScheduleWindow `json:"download_windows"`
+
+	// BandwidthLimitKBps caps the combined throughput of all active downloads
+	// in KiB/s; 0 means unlimited. BandwidthSchedule entries override it while
+	// their window is active, the first matching entry wins.
+	BandwidthLimitKBps int             `json:"bandwidth_limit_kbps"`
+	BandwidthSchedule  []BandwidthRule `json:"bandwidth_schedule"`
+
+	// DefaultSiteLimit applies to every host without its own entry in SiteLimits
+	DefaultSiteLimit SiteLimit   `json:"default_site_limit"`
+	SiteLimits       []SiteLimit `json:"site_limits"`
+
+	// Retry controls automatic retries of failed downloads
+	Retry RetryPolicy `json:"retry"`
+
+	// DefaultQuota applies to every user without their own entry in UserQuotas
+	DefaultQuota Quota   `json:"default_quota"`
+	UserQuotas   []Quota `json:"user_quotas"`
+
+	// DisableAuth turns off login for the web UI and API
+	DisableAuth bool `json:"disable_auth"`
+
+	// BasePath serves the app under a path prefix such as "/gogetmedia"
+	BasePath string `json:"base_path"`
+
+	// TrustedProxies lists the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers are used
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// CORS controls which other sites may call the API from a browser
+	CORS CORSConfig `json:"cors"`
+
+	// TLS serves the UI and API over HTTPS
+	TLS TLSConfig `json:"tls"`
+
+	// RateLimit limits how many API requests a single client address can make
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	// LockedSettings lists settings, by their JSON name, that cannot be
+	// changed through the API
+	LockedSettings []string `json:"locked_settings"`
+}
+
+// ScheduleWindow is a recurring time-of-day window in server local time. A
+// window whose end is before its start wraps past midnight.
+type ScheduleWindow struct {
+	Start string   `json:"start"`          // "HH:MM"
+	End   string   `json:"end"`            // "HH:MM"
+	Days  []string `json:"days,omitempty"` // "mon".."sun", empty means every day
+}
+
+// BandwidthRule applies a bandwidth limit during a recurring window
+type BandwidthRule struct {
+	ScheduleWindow
+	LimitKBps int `json:"limit_kbps"` // 0 means unlimited during the window
+}
+
+// SiteLimit throttles downloads from a single host. Zero values disable the
+// corresponding limit.
+type SiteLimit struct {
+	Host                    string  `json:"host,omitempty"`             // e.g. "youtube.com", also matches subdomains
+	MaxConcurrent           int     `json:"max_concurrent"`             // active downloads from the host
+	MinIntervalSeconds      int     `json:"min_interval_seconds"`       // minimum gap between download starts
+	SleepRequestsSeconds    float64 `json:"sleep_requests_seconds"`     // yt-dlp --sleep-requests
+	SleepIntervalSeconds    float64 `json:"sleep_interval_seconds"`     // yt-dlp --sleep-interval
+	MaxSleepIntervalSeconds float64 `json:"max_sleep_interval_seconds"` // yt-dlp --max-sleep-interval
+}
+
+// RetryPolicy describes when and how often failed downloads are retried
+type RetryPolicy struct {
+	MaxAttempts      int      `json:"max_attempts"`       // total attempts including the first, 0 or 1 disables retries
+	BaseDelaySeconds int      `json:"base_delay_seconds"` // delay before the first retry
+	MaxDelaySeconds  int      `json:"max_delay_seconds"`  // upper bound for the delay
+	Jitter           float64  `json:"jitter"`             // 0..1, fraction of the delay to randomise
+	RetryOn          []string `json:"retry_on,omitempty"` // error codes to retry, empty means all transient errors
+}
+
+// Quota limits how much a single user may download. Zero values disable the
+// corresponding limit.
+type Quota struct {
+	Username      string `json:"username,omitempty"`
+	MaxConcurrent int    `json:"max_concurrent"`   // downloads running at the same time
+	MaxQueued     int    `json:"max_queued"`       // downloads waiting to run
+	MaxStorageMB  int64  `json:"max_storage_mb"`   // total size of completed downloads
+	MaxFileSizeMB int64  `json:"max_file_size_mb"` // size of a single download
+}
+
+// CORSConfig lists the origins allowed to make cross-origin requests and the
+// methods they may use
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowed_origins"` // e.g. "https://example.com", or "*" for any
+	AllowedMethods []string `json:"allowed_methods"` // empty means GET, POST, PUT, DELETE
+}
+
+// TLSConfig enables HTTPS. Without CertFile and KeyFile a self-signed
+// certificate is used.
+type TLSConfig struct {
+	Enabled          bool   `json:"enabled"`
+	CertFile         string `json:"cert_file"`          // PEM certificate chain
+	KeyFile          string `json:"key_file"`           // PEM private key
+	RedirectHTTPPort int    `json:"redirect_http_port"` // port redirecting plain HTTP to HTTPS, 0 disables it
+}
+
+// RateLimitConfig limits API requests per client address. Zero values disable
+// the corresponding limit.
+type RateLimitConfig struct {
+	RequestsPerMinute      int `json:"requests_per_minute"`       // sustained rate of API requests
+	Burst                  int `json:"burst"`                     // requests allowed at once above the sustained rate
+	LoginAttemptsPerMinute int `json:"login_attempts_per_minute"` // login requests, limited separately
+}
+
+// Usage is what a user has downloaded and queued, against their quota
+type Usage struct {
+	Username      string `json:"username,omitempty"`
+	Active        int    `json:"active"`         // running downloads
+	Queued        int    `json:"queued"`         // downloads waiting to run
+	StoredBytes   int64  `json:"stored_bytes"`   // size of completed downloads
+	ReservedBytes int64  `json:"reserved_bytes"` // estimated size of unfinished downloads
+	Quota         Quota  `json:"quota"`
+}
+
+// ScheduleStatus reports whether downloads may currently run and how many
+// are held
+type ScheduleStatus struct {
+	Windows      []ScheduleWindow `json:"windows"`
+	WindowOpen   bool             `json:"window_open"`
+	NextChange   *time.Time       `json:"next_change,omitempty"`
+	Held         int              `json:"held"`
+	ActiveByHost map[string]int   `json:"active_by_host"`
+}
@@ -0,0 +1,144 @@
+package apitypes
+
+import "time"
+
+// DownloadType is "video" or "audio"
+type DownloadType string
+
+// Download types
+const (
+	VideoDownload DownloadType = "video"
+	AudioDownload DownloadType = "audio"
+)
+
+// DownloadStatus is the state of a download
+type DownloadStatus string
+
+// Download statuses
+const (
+	StatusQueued         DownloadStatus = "queued"
+	StatusScheduled      DownloadStatus = "scheduled"
+	StatusDownloading    DownloadStatus = "downloading"
+	StatusPostProcessing DownloadStatus = "post-processing"
+	StatusPaused         DownloadStatus = "paused"
+	StatusCompleted      DownloadStatus = "completed"
+	StatusFailed         DownloadStatus = "failed"
+	StatusCancelled      DownloadStatus = "cancelled"
+	StatusAlreadyExists  DownloadStatus = "already_exists"
+)
+
+// ErrorCode classifies why a download failed, e.g. "network" or "private"
+type ErrorCode string
+
+// Download is a download as the API returns it
+type Download struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Type          DownloadType     `json:"type"`
+	Quality       string           `json:"quality"`
+	Format        string           `json:"format"`
+	Status        DownloadStatus   `json:"status"`
+	Progress      DownloadProgress `json:"progress"`
+	Title         string           `json:"title"`
+	Filename      string           `json:"filename"`
+	OutputPath    string           `json:"output_path"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Owner         string           `json:"owner,omitempty"`       // username of the user who added it
+	ExternalID    string           `json:"external_id,omitempty"` // the client's ID, see DownloadRequest
+	StartAt       *time.Time       `json:"start_at,omitempty"`
+	CompletedAt   *time.Time       `json:"completed_at,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	StatusMessage string           `json:"status_message,omitempty"`
+
+	// EstimatedBytes is the expected size from the metadata when the download
+	// was added, FileSize the size of the finished file (0 = unknown)
+	EstimatedBytes int64 `json:"estimated_bytes,omitempty"`
+	FileSize       int64 `json:"file_size,omitempty"`
+
+	// SHA256 is the hex checksum of the finished file ("" = not computed yet)
+	SHA256 string `json:"sha256,omitempty"`
+
+	// RateLimitKBps is the requested per-download limit, AppliedRateLimitKBps
+	// the limit the current run was started with (0 = unlimited)
+	RateLimitKBps        int `json:"rate_limit_kbps,omitempty"`
+	AppliedRateLimitKBps int `json:"applied_rate_limit_kbps,omitempty"`
+
+	// ErrorCode classifies Error. Attempts holds the history of runs, and
+	// AutoRetries counts automatic retries since the last manual retry.
+	ErrorCode     ErrorCode  `json:"error_code,omitempty"`
+	Attempts      []Attempt  `json:"attempts,omitempty"`
+	AutoRetries   int        `json:"auto_retries,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	// Command is the yt-dlp command line of the most recent run
+	Command []string `json:"command,omitempty"`
+
+	// Priority orders queued downloads, higher starts first. Destination is
+	// the folder below the download directory the file is saved in ("" for
+	// the download directory itself).
+	Priority    int    `json:"priority,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	// Revision increases with every change of the download
+	Revision uint64 `json:"revision"`
+}
+
+// DownloadProgress is the progress of a running download
+type DownloadProgress struct {
+	Percentage float64 `json:"percentage"`
+	Speed      string  `json:"speed"`
+	ETA        string  `json:"eta"`
+	Size       string  `json:"size"`
+
+	// Machine-readable values, filled when yt-dlp reports them. TotalBytes
+	// is an estimate when TotalEstimated is set.
+	DownloadedBytes int64   `json:"downloaded_bytes,omitempty"`
+	TotalBytes      int64   `json:"total_bytes,omitempty"`
+	TotalEstimated  bool    `json:"total_estimated,omitempty"`
+	SpeedBps        float64 `json:"speed_bps,omitempty"`
+	ETASeconds      int     `json:"eta_seconds,omitempty"`
+	FragmentIndex   int     `json:"fragment_index,omitempty"`
+	FragmentCount   int     `json:"fragment_count,omitempty"`
+
+	// Percentage is the overall progress across all phases; PhasePercentage
+	// is the progress of the current Phase, detailed per phase in Phases
+	Phase           string          `json:"phase,omitempty"` // e.g. "video", "audio" or "merge"
+	PhasePercentage float64         `json:"phase_percentage,omitempty"`
+	Phases          []PhaseProgress `json:"phases,omitempty"`
+}
+
+// PhaseProgress is the progress of one phase of a download
+type PhaseProgress struct {
+	Name            string  `json:"name"`
+	State           string  `json:"state"` // "pending", "active", "done" or "skipped"
+	Percentage      float64 `json:"percentage"`
+	Weight          float64 `json:"weight"`
+	DownloadedBytes int64   `json:"downloaded_bytes,omitempty"`
+	TotalBytes      int64   `json:"total_bytes,omitempty"`
+}
+
+// Attempt is one run of a download
+type Attempt struct {
+	Number    int            `json:"number"`
+	StartedAt time.Time      `json:"started_at"`
+	EndedAt   *time.Time     `json:"ended_at,omitempty"`
+	Outcome   DownloadStatus `json:"outcome,omitempty"`
+	ErrorCode ErrorCode      `json:"error_code,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// DownloadLog is the yt-dlp and ffmpeg output of a download
+type DownloadLog struct {
+	ID      string    `json:"id"`
+	Command []string  `json:"command,omitempty"`
+	Lines   []LogLine `json:"lines"`
+	Live    bool      `json:"live"` // true while the download may still produce output
+}
+
+// LogLine is a line of output. Stream is "stdout" or "stderr" for the output
+// of yt-dlp and ffmpeg, "command" and "info" for lines of the server.
+type LogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Text   string    `json:"text"`
+}
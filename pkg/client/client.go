@@ -0,0 +1,749 @@
+// Package client is a Go client for the GoGetMedia REST API.
+//
+// Scripts authenticate with an API token:
+//
+//	c := client.New("http://127.0.0.1:8080", client.WithToken("ggm_..."))
+//	download, err := c.AddDownload(ctx, apitypes.DownloadRequest{URL: url, Type: "video", Quality: "best", Format: "mp4"})
+//
+// Login signs in with a password instead and keeps the session cookie and
+// CSRF token for later calls.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gogetmedia/pkg/apitypes"
+)
+
+// apiPrefix is the path of the API version the client speaks
+const apiPrefix = "/api/v1"
+
+// Client calls the API of a GoGetMedia server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+
+	mutex     sync.Mutex
+	csrfToken string // of the session started by Login
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken authenticates every request with an API token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sends requests with httpClient, e.g. for custom TLS settings
+// or timeouts. Login needs the client to have a cookie jar.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client for the server at baseURL, e.g. "http://127.0.0.1:8080"
+// or "https://example.com/gogetmedia" behind a reverse proxy
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimRight(baseURL, "/")}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		jar, _ := cookiejar.New(nil)
+		c.httpClient = &http.Client{Jar: jar}
+	}
+	return c
+}
+
+// Error is a response with a non-2xx status. Code and Details come from the
+// JSON error body, see apitypes.Error.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, message)
+}
+
+// StatusCode returns the HTTP status of an *Error, or 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// ErrorCode returns the error code of an *Error, e.g. apitypes.CodeQuotaExceeded,
+// or "" for other errors
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// newRequest creates a request with body encoded as JSON and the credentials
+// of the client
+func (c *Client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if method != "GET" && method != "HEAD" {
+		c.mutex.Lock()
+		if c.csrfToken != "" {
+			req.Header.Set("X-CSRF-Token", c.csrfToken)
+		}
+		c.mutex.Unlock()
+	}
+	return req, nil
+}
+
+// send performs a request and returns the response if its status is 2xx
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiError apitypes.Error
+		if err := json.Unmarshal(body, &apiError); err == nil && apiError.Code != "" {
+			return nil, &Error{StatusCode: resp.StatusCode, Code: apiError.Code, Message: apiError.Message, Details: apiError.Details}
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// do sends a JSON request and decodes the response into result, if given
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// downloadPath returns the path of a download, with suffix appended
+func downloadPath(id, suffix string) string {
+	return apiPrefix + "/downloads/" + url.PathEscape(id) + suffix
+}
+
+// AuthStatus reports whether the server requires login and who is signed in
+func (c *Client) AuthStatus(ctx context.Context) (*apitypes.AuthStatus, error) {
+	var status apitypes.AuthStatus
+	if err := c.do(ctx, "GET", apiPrefix+"/auth/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Login signs in with a password. Later calls use the session, unless the
+// client has an API token.
+func (c *Client) Login(ctx context.Context, username, password string) (*apitypes.User, error) {
+	if c.httpClient.Jar == nil {
+		return nil, errors.New("login needs an HTTP client with a cookie jar")
+	}
+	var response apitypes.LoginResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/auth/login", apitypes.LoginRequest{Username: username, Password: password}, &response); err != nil {
+		return nil, err
+	}
+	c.setCSRFToken(response.CSRFToken)
+	return &response.User, nil
+}
+
+// Logout ends the session started by Login
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.do(ctx, "POST", apiPrefix+"/auth/logout", nil, nil)
+	c.setCSRFToken("")
+	return err
+}
+
+func (c *Client) setCSRFToken(token string) {
+	c.mutex.Lock()
+	c.csrfToken = token
+	c.mutex.Unlock()
+}
+
+// ChangePassword changes the password of the signed-in user. The session
+// continues, all other sessions end.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string) error {
+	var response apitypes.ChangePasswordResponse
+	request := apitypes.ChangePasswordRequest{CurrentPassword: currentPassword, NewPassword: newPassword}
+	if err := c.do(ctx, "POST", apiPrefix+"/auth/password", request, &response); err != nil {
+		return err
+	}
+	if response.CSRFToken != "" && c.token == "" {
+		c.setCSRFToken(response.CSRFToken)
+	}
+	return nil
+}
+
+// ListTokens returns the API tokens of the signed-in user
+func (c *Client) ListTokens(ctx context.Context) ([]apitypes.Token, error) {
+	var tokens []apitypes.Token
+	if err := c.do(ctx, "GET", apiPrefix+"/auth/tokens", nil, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CreateToken creates an API token. Its secret is only returned here.
+func (c *Client) CreateToken(ctx context.Context, name string) (*apitypes.CreateTokenResponse, error) {
+	var response apitypes.CreateTokenResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/auth/tokens", apitypes.CreateTokenRequest{Name: name}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// RevokeToken deletes one of the signed-in user's API tokens
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", apiPrefix+"/auth/tokens/"+url.PathEscape(id), nil, nil)
+}
+
+// ListUsers returns all accounts (admin)
+func (c *Client) ListUsers(ctx context.Context) ([]apitypes.User, error) {
+	var users []apitypes.User
+	if err := c.do(ctx, "GET", apiPrefix+"/auth/users", nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUser creates an account (admin)
+func (c *Client) CreateUser(ctx context.Context, request apitypes.CreateUserRequest) (*apitypes.User, error) {
+	var user apitypes.User
+	if err := c.do(ctx, "POST", apiPrefix+"/auth/users", request, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser deletes an account (admin)
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	return c.do(ctx, "DELETE", apiPrefix+"/auth/users/"+url.PathEscape(username), nil, nil)
+}
+
+// SetUserRole changes the role of an account (admin)
+func (c *Client) SetUserRole(ctx context.Context, username, role string) (*apitypes.User, error) {
+	var user apitypes.User
+	if err := c.do(ctx, "POST", apiPrefix+"/auth/users/"+url.PathEscape(username)+"/role", apitypes.SetRoleRequest{Role: role}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetConfig returns the server configuration
+func (c *Client) GetConfig(ctx context.Context) (*apitypes.ConfigResponse, error) {
+	var response apitypes.ConfigResponse
+	if err := c.do(ctx, "GET", apiPrefix+"/config", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// UpdateConfig changes the settings in changes, keyed by their JSON names,
+// and returns the new configuration (admin)
+func (c *Client) UpdateConfig(ctx context.Context, changes map[string]interface{}) (*apitypes.ConfigResponse, error) {
+	var response apitypes.ConfigResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/config", changes, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ListDownloads returns the downloads visible to the caller, newest first
+func (c *Client) ListDownloads(ctx context.Context) ([]*apitypes.Download, error) {
+	list, err := c.QueryDownloads(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Downloads, nil
+}
+
+// ListOptions filters, sorts and pages QueryDownloads. Empty fields are left
+// to the server's defaults.
+type ListOptions struct {
+	Statuses []apitypes.DownloadStatus
+	Type     apitypes.DownloadType
+	Query    string    // text in the title, filename or URL
+	Since    time.Time // added at or after
+	Sort     string    // e.g. "title" or "-created_at"
+	Limit    int       // downloads per page, 0 for all
+	Cursor   string    // NextCursor of the previous page
+
+	// ExternalID selects the download added with that external_id
+	ExternalID string
+
+	// Revision of an earlier list to only get the changes since. The result
+	// has Delta set unless the server no longer knows the changes and sends
+	// the full list. Since is ignored with a revision.
+	Revision uint64
+}
+
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	if len(o.Statuses) > 0 {
+		statuses := make([]string, len(o.Statuses))
+		for i, status := range o.Statuses {
+			statuses[i] = string(status)
+		}
+		values.Set("status", strings.Join(statuses, ","))
+	}
+	if o.Type != "" {
+		values.Set("type", string(o.Type))
+	}
+	if o.Query != "" {
+		values.Set("q", o.Query)
+	}
+	if o.ExternalID != "" {
+		values.Set("external_id", o.ExternalID)
+	}
+	if o.Revision > 0 {
+		values.Set("since", strconv.FormatUint(o.Revision, 10))
+	} else if !o.Since.IsZero() {
+		values.Set("since", o.Since.Format(time.RFC3339))
+	}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		values.Set("cursor", o.Cursor)
+	}
+	return values
+}
+
+// Filter returns the filter fields of the options in the syntax of
+// apitypes.BulkRequest.Filter
+func (o ListOptions) Filter() string {
+	values := o.values()
+	for _, name := range []string{"sort", "limit", "cursor"} {
+		values.Del(name)
+	}
+	if o.Revision > 0 {
+		values.Del("since")
+		if !o.Since.IsZero() {
+			values.Set("since", o.Since.Format(time.RFC3339))
+		}
+	}
+	return values.Encode()
+}
+
+// QueryDownloads returns a page of the downloads visible to the caller
+func (c *Client) QueryDownloads(ctx context.Context, opts ListOptions) (*apitypes.DownloadList, error) {
+	path := apiPrefix + "/downloads"
+	if query := opts.values().Encode(); query != "" {
+		path += "?" + query
+	}
+	var list apitypes.DownloadList
+	if err := c.do(ctx, "GET", path, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetDownload returns a single download
+func (c *Client) GetDownload(ctx context.Context, id string) (*apitypes.Download, error) {
+	downloads, err := c.ListDownloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, download := range downloads {
+		if download.ID == id {
+			return download, nil
+		}
+	}
+	return nil, &Error{StatusCode: http.StatusNotFound, Message: "Download not found"}
+}
+
+// AddDownload adds a single video or audio download
+func (c *Client) AddDownload(ctx context.Context, request apitypes.DownloadRequest) (*apitypes.Download, error) {
+	var download apitypes.Download
+	if err := c.do(ctx, "POST", apiPrefix+"/downloads", request, &download); err != nil {
+		return nil, err
+	}
+	return &download, nil
+}
+
+// AddPlaylist adds every video of a playlist
+func (c *Client) AddPlaylist(ctx context.Context, request apitypes.DownloadRequest) (*apitypes.PlaylistResponse, error) {
+	var response apitypes.PlaylistResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/downloads/playlist", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// AddFirstVideo adds only the first video of a playlist
+func (c *Client) AddFirstVideo(ctx context.Context, request apitypes.DownloadRequest) (*apitypes.Download, error) {
+	var download apitypes.Download
+	if err := c.do(ctx, "POST", apiPrefix+"/downloads/first-video", request, &download); err != nil {
+		return nil, err
+	}
+	return &download, nil
+}
+
+// DeleteDownload removes a download
+func (c *Client) DeleteDownload(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", downloadPath(id, ""), nil, nil)
+}
+
+// CancelDownload cancels a download
+func (c *Client) CancelDownload(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", downloadPath(id, "/cancel"), nil, nil)
+}
+
+// PauseDownload pauses a running or queued download
+func (c *Client) PauseDownload(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", downloadPath(id, "/pause"), nil, nil)
+}
+
+// ResumeDownload resumes a paused download
+func (c *Client) ResumeDownload(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", downloadPath(id, "/resume"), nil, nil)
+}
+
+// RetryDownload queues a failed or cancelled download again
+func (c *Client) RetryDownload(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", downloadPath(id, "/retry"), nil, nil)
+}
+
+// ClearQueued removes the caller's queued downloads
+func (c *Client) ClearQueued(ctx context.Context) error {
+	return c.do(ctx, "POST", apiPrefix+"/downloads/clear-queued", nil, nil)
+}
+
+// DeleteCompleted removes the caller's completed downloads and their files
+func (c *Client) DeleteCompleted(ctx context.Context) error {
+	return c.do(ctx, "POST", apiPrefix+"/downloads/delete-completed", nil, nil)
+}
+
+// ClearFailed removes the caller's failed downloads
+func (c *Client) ClearFailed(ctx context.Context) error {
+	return c.do(ctx, "POST", apiPrefix+"/downloads/clear-failed", nil, nil)
+}
+
+// Bulk applies an action to the downloads given by ID or selected by a
+// filter. Failures of single downloads are reported in the results, not as
+// an error.
+func (c *Client) Bulk(ctx context.Context, request apitypes.BulkRequest) (*apitypes.BulkResponse, error) {
+	var response apitypes.BulkResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/downloads/bulk", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Export writes the downloads matching the filter of opts to w in one of
+// the apitypes.Export formats and returns the number of bytes written. Sort
+// applies too, Limit and Cursor do not.
+func (c *Client) Export(ctx context.Context, format string, opts ListOptions, w io.Writer) (int64, error) {
+	query, _ := url.ParseQuery(opts.Filter())
+	query.Set("format", format)
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	req, err := c.newRequest(ctx, "GET", apiPrefix+"/export?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// Import adds the URLs of a list, CSV file, bookmark export or OPML file.
+// Entries that were not added are reported in the response, not as an error.
+func (c *Client) Import(ctx context.Context, request apitypes.ImportRequest) (*apitypes.ImportResponse, error) {
+	var response apitypes.ImportResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/import", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Backup writes a backup of the server to w, with media also the downloaded
+// files, and returns the number of bytes written. Backups need admin.
+func (c *Client) Backup(ctx context.Context, media bool, w io.Writer) (int64, error) {
+	path := apiPrefix + "/admin/backup"
+	if media {
+		path += "?media=true"
+	}
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// Restore uploads a backup written by Backup. The server checks it and
+// restores it when it is next started.
+func (c *Client) Restore(ctx context.Context, archive io.Reader) (*apitypes.RestoreResponse, error) {
+	req, err := c.newRequest(ctx, "POST", apiPrefix+"/admin/restore", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(archive)
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response apitypes.RestoreResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &response, nil
+}
+
+// CancelRestore cancels a restore that waits for the server to restart
+func (c *Client) CancelRestore(ctx context.Context) error {
+	return c.do(ctx, "DELETE", apiPrefix+"/admin/restore", nil, nil)
+}
+
+// DownloadFile writes the file of a completed download to w and returns the
+// number of bytes written
+func (c *Client) DownloadFile(ctx context.Context, id string, w io.Writer) (int64, error) {
+	req, err := c.newRequest(ctx, "GET", downloadPath(id, "/download"), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// GetDownloadLog returns the captured yt-dlp and ffmpeg output of a download
+func (c *Client) GetDownloadLog(ctx context.Context, id string) (*apitypes.DownloadLog, error) {
+	var downloadLog apitypes.DownloadLog
+	if err := c.do(ctx, "GET", downloadPath(id, "/log"), nil, &downloadLog); err != nil {
+		return nil, err
+	}
+	return &downloadLog, nil
+}
+
+// LogEvent is an event of a followed download log. Type is "command" with
+// Command set, "line" with Line set, or "end" when the download has stopped.
+type LogEvent struct {
+	Type    string
+	Command []string
+	Line    *apitypes.LogLine
+}
+
+// FollowDownloadLog streams the log of a download, the existing lines first,
+// and calls handle for each event. It returns nil after the "end" event, the
+// error of handle if it fails, or the context's error when ctx ends.
+func (c *Client) FollowDownloadLog(ctx context.Context, id string, handle func(LogEvent) error) error {
+	req, err := c.newRequest(ctx, "GET", downloadPath(id, "/log?follow=1"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = readEvents(resp.Body, func(event, data string) error {
+		switch event {
+		case "command":
+			var command []string
+			if err := json.Unmarshal([]byte(data), &command); err != nil {
+				return fmt.Errorf("invalid event: %w", err)
+			}
+			return handle(LogEvent{Type: "command", Command: command})
+		case "end":
+			if err := handle(LogEvent{Type: "end"}); err != nil {
+				return err
+			}
+			return errEndOfStream
+		default:
+			var line apitypes.LogLine
+			if err := json.Unmarshal([]byte(data), &line); err != nil {
+				return fmt.Errorf("invalid event: %w", err)
+			}
+			return handle(LogEvent{Type: "line", Line: &line})
+		}
+	})
+	switch {
+	case errors.Is(err, errEndOfStream):
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err == nil:
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// errEndOfStream stops reading an event stream after its last event
+var errEndOfStream = errors.New("end of stream")
+
+// readEvents parses a server-sent event stream and calls handle with the name
+// and data of each event. Comments such as keep-alives are skipped.
+func readEvents(r io.Reader, handle func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := handle(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
+}
+
+// GetSchedule reports the download windows and held downloads
+func (c *Client) GetSchedule(ctx context.Context) (*apitypes.ScheduleStatus, error) {
+	var status apitypes.ScheduleStatus
+	if err := c.do(ctx, "GET", apiPrefix+"/schedule", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetUsage reports the caller's downloads and storage against their quota
+func (c *Client) GetUsage(ctx context.Context) (*apitypes.Usage, error) {
+	var usage apitypes.Usage
+	if err := c.do(ctx, "GET", apiPrefix+"/me/usage", nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// ValidateURL looks up the media behind a URL without adding it
+func (c *Client) ValidateURL(ctx context.Context, request apitypes.ValidateRequest) (*apitypes.ValidateResponse, error) {
+	var response apitypes.ValidateResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/validate", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetYtDlpUpdateInfo reports the installed and the latest yt-dlp version
+func (c *Client) GetYtDlpUpdateInfo(ctx context.Context) (*apitypes.UpdateInfo, error) {
+	var info apitypes.UpdateInfo
+	if err := c.do(ctx, "GET", apiPrefix+"/yt-dlp/version", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// UpdateYtDlp installs the latest yt-dlp release on the server (admin)
+func (c *Client) UpdateYtDlp(ctx context.Context) (*apitypes.StatusResponse, error) {
+	var response apitypes.StatusResponse
+	if err := c.do(ctx, "POST", apiPrefix+"/yt-dlp/update", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CheckFfmpeg reports whether the server can run ffmpeg
+func (c *Client) CheckFfmpeg(ctx context.Context) (*apitypes.FfmpegStatus, error) {
+	var status apitypes.FfmpegStatus
+	if err := c.do(ctx, "GET", apiPrefix+"/ffmpeg/check", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetVersions returns the yt-dlp and ffmpeg versions of the server
+func (c *Client) GetVersions(ctx context.Context) (*apitypes.VersionInfo, error) {
+	var versions apitypes.VersionInfo
+	if err := c.do(ctx, "GET", apiPrefix+"/versions", nil, &versions); err != nil {
+		return nil, err
+	}
+	return &versions, nil
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gogetmedia/internal/api"
+	"gogetmedia/internal/auth"
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/manager"
+	"gogetmedia/pkg/apitypes"
+)
+
+// newTestServer serves the real API routes with authentication enabled and
+// returns the server and the admin password. Downloads stay queued because
+// the manager has no workers.
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+
+	store, err := auth.NewStore(filepath.Join(tempDir, auth.UsersFileName))
+	if err != nil {
+		t.Fatalf("Failed to create auth store: %v", err)
+	}
+	password, err := store.Bootstrap("")
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.DownloadPath = tempDir
+	cfg.CompletedFileExpiryHours = 0
+	if err := cfg.Save(filepath.Join(tempDir, "config.json")); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	dm := manager.NewDownloadManager(core.NewDownloader("yt-dlp", "ffmpeg", false, false), 0, tempDir, cfg)
+	t.Cleanup(dm.Shutdown)
+
+	handler := api.NewHandler(cfg, filepath.Join(tempDir, "config.json"), dm, nil, store)
+	server := httptest.NewServer(api.SetupRoutes(handler, fstest.MapFS{}))
+	t.Cleanup(server.Close)
+	return server, password
+}
+
+func TestClient(t *testing.T) {
+	server, password := newTestServer(t)
+	ctx := context.Background()
+
+	// Without credentials the server refuses API calls
+	if _, err := New(server.URL).ListDownloads(ctx); StatusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without credentials, got %v", err)
+	}
+
+	// Login keeps the session and its CSRF token for changes
+	session := New(server.URL)
+	user, err := session.Login(ctx, "admin", password)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if user.Role != apitypes.RoleAdmin {
+		t.Errorf("Expected the admin role, got %q", user.Role)
+	}
+	created, err := session.CreateToken(ctx, "script")
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if created.Secret == "" || created.Token.Name != "script" {
+		t.Errorf("Unexpected token %+v", created)
+	}
+
+	// Scripts use the token
+	c := New(server.URL, WithToken(created.Secret))
+	status, err := c.AuthStatus(ctx)
+	if err != nil || !status.Enabled || status.User == nil || status.User.Username != "admin" {
+		t.Fatalf("Expected to be signed in as admin, got %+v, %v", status, err)
+	}
+
+	// Downloads can be added, listed, paused and removed
+	download, err := c.AddDownload(ctx, apitypes.DownloadRequest{
+		URL:     "https://example.com/watch?v=1",
+		Type:    "video",
+		Quality: "best",
+		Format:  "mov", // needs no ffmpeg
+
+		ExternalID: "job-1",
+	})
+	if err != nil {
+		t.Fatalf("AddDownload failed: %v", err)
+	}
+	if download.Status != apitypes.StatusQueued {
+		t.Errorf("Expected a queued download, got %s", download.Status)
+	}
+
+	downloads, err := c.ListDownloads(ctx)
+	if err != nil || len(downloads) != 1 || downloads[0].ID != download.ID {
+		t.Fatalf("Expected the added download, got %v, %v", downloads, err)
+	}
+	list, err := c.QueryDownloads(ctx, ListOptions{ExternalID: "job-1"})
+	if err != nil || list.Total != 1 || list.Downloads[0].ID != download.ID {
+		t.Errorf("Expected to find the download by external ID, got %+v, %v", list, err)
+	}
+	if err := c.PauseDownload(ctx, download.ID); err != nil {
+		t.Errorf("PauseDownload failed: %v", err)
+	}
+	if got, err := c.GetDownload(ctx, download.ID); err != nil || got.Status != apitypes.StatusPaused {
+		t.Errorf("Expected a paused download, got %v, %v", got, err)
+	}
+
+	// Bulk actions take the filter of a list
+	filter := ListOptions{Statuses: []apitypes.DownloadStatus{apitypes.StatusPaused}, Query: "example.com", Limit: 10}.Filter()
+	bulk, err := c.Bulk(ctx, apitypes.BulkRequest{Action: apitypes.BulkChangePriority, Priority: 2, Filter: filter})
+	if err != nil || bulk.Succeeded != 1 || bulk.Results[0].ID != download.ID {
+		t.Errorf("Expected the paused download to get a priority, got %+v, %v", bulk, err)
+	}
+
+	// Imports report every entry
+	imported, err := c.Import(ctx, apitypes.ImportRequest{Content: "https://example.com/imported\nnot a url\n", Format: "mov"})
+	if err != nil || imported.Kind != apitypes.ImportText || imported.Accepted != 1 || imported.Rejected != 1 {
+		t.Errorf("Expected one accepted and one rejected entry, got %+v, %v", imported, err)
+	}
+
+	var exported bytes.Buffer
+	if _, err := c.Export(ctx, apitypes.ExportCSV, ListOptions{Query: "imported"}, &exported); err != nil || strings.Count(exported.String(), "\n") != 2 {
+		t.Errorf("Expected a header and one row, got %q, %v", exported.String(), err)
+	}
+
+	// Backups are staged for restore at the next start
+	var archive bytes.Buffer
+	if _, err := c.Backup(ctx, false, &archive); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	restored, err := c.Restore(ctx, &archive)
+	if err != nil || restored.Manifest.Users != 1 {
+		t.Errorf("Expected the backup to be staged, got %+v, %v", restored, err)
+	}
+	if err := c.CancelRestore(ctx); err != nil {
+		t.Errorf("CancelRestore failed: %v", err)
+	}
+
+	// Following the log of a download that is not running ends right away
+	var events []string
+	err = c.FollowDownloadLog(ctx, download.ID, func(event LogEvent) error {
+		events = append(events, event.Type)
+		return nil
+	})
+	if err != nil || strings.Join(events, ",") != "end" {
+		t.Errorf("Expected only the end event, got %v, %v", events, err)
+	}
+
+	if err := c.DeleteDownload(ctx, download.ID); err != nil {
+		t.Errorf("DeleteDownload failed: %v", err)
+	}
+	if _, err := c.GetDownload(ctx, download.ID); !IsNotFound(err) {
+		t.Errorf("Expected the download to be gone, got %v", err)
+	}
+
+	// Errors carry the status, code and message of the server
+	_, err = c.AddDownload(ctx, apitypes.DownloadRequest{URL: "file:///etc/passwd", Type: "video", Format: "mov"})
+	if StatusCode(err) != http.StatusBadRequest || ErrorCode(err) != apitypes.CodeInvalidURL || !strings.Contains(err.Error(), "http") {
+		t.Errorf("Expected a 400 for an unsupported scheme, got %v", err)
+	}
+	if err := c.RetryDownload(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("Expected a 404 for an unknown download, got %v", err)
+	}
+
+	// Settings are changed by their JSON names
+	response, err := c.UpdateConfig(ctx, map[string]interface{}{"max_concurrent_downloads": 2})
+	if err != nil || response.MaxConcurrentDownloads != 2 {
+		t.Errorf("Expected the new setting, got %+v, %v", response, err)
+	}
+
+	// Logging out ends the session
+	if err := session.Logout(ctx); err != nil {
+		t.Errorf("Logout failed: %v", err)
+	}
+	if _, err := session.ListTokens(ctx); StatusCode(err) != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after logout, got %v", err)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := "event: command\ndata: [\"yt-dlp\"]\n\n: keep-alive\n\ndata: {\"text\":\"a\"}\n\nevent: end\ndata: {}\n\n"
+
+	var got []string
+	err := readEvents(strings.NewReader(stream), func(event, data string) error {
+		got = append(got, event+"="+data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readEvents failed: %v", err)
+	}
+	expected := []string{`command=["yt-dlp"]`, `={"text":"a"}`, `end={}`}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
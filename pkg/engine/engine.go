@@ -0,0 +1,355 @@
+// Package engine embeds the GoGetMedia download queue in other programs,
+// without the web server.
+//
+//	e, err := engine.New(
+//		engine.WithOutputDir("/srv/media"),
+//		engine.WithYtDlpPath("/usr/local/bin/yt-dlp"),
+//		engine.WithConcurrency(4),
+//		engine.WithEventHandler(func(event engine.Event) {
+//			if event.Download.Status == engine.StatusCompleted {
+//				ingest(event.Download.OutputPath)
+//			}
+//		}),
+//	)
+//	if err != nil { ... }
+//	defer e.Close()
+//	download, err := e.Add(engine.Request{URL: url, Type: engine.VideoDownload, Quality: "best", Format: "mp4"})
+//
+// The queue applies the same retry policy, download windows, bandwidth and
+// per-site limits as the server; WithConfig sets them.
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gogetmedia/internal/config"
+	"gogetmedia/internal/core"
+	"gogetmedia/internal/enginebridge"
+	"gogetmedia/internal/manager"
+)
+
+// Types of the download engine
+type (
+	Download       = core.Download
+	DownloadStatus = core.DownloadStatus
+	DownloadType   = core.DownloadType
+	DownloadLog    = manager.DownloadLog
+	Config         = config.Config
+	Event          = manager.Event
+	EventType      = manager.EventType
+	Store          = manager.Store
+)
+
+// Download types
+const (
+	VideoDownload = core.VideoDownload
+	AudioDownload = core.AudioDownload
+)
+
+// Download statuses
+const (
+	StatusQueued         = core.StatusQueued
+	StatusScheduled      = core.StatusScheduled
+	StatusDownloading    = core.StatusDownloading
+	StatusPostProcessing = core.StatusPostProcessing
+	StatusPaused         = core.StatusPaused
+	StatusCompleted      = core.StatusCompleted
+	StatusFailed         = core.StatusFailed
+	StatusCancelled      = core.StatusCancelled
+	StatusAlreadyExists  = core.StatusAlreadyExists
+)
+
+// Event types
+const (
+	EventAdded         = manager.EventAdded
+	EventStatusChanged = manager.EventStatusChanged
+	EventProgress      = manager.EventProgress
+	EventRemoved       = manager.EventRemoved
+)
+
+// DefaultConfig returns the settings used when WithConfig is not given
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// NewFileStore keeps the downloads in a JSON file at path
+func NewFileStore(path string) Store {
+	return manager.NewFileStore(path)
+}
+
+// MemoryStore keeps the downloads in memory only, so nothing survives a
+// restart
+type MemoryStore struct {
+	mutex     sync.Mutex
+	downloads map[string]*Download
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() (map[string]*Download, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.downloads, nil
+}
+
+func (s *MemoryStore) Save(downloads map[string]*Download) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.downloads = downloads
+	return nil
+}
+
+// Option configures an Engine
+type Option func(*options)
+
+type options struct {
+	config    *Config
+	overrides []func(*Config)
+	store     Store
+	handlers  []func(Event)
+}
+
+// WithConfig uses a copy of cfg instead of DefaultConfig. Other options
+// override its settings regardless of their order.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithOutputDir sets the directory downloads are saved in
+func WithOutputDir(dir string) Option {
+	return func(o *options) {
+		o.overrides = append(o.overrides, func(cfg *Config) { cfg.DownloadPath = dir })
+	}
+}
+
+// WithYtDlpPath sets the yt-dlp executable
+func WithYtDlpPath(path string) Option {
+	return func(o *options) {
+		o.overrides = append(o.overrides, func(cfg *Config) { cfg.YtDlpPath = path })
+	}
+}
+
+// WithFfmpegPath sets the ffmpeg executable
+func WithFfmpegPath(path string) Option {
+	return func(o *options) {
+		o.overrides = append(o.overrides, func(cfg *Config) { cfg.FfmpegPath = path })
+	}
+}
+
+// WithConcurrency sets how many downloads run at the same time, 1 to 10
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.overrides = append(o.overrides, func(cfg *Config) { cfg.MaxConcurrentDownloads = n })
+	}
+}
+
+// WithStore keeps the downloads between runs in store instead of the state
+// file in the output directory
+func WithStore(store Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithEventHandler calls handler for every added, changed and removed
+// download. Handlers run one event at a time, in order, on a goroutine of the
+// engine, and may call the engine.
+func WithEventHandler(handler func(Event)) Option {
+	return func(o *options) {
+		o.handlers = append(o.handlers, handler)
+	}
+}
+
+// Engine is a download queue. It is safe for concurrent use.
+type Engine struct {
+	config  *Config
+	manager *manager.DownloadManager
+}
+
+// New starts an engine. Downloads saved in its store are restored and
+// interrupted ones continue.
+func New(opts ...Option) (*Engine, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	cfg := DefaultConfig()
+	if o.config != nil {
+		cfg = o.config.Clone()
+	}
+	for _, override := range o.overrides {
+		override(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := os.MkdirAll(cfg.DownloadPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	managerOptions := manager.Options{Store: o.store}
+	if len(o.handlers) > 0 {
+		handlers := o.handlers
+		managerOptions.OnEvent = func(event Event) {
+			for _, handler := range handlers {
+				handler(event)
+			}
+		}
+	}
+
+	downloader := core.NewDownloader(cfg.YtDlpPath, cfg.FfmpegPath, cfg.EnableHardwareAccel, cfg.OptimizeForLowPower)
+	return &Engine{
+		config:  cfg,
+		manager: manager.NewDownloadManagerWithOptions(downloader, cfg.MaxConcurrentDownloads, cfg.DownloadPath, cfg, managerOptions),
+	}, nil
+}
+
+// The server in this module uses the download manager directly
+func init() {
+	enginebridge.Manager = func(engine interface{}) *manager.DownloadManager {
+		return engine.(*Engine).manager
+	}
+}
+
+// Request describes a download to add
+type Request struct {
+	URL     string
+	Type    DownloadType // VideoDownload or AudioDownload
+	Quality string       // "best", "worst", "720p", etc.
+	Format  string       // "mp4", "mp3", etc.
+
+	// Optional earliest start time and speed limit (0 = the global limit)
+	StartAt       *time.Time
+	RateLimitKBps int
+
+	// Owner is the user the download counts against for quotas, if any
+	Owner string
+}
+
+func (e *Engine) downloadRequest(req Request) (core.DownloadRequest, error) {
+	if err := core.ValidateMediaURL(req.URL); err != nil {
+		return core.DownloadRequest{}, err
+	}
+	if req.Type == "" {
+		req.Type = VideoDownload
+	}
+	if req.Format == "" {
+		req.Format = e.config.DefaultVideoFormat
+		if req.Type == AudioDownload {
+			req.Format = e.config.DefaultAudioFormat
+		}
+	}
+	if req.Quality == "" {
+		req.Quality = "best"
+	}
+	if req.RateLimitKBps < 0 {
+		return core.DownloadRequest{}, fmt.Errorf("rate limit cannot be negative")
+	}
+	if core.RequiresFfmpeg(req.Type, req.Format) && !core.CheckFfmpegAvailable(e.config.FfmpegPath) {
+		return core.DownloadRequest{}, fmt.Errorf("ffmpeg is required for %s downloads but is not available at %s", req.Format, e.config.FfmpegPath)
+	}
+	return core.DownloadRequest{
+		URL:           req.URL,
+		Type:          req.Type,
+		Quality:       req.Quality,
+		Format:        req.Format,
+		OutputDir:     e.config.DownloadPath,
+		StartAt:       req.StartAt,
+		Owner:         req.Owner,
+		RateLimitKBps: req.RateLimitKBps,
+	}, nil
+}
+
+// Add queues a single video or audio download. Missing fields default to the
+// best quality and the configured format.
+func (e *Engine) Add(req Request) (*Download, error) {
+	downloadRequest, err := e.downloadRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	download, err := e.manager.AddDownload(downloadRequest)
+	if err != nil {
+		return nil, err
+	}
+	return e.Get(download.ID)
+}
+
+// AddPlaylist queues every video of a playlist and returns the first one
+func (e *Engine) AddPlaylist(req Request) (*Download, error) {
+	downloadRequest, err := e.downloadRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	download, err := e.manager.AddPlaylistDownload(downloadRequest)
+	if err != nil || download == nil {
+		return download, err
+	}
+	return e.Get(download.ID)
+}
+
+// Get returns a copy of a download
+func (e *Engine) Get(id string) (*Download, error) {
+	downloads := e.manager.Snapshot(id)
+	if len(downloads) == 0 {
+		return nil, fmt.Errorf("download not found")
+	}
+	return downloads[0], nil
+}
+
+// List returns copies of all downloads, oldest first
+func (e *Engine) List() []*Download {
+	downloads := e.manager.Snapshot()
+	sort.Slice(downloads, func(i, j int) bool {
+		if !downloads[i].CreatedAt.Equal(downloads[j].CreatedAt) {
+			return downloads[i].CreatedAt.Before(downloads[j].CreatedAt)
+		}
+		return downloads[i].ID < downloads[j].ID
+	})
+	return downloads
+}
+
+// Cancel stops a download for good
+func (e *Engine) Cancel(id string) error {
+	return e.manager.CancelDownload(id)
+}
+
+// Pause stops a running or waiting download until it is resumed
+func (e *Engine) Pause(id string) error {
+	return e.manager.PauseDownload(id)
+}
+
+// Resume continues a paused download from its partial file
+func (e *Engine) Resume(id string) error {
+	return e.manager.ResumeDownload(id)
+}
+
+// Retry queues a failed or cancelled download again
+func (e *Engine) Retry(id string) error {
+	return e.manager.RetryDownload(id)
+}
+
+// Remove stops a download and forgets it. The file of a completed download
+// is deleted.
+func (e *Engine) Remove(id string) error {
+	return e.manager.RemoveDownload(id)
+}
+
+// Log returns the yt-dlp and ffmpeg output of a download
+func (e *Engine) Log(id string) (*DownloadLog, error) {
+	return e.manager.GetDownloadLog(id)
+}
+
+// Close stops all downloads and saves the queue to the store. Interrupted
+// downloads continue when an engine is started with the same store.
+func (e *Engine) Close() {
+	e.manager.Shutdown()
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+// recorder collects the events of an engine
+type recorder chan Event
+
+func (r recorder) handle(event Event) {
+	if event.Type != EventProgress {
+		r <- event
+	}
+}
+
+// next waits for the next event
+func (r recorder) next(t *testing.T) Event {
+	t.Helper()
+	select {
+	case event := <-r:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+		return Event{}
+	}
+}
+
+func newTestEngine(t *testing.T, store Store, events recorder) *Engine {
+	t.Helper()
+	e, err := New(
+		WithOutputDir(t.TempDir()),
+		WithYtDlpPath("/nonexistent/yt-dlp"),
+		WithConcurrency(1),
+		WithStore(store),
+		WithEventHandler(events.handle),
+	)
+	if err != nil {
+		t.Fatalf("Failed to start engine: %v", err)
+	}
+	return e
+}
+
+func TestEngine(t *testing.T) {
+	store := NewMemoryStore()
+	events := make(recorder, 100)
+	e := newTestEngine(t, store, events)
+
+	// A download that may not start yet is held by the scheduler
+	startAt := time.Now().Add(time.Hour)
+	download, err := e.Add(Request{URL: "https://example.com/watch?v=1", Format: "mov", StartAt: &startAt})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if download.Type != VideoDownload || download.Quality != "best" {
+		t.Errorf("Expected defaults for missing fields, got %s/%s", download.Type, download.Quality)
+	}
+	if event := events.next(t); event.Type != EventAdded || event.Download.ID != download.ID {
+		t.Fatalf("Expected an added event, got %+v", event)
+	}
+	event := events.next(t)
+	if event.Type != EventStatusChanged || event.Download.Status != StatusScheduled || event.PreviousStatus != StatusQueued {
+		t.Fatalf("Expected the download to be scheduled, got %s %s", event.Type, event.Download.Status)
+	}
+
+	if err := e.Pause(download.ID); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if event := events.next(t); event.Download.Status != StatusPaused {
+		t.Errorf("Expected a paused event, got %s", event.Download.Status)
+	}
+	if got, err := e.Get(download.ID); err != nil || got.Status != StatusPaused {
+		t.Errorf("Expected a paused download, got %v, %v", got, err)
+	}
+
+	// Only http and https URLs are accepted
+	if _, err := e.Add(Request{URL: "file:///etc/passwd", Format: "mov"}); err == nil {
+		t.Error("Expected a file URL to be rejected")
+	}
+
+	// Closing saves the queue to the store, a new engine restores it
+	e.Close()
+	restoredEvents := make(recorder, 100)
+	e2 := newTestEngine(t, store, restoredEvents)
+	defer e2.Close()
+	downloads := e2.List()
+	if len(downloads) != 1 || downloads[0].ID != download.ID || downloads[0].Status != StatusPaused {
+		t.Fatalf("Expected the paused download to be restored, got %v", downloads)
+	}
+
+	if err := e2.Remove(download.ID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if event := restoredEvents.next(t); event.Type != EventRemoved || event.Download.ID != download.ID {
+		t.Errorf("Expected a removed event, got %+v", event)
+	}
+	if _, err := e2.Get(download.ID); err == nil {
+		t.Error("Expected the download to be gone")
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	if _, err := New(WithOutputDir(t.TempDir()), WithConcurrency(0)); err == nil {
+		t.Error("Expected an error for a concurrency of 0")
+	}
+}
+
+func TestOptionsLeaveConfigAlone(t *testing.T) {
+	cfg := DefaultConfig()
+	dir := t.TempDir()
+	cfg.DownloadPath = dir
+	if _, err := New(WithConfig(cfg), WithOutputDir(t.TempDir()), WithConcurrency(2)); err != nil {
+		t.Fatalf("Failed to start engine: %v", err)
+	}
+	if want := DefaultConfig().MaxConcurrentDownloads; cfg.MaxConcurrentDownloads != want {
+		t.Errorf("Expected the config to keep %d concurrent downloads, got %d", want, cfg.MaxConcurrentDownloads)
+	}
+	if cfg.DownloadPath != dir {
+		t.Errorf("Expected the config to keep download path %s, got %s", dir, cfg.DownloadPath)
+	}
+}